@@ -1,16 +1,74 @@
 package main
 
 import (
+	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/joho/godotenv"
 	"github.com/sajjadanwar0/laracasts-dl/internal/config"
 	"github.com/sajjadanwar0/laracasts-dl/internal/downloader"
+	"github.com/sajjadanwar0/laracasts-dl/internal/fsutil"
+	"github.com/sajjadanwar0/laracasts-dl/internal/keychain"
+	"github.com/sajjadanwar0/laracasts-dl/internal/naming"
+	"github.com/sajjadanwar0/laracasts-dl/internal/vimeo"
+	"golang.org/x/term"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
+// errEnvNotFound is returned by loadEnv when no .env file exists yet
+var errEnvNotFound = errors.New("could not find .env file")
+
+// envFile is the .env file loadEnv loaded
+var envFile string
+
+// loadEnv reads .env, then validates and applies the settings
 func loadEnv() error {
+	if err := readEnv(); err != nil {
+		return err
+	}
+
+	// Fetch the password from the OS keychain when the wizard stored it there
+	if os.Getenv("PASSWORD") == "" && os.Getenv("PASSWORD_KEYCHAIN") == "true" {
+		password, err := keychain.Get(os.Getenv("EMAIL"))
+		if err != nil {
+			return err
+		}
+		os.Setenv("PASSWORD", password)
+	}
+
+	// Validate and normalize every setting, reporting all problems at once
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	fileMode, dirMode, modesSet, err := config.GetFileModes()
+	if err != nil {
+		return err
+	}
+	uid, gid, err := config.GetFileOwner()
+	if err != nil {
+		return err
+	}
+	if modesSet || uid != -1 || gid != -1 {
+		fsutil.Configure(fileMode, dirMode, uid, gid)
+	}
+
+	transliterate, err := config.GetTransliterate()
+	if err != nil {
+		return err
+	}
+	naming.Configure(transliterate)
+
+	return nil
+}
+
+// readEnv loads the first .env file found into the environment, without
+// checking its settings
+func readEnv() error {
 	// Get the executable path
 	ex, err := os.Executable()
 	if err != nil {
@@ -33,6 +91,7 @@ func loadEnv() error {
 		absPath, _ := filepath.Abs(path)
 		if err := godotenv.Load(absPath); err == nil {
 			loaded = true
+			envFile = absPath
 			fmt.Printf("Loaded environment from: %s\n", absPath)
 			break
 		} else {
@@ -41,21 +100,8 @@ func loadEnv() error {
 	}
 
 	if !loaded {
-		return fmt.Errorf("could not find .env file, last error: %v", loadErr)
+		return fmt.Errorf("%w, last error: %v", errEnvNotFound, loadErr)
 	}
-
-	// Validate all required environment variables
-	for _, env := range config.RequiredEnvVars {
-		if os.Getenv(env) == "" {
-			return fmt.Errorf("required environment variable %s is not set", env)
-		}
-	}
-
-	// Validate video quality
-	if !config.ValidateVideoQuality(os.Getenv("VIDEO_QUALITY")) {
-		return fmt.Errorf("invalid VIDEO_QUALITY in .env. Must be one of: 360p, 540p, 720p, 1080p")
-	}
-
 	return nil
 }
 func main() {
@@ -66,40 +112,294 @@ func main() {
 		noCache    bool
 		workers    int
 		chunkSize  int
+		container  string
+		qualities  string
+		metaOnly   bool
+		maxAge     string
+		minLength  time.Duration
+		maxLength  time.Duration
+		ical       bool
+		serveAddr  string
+		origin     string
+		syncFrom   string
+		embedSubs  bool
+		redownload bool
+		listFile   string
+		collection string
+		verbose    bool
+		autoRetry  int
+		format     string
+		tags       string
+		difficulty string
+		chaos      float64
+		insecure   bool
+		layout     string
+		chapters   string
+		harFile    string
+		order      string
+		cleanup    bool
+		resumeFrom string
+		checkpoint int
+		noRelogin  bool
+		refreshMD  bool
+		force      bool
+		archived   bool
+		bell       bool
+		logEvery   time.Duration
+		catchUp    time.Duration
+		benchVideo string
+		noAdaptive bool
 	)
 
 	// Define flags but don't parse yet
 	flag.StringVar(&seriesFlag, "s", "", "Series slug to download (leave empty to download all series)")
 	flag.BoolVar(&clearCache, "clear-cache", false, "Clear the cache before starting")
-	flag.BoolVar(&noCache, "no-cache", false, "Ignore cache and download fresh")
-	flag.IntVar(&workers, "workers", 15, "Number of concurrent downloads (default: 15)")
+	flag.BoolVar(&noCache, "no-cache", false, "Fetch series metadata and video sizes fresh instead of reading them from the cache, still caching the results")
+	flag.IntVar(&workers, "workers", 0, "Number of concurrent episode downloads per series (default: EPISODE_CONCURRENCY or 15)")
 	flag.IntVar(&chunkSize, "chunk-size", 20, "Chunk size in MB (default: 20)")
+	flag.BoolVar(&noAdaptive, "no-adaptive-connections", false, "Always fetch CHUNK_CONCURRENCY chunks at once, even from CDN hosts where they are not faster than a single connection")
+	flag.StringVar(&qualities, "qualities", "", "Comma-separated qualities to archive side by side, e.g. 720p,1080p (default: VIDEO_QUALITY)")
+	flag.BoolVar(&metaOnly, "metadata-only", false, "Build the local catalog of topics, series and episodes without downloading videos")
+	flag.StringVar(&maxAge, "max-age", "", "Only download episodes published within this age, e.g. 90d, 2w")
+	flag.DurationVar(&minLength, "min-duration", 0, "Only download episodes at least this long, e.g. 5m")
+	flag.DurationVar(&maxLength, "max-duration", 0, "Only download episodes at most this long, e.g. 30m")
+	flag.StringVar(&tags, "tag", "", "Only download episodes with any of these comma-separated tags or topics, e.g. testing")
+	flag.StringVar(&chapters, "chapters", "", "With -s, only download these chapters of the series, e.g. 2,4-6")
+	flag.StringVar(&difficulty, "difficulty", "", "Only download episodes of this difficulty: beginner, intermediate or advanced")
+	flag.StringVar(&layout, "layout", downloader.LayoutTopics, "Library layout: topics, or authors to also link series under authors/<instructor>")
+	flag.BoolVar(&archived, "include-archived", false, "Also download the series Laracasts archived as outdated when downloading all series")
+	flag.StringVar(&order, "order", downloader.OrderAsListed, "Download order of series and episodes: as-listed, alpha, size-asc or length-asc")
+	flag.StringVar(&container, "container", vimeo.ContainerMP4, "Output container for HLS/DASH fallback downloads: mp4 or mkv")
+	flag.BoolVar(&ical, "ical", false, "Also write changelog.ics with newly published series and episodes")
+	flag.StringVar(&serveAddr, "serve", "", "Serve this library as a caching origin for other instances, e.g. :8080")
+	flag.StringVar(&origin, "origin", "", "URL of an instance running -serve to copy videos and metadata from first")
+	flag.StringVar(&syncFrom, "sync-from", "", "Mirror another library (directory or -serve URL), fetching only missing or differing pieces")
+	flag.BoolVar(&embedSubs, "embed-subs", false, "Embed subtitles into downloaded videos as soft subtitle tracks (requires ffmpeg)")
+	flag.BoolVar(&refreshMD, "refresh-metadata", false, "Fetch the metadata of every series again instead of using the cached series data")
+	flag.BoolVar(&force, "force-download", false, "Download every selected episode and bit again, even those completed or on disk (old copies go to the trash)")
+	flag.BoolVar(&redownload, "redownload-mismatched", false, "Replace downloaded videos whose size differs from the remote file")
+	flag.StringVar(&resumeFrom, "resume-from", "", "Continue a download of all series from this checkpoint file, e.g. downloads/checkpoint.json")
+	flag.IntVar(&checkpoint, "checkpoint-every", downloader.DefaultCheckpointEvery, "Save a checkpoint of a download of all series every N completed series (0 disables)")
+	flag.BoolVar(&noRelogin, "no-relogin", false, "Stop instead of signing in again with fewer workers when Laracasts signs the session out mid-run")
+	flag.DurationVar(&catchUp, "catch-up-after", downloader.DefaultCatchUpAfter, "Check a series again for episodes published during its download when its episode list is this old by the end, e.g. 30m (0 disables)")
+	flag.IntVar(&autoRetry, "auto-retry-series", 0, "Retry the failed episodes of a series up to N more times, waiting longer between passes")
+	flag.StringVar(&format, "format", downloader.InventoryCSV, "Format of the inventory command: csv or md")
+	flag.BoolVar(&cleanup, "cleanup", false, "With analyze, offer to clean up duplicate, orphaned and incomplete videos")
+	flag.StringVar(&listFile, "f", "", "File with series slugs or URLs to download, one per line (- for stdin)")
+	flag.StringVar(&collection, "collection", "", "Download the series of this collection defined in COLLECTIONS")
+	flag.DurationVar(&logEvery, "log-interval", vimeo.DefaultLogInterval, "How often to log a status line of running downloads when output is not a terminal, e.g. under cron or CI (0 disables)")
+	flag.BoolVar(&bell, "bell", false, "Ring the terminal bell when a download run finishes")
+	flag.BoolVar(&verbose, "v", false, "Verbose output, adds cache statistics to the run summary")
+	flag.StringVar(&benchVideo, "bench-video", vimeo.BenchVideoID, "Public Vimeo video ID the bench command measures the network with")
+	flag.StringVar(&harFile, "har", "", "Trace every HTTP request and save them to this HAR file, e.g. out.har, for diagnosing breakages")
+	flag.BoolVar(&insecure, "insecure-skip-verify", false, "Do not verify TLS certificates (unsafe, prefer CA_BUNDLE behind an intercepting proxy)")
 	downloadBits := flag.Bool("b", false, "Download all Laracasts bits")
+	flag.Float64Var(&chaos, "chaos", 0, "Developer mode: disrupt this fraction of requests to test retries")
+	hideFlags("chaos")
 
 	// Parse flags
 	flag.Parse()
 
-	// Load environment variables
-	if err := loadEnv(); err != nil {
+	if !vimeo.ValidateContainer(container) {
+		fmt.Printf("Invalid -container %q. Must be one of: mp4, mkv\n", container)
+		os.Exit(1)
+	}
+	vimeo.SetLogInterval(logEvery)
+
+	// Commands follow the flags. Downloading is the default, "download" is
+	// accepted for it with the flags after it, as are "inventory" and
+	// "analyze".
+	command := flag.Args()
+	inventory := len(command) > 0 && command[0] == "inventory"
+	analyze := len(command) > 0 && command[0] == "analyze"
+	if len(command) > 0 && (command[0] == "download" || inventory || analyze) {
+		_ = flag.CommandLine.Parse(command[1:])
+		command = flag.Args()
+	}
+	bench := len(command) == 1 && command[0] == "bench"
+	importExisting := len(command) == 1 && command[0] == "import-existing"
+	emptyTrash := len(command) == 2 && command[0] == "trash" && command[1] == "empty"
+	usage := len(command) == 1 && command[0] == "usage"
+	stats := len(command) == 1 && command[0] == "stats"
+	supportBundle := len(command) > 0 && len(command) <= 2 && command[0] == "support-bundle"
+	if len(command) > 0 && !bench && !importExisting && !emptyTrash && !usage && !stats && !supportBundle && (command[0] != "relocate" || len(command) != 3) {
+		fmt.Println("Usage: laracasts-dl [download] [flags]")
+		fmt.Println("       laracasts-dl [flags] relocate <old path> <new path>")
+		fmt.Println("       laracasts-dl [flags] import-existing")
+		fmt.Println("       laracasts-dl trash empty")
+		fmt.Println("       laracasts-dl usage")
+		fmt.Println("       laracasts-dl stats")
+		fmt.Println("       laracasts-dl support-bundle [file.zip]")
+		fmt.Println("       laracasts-dl inventory [-format csv|md]")
+		fmt.Println("       laracasts-dl analyze [-cleanup]")
+		fmt.Println("       laracasts-dl [-bench-video ID] bench")
+		os.Exit(1)
+	}
+	if benchVideo == "" || strings.Trim(benchVideo, "0123456789") != "" {
+		fmt.Printf("Invalid -bench-video %q. Must be the numeric ID of a public Vimeo video\n", benchVideo)
+		os.Exit(1)
+	}
+	vimeo.BenchVideoID = benchVideo
+	if layout != downloader.LayoutTopics && layout != downloader.LayoutAuthors {
+		fmt.Printf("Invalid -layout %q. Must be one of: topics, authors\n", layout)
+		os.Exit(1)
+	}
+	if !downloader.ValidateOrder(order) {
+		fmt.Printf("Invalid -order %q. Must be one of: as-listed, alpha, size-asc, length-asc\n", order)
+		os.Exit(1)
+	}
+	if format != downloader.InventoryCSV && format != downloader.InventoryMarkdown {
+		fmt.Printf("Invalid -format %q. Must be one of: csv, md\n", format)
+		os.Exit(1)
+	}
+
+	var batch []string
+	if listFile != "" {
+		var err error
+		if batch, err = readSlugList(listFile); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(batch) == 0 {
+			fmt.Println("Error: the series list is empty")
+			os.Exit(1)
+		}
+	}
+
+	if supportBundle {
+		writeSupportBundle(command)
+		return
+	}
+
+	// Load environment variables, offering to create the .env file on first run
+	err := loadEnv()
+	if errors.Is(err, errEnvNotFound) && term.IsTerminal(int(os.Stdin.Fd())) {
+		if wizardErr := runSetupWizard(".env"); wizardErr != nil {
+			fmt.Printf("Setup failed: %v\n", wizardErr)
+			os.Exit(1)
+		}
+		err = loadEnv()
+	}
+	if err != nil {
 		fmt.Printf("Error loading environment: %v\n", err)
 		fmt.Println("Make sure .env file exists in the project root with EMAIL and PASSWORD")
 		os.Exit(1)
 	}
 
-	email := os.Getenv("EMAIL")
-	password := os.Getenv("PASSWORD")
-
-	if email == "" || password == "" {
-		fmt.Println("Please set EMAIL and PASSWORD in .env file")
+	auth, err := downloader.NewAuthenticator()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
 
+	if insecure {
+		fmt.Println("⚠️  -insecure-skip-verify: TLS certificates are NOT verified. Anyone on the network path can")
+		fmt.Println("⚠️  read your Laracasts password and session. Prefer adding your proxy's certificate via CA_BUNDLE.")
+		config.InsecureSkipVerify = true
+	}
+
 	// Initialize downloader
 	dl, err := downloader.New()
 	if err != nil {
 		fmt.Printf("Error creating downloader: %v\n", err)
 		os.Exit(1)
 	}
+	dl.DumpStatusOnSignal()
+	dl.Vimeo.Container = container
+	if chunkSize > 0 {
+		dl.Vimeo.ChunkSize = int64(chunkSize) * 1024 * 1024
+	}
+	dl.Vimeo.AdaptiveConnections = !noAdaptive
+	if !dl.Vimeo.HasFFmpeg {
+		fmt.Printf("⚠️  ffmpeg not found: videos only available as HLS/DASH streams will be skipped (%s)\n", vimeo.FFmpegInstallHint())
+		if embedSubs {
+			fmt.Println("⚠️  -embed-subs requires ffmpeg, subtitles will not be embedded")
+			embedSubs = false
+		}
+	}
+	if workers > 0 {
+		dl.Concurrency.Episodes = workers
+		if err := dl.Concurrency.CheckBudget(); err != nil {
+			fmt.Printf("Invalid -workers: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	dl.Changelog.ICal = ical
+	dl.EmbedSubs = embedSubs
+	dl.RedownloadMismatched = redownload
+	dl.RefreshMetadata = refreshMD
+	dl.NoCache = noCache
+	dl.ForceDownload = force
+	dl.AutoRetrySeries = autoRetry
+	dl.AutoRelogin = !noRelogin
+	dl.CatchUpAfter = catchUp
+	dl.IncludeArchived = archived
+	dl.Order = order
+	dl.CheckpointEvery = checkpoint
+	if checkpoint <= 0 {
+		dl.Checkpoint = ""
+	}
+	if resumeFrom != "" {
+		if err := dl.ResumeFrom(resumeFrom); err != nil {
+			fmt.Printf("Invalid -resume-from: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	dl.Report.Verbose = verbose
+	dl.Origin = strings.TrimSuffix(origin, "/")
+	if harFile != "" {
+		dl.RecordHAR()
+	}
+	if chaos > 0 {
+		dl.EnableChaos(downloader.Chaos{Rate: chaos, Delay: 5 * time.Second, Seed: time.Now().UnixNano()})
+	}
+
+	dl.Filter = downloader.EpisodeFilter{MinDuration: minLength, MaxDuration: maxLength, Difficulty: difficulty}
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			dl.Filter.Tags = append(dl.Filter.Tags, tag)
+		}
+	}
+	switch strings.ToLower(difficulty) {
+	case "", "beginner", "intermediate", "advanced":
+	default:
+		fmt.Printf("Invalid -difficulty %q. Must be one of: beginner, intermediate, advanced\n", difficulty)
+		os.Exit(1)
+	}
+	if collection != "" {
+		if _, err := dl.CollectionSlugs(collection); err != nil {
+			fmt.Printf("Invalid -collection: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if chapters != "" {
+		if seriesFlag == "" {
+			fmt.Println("-chapters requires -s with the series to download")
+			os.Exit(1)
+		}
+		if dl.Filter.Chapters, err = downloader.ParseChapters(chapters); err != nil {
+			fmt.Printf("Invalid -chapters: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if maxAge != "" {
+		if dl.Filter.MaxAge, err = downloader.ParseAge(maxAge); err != nil {
+			fmt.Printf("Invalid -max-age: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if qualities != "" {
+		dl.Qualities = nil
+		for _, quality := range strings.Split(qualities, ",") {
+			quality = strings.TrimSpace(quality)
+			if !config.ValidateVideoQuality(quality) {
+				fmt.Printf("Invalid quality %q in -qualities. Must be one of: 360p, 540p, 720p, 1080p\n", quality)
+				os.Exit(1)
+			}
+			dl.Qualities = append(dl.Qualities, quality)
+		}
+	}
 
 	// Handle cache flags
 	if clearCache {
@@ -110,9 +410,94 @@ func main() {
 		}
 	}
 
+	if bench {
+		if err := dl.Bench(); err != nil {
+			fmt.Printf("Error benchmarking: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if importExisting {
+		imported, err := dl.ImportExisting()
+		if err != nil {
+			fmt.Printf("Error importing existing videos: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Imported %d episodes found in %s\n", imported, dl.BasePath)
+		return
+	}
+
+	if usage {
+		dl.PrintUsage()
+		return
+	}
+
+	if stats {
+		if err := dl.PrintStats(); err != nil {
+			fmt.Printf("Error reading events: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if emptyTrash {
+		files, bytes, err := dl.EmptyTrash()
+		if err != nil {
+			fmt.Printf("Error emptying trash: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Deleted %d files (%.1f MB) from %s\n", files, float64(bytes)/1024/1024, downloader.TrashDir)
+		return
+	}
+
+	if len(command) > 0 {
+		relocate(dl, command[1], command[2])
+		return
+	}
+
+	if inventory {
+		if err := downloader.WriteInventory(os.Stdout, dl.Inventory(), format); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing inventory: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if analyze {
+		analyzeLibrary(dl, cleanup)
+		return
+	}
+
+	if syncFrom != "" {
+		if err := dl.SyncFrom(syncFrom); err != nil {
+			fmt.Printf("Error syncing library: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if serveAddr != "" {
+		if err := dl.Serve(serveAddr); err != nil {
+			fmt.Printf("Error serving library: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Check the download path before the first video, turning off what a
+	// network share does not support
+	if err := dl.Preflight(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		emailSummary(dl, err)
+		os.Exit(1)
+	}
+
 	// Login to Laracasts
-	if err := dl.Login(email, password); err != nil {
+	if err := dl.Authenticate(auth); err != nil {
 		fmt.Printf("Login failed: %v\n", err)
+		saveHAR(dl, harFile)
+		emailSummary(dl, fmt.Errorf("login failed: %w", err))
 		os.Exit(1)
 	}
 
@@ -124,17 +509,37 @@ func main() {
 		}
 	})
 
-	if *downloadBits {
-		if err := dl.DownloadAllBits(); err != nil {
-			fmt.Printf("Error downloading bits: %v\n", err)
+	if metaOnly {
+		err := dl.SyncMetadata(seriesFlag)
+		saveChangelog(dl)
+		saveUsage(dl)
+		saveHAR(dl, harFile)
+		if err != nil {
+			fmt.Printf("Error syncing metadata: %v\n", err)
 			os.Exit(1)
 		}
 		return
 	}
 
+	if *downloadBits {
+		err := dl.DownloadAllBits()
+		printReport(dl, err)
+		updateManifest(dl)
+		saveUsage(dl)
+		saveHAR(dl, harFile)
+		if err != nil {
+			fmt.Printf("Error downloading bits: %v\n", err)
+		}
+		finish(dl, err, bell)
+	}
+
 	// Handle downloads based on flag state
 	var downloadErr error
-	if isFlagProvided && seriesFlag != "" {
+	if len(batch) > 0 {
+		downloadErr = dl.DownloadBatch(batch)
+	} else if collection != "" {
+		downloadErr = dl.DownloadCollection(collection)
+	} else if isFlagProvided && seriesFlag != "" {
 		// Specific series download
 		fmt.Printf("Downloading specific series: %s\n", seriesFlag)
 		downloadErr = dl.DownloadSeries(seriesFlag)
@@ -146,10 +551,244 @@ func main() {
 		downloadErr = dl.DownloadAllByTopics()
 	}
 
+	if layout == downloader.LayoutAuthors {
+		if err := dl.LinkAuthors(); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+	if len(dl.Collections) > 0 {
+		if err := dl.LinkCollections(); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+
+	printReport(dl, downloadErr)
+	saveChangelog(dl)
+	updateManifest(dl)
+	saveUsage(dl)
+	saveHAR(dl, harFile)
+
 	if downloadErr != nil {
 		fmt.Printf("\nError during download: %v\n", downloadErr)
+	}
+	finish(dl, downloadErr, bell)
+}
+
+// Exit codes of a download run, so wrapper scripts can tell a partial
+// download from one that got nothing
+const (
+	exitSucceeded = 0
+	exitFailed    = 1 // nothing downloaded, or the run could not start
+	exitPartial   = 2 // some videos failed, the others were downloaded
+)
+
+// finish ends a download run with a line stating its outcome, rings the
+// terminal bell if asked to, and exits with the code of the outcome
+func finish(dl *downloader.Downloader, err error, bell bool) {
+	code := exitSucceeded
+	switch dl.Report.Outcome(err) {
+	case downloader.OutcomeSucceeded:
+		fmt.Println("\n✅ Download completed successfully!")
+	case downloader.OutcomePartial:
+		code = exitPartial
+		failed := "some series failed"
+		if n := dl.Report.FailedVideos(); n > 0 {
+			failed = fmt.Sprintf("%d videos failed", n)
+		}
+		fmt.Printf("\n⚠️  Download partially completed, %s; run again to retry them (exit code %d)\n", failed, code)
+	default:
+		code = exitFailed
+		fmt.Printf("\n❌ Download failed, nothing was downloaded (exit code %d)\n", code)
+	}
+
+	if bell {
+		fmt.Print("\a")
+	}
+	os.Exit(code)
+}
+
+// writeSupportBundle saves a support bundle to the file the command names,
+// or a dated one. Settings are only read, so a .env that keeps every other
+// command from starting goes into the bundle with its problems.
+func writeSupportBundle(command []string) {
+	path := fmt.Sprintf("laracasts-support-%s.zip", time.Now().Format("20060102-150405"))
+	if len(command) == 2 {
+		path = command[1]
+	}
+
+	var settings map[string]string
+	problems := readEnv()
+	if problems == nil {
+		if settings, problems = godotenv.Read(envFile); problems == nil {
+			problems = config.Validate()
+		}
+	}
+	if err := downloader.SupportBundle(path, settings, problems); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Wrote %s, check it for anything private before attaching it to a GitHub issue\n", path)
+}
+
+// printReport prints the run summary, writes it to report.json in the
+// download directory and emails it when SUMMARY_EMAIL_TO is set, with err
+// the download ended with
+func printReport(dl *downloader.Downloader, err error) {
+	// Deliver the last progress events before summing up
+	if dl.Webhook != nil {
+		dl.Webhook.Close()
+	}
+
+	dl.Report.Print()
+	if err := dl.Report.Save(dl.BasePath); err != nil {
+		fmt.Printf("Warning: Failed to save report: %v\n", err)
+	}
+	emailSummary(dl, err)
+}
+
+// emailSummary emails the summary of a run that ended with err, also one
+// that could not start, when SUMMARY_EMAIL_TO is set
+func emailSummary(dl *downloader.Downloader, err error) {
+	if err := dl.EmailSummary(err); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+}
+
+// hideFlags leaves developer flags out of the -h output
+func hideFlags(names ...string) {
+	hidden := make(map[string]bool)
+	for _, name := range names {
+		hidden[name] = true
+	}
+
+	flag.Usage = func() {
+		visible := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+		visible.SetOutput(flag.CommandLine.Output())
+		flag.VisitAll(func(f *flag.Flag) {
+			if !hidden[f.Name] {
+				visible.Var(f.Value, f.Name, f.Usage)
+				visible.Lookup(f.Name).DefValue = f.DefValue
+			}
+		})
+
+		fmt.Fprintf(visible.Output(), "Usage of %s:\n", os.Args[0])
+		visible.PrintDefaults()
+	}
+}
+
+// readSlugList reads the series list from path, or from stdin for "-"
+func readSlugList(path string) ([]string, error) {
+	if path == "-" {
+		return downloader.ReadSlugList(os.Stdin)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open series list: %v", err)
+	}
+	defer file.Close()
+	return downloader.ReadSlugList(file)
+}
+
+// relocate updates the paths recorded for a library moved from oldPath to
+// newPath. The cache is read from DOWNLOAD_PATH, which should already point
+// at the new location.
+func relocate(dl *downloader.Downloader, oldPath, newPath string) {
+	if filepath.Clean(newPath) != filepath.Clean(dl.BasePath) {
+		fmt.Printf("Warning: DOWNLOAD_PATH is %s, update it to %s to use the moved library\n", dl.BasePath, newPath)
+	}
+
+	updated, err := dl.Relocate(oldPath, newPath)
+	if err != nil {
+		fmt.Printf("Error relocating library: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Updated %d records from %s to %s\n", updated, oldPath, newPath)
+}
+
+// analyzeLibrary prints the disk usage of the library and, with cleanup,
+// asks before acting on each kind of problem found
+func analyzeLibrary(dl *downloader.Downloader, cleanup bool) {
+	analysis, err := dl.Analyze()
+	if err != nil {
+		fmt.Printf("Error analyzing library: %v\n", err)
 		os.Exit(1)
 	}
+	analysis.Print()
+
+	if !cleanup {
+		return
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Println("-cleanup asks before every action and needs a terminal")
+		os.Exit(1)
+	}
+	reader := bufio.NewReader(os.Stdin)
+	confirm := func(question string) bool {
+		return strings.EqualFold(prompt(reader, "\n"+question+" (y/N)", "n"), "y")
+	}
+
+	if len(analysis.Duplicates) > 0 && confirm(fmt.Sprintf("Replace the copies of %d duplicate videos with hard links?", len(analysis.Duplicates))) {
+		freed, err := dl.LinkDuplicates(analysis.Duplicates)
+		if err != nil {
+			fmt.Printf("Error linking duplicates: %v\n", err)
+		}
+		fmt.Printf("Freed %.1f MB\n", float64(freed)/1024/1024)
+	}
+	// Without a trash retention, trashing deletes right away
+	question, done := "Move %d %s to "+downloader.TrashDir+"?", "Moved"
+	if dl.TrashRetention <= 0 {
+		question, done = "Delete %d %s? They cannot be restored (TRASH_RETENTION_DAYS is 0)", "Deleted"
+	}
+	for _, files := range []struct {
+		name  string
+		files []downloader.LibraryFile
+	}{
+		{"orphaned videos", analysis.Orphans},
+		{"incomplete downloads", analysis.Incomplete},
+	} {
+		if len(files.files) == 0 || !confirm(fmt.Sprintf(question, len(files.files), files.name)) {
+			continue
+		}
+		moved, err := dl.TrashFiles(files.files)
+		if err != nil {
+			fmt.Printf("Error trashing %s: %v\n", files.name, err)
+		}
+		fmt.Printf("%s %d %s\n", done, moved, files.name)
+	}
+}
+
+// saveHAR writes the requests traced with -har to path, if given
+func saveHAR(dl *downloader.Downloader, path string) {
+	if path == "" {
+		return
+	}
+	if err := dl.SaveHAR(path); err != nil {
+		fmt.Printf("Warning: Failed to save HAR file: %v\n", err)
+		return
+	}
+	fmt.Printf("Saved the HTTP trace to %s\n", path)
+}
 
-	fmt.Println("\nDownload completed successfully!")
+// saveChangelog records newly published content found during the run; a
+// failure here should never fail the run itself
+func saveChangelog(dl *downloader.Downloader) {
+	if err := dl.Changelog.Save(dl.BasePath); err != nil {
+		fmt.Printf("Warning: Failed to save changelog: %v\n", err)
+	}
+}
+
+// saveUsage adds the data downloaded by the run to the monthly usage
+func saveUsage(dl *downloader.Downloader) {
+	if err := dl.SaveUsage(); err != nil {
+		fmt.Printf("Warning: Failed to save usage: %v\n", err)
+	}
+}
+
+// updateManifest hashes the videos completed during the run so the library
+// can be mirrored with -sync-from
+func updateManifest(dl *downloader.Downloader) {
+	if _, err := dl.UpdateManifest(); err != nil {
+		fmt.Printf("Warning: Failed to update piece manifest: %v\n", err)
+	}
 }
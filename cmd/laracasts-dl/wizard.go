@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/joho/godotenv"
+	"github.com/sajjadanwar0/laracasts-dl/internal/config"
+	"github.com/sajjadanwar0/laracasts-dl/internal/downloader"
+	"github.com/sajjadanwar0/laracasts-dl/internal/keychain"
+	"golang.org/x/term"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// runSetupWizard asks for the settings normally kept in .env and writes them
+// to envPath, optionally keeping the password in the OS keychain
+func runSetupWizard(envPath string) error {
+	reader := bufio.NewReader(os.Stdin)
+
+	downloader.PrintBox("First run setup")
+	fmt.Println("No .env file was found, let's create one.")
+
+	email := ""
+	for email == "" {
+		email = prompt(reader, "Laracasts email", "")
+	}
+
+	password, err := promptPassword("Laracasts password")
+	if err != nil {
+		return err
+	}
+
+	defaultPath := "downloads"
+	if home, err := os.UserHomeDir(); err == nil {
+		defaultPath = filepath.Join(home, "Laracasts")
+	}
+	downloadPath := prompt(reader, "Download path", defaultPath)
+
+	quality := ""
+	for !config.ValidateVideoQuality(quality) {
+		quality = prompt(reader, "Video quality (360p, 540p, 720p, 1080p)", "1080p")
+	}
+
+	concurrency := 0
+	for concurrency < 1 || concurrency > 100 {
+		concurrency, _ = strconv.Atoi(prompt(reader, "Episodes downloaded at once per series (1-100)",
+			strconv.Itoa(config.DefaultConcurrency.Episodes)))
+	}
+
+	useKeychain := false
+	if keychain.Available() {
+		answer := prompt(reader, "Store the password in the OS keychain instead of .env? (y/N)", "n")
+		useKeychain = strings.HasPrefix(strings.ToLower(answer), "y")
+	}
+
+	var lines []string
+	for _, setting := range [][2]string{
+		{"EMAIL", email},
+		{"DOWNLOAD_PATH", downloadPath},
+		{"VIDEO_QUALITY", quality},
+		{"EPISODE_CONCURRENCY", strconv.Itoa(concurrency)},
+	} {
+		line, err := envLine(setting[0], setting[1])
+		if err != nil {
+			return err
+		}
+		lines = append(lines, line)
+	}
+
+	if useKeychain {
+		if err := keychain.Set(email, password); err != nil {
+			return err
+		}
+		lines = append(lines, "PASSWORD_KEYCHAIN=true")
+	} else {
+		line, err := envLine("PASSWORD", password)
+		if err != nil {
+			return fmt.Errorf("%v, store the password in the keychain or add it to .env by hand", err)
+		}
+		lines = append(lines, line)
+	}
+
+	if err := os.WriteFile(envPath, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %v", envPath, err)
+	}
+
+	absPath, _ := filepath.Abs(envPath)
+	fmt.Printf("✓ Saved configuration to %s\n", absPath)
+	return nil
+}
+
+// prompt reads a line from the user, returning fallback when it is empty
+func prompt(reader *bufio.Reader, label, fallback string) string {
+	if fallback != "" {
+		fmt.Printf("%s [%s]: ", label, fallback)
+	} else {
+		fmt.Printf("%s: ", label)
+	}
+
+	line, _ := reader.ReadString('\n')
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return fallback
+	}
+	return line
+}
+
+// promptPassword reads a non-empty password without echoing it
+func promptPassword(label string) (string, error) {
+	for {
+		fmt.Printf("%s: ", label)
+		password, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Println()
+		if err != nil {
+			return "", fmt.Errorf("failed to read password: %v", err)
+		}
+		if len(password) > 0 {
+			return string(password), nil
+		}
+	}
+}
+
+// envLine formats a .env line setting name to value. Values are single
+// quoted, which godotenv reads verbatim without expanding $VAR or escapes.
+// Values a single quoted string cannot hold are double quoted with \, ", $
+// and newlines escaped, or else left unquoted. Each form is read back, and
+// the first the value survives is used.
+func envLine(name, value string) (string, error) {
+	escaped := strings.NewReplacer("\\", "\\\\", `"`, `\"`, "$", `\$`, "\n", `\n`, "\r", `\r`).Replace(value)
+	for _, line := range []string{
+		name + "='" + value + "'",
+		name + `="` + escaped + `"`,
+		name + "=" + value,
+	} {
+		if parsed, err := godotenv.Unmarshal(line); err == nil && parsed[name] == value {
+			return line, nil
+		}
+	}
+	return "", fmt.Errorf("the value of %s cannot be written to .env", name)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/joho/godotenv"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnvLineRoundTrips(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	for _, value := range []string{
+		"plain",
+		"pa$$word$HOME",
+		"${PASSWORD}",
+		"héllo wörld ✓",
+		`back\slash\`,
+		`\x41é`,
+		"it's",
+		`"quoted"`,
+		"# not a comment",
+		" spaced ",
+		"two\nlines",
+		"",
+	} {
+		line, err := envLine("PASSWORD", value)
+		if err != nil {
+			t.Errorf("envLine(%q) error = %v", value, err)
+			continue
+		}
+		if err := os.WriteFile(path, []byte(line+"\nOTHER=1\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		env, err := godotenv.Read(path)
+		if err != nil || env["PASSWORD"] != value || env["OTHER"] != "1" {
+			t.Errorf("%s read back as %q, %v, want %q", line, env["PASSWORD"], err, value)
+		}
+	}
+}
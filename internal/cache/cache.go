@@ -3,6 +3,7 @@ package cache
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/fsutil"
 	"os"
 	"path/filepath"
 	"strings"
@@ -17,23 +18,24 @@ type CacheEntry struct {
 
 type Cache struct {
 	BasePath string
+	Stats    *Stats
 	mutex    sync.RWMutex
 }
 
 func NewCache(basePath string) (*Cache, error) {
 	cachePath := filepath.Join(basePath, ".cache")
-	if err := os.MkdirAll(cachePath, 0755); err != nil {
+	if err := fsutil.MkdirAll(cachePath); err != nil {
 		return nil, fmt.Errorf("failed to create cache directory: %v", err)
 	}
 
 	for _, dir := range []string{"series", "downloads", "state"} {
 		dirPath := filepath.Join(cachePath, dir)
-		if err := os.MkdirAll(dirPath, 0755); err != nil {
+		if err := fsutil.MkdirAll(dirPath); err != nil {
 			return nil, fmt.Errorf("failed to create cache subdirectory %s: %v", dir, err)
 		}
 	}
 
-	cache := &Cache{BasePath: cachePath}
+	cache := &Cache{BasePath: cachePath, Stats: &Stats{}}
 	if err := cache.verifyDirectories(); err != nil {
 		return nil, err
 	}
@@ -72,7 +74,7 @@ func (c *Cache) Set(key string, data interface{}) error {
 	dirPath := filepath.Join(c.BasePath, subdir)
 	filePath := filepath.Join(dirPath, key+".json")
 
-	if err := os.MkdirAll(dirPath, 0755); err != nil {
+	if err := fsutil.MkdirAll(dirPath); err != nil {
 		return fmt.Errorf("failed to ensure cache directory: %v", err)
 	}
 
@@ -87,7 +89,7 @@ func (c *Cache) Set(key string, data interface{}) error {
 	}
 
 	tmpFile := filePath + ".tmp"
-	if err := os.WriteFile(tmpFile, jsonData, 0644); err != nil {
+	if err := fsutil.WriteFile(tmpFile, jsonData); err != nil {
 		return fmt.Errorf("failed to write cache file: %v", err)
 	}
 
@@ -145,6 +147,27 @@ func (c *Cache) Get(key string, data interface{}) (bool, error) {
 	return true, nil
 }
 
+// Keys returns the keys of all cache entries starting with prefix
+func (c *Cache) Keys(prefix string) []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	var keys []string
+	for _, subdir := range []string{"series", "downloads", "state"} {
+		files, err := os.ReadDir(filepath.Join(c.BasePath, subdir))
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			key := strings.TrimSuffix(file.Name(), ".json")
+			if !file.IsDir() && key != file.Name() && strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
 func (c *Cache) IsStale(key string, maxAge time.Duration) bool {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
@@ -189,7 +212,7 @@ func (c *Cache) Clear() error {
 
 	dirs := []string{"series", "downloads", "state"}
 	for _, dir := range dirs {
-		if err := os.MkdirAll(filepath.Join(c.BasePath, dir), 0755); err != nil {
+		if err := fsutil.MkdirAll(filepath.Join(c.BasePath, dir)); err != nil {
 			return fmt.Errorf("failed to recreate cache directory %s: %v", dir, err)
 		}
 	}
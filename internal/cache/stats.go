@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Stats counts how often cached pages spared a request to Laracasts. Callers
+// record lookups since only they know when an entry is outdated.
+type Stats struct {
+	hits      atomic.Int64
+	misses    atomic.Int64
+	refreshes atomic.Int64
+	saved     atomic.Int64
+}
+
+// StatsSnapshot is a point in time copy of Stats
+type StatsSnapshot struct {
+	Hits       int64 `json:"hits"`
+	Misses     int64 `json:"misses"`
+	Refreshes  int64 `json:"stale_refreshes"`
+	BytesSaved int64 `json:"bytes_saved"`
+}
+
+// Hit records a lookup served from the cache, sparing a download of size bytes
+func (s *Stats) Hit(size int64) {
+	s.hits.Add(1)
+	s.saved.Add(size)
+}
+
+// Miss records a lookup for an entry that was not cached
+func (s *Stats) Miss() {
+	s.misses.Add(1)
+}
+
+// Refresh records a cached entry that was outdated and fetched again
+func (s *Stats) Refresh() {
+	s.refreshes.Add(1)
+}
+
+func (s *Stats) Snapshot() StatsSnapshot {
+	return StatsSnapshot{
+		Hits:       s.hits.Load(),
+		Misses:     s.misses.Load(),
+		Refreshes:  s.refreshes.Load(),
+		BytesSaved: s.saved.Load(),
+	}
+}
+
+// HitRate returns the fraction of lookups served from the cache
+func (s StatsSnapshot) HitRate() float64 {
+	total := s.Hits + s.Misses + s.Refreshes
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+func (s StatsSnapshot) String() string {
+	return fmt.Sprintf("%d hits, %d misses, %d stale refreshes (%.0f%% hit rate)",
+		s.Hits, s.Misses, s.Refreshes, s.HitRate()*100)
+}
@@ -3,21 +3,51 @@
 package config
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/url"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var RequiredEnvVars = []string{
-	"EMAIL",
-	"PASSWORD",
 	"DOWNLOAD_PATH", // Now required
 	"VIDEO_QUALITY", // Now required
 }
 
 const (
-	LaracastsBaseUrl       = "https://laracasts.com"
+	// AuthMethodPassword Authentication methods selected by AUTH_METHOD
+	AuthMethodPassword = "password" // EMAIL and PASSWORD
+	AuthMethodCookie   = "cookie"   // SESSION_COOKIES copied from a signed in browser
+	AuthMethodTOTP     = "totp"     // EMAIL, PASSWORD and TOTP_SECRET
+)
+
+// AuthEnvVars lists the variables each authentication method requires
+var AuthEnvVars = map[string][]string{
+	AuthMethodPassword: {"EMAIL", "PASSWORD"},
+	AuthMethodCookie:   {"SESSION_COOKIES"},
+	AuthMethodTOTP:     {"EMAIL", "PASSWORD", "TOTP_SECRET"},
+}
+
+// SiteLaracasts is the SITE of the default adapter
+const SiteLaracasts = "laracasts"
+
+// LaracastsBaseUrl is the site root; it is a variable so tests can point the
+// downloader at a mock server
+var LaracastsBaseUrl = "https://laracasts.com"
+
+const (
+	LaracastsLoginPath     = "/login"
 	LaracastsPostLoginPath = "/sessions"
+	LaracastsTwoFactorPath = "/two-factor-challenge"
 	LaracastsSeriesPath    = "/series"
 	LaracastsWatchPath     = "/watch/series"
 	LaracastsBitsPath      = "/bits"
@@ -25,6 +55,19 @@ const (
 	LaracastsBrowsePath    = "/browse"
 )
 
+const (
+	// DeletedPolicyKeep Policies for completed episodes deleted from disk
+	DeletedPolicyKeep       = "keep"       // record the deletion as intentional
+	DeletedPolicyRedownload = "redownload" // download the episode again on the next sync
+)
+
+const (
+	// DuplicatePolicyHardlink Policies for bits that are also series episodes
+	DuplicatePolicyHardlink = "hardlink" // link the bit to the episode already on disk
+	DuplicatePolicySkip     = "skip"     // leave the bit out of the bits folder
+	DuplicatePolicyDownload = "download" // download the bit as a separate copy
+)
+
 // DefaultHeaders HTTP request headers
 var DefaultHeaders = map[string]string{
 	"User-Agent":      "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36",
@@ -54,6 +97,618 @@ func GetVideoQuality() string {
 	return os.Getenv("VIDEO_QUALITY")
 }
 
+// GetExtraHeaders parses EXTRA_HEADERS, a "|" separated list of "Name: value"
+// pairs sent with every laracasts.com request (e.g. the User-Agent matching a
+// Cloudflare clearance cookie)
+func GetExtraHeaders() (map[string]string, error) {
+	headers := make(map[string]string)
+	raw := strings.TrimSpace(os.Getenv("EXTRA_HEADERS"))
+	if raw == "" {
+		return headers, nil
+	}
+
+	for _, pair := range strings.Split(raw, "|") {
+		name, value, ok := strings.Cut(pair, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t\r\n") {
+			return nil, fmt.Errorf("invalid EXTRA_HEADERS entry %q, expected \"Name: value\"", strings.TrimSpace(pair))
+		}
+		headers[http.CanonicalHeaderKey(name)] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
+// Mirror is a fallback route for Laracasts page requests: either another base
+// URL, sent the laracasts.com Host header, or an address laracasts.com
+// connections are dialed to instead of the resolved one
+type Mirror struct {
+	BaseURL *url.URL // set for base URL mirrors
+	Address string   // IP or IP:port, set for IP overrides
+}
+
+func (m Mirror) String() string {
+	if m.BaseURL != nil {
+		return m.BaseURL.String()
+	}
+	return m.Address
+}
+
+// GetMirrors parses LARACASTS_MIRRORS, a comma separated list of base URLs
+// (https://edge.example.com) and IP overrides (104.16.0.1 or [2606::1]:443)
+// tried in order when laracasts.com fails a page request
+func GetMirrors() ([]Mirror, error) {
+	raw := strings.TrimSpace(os.Getenv("LARACASTS_MIRRORS"))
+	if raw == "" {
+		return nil, nil
+	}
+
+	var mirrors []Mirror
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if strings.Contains(entry, "://") {
+			u, err := url.Parse(entry)
+			if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+				return nil, fmt.Errorf("invalid LARACASTS_MIRRORS entry %q, expected a base URL or IP", entry)
+			}
+			mirrors = append(mirrors, Mirror{BaseURL: u})
+			continue
+		}
+
+		address := entry
+		host, _, err := net.SplitHostPort(entry)
+		if err != nil {
+			// No port, the one of the original request is kept
+			host = strings.Trim(entry, "[]")
+			address = host
+		}
+		if net.ParseIP(host) == nil {
+			return nil, fmt.Errorf("invalid LARACASTS_MIRRORS entry %q, expected a base URL or IP", entry)
+		}
+		mirrors = append(mirrors, Mirror{Address: address})
+	}
+	return mirrors, nil
+}
+
+// Address families connections are made over, selected by NETWORK_PREFERENCE
+const (
+	NetworkAuto = "auto" // either, racing IPv4 against IPv6 (happy eyeballs)
+	NetworkIPv4 = "ipv4"
+	NetworkIPv6 = "ipv6"
+)
+
+// NetworkPreference is the address family connections use, by default and
+// for specific hosts and their subdomains
+type NetworkPreference struct {
+	Default string
+	Hosts   map[string]string
+
+	// FallbackDelay is how long an IPv6 connection attempt gets before IPv4
+	// is tried in parallel with auto, zero for Go's default of 300ms
+	FallbackDelay time.Duration
+}
+
+// For returns the address family of connections to host, the most specific
+// override winning
+func (p NetworkPreference) For(host string) string {
+	if family, ok := hostOverride(p.Hosts, host); ok {
+		return family
+	}
+	if p.Default == "" {
+		return NetworkAuto
+	}
+	return p.Default
+}
+
+// hostOverride returns the value set for host or the closest of its parent
+// domains in overrides
+func hostOverride[V any](overrides map[string]V, host string) (V, bool) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	best := ""
+	var value V
+	for suffix, v := range overrides {
+		if (host == suffix || strings.HasSuffix(host, "."+suffix)) && len(suffix) > len(best) {
+			best, value = suffix, v
+		}
+	}
+	return value, best != ""
+}
+
+// GetNetworkPreference parses NETWORK_PREFERENCE, ipv4, ipv6 or auto,
+// optionally followed by comma separated overrides for hosts whose routes are
+// broken over one family, e.g. "auto, vimeocdn.com=ipv4", and
+// HAPPY_EYEBALLS_DELAY_MS
+func GetNetworkPreference() (NetworkPreference, error) {
+	pref := NetworkPreference{Default: NetworkAuto, Hosts: make(map[string]string)}
+	if ms, err := strconv.Atoi(os.Getenv("HAPPY_EYEBALLS_DELAY_MS")); err == nil && ms > 0 {
+		pref.FallbackDelay = time.Duration(ms) * time.Millisecond
+	}
+
+	valid := func(family string) bool {
+		return family == NetworkAuto || family == NetworkIPv4 || family == NetworkIPv6
+	}
+	for _, entry := range strings.Split(os.Getenv("NETWORK_PREFERENCE"), ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+
+		host, family, override := strings.Cut(entry, "=")
+		if !override {
+			if !valid(entry) {
+				return pref, fmt.Errorf("invalid NETWORK_PREFERENCE %q (use auto, ipv4 or ipv6)", entry)
+			}
+			pref.Default = entry
+			continue
+		}
+		host, family = strings.TrimPrefix(strings.TrimSpace(host), "*."), strings.TrimSpace(family)
+		if host == "" || !valid(family) {
+			return pref, fmt.Errorf("invalid NETWORK_PREFERENCE entry %q, expected host=auto|ipv4|ipv6", entry)
+		}
+		pref.Hosts[host] = family
+	}
+	return pref, nil
+}
+
+// Defaults of the politeness policy, used when POLITENESS_DELAY_MS and
+// POLITENESS_JITTER_MS are not set
+const (
+	DefaultPolitenessDelay  = 500 * time.Millisecond
+	DefaultPolitenessJitter = 250 * time.Millisecond
+)
+
+// Politeness spaces out the metadata requests sent to a host: pages, logins
+// and player configs, but not video transfers
+type Politeness struct {
+	Delay  time.Duration // between two requests to the same host
+	Jitter time.Duration // up to this much is added to every delay at random
+
+	// Hosts overrides Delay for hosts and their subdomains
+	Hosts map[string]time.Duration
+}
+
+// For returns the delay and jitter between requests to host
+func (p Politeness) For(host string) (time.Duration, time.Duration) {
+	delay := p.Delay
+	if d, ok := hostOverride(p.Hosts, host); ok {
+		delay = d
+	}
+	if delay <= 0 {
+		return 0, 0
+	}
+	return delay, p.Jitter
+}
+
+// GetPoliteness parses POLITENESS_DELAY_MS, POLITENESS_JITTER_MS and
+// POLITENESS_HOSTS, comma separated host=milliseconds overrides such as
+// "laracasts.com=2000, player.vimeo.com=0"
+func GetPoliteness() (Politeness, error) {
+	p := Politeness{Delay: DefaultPolitenessDelay, Jitter: DefaultPolitenessJitter, Hosts: make(map[string]time.Duration)}
+	if ms, err := strconv.Atoi(os.Getenv("POLITENESS_DELAY_MS")); err == nil && ms >= 0 {
+		p.Delay = time.Duration(ms) * time.Millisecond
+	}
+	if ms, err := strconv.Atoi(os.Getenv("POLITENESS_JITTER_MS")); err == nil && ms >= 0 {
+		p.Jitter = time.Duration(ms) * time.Millisecond
+	}
+
+	for _, entry := range strings.Split(os.Getenv("POLITENESS_HOSTS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		host, raw, _ := strings.Cut(entry, "=")
+		host = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(host), "*."))
+		ms, err := strconv.Atoi(strings.TrimSpace(raw))
+		if host == "" || err != nil || ms < 0 {
+			return p, fmt.Errorf("invalid POLITENESS_HOSTS entry %q, expected host=milliseconds", entry)
+		}
+		p.Hosts[host] = time.Duration(ms) * time.Millisecond
+	}
+	return p, nil
+}
+
+// GetExtraCookies parses EXTRA_COOKIES, a "; " separated cookie string such
+// as "cf_clearance=abc123", added to the laracasts.com cookie jar
+func GetExtraCookies() ([]*http.Cookie, error) {
+	raw := strings.TrimSpace(os.Getenv("EXTRA_COOKIES"))
+	if raw == "" {
+		return nil, nil
+	}
+
+	var cookies []*http.Cookie
+	for _, pair := range strings.Split(raw, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid EXTRA_COOKIES entry %q, expected name=value", strings.TrimSpace(pair))
+		}
+		cookies = append(cookies, &http.Cookie{Name: name, Value: value, Path: "/"})
+	}
+	return cookies, nil
+}
+
+// InsecureSkipVerify disables TLS certificate verification for every
+// request; set by -insecure-skip-verify as a last resort behind proxies whose
+// certificate cannot be added through CA_BUNDLE
+var InsecureSkipVerify bool
+
+// GetTLSConfig returns the TLS settings of all HTTPS requests. CA_BUNDLE, the
+// path of a PEM file, adds root certificates to the system ones, e.g. the
+// certificate of a TLS-inspecting corporate proxy
+func GetTLSConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: InsecureSkipVerify}
+
+	path := strings.TrimSpace(os.Getenv("CA_BUNDLE"))
+	if path == "" {
+		return tlsConfig, nil
+	}
+
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("CA_BUNDLE %s cannot be read: %v", path, err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("CA_BUNDLE %s contains no PEM certificates", path)
+	}
+	tlsConfig.RootCAs = pool
+	return tlsConfig, nil
+}
+
+// GetProgressWebhook returns PROGRESS_WEBHOOK_URL, the http(s) URL that
+// per-episode progress events are posted to, empty when unset
+func GetProgressWebhook() string {
+	return strings.TrimSpace(os.Getenv("PROGRESS_WEBHOOK_URL"))
+}
+
+// GetOriginToken returns ORIGIN_TOKEN, the shared secret a -serve origin
+// requires and -origin and -sync-from send, empty when unset
+func GetOriginToken() string {
+	return strings.TrimSpace(os.Getenv("ORIGIN_TOKEN"))
+}
+
+// ValidateWebhookURL checks if the provided webhook URL is valid
+func ValidateWebhookURL(raw string) bool {
+	if raw == "" {
+		return true
+	}
+	u, err := url.Parse(raw)
+	return err == nil && u.Host != "" && (u.Scheme == "http" || u.Scheme == "https")
+}
+
+// DefaultSMTPPort is the SMTP submission port, upgraded to TLS with STARTTLS
+const DefaultSMTPPort = 587
+
+// SummaryEmail is where the summary of a run is emailed: over SMTP, or piped
+// to a sendmail-compatible command when Sendmail is set
+type SummaryEmail struct {
+	To       []string
+	From     string
+	SMTPHost string
+	SMTPPort int
+	Username string
+	Password string
+	Sendmail string // e.g. "/usr/sbin/sendmail -t"
+}
+
+// GetSummaryEmail parses SUMMARY_EMAIL_TO, comma separated addresses the
+// summary of every download run is emailed to, SUMMARY_EMAIL_FROM, and either
+// SMTP_HOST, SMTP_PORT, SMTP_USERNAME and SMTP_PASSWORD or SENDMAIL_COMMAND.
+// It returns nil when SUMMARY_EMAIL_TO is unset.
+func GetSummaryEmail() (*SummaryEmail, error) {
+	raw := strings.TrimSpace(os.Getenv("SUMMARY_EMAIL_TO"))
+	if raw == "" {
+		return nil, nil
+	}
+
+	email := &SummaryEmail{
+		From:     strings.TrimSpace(os.Getenv("SUMMARY_EMAIL_FROM")),
+		SMTPHost: strings.TrimSpace(os.Getenv("SMTP_HOST")),
+		SMTPPort: DefaultSMTPPort,
+		Username: strings.TrimSpace(os.Getenv("SMTP_USERNAME")),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		Sendmail: strings.TrimSpace(os.Getenv("SENDMAIL_COMMAND")),
+	}
+	for _, address := range strings.Split(raw, ",") {
+		address = strings.TrimSpace(address)
+		if address == "" {
+			continue
+		}
+		if _, err := mail.ParseAddress(address); err != nil {
+			return nil, fmt.Errorf("SUMMARY_EMAIL_TO %q is not a valid email address", address)
+		}
+		email.To = append(email.To, address)
+	}
+	if email.From == "" {
+		email.From = email.To[0]
+	}
+	if _, err := mail.ParseAddress(email.From); err != nil {
+		return nil, fmt.Errorf("SUMMARY_EMAIL_FROM %q is not a valid email address", email.From)
+	}
+
+	if port := strings.TrimSpace(os.Getenv("SMTP_PORT")); port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("SMTP_PORT %q is not a port number", port)
+		}
+		email.SMTPPort = n
+	}
+	if email.SMTPHost == "" && email.Sendmail == "" {
+		return nil, fmt.Errorf("SUMMARY_EMAIL_TO is set without SMTP_HOST or SENDMAIL_COMMAND to send the summary with")
+	}
+	return email, nil
+}
+
+// GetIgnoredSeries returns the slugs listed in IGNORED_SERIES, separated by
+// commas, of series bulk downloads leave out
+func GetIgnoredSeries() []string {
+	var slugs []string
+	for _, slug := range strings.Split(os.Getenv("IGNORED_SERIES"), ",") {
+		if slug = strings.TrimSpace(slug); slug != "" {
+			slugs = append(slugs, slug)
+		}
+	}
+	return slugs
+}
+
+// GetCollections returns the named series lists defined in COLLECTIONS, as
+// "name: slug, slug | name: slug", keeping the order of the slugs
+func GetCollections() (map[string][]string, error) {
+	collections := make(map[string][]string)
+	raw := strings.TrimSpace(os.Getenv("COLLECTIONS"))
+	if raw == "" {
+		return collections, nil
+	}
+
+	for _, entry := range strings.Split(raw, "|") {
+		name, list, ok := strings.Cut(entry, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t/\\") {
+			return nil, fmt.Errorf("invalid COLLECTIONS entry %q, expected \"name: slug, slug\"", strings.TrimSpace(entry))
+		}
+		if _, exists := collections[name]; exists {
+			return nil, fmt.Errorf("collection %q is defined twice in COLLECTIONS", name)
+		}
+
+		slugs := []string{}
+		for _, slug := range strings.Split(list, ",") {
+			if slug = strings.TrimSpace(slug); slug != "" {
+				slugs = append(slugs, slug)
+			}
+		}
+		if len(slugs) == 0 {
+			return nil, fmt.Errorf("collection %q in COLLECTIONS lists no series", name)
+		}
+		collections[name] = slugs
+	}
+	return collections, nil
+}
+
+// GetSite returns SITE, the name of the site adapter to scrape with,
+// defaulting to Laracasts
+func GetSite() string {
+	if site := os.Getenv("SITE"); site != "" {
+		return site
+	}
+	return SiteLaracasts
+}
+
+// GetAuthMethod returns AUTH_METHOD, defaulting to password
+func GetAuthMethod() string {
+	if method := os.Getenv("AUTH_METHOD"); method != "" {
+		return method
+	}
+	return AuthMethodPassword
+}
+
+// GetDeletedEpisodePolicy returns how completed episodes missing on disk are
+// handled, defaulting to keeping the deletion
+func GetDeletedEpisodePolicy() string {
+	if os.Getenv("DELETED_EPISODE_POLICY") == DeletedPolicyRedownload {
+		return DeletedPolicyRedownload
+	}
+	return DeletedPolicyKeep
+}
+
+// ValidateDeletedEpisodePolicy checks if the provided policy is valid
+func ValidateDeletedEpisodePolicy(policy string) bool {
+	return policy == "" || policy == DeletedPolicyKeep || policy == DeletedPolicyRedownload
+}
+
+// GetDuplicatePolicy returns how bits already downloaded as a series episode
+// are handled, defaulting to hardlinking them
+func GetDuplicatePolicy() string {
+	switch policy := os.Getenv("BITS_DUPLICATE_POLICY"); policy {
+	case DuplicatePolicySkip, DuplicatePolicyDownload:
+		return policy
+	}
+	return DuplicatePolicyHardlink
+}
+
+// ValidateDuplicatePolicy checks if the provided policy is valid
+func ValidateDuplicatePolicy(policy string) bool {
+	return policy == "" || policy == DuplicatePolicyHardlink || policy == DuplicatePolicySkip || policy == DuplicatePolicyDownload
+}
+
+// GetTransliterate reports whether file and directory names are
+// transliterated to ASCII, from TRANSLITERATE_FILENAMES
+func GetTransliterate() (bool, error) {
+	raw := os.Getenv("TRANSLITERATE_FILENAMES")
+	if raw == "" {
+		return false, nil
+	}
+	enabled, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("TRANSLITERATE_FILENAMES %q is not a boolean (use true or false)", raw)
+	}
+	return enabled, nil
+}
+
+// DefaultTrashRetention is how long removed videos stay in the trash when
+// TRASH_RETENTION_DAYS is not set
+const DefaultTrashRetention = 14 * 24 * time.Hour
+
+// GetTrashRetention returns how long videos removed or replaced by a download
+// are kept in the trash, from TRASH_RETENTION_DAYS. Zero deletes them right
+// away.
+func GetTrashRetention() time.Duration {
+	raw := os.Getenv("TRASH_RETENTION_DAYS")
+	days, err := strconv.Atoi(raw)
+	if raw == "" || err != nil || days < 0 {
+		return DefaultTrashRetention
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// GetMonthlyCap returns the bytes that may be downloaded per calendar month,
+// from MAX_MONTHLY_GB, or 0 without a cap
+func GetMonthlyCap() int64 {
+	gb, err := strconv.Atoi(os.Getenv("MAX_MONTHLY_GB"))
+	if err != nil || gb < 0 {
+		return 0
+	}
+	return int64(gb) * 1024 * 1024 * 1024
+}
+
+// Concurrency limits how many topics, series, episodes and chunks per episode
+// are processed at the same time
+type Concurrency struct {
+	Topics   int // topic pages scraped at once
+	Series   int // series downloaded at once when syncing everything
+	Episodes int // episodes downloaded at once per series
+	Chunks   int // ranged requests at once per video
+	FFmpeg   int // ffmpeg processes at once for stream fallbacks and subtitles
+}
+
+// DefaultConcurrency is used for every level not configured in .env
+var DefaultConcurrency = Concurrency{Topics: 4, Series: 6, Episodes: 15, Chunks: 15, FFmpeg: runtime.NumCPU()}
+
+// DefaultConnectionBudget caps series x episodes x chunks, the number of
+// video connections that can be open at once
+const DefaultConnectionBudget = 1500
+
+// Connections returns the worst case number of simultaneous video connections
+func (c Concurrency) Connections() int {
+	return c.Series * c.Episodes * c.Chunks
+}
+
+// GetConcurrency reads TOPIC_CONCURRENCY, SERIES_CONCURRENCY,
+// EPISODE_CONCURRENCY, CHUNK_CONCURRENCY and FFMPEG_CONCURRENCY, checking the
+// result against CONNECTION_BUDGET
+func GetConcurrency() (Concurrency, error) {
+	c := DefaultConcurrency
+	for _, level := range []struct {
+		name  string
+		value *int
+	}{
+		{"TOPIC_CONCURRENCY", &c.Topics},
+		{"SERIES_CONCURRENCY", &c.Series},
+		{"EPISODE_CONCURRENCY", &c.Episodes},
+		{"CHUNK_CONCURRENCY", &c.Chunks},
+		{"FFMPEG_CONCURRENCY", &c.FFmpeg},
+	} {
+		raw := strings.TrimSpace(os.Getenv(level.name))
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > 100 {
+			return c, fmt.Errorf("invalid %s %q, expected a whole number from 1 to 100", level.name, raw)
+		}
+		*level.value = n
+	}
+
+	if err := c.CheckBudget(); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// CheckBudget verifies the concurrency stays within CONNECTION_BUDGET
+func (c Concurrency) CheckBudget() error {
+	budget := DefaultConnectionBudget
+	if raw := strings.TrimSpace(os.Getenv("CONNECTION_BUDGET")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid CONNECTION_BUDGET %q, expected a positive whole number", raw)
+		}
+		budget = n
+	}
+
+	if c.Connections() > budget {
+		return fmt.Errorf("SERIES_CONCURRENCY x EPISODE_CONCURRENCY x CHUNK_CONCURRENCY = %d x %d x %d = %d connections exceeds CONNECTION_BUDGET %d (lower one of them or raise the budget)",
+			c.Series, c.Episodes, c.Chunks, c.Connections(), budget)
+	}
+	return nil
+}
+
+// GetFileModes parses FILE_MODE and DIR_MODE, octal permissions such as 0664
+// and 2775 for created files and directories. ok is false when neither is
+// set, leaving modes to the process umask
+func GetFileModes() (file, dir os.FileMode, ok bool, err error) {
+	file, dir = 0644, 0755
+
+	if raw := os.Getenv("FILE_MODE"); raw != "" {
+		if file, err = parseMode("FILE_MODE", raw); err != nil {
+			return 0, 0, false, err
+		}
+		ok = true
+	}
+	if raw := os.Getenv("DIR_MODE"); raw != "" {
+		if dir, err = parseMode("DIR_MODE", raw); err != nil {
+			return 0, 0, false, err
+		}
+		ok = true
+	}
+	return file, dir, ok, nil
+}
+
+func parseMode(name, raw string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(raw, 8, 32)
+	if err != nil || mode > 07777 {
+		return 0, fmt.Errorf("invalid %s %q, expected octal permissions such as 0644", name, raw)
+	}
+
+	// Map the setuid/setgid/sticky bits to their os.FileMode equivalents
+	perm := os.FileMode(mode & 0777)
+	if mode&04000 != 0 {
+		perm |= os.ModeSetuid
+	}
+	if mode&02000 != 0 {
+		perm |= os.ModeSetgid
+	}
+	if mode&01000 != 0 {
+		perm |= os.ModeSticky
+	}
+	return perm, nil
+}
+
+// GetFileOwner parses FILE_OWNER, a numeric "uid:gid" (or just "uid") that
+// created files and directories are chowned to. Both are -1 when unset
+func GetFileOwner() (uid, gid int, err error) {
+	raw := strings.TrimSpace(os.Getenv("FILE_OWNER"))
+	if raw == "" {
+		return -1, -1, nil
+	}
+
+	user, group, hasGroup := strings.Cut(raw, ":")
+	gid = -1
+	if uid, err = strconv.Atoi(user); err != nil || uid < 0 {
+		return -1, -1, fmt.Errorf("invalid FILE_OWNER %q, expected numeric uid:gid", raw)
+	}
+	if hasGroup {
+		if gid, err = strconv.Atoi(group); err != nil || gid < 0 {
+			return -1, -1, fmt.Errorf("invalid FILE_OWNER %q, expected numeric uid:gid", raw)
+		}
+	}
+	return uid, gid, nil
+}
+
 // ValidateVideoQuality checks if the provided quality is valid
 func ValidateVideoQuality(quality string) bool {
 	validQualities := map[string]bool{
@@ -0,0 +1,92 @@
+package config
+
+import "os"
+
+// FingerprintRotate picks a different browser fingerprint for every session
+const FingerprintRotate = "rotate"
+
+// Fingerprint is the set of headers a real browser sends with every request.
+// They are kept together so the User-Agent never contradicts the client hints
+// next to it.
+type Fingerprint struct {
+	Name    string
+	Headers map[string]string
+}
+
+// Fingerprints is the pool sessions pick their headers from. Accept is left
+// to each request, since pages, JSON and videos ask for different types.
+var Fingerprints = []Fingerprint{
+	{
+		Name: "chrome-windows",
+		Headers: map[string]string{
+			"User-Agent":         "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36",
+			"Accept-Language":    "en-US,en;q=0.9",
+			"Sec-Ch-Ua":          `"Google Chrome";v="129", "Not=A?Brand";v="8", "Chromium";v="129"`,
+			"Sec-Ch-Ua-Mobile":   "?0",
+			"Sec-Ch-Ua-Platform": `"Windows"`,
+		},
+	},
+	{
+		Name: "chrome-mac",
+		Headers: map[string]string{
+			"User-Agent":         "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36",
+			"Accept-Language":    "en-US,en;q=0.9",
+			"Sec-Ch-Ua":          `"Google Chrome";v="129", "Not=A?Brand";v="8", "Chromium";v="129"`,
+			"Sec-Ch-Ua-Mobile":   "?0",
+			"Sec-Ch-Ua-Platform": `"macOS"`,
+		},
+	},
+	{
+		Name: "edge-windows",
+		Headers: map[string]string{
+			"User-Agent":         "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36 Edg/129.0.0.0",
+			"Accept-Language":    "en-US,en;q=0.9",
+			"Sec-Ch-Ua":          `"Microsoft Edge";v="129", "Not=A?Brand";v="8", "Chromium";v="129"`,
+			"Sec-Ch-Ua-Mobile":   "?0",
+			"Sec-Ch-Ua-Platform": `"Windows"`,
+		},
+	},
+	{
+		Name: "firefox-windows",
+		Headers: map[string]string{
+			"User-Agent":      "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:131.0) Gecko/20100101 Firefox/131.0",
+			"Accept-Language": "en-US,en;q=0.5",
+		},
+	},
+	{
+		Name: "firefox-linux",
+		Headers: map[string]string{
+			"User-Agent":      "Mozilla/5.0 (X11; Linux x86_64; rv:131.0) Gecko/20100101 Firefox/131.0",
+			"Accept-Language": "en-US,en;q=0.5",
+		},
+	},
+	{
+		Name: "safari-mac",
+		Headers: map[string]string{
+			"User-Agent":      "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.0 Safari/605.1.15",
+			"Accept-Language": "en-US,en;q=0.9",
+		},
+	},
+}
+
+// GetFingerprint returns HEADER_FINGERPRINT, the name of the fingerprint to
+// always use, defaulting to rotating through the pool
+func GetFingerprint() string {
+	if name := os.Getenv("HEADER_FINGERPRINT"); name != "" {
+		return name
+	}
+	return FingerprintRotate
+}
+
+// ValidateFingerprint checks if the provided fingerprint name is valid
+func ValidateFingerprint(name string) bool {
+	if name == "" || name == FingerprintRotate {
+		return true
+	}
+	for _, f := range Fingerprints {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,198 @@
+package config
+
+import (
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ValidationError lists every problem found in the configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "found %d problems in .env:", len(e.Problems))
+	for _, problem := range e.Problems {
+		b.WriteString("\n  - " + problem)
+	}
+	return b.String()
+}
+
+// numericRanges bounds the numeric settings
+var numericRanges = []struct {
+	name     string
+	min, max int
+}{
+	{"TRASH_RETENTION_DAYS", 0, 3650},
+	{"MAX_MONTHLY_GB", 0, 1000000},
+	{"HAPPY_EYEBALLS_DELAY_MS", 0, 10000},
+	{"POLITENESS_DELAY_MS", 0, 60000},
+	{"POLITENESS_JITTER_MS", 0, 60000},
+}
+
+// Validate normalizes the environment loaded from .env in place and checks
+// every value, reporting all problems at once with a hint on how to fix them
+func Validate() error {
+	Normalize()
+
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	method := GetAuthMethod()
+	authVars, ok := AuthEnvVars[method]
+	if !ok {
+		add("AUTH_METHOD %q is not supported (use password, cookie or totp)", method)
+	}
+	for _, env := range append(append([]string{}, RequiredEnvVars...), authVars...) {
+		if os.Getenv(env) == "" {
+			add("%s is not set (required for AUTH_METHOD=%s)", env, method)
+		}
+	}
+
+	if email := os.Getenv("EMAIL"); email != "" {
+		if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+			add("EMAIL %q is not a valid email address (use the address you sign in to Laracasts with)", email)
+		}
+	}
+
+	if quality := os.Getenv("VIDEO_QUALITY"); quality != "" && !ValidateVideoQuality(quality) {
+		add("VIDEO_QUALITY %q is not supported (use 360p, 540p, 720p or 1080p)", quality)
+	}
+
+	if path := GetDownloadPath(); path != "" {
+		if err := checkWritable(path); err != nil {
+			add("DOWNLOAD_PATH %q is not writable: %v (pick a directory you can write to)", path, err)
+		}
+	}
+
+	for _, r := range numericRanges {
+		raw := os.Getenv(r.name)
+		if raw == "" {
+			continue
+		}
+		if n, err := strconv.Atoi(raw); err != nil || n < r.min || n > r.max {
+			add("%s %q is out of range (use a whole number from %d to %d)", r.name, raw, r.min, r.max)
+		}
+	}
+
+	if !ValidateDeletedEpisodePolicy(os.Getenv("DELETED_EPISODE_POLICY")) {
+		add("DELETED_EPISODE_POLICY %q is not supported (use keep or redownload)", os.Getenv("DELETED_EPISODE_POLICY"))
+	}
+	if !ValidateDuplicatePolicy(os.Getenv("BITS_DUPLICATE_POLICY")) {
+		add("BITS_DUPLICATE_POLICY %q is not supported (use hardlink, skip or download)", os.Getenv("BITS_DUPLICATE_POLICY"))
+	}
+
+	if !ValidateWebhookURL(GetProgressWebhook()) {
+		add("PROGRESS_WEBHOOK_URL %q is not an http(s) URL", GetProgressWebhook())
+	}
+	if !ValidateFingerprint(os.Getenv("HEADER_FINGERPRINT")) {
+		var names []string
+		for _, f := range Fingerprints {
+			names = append(names, f.Name)
+		}
+		add("HEADER_FINGERPRINT %q is not supported (use rotate or one of %s)", os.Getenv("HEADER_FINGERPRINT"), strings.Join(names, ", "))
+	}
+
+	// Structured values report their own format in the error
+	if _, err := GetExtraHeaders(); err != nil {
+		add("%v", err)
+	}
+	if _, err := GetExtraCookies(); err != nil {
+		add("%v", err)
+	}
+	if _, err := GetMirrors(); err != nil {
+		add("%v", err)
+	}
+	if _, err := GetCollections(); err != nil {
+		add("%v", err)
+	}
+	if _, err := GetSummaryEmail(); err != nil {
+		add("%v", err)
+	}
+	if _, err := GetNetworkPreference(); err != nil {
+		add("%v", err)
+	}
+	if _, err := GetPoliteness(); err != nil {
+		add("%v", err)
+	}
+	if _, err := GetTLSConfig(); err != nil {
+		add("%v", err)
+	}
+	if _, _, _, err := GetFileModes(); err != nil {
+		add("%v", err)
+	}
+	if _, _, err := GetFileOwner(); err != nil {
+		add("%v", err)
+	}
+	if _, err := GetConcurrency(); err != nil {
+		add("%v", err)
+	}
+	if _, err := GetTransliterate(); err != nil {
+		add("%v", err)
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// Normalize trims values and fixes the case of enum settings, so "1080P" or
+// " Keep " are accepted
+func Normalize() {
+	for _, name := range []string{"EMAIL", "DOWNLOAD_PATH", "VIDEO_QUALITY", "AUTH_METHOD", "DELETED_EPISODE_POLICY",
+		"FILE_MODE", "DIR_MODE", "FILE_OWNER",
+		"TOPIC_CONCURRENCY", "SERIES_CONCURRENCY", "EPISODE_CONCURRENCY", "CHUNK_CONCURRENCY", "FFMPEG_CONCURRENCY", "CONNECTION_BUDGET",
+		"TRANSLITERATE_FILENAMES", "BITS_DUPLICATE_POLICY", "CA_BUNDLE", "HEADER_FINGERPRINT", "PROGRESS_WEBHOOK_URL",
+		"TRASH_RETENTION_DAYS", "MAX_MONTHLY_GB", "NETWORK_PREFERENCE", "HAPPY_EYEBALLS_DELAY_MS",
+		"POLITENESS_DELAY_MS", "POLITENESS_JITTER_MS", "POLITENESS_HOSTS", "IGNORED_SERIES", "SITE", "COLLECTIONS"} {
+		if value, ok := os.LookupEnv(name); ok {
+			os.Setenv(name, strings.TrimSpace(value))
+		}
+	}
+
+	for _, name := range []string{"VIDEO_QUALITY", "AUTH_METHOD", "DELETED_EPISODE_POLICY", "BITS_DUPLICATE_POLICY", "HEADER_FINGERPRINT", "SITE"} {
+		if value, ok := os.LookupEnv(name); ok {
+			os.Setenv(name, strings.ToLower(value))
+		}
+	}
+
+	// Accept a bare height such as 1080
+	if quality := os.Getenv("VIDEO_QUALITY"); quality != "" && !strings.HasSuffix(quality, "p") {
+		os.Setenv("VIDEO_QUALITY", quality+"p")
+	}
+}
+
+// checkWritable verifies that path, or the closest existing parent it would
+// be created in, is a writable directory
+func checkWritable(path string) error {
+	dir := filepath.Clean(path)
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", dir)
+			}
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return err
+		}
+		dir = parent
+	}
+
+	probe, err := os.CreateTemp(dir, ".write-test-*")
+	if err != nil {
+		return err
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
@@ -0,0 +1,170 @@
+package config_test
+
+import (
+	"errors"
+	"github.com/sajjadanwar0/laracasts-dl/internal/config"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setEnv sets every variable Validate looks at, clearing the ones not given
+func setEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+	for _, name := range []string{"AUTH_METHOD", "EMAIL", "PASSWORD", "SESSION_COOKIES", "TOTP_SECRET",
+		"DOWNLOAD_PATH", "VIDEO_QUALITY",
+		"DELETED_EPISODE_POLICY", "EXTRA_HEADERS", "EXTRA_COOKIES", "LARACASTS_MIRRORS",
+		"FILE_MODE", "DIR_MODE", "FILE_OWNER", "TRANSLITERATE_FILENAMES", "BITS_DUPLICATE_POLICY", "CA_BUNDLE", "HEADER_FINGERPRINT", "PROGRESS_WEBHOOK_URL",
+		"TRASH_RETENTION_DAYS", "MAX_MONTHLY_GB", "NETWORK_PREFERENCE", "HAPPY_EYEBALLS_DELAY_MS",
+		"POLITENESS_DELAY_MS", "POLITENESS_JITTER_MS", "POLITENESS_HOSTS", "COLLECTIONS",
+		"SUMMARY_EMAIL_TO", "SUMMARY_EMAIL_FROM", "SMTP_HOST", "SMTP_PORT", "SMTP_USERNAME", "SMTP_PASSWORD", "SENDMAIL_COMMAND"} {
+		t.Setenv(name, env[name])
+	}
+}
+
+func TestValidateAcceptsAndNormalizes(t *testing.T) {
+	setEnv(t, map[string]string{
+		"EMAIL":                  " jeffrey@example.com ",
+		"PASSWORD":               "secret",
+		"DOWNLOAD_PATH":          filepath.Join(t.TempDir(), "new", "dir"),
+		"VIDEO_QUALITY":          "1080",
+		"DELETED_EPISODE_POLICY": "Redownload",
+		"TRASH_RETENTION_DAYS":   " 30 ",
+	})
+
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if got := os.Getenv("VIDEO_QUALITY"); got != "1080p" {
+		t.Errorf("VIDEO_QUALITY = %q, want 1080p", got)
+	}
+	if got := os.Getenv("EMAIL"); got != "jeffrey@example.com" {
+		t.Errorf("EMAIL = %q, want it trimmed", got)
+	}
+	if got := config.GetDeletedEpisodePolicy(); got != config.DeletedPolicyRedownload {
+		t.Errorf("GetDeletedEpisodePolicy() = %q, want redownload", got)
+	}
+}
+
+func TestValidateReportsAllProblems(t *testing.T) {
+	notADir := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(notADir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	setEnv(t, map[string]string{
+		"EMAIL":                 "not-an-email",
+		"DOWNLOAD_PATH":         notADir,
+		"VIDEO_QUALITY":         "4k",
+		"TRASH_RETENTION_DAYS":  "5000",
+		"FILE_MODE":             "rwx",
+		"BITS_DUPLICATE_POLICY": "copy",
+		"CA_BUNDLE":             notADir,
+	})
+
+	err := config.Validate()
+	var validationErr *config.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Validate() error = %v, want *ValidationError", err)
+	}
+
+	for _, want := range []string{"PASSWORD", "EMAIL", "DOWNLOAD_PATH", "VIDEO_QUALITY", "TRASH_RETENTION_DAYS", "FILE_MODE", "BITS_DUPLICATE_POLICY", "CA_BUNDLE"} {
+		found := false
+		for _, problem := range validationErr.Problems {
+			if strings.HasPrefix(problem, want) || strings.Contains(problem, " "+want+" ") {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("no problem reported for %s in %q", want, validationErr.Problems)
+		}
+	}
+}
+
+func TestNetworkPreference(t *testing.T) {
+	setEnv(t, map[string]string{"NETWORK_PREFERENCE": "IPv6, vimeocdn.com=ipv4, *.akamaized.net=auto", "HAPPY_EYEBALLS_DELAY_MS": "50"})
+
+	pref, err := config.GetNetworkPreference()
+	if err != nil {
+		t.Fatalf("GetNetworkPreference() error = %v", err)
+	}
+	if pref.FallbackDelay != 50*time.Millisecond {
+		t.Errorf("FallbackDelay = %v, want 50ms", pref.FallbackDelay)
+	}
+	for host, want := range map[string]string{
+		"laracasts.com":              config.NetworkIPv6,
+		"vimeocdn.com":               config.NetworkIPv4,
+		"skyfire.vimeocdn.com":       config.NetworkIPv4,
+		"notvimeocdn.com":            config.NetworkIPv6,
+		"vod-adaptive.akamaized.net": config.NetworkAuto,
+	} {
+		if got := pref.For(host); got != want {
+			t.Errorf("For(%q) = %q, want %q", host, got, want)
+		}
+	}
+
+	t.Setenv("NETWORK_PREFERENCE", "vimeocdn.com=ipv5")
+	if _, err := config.GetNetworkPreference(); err == nil {
+		t.Error("GetNetworkPreference() accepted an unknown family")
+	}
+}
+
+func TestCollections(t *testing.T) {
+	setEnv(t, map[string]string{"COLLECTIONS": "interview-prep: laravel-basics, series/php-for-beginners | testing:pest-from-scratch,"})
+
+	collections, err := config.GetCollections()
+	if err != nil {
+		t.Fatalf("GetCollections() error = %v", err)
+	}
+	want := map[string][]string{
+		"interview-prep": {"laravel-basics", "series/php-for-beginners"},
+		"testing":        {"pest-from-scratch"},
+	}
+	if !reflect.DeepEqual(collections, want) {
+		t.Errorf("GetCollections() = %v, want %v", collections, want)
+	}
+
+	for _, raw := range []string{"laravel-basics", "interview prep: laravel-basics", "empty: ,", "a: x | a: y"} {
+		t.Setenv("COLLECTIONS", raw)
+		if _, err := config.GetCollections(); err == nil {
+			t.Errorf("GetCollections() accepted %q", raw)
+		}
+	}
+}
+
+func TestSummaryEmail(t *testing.T) {
+	setEnv(t, map[string]string{
+		"SUMMARY_EMAIL_TO": "nas@example.com, admin@example.com",
+		"SMTP_HOST":        "smtp.example.com",
+		"SMTP_USERNAME":    "nas",
+		"SMTP_PASSWORD":    "secret",
+	})
+
+	email, err := config.GetSummaryEmail()
+	if err != nil {
+		t.Fatalf("GetSummaryEmail() error = %v", err)
+	}
+	want := &config.SummaryEmail{
+		To:       []string{"nas@example.com", "admin@example.com"},
+		From:     "nas@example.com",
+		SMTPHost: "smtp.example.com",
+		SMTPPort: config.DefaultSMTPPort,
+		Username: "nas",
+		Password: "secret",
+	}
+	if !reflect.DeepEqual(email, want) {
+		t.Errorf("GetSummaryEmail() = %+v, want %+v", email, want)
+	}
+
+	t.Setenv("SMTP_HOST", "")
+	if _, err := config.GetSummaryEmail(); err == nil {
+		t.Error("GetSummaryEmail() accepted neither SMTP_HOST nor SENDMAIL_COMMAND")
+	}
+	t.Setenv("SUMMARY_EMAIL_TO", "")
+	if email, err := config.GetSummaryEmail(); email != nil || err != nil {
+		t.Errorf("GetSummaryEmail() without SUMMARY_EMAIL_TO = %+v, %v, want nil", email, err)
+	}
+}
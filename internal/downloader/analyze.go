@@ -0,0 +1,470 @@
+package downloader
+
+import (
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/vimeo"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Analysis breaks down the disk space the library takes and lists what could
+// be cleaned up
+type Analysis struct {
+	Total      int64
+	Topics     []FolderUsage // top folders, and each topic in the topics layout
+	Series     []FolderUsage // folders holding videos
+	Duplicates []DuplicateVideo
+	Orphans    []LibraryFile // videos no cached series has an episode for
+	Incomplete []LibraryFile // partial or interrupted downloads
+}
+
+// FolderUsage is the disk space taken by the files under a folder
+type FolderUsage struct {
+	Path  string // relative to the download path
+	Files int
+	Bytes int64
+}
+
+// DuplicateVideo is a video saved in several places, e.g. a series listed
+// under several topics downloaded before topics were linked
+type DuplicateVideo struct {
+	VimeoId string
+	Title   string
+	Paths   []string // relative to the download path, the first is kept
+	Bytes   int64    // taken by the copies after the first
+}
+
+// LibraryFile is a file found by Analyze
+type LibraryFile struct {
+	Path   string // relative to the download path
+	Bytes  int64
+	Reason string
+}
+
+// libraryEpisode is the cached episode a video on disk belongs to
+type libraryEpisode struct {
+	slug      string
+	episode   Episode
+	quality   string
+	completed bool
+}
+
+// Analyze walks the download path and matches the videos there against the
+// cached series metadata, without any request. Hidden folders, like the cache
+// and the trash, and the links of the authors layout are left out.
+func (d *Downloader) Analyze() (*Analysis, error) {
+	known := d.libraryEpisodes()
+
+	bitsDir := filepath.Join(d.BasePath, "bits")
+	if state, err := d.loadBitsDownloadState(); err == nil && state.Dir != "" {
+		bitsDir = state.Dir
+	}
+
+	analysis := &Analysis{}
+	topics := make(map[string]*FolderUsage)
+	series := make(map[string]*FolderUsage)
+	copies := make(map[string][]string) // vimeo id and quality -> paths
+	refs := make(map[string]*libraryEpisode)
+
+	err := filepath.WalkDir(d.BasePath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if d.skipLibraryDir(path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+
+		rel := d.relativePath(path)
+		analysis.Total += info.Size()
+		addUsage(topics, topicFolder(rel), info.Size())
+		if filepath.Dir(rel) != "." {
+			addUsage(series, filepath.Dir(rel), info.Size())
+		}
+
+		ref := known[path]
+		if abs, err := filepath.Abs(path); err == nil {
+			ref = known[abs]
+		}
+
+		name := entry.Name()
+		switch {
+		case isPartialVideo(name):
+			analysis.Incomplete = append(analysis.Incomplete, LibraryFile{Path: rel, Bytes: info.Size(), Reason: "unfinished stream download"})
+		case filepath.Ext(filepath.Dir(path)) == vimeo.HLSCacheExt:
+			// Segments cached for an unfinished HLS download
+		case !isVideoFile(name):
+		case ref != nil:
+			refs[path] = ref
+			key := ref.episode.VimeoId + " " + ref.quality
+			copies[key] = append(copies[key], path)
+			if reason := d.incompleteReason(ref, info.Size()); reason != "" {
+				analysis.Incomplete = append(analysis.Incomplete, LibraryFile{Path: rel, Bytes: info.Size(), Reason: reason})
+			}
+		case !isWithin(path, bitsDir):
+			analysis.Orphans = append(analysis.Orphans, LibraryFile{Path: rel, Bytes: info.Size(), Reason: "not an episode of any cached series"})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %v", d.BasePath, err)
+	}
+
+	analysis.Topics = sortedUsage(topics)
+	analysis.Series = sortedUsage(series)
+	analysis.Duplicates = d.duplicateVideos(refs, copies)
+	return analysis, nil
+}
+
+// libraryEpisodes maps the absolute paths every quality of every cached
+// episode may be saved at to the episode
+func (d *Downloader) libraryEpisodes() map[string]*libraryEpisode {
+	known := make(map[string]*libraryEpisode)
+
+	for _, key := range d.Cache.Keys("series_") {
+		var seriesData SeriesMetadata
+		if found, err := d.Cache.Get(key, &seriesData); err != nil || !found {
+			continue
+		}
+		disambiguateFilenames(&seriesData)
+
+		slug := strings.TrimPrefix(key, "series_")
+		completed := make(map[string]bool)
+		if state, err := d.loadDownloadState(slug); err == nil {
+			completed = state.Completed
+		}
+
+		for _, dir := range d.seriesDirs(slug, seriesData.Title) {
+			if abs, err := filepath.Abs(dir); err == nil {
+				dir = abs
+			}
+			for _, chapter := range seriesData.Chapters {
+				for _, episode := range chapter.Episodes {
+					for _, v := range d.variants(filepath.Join(dir, episodeFilename(episode))) {
+						ref := &libraryEpisode{slug: slug, episode: episode, quality: v.Quality, completed: completed[episode.VimeoId]}
+						for _, path := range []string{v.Path, vimeo.ContainerPath(v.Path, d.Vimeo.Container)} {
+							if _, ok := known[path]; !ok {
+								known[path] = ref
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return known
+}
+
+// incompleteReason tells why the video of ref, size bytes on disk, looks
+// unfinished, or returns "" when it does not
+func (d *Downloader) incompleteReason(ref *libraryEpisode, size int64) string {
+	if !ref.completed {
+		return "download was not completed"
+	}
+	if remote, ok := d.sizes.cached(ref.episode.VimeoId, ref.quality); ok && remote > 0 && size < remote {
+		return fmt.Sprintf("%s of %s", formatBytes(size), formatBytes(remote))
+	}
+	return ""
+}
+
+// duplicateVideos returns the videos found at several paths, counting hard
+// links to the same file once
+func (d *Downloader) duplicateVideos(refs map[string]*libraryEpisode, copies map[string][]string) []DuplicateVideo {
+	var duplicates []DuplicateVideo
+	for _, paths := range copies {
+		sort.Strings(paths)
+
+		var distinct []string
+		var infos []os.FileInfo
+		var extra int64
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			same := false
+			for _, other := range infos {
+				if os.SameFile(info, other) {
+					same = true
+					break
+				}
+			}
+			if same {
+				continue
+			}
+			if len(distinct) > 0 {
+				extra += info.Size()
+			}
+			distinct = append(distinct, d.relativePath(path))
+			infos = append(infos, info)
+		}
+
+		if len(distinct) < 2 {
+			continue
+		}
+		duplicates = append(duplicates, DuplicateVideo{
+			VimeoId: refs[paths[0]].episode.VimeoId,
+			Title:   refs[paths[0]].episode.Title,
+			Paths:   distinct,
+			Bytes:   extra,
+		})
+	}
+
+	sort.Slice(duplicates, func(i, j int) bool { return duplicates[i].Bytes > duplicates[j].Bytes })
+	return duplicates
+}
+
+// Print writes the analysis: the largest folders, then the cleanup
+// suggestions
+func (a *Analysis) Print() {
+	fmt.Printf("📦 Library: %s\n", formatBytes(a.Total))
+
+	printUsage := func(title string, usage []FolderUsage) {
+		if len(usage) == 0 {
+			return
+		}
+		fmt.Printf("\n%s:\n", title)
+		for i, u := range usage {
+			if i == analysisListLimit {
+				fmt.Printf("  … %d more\n", len(usage)-i)
+				break
+			}
+			fmt.Printf("  %10s  %5d files  %s\n", formatBytes(u.Bytes), u.Files, u.Path)
+		}
+	}
+	printUsage("By topic", a.Topics)
+	printUsage("By series", a.Series)
+
+	if len(a.Duplicates) > 0 {
+		fmt.Printf("\n🔁 %d videos are saved more than once, %s could be freed by hard linking them:\n", len(a.Duplicates), formatBytes(a.DuplicateBytes()))
+		for _, dup := range a.Duplicates {
+			fmt.Printf("- %s (vimeo %s): %s\n", dup.Title, dup.VimeoId, strings.Join(dup.Paths, ", "))
+		}
+	}
+	printFiles := func(title string, files []LibraryFile) {
+		if len(files) == 0 {
+			return
+		}
+		fmt.Printf("\n%s (%d, %s):\n", title, len(files), formatBytes(totalBytes(files)))
+		for _, f := range files {
+			fmt.Printf("- %s: %s\n", f.Path, f.Reason)
+		}
+	}
+	printFiles("👻 Orphaned videos", a.Orphans)
+	printFiles("⏳ Incomplete downloads", a.Incomplete)
+
+	if len(a.Duplicates) == 0 && len(a.Orphans) == 0 && len(a.Incomplete) == 0 {
+		fmt.Println("\n✨ Nothing to clean up")
+	}
+}
+
+// analysisListLimit caps the folders printed per breakdown
+const analysisListLimit = 20
+
+// DuplicateBytes returns the space taken by the copies of duplicate videos
+func (a *Analysis) DuplicateBytes() int64 {
+	var total int64
+	for _, dup := range a.Duplicates {
+		total += dup.Bytes
+	}
+	return total
+}
+
+// TrashFiles moves files found by Analyze to the trash, or deletes them
+// without a TrashRetention, returning how many were. Files of a series
+// another instance is downloading are left alone.
+func (d *Downloader) TrashFiles(files []LibraryFile) (int, error) {
+	locks := d.folderLocks()
+	moved := 0
+	for _, f := range files {
+		path := filepath.Join(d.BasePath, f.Path)
+		unlock, err := d.lockFolder(locks, path)
+		if isLocked(err) {
+			fmt.Printf("Skipping %s, it is being downloaded by another instance\n", f.Path)
+			continue
+		}
+		if err != nil {
+			return moved, err
+		}
+		err = d.trash(path)
+		unlock()
+		if err != nil && !os.IsNotExist(err) {
+			return moved, fmt.Errorf("failed to trash %s: %v", f.Path, err)
+		}
+		moved++
+	}
+	return moved, nil
+}
+
+// LinkDuplicates replaces the copies of duplicate videos with hard links to
+// the first one, returning the bytes freed. Copies in a series another
+// instance is downloading are left alone.
+func (d *Downloader) LinkDuplicates(duplicates []DuplicateVideo) (int64, error) {
+	locks := d.folderLocks()
+	var freed int64
+	for _, dup := range duplicates {
+		source := filepath.Join(d.BasePath, dup.Paths[0])
+		for _, rel := range dup.Paths[1:] {
+			path := filepath.Join(d.BasePath, rel)
+			if filepath.Ext(path) != filepath.Ext(source) {
+				continue
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			unlock, err := d.lockFolder(locks, path)
+			if isLocked(err) {
+				fmt.Printf("Skipping %s, it is being downloaded by another instance\n", rel)
+				continue
+			}
+			if err != nil {
+				return freed, err
+			}
+
+			err = d.linkCopy(source, path)
+			unlock()
+			if err != nil {
+				return freed, fmt.Errorf("failed to replace %s: %v", rel, err)
+			}
+			freed += info.Size()
+		}
+	}
+	return freed, nil
+}
+
+// linkCopy replaces the file at path with a hard link to source
+func (d *Downloader) linkCopy(source, path string) error {
+	tmpPath := path + ".link"
+	if err := os.Link(source, tmpPath); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// folderLocks maps the folders of the cached series, and the bits folder, to
+// the lock a download into them holds
+func (d *Downloader) folderLocks() map[string]string {
+	locks := make(map[string]string)
+	for _, key := range d.Cache.Keys("series_") {
+		var seriesData SeriesMetadata
+		if found, err := d.Cache.Get(key, &seriesData); err != nil || !found {
+			continue
+		}
+		for _, dir := range d.seriesDirs(strings.TrimPrefix(key, "series_"), seriesData.Title) {
+			locks[absDir(dir)] = key
+		}
+	}
+
+	bitsDir := filepath.Join(d.BasePath, "bits")
+	if state, err := d.loadBitsDownloadState(); err == nil && state.Dir != "" {
+		bitsDir = state.Dir
+	}
+	locks[absDir(bitsDir)] = "bits"
+	return locks
+}
+
+// lockFolder takes the lock of locks guarding the closest folder above path,
+// if any, failing when another instance holds it, and returns the function
+// releasing it
+func (d *Downloader) lockFolder(locks map[string]string, path string) (func(), error) {
+	base := absDir(d.BasePath)
+	for dir := absDir(filepath.Dir(path)); ; dir = filepath.Dir(dir) {
+		if name, ok := locks[dir]; ok {
+			lock, err := d.lock(name)
+			if err != nil {
+				return nil, err
+			}
+			return func() { lock.Unlock() }, nil
+		}
+		if dir == base || filepath.Dir(dir) == dir {
+			return func() {}, nil
+		}
+	}
+}
+
+// skipLibraryDir reports whether walks of the library leave out the folder at
+// path: hidden ones, like the cache and the trash, and the links of the
+// authors and collections layouts
+func (d *Downloader) skipLibraryDir(path string) bool {
+	if path == d.BasePath {
+		return false
+	}
+	return strings.HasPrefix(filepath.Base(path), ".") ||
+		path == filepath.Join(d.BasePath, AuthorsDir) ||
+		path == filepath.Join(d.BasePath, CollectionsDir)
+}
+
+// topicFolder returns the folder rel is accounted to by topic: the topic in
+// the topics layout, otherwise the top folder
+func topicFolder(rel string) string {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	switch {
+	case len(parts) == 1:
+		return "."
+	case parts[0] == "topics" && len(parts) > 2:
+		return filepath.Join(parts[0], parts[1])
+	}
+	return parts[0]
+}
+
+// isPartialVideo reports whether name is the ".part" output of an unfinished
+// stream or origin download
+func isPartialVideo(name string) bool {
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	return strings.HasSuffix(name, ".part") || strings.HasSuffix(base, ".part")
+}
+
+// isWithin reports whether path is dir or lies under it
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && filepath.IsLocal(rel)
+}
+
+func addUsage(usage map[string]*FolderUsage, path string, size int64) {
+	u := usage[path]
+	if u == nil {
+		u = &FolderUsage{Path: path}
+		usage[path] = u
+	}
+	u.Files++
+	u.Bytes += size
+}
+
+func sortedUsage(usage map[string]*FolderUsage) []FolderUsage {
+	sorted := make([]FolderUsage, 0, len(usage))
+	for _, u := range usage {
+		sorted = append(sorted, *u)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Bytes != sorted[j].Bytes {
+			return sorted[i].Bytes > sorted[j].Bytes
+		}
+		return sorted[i].Path < sorted[j].Path
+	})
+	return sorted
+}
+
+func totalBytes(files []LibraryFile) int64 {
+	var total int64
+	for _, f := range files {
+		total += f.Bytes
+	}
+	return total
+}
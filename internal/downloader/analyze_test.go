@@ -0,0 +1,63 @@
+package downloader_test
+
+import (
+	"github.com/sajjadanwar0/laracasts-dl/internal/fsutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+
+	seriesDir := filepath.Join(downloadPath, "laravel-basics")
+	for name, size := range map[string]int{"99-leftover.mp4": 1000, "04-stream.part.mp4": 500} {
+		if err := os.WriteFile(filepath.Join(seriesDir, name), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	analysis, err := dl.Analyze()
+	if err != nil {
+		t.Fatalf("Analyze() error = %v", err)
+	}
+	if want := int64(3*mockVideoSize + 1500); analysis.Series[0].Path != "laravel-basics" || analysis.Series[0].Bytes < want {
+		t.Errorf("largest series = %+v, want laravel-basics with at least %d bytes", analysis.Series[0], want)
+	}
+	if len(analysis.Orphans) != 1 || analysis.Orphans[0].Path != filepath.Join("laravel-basics", "99-leftover.mp4") {
+		t.Errorf("orphans = %+v, want the leftover video", analysis.Orphans)
+	}
+	if len(analysis.Incomplete) != 1 || analysis.Incomplete[0].Path != filepath.Join("laravel-basics", "04-stream.part.mp4") {
+		t.Errorf("incomplete = %+v, want the partial stream", analysis.Incomplete)
+	}
+	if len(analysis.Duplicates) != 0 {
+		t.Errorf("duplicates = %+v, want none", analysis.Duplicates)
+	}
+
+	// The partial stream of a series another instance is downloading stays
+	other, err := fsutil.TryLock(filepath.Join(downloadPath, ".cache", "locks", "series_laravel-basics.lock"))
+	if err != nil {
+		t.Fatalf("TryLock() error = %v", err)
+	}
+	if moved, err := dl.TrashFiles(analysis.Incomplete); err != nil || moved != 0 {
+		t.Errorf("TrashFiles() of a locked series = %d, %v, want none moved", moved, err)
+	}
+	if !fileExists(filepath.Join(seriesDir, "04-stream.part.mp4")) {
+		t.Error("file of a locked series trashed")
+	}
+	if err := other.Unlock(); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+
+	if _, err := dl.TrashFiles(analysis.Orphans); err != nil {
+		t.Fatalf("TrashFiles() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(seriesDir, "99-leftover.mp4")); !os.IsNotExist(err) {
+		t.Errorf("orphan still in the library: %v", err)
+	}
+}
@@ -0,0 +1,367 @@
+package downloader
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/config"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Authenticator signs an HTTP client in to a site, leaving the session
+// cookies in the client's jar
+type Authenticator interface {
+	Authenticate(client *http.Client, site Site) error
+}
+
+// NewAuthenticator returns the authenticator selected by AUTH_METHOD
+func NewAuthenticator() (Authenticator, error) {
+	password := &PasswordAuthenticator{
+		Email:    os.Getenv("EMAIL"),
+		Password: os.Getenv("PASSWORD"),
+	}
+
+	switch config.GetAuthMethod() {
+	case config.AuthMethodPassword:
+		return password, nil
+	case config.AuthMethodCookie:
+		return &CookieAuthenticator{Cookies: os.Getenv("SESSION_COOKIES")}, nil
+	case config.AuthMethodTOTP:
+		return &TotpAuthenticator{PasswordAuthenticator: *password, Secret: os.Getenv("TOTP_SECRET")}, nil
+	}
+	return nil, fmt.Errorf("unknown AUTH_METHOD %q", config.GetAuthMethod())
+}
+
+// Authenticate signs the downloader in with auth. A failure with the system
+// clock far off the site's is reported as the clock's.
+func (d *Downloader) Authenticate(auth Authenticator) error {
+	PrintBox("Authenticating")
+	err := auth.Authenticate(d.Client, d.Site)
+	if clockErr := d.checkClock(err != nil); clockErr != nil {
+		return fmt.Errorf("%w (%v)", clockErr, err)
+	}
+	if err != nil {
+		return err
+	}
+	d.session.signIn(auth)
+	return nil
+}
+
+// Login signs in with an email and password
+func (d *Downloader) Login(email, password string) error {
+	return d.Authenticate(&PasswordAuthenticator{Email: email, Password: password})
+}
+
+// PasswordAuthenticator posts the account email and password to the login
+// endpoint
+type PasswordAuthenticator struct {
+	Email    string
+	Password string
+}
+
+func (a *PasswordAuthenticator) Authenticate(client *http.Client, site Site) error {
+	resp, err := a.login(client, site)
+	if err != nil {
+		return err
+	}
+	if resp.TwoFactor {
+		return fmt.Errorf("account requires two-factor authentication, set AUTH_METHOD=totp and TOTP_SECRET")
+	}
+
+	fmt.Printf("✓ Logged in as %s\n", a.Email)
+	return nil
+}
+
+// loginResponse is the JSON body of a successful login request
+type loginResponse struct {
+	TwoFactor bool `json:"two_factor"`
+}
+
+func (a *PasswordAuthenticator) login(client *http.Client, site Site) (*loginResponse, error) {
+	// First visit the site to get the session and XSRF cookies
+	if _, err := refreshXSRFToken(client, site); err != nil {
+		return nil, err
+	}
+
+	body, err := postJSON(client, site, site.Paths().PostLogin, site.LoginPayload(a.Email, a.Password))
+	if err != nil {
+		return nil, fmt.Errorf("login failed: %w", err)
+	}
+
+	var resp loginResponse
+	if len(bytes.TrimSpace(body)) > 0 {
+		// The body is only inspected for the two-factor flag
+		_ = json.Unmarshal(body, &resp)
+	}
+	return &resp, nil
+}
+
+// CookieAuthenticator reuses the session cookies of a browser that is already
+// signed in, for accounts that cannot log in with a password (e.g. GitHub
+// sign-in)
+type CookieAuthenticator struct {
+	Cookies string // "name=value; name2=value2"
+}
+
+func (a *CookieAuthenticator) Authenticate(client *http.Client, site Site) error {
+	siteURL, err := url.Parse(site.BaseURL())
+	if err != nil {
+		return err
+	}
+
+	var cookies []*http.Cookie
+	for _, pair := range strings.Split(a.Cookies, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || name == "" {
+			continue
+		}
+		cookies = append(cookies, &http.Cookie{Name: name, Value: value, Path: "/"})
+	}
+	if len(cookies) == 0 {
+		return fmt.Errorf("SESSION_COOKIES is empty, expected \"name=value; name2=value2\"")
+	}
+	client.Jar.SetCookies(siteURL, cookies)
+
+	signedIn, err := isSignedIn(client, site)
+	if err != nil {
+		return fmt.Errorf("failed to verify session: %v", err)
+	}
+	if !signedIn {
+		return fmt.Errorf("session cookies were rejected, copy them from the browser again")
+	}
+
+	fmt.Println("✓ Logged in with session cookies")
+	return nil
+}
+
+// TotpAuthenticator logs in with a password and answers the two-factor
+// challenge with a code generated from the account's TOTP secret
+type TotpAuthenticator struct {
+	PasswordAuthenticator
+	Secret string // base32 secret shown when enabling two-factor authentication
+}
+
+func (a *TotpAuthenticator) Authenticate(client *http.Client, site Site) error {
+	resp, err := a.login(client, site)
+	if err != nil {
+		return err
+	}
+
+	if resp.TwoFactor {
+		code, err := totpCode(a.Secret, time.Now())
+		if err != nil {
+			return err
+		}
+		if _, err := postJSON(client, site, site.Paths().TwoFactor, map[string]string{"code": code}); err != nil {
+			return fmt.Errorf("two-factor challenge failed: %w", err)
+		}
+	}
+
+	fmt.Printf("✓ Logged in as %s\n", a.Email)
+	return nil
+}
+
+// postJSON sends an XSRF-protected JSON request to a path of site and
+// returns the response body of a successful request. When Laracasts answers
+// 419 because the token expired or rotated, a fresh token is fetched and the
+// request sent again.
+func postJSON(client *http.Client, site Site, path string, payload interface{}) ([]byte, error) {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	token, err := xsrfToken(client, site)
+	if err != nil {
+		// Some CDNs drop the cookie from the first response
+		if token, err = refreshXSRFToken(client, site); err != nil {
+			return nil, err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest("POST", site.BaseURL()+path, bytes.NewReader(jsonData))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %v", err)
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("X-XSRF-TOKEN", token)
+		req.Header.Set("X-Requested-With", "XMLHttpRequest")
+		req.Header.Set("Referer", site.BaseURL())
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode == statusPageExpired && attempt < xsrfRetries {
+			fmt.Println("XSRF token expired, fetching a fresh one")
+			if token, err = refreshXSRFToken(client, site); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return nil, &statusError{
+				StatusCode: resp.StatusCode,
+				RetryAfter: retryAfter(resp.Header.Get("Retry-After")),
+				Body:       string(body),
+			}
+		}
+		return body, nil
+	}
+}
+
+// statusError is a request the site answered with an unsuccessful status
+type statusError struct {
+	StatusCode int
+	RetryAfter time.Duration // from the Retry-After header, zero without one
+	Body       string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.StatusCode, e.Body)
+}
+
+// retryAfter parses a Retry-After header, given in seconds or as a date
+func retryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+	return 0
+}
+
+// statusPageExpired is Laravel's status for a missing or mismatched XSRF token
+const statusPageExpired = 419
+
+const (
+	xsrfRetries    = 3                      // token fetches before giving up
+	xsrfRetryDelay = 500 * time.Millisecond // pause before the next fetch, growing with each
+)
+
+// refreshXSRFToken visits the home and login pages until the site sets an
+// XSRF-TOKEN cookie, retrying with a growing pause, and returns the token
+func refreshXSRFToken(client *http.Client, site Site) (string, error) {
+	var lastErr error
+	for attempt := 0; attempt < xsrfRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * xsrfRetryDelay)
+		}
+
+		for _, path := range []string{"", site.Paths().Login} {
+			if err := visitPage(client, site.BaseURL()+path); err != nil {
+				lastErr = err
+				continue
+			}
+			token, err := xsrfToken(client, site)
+			if err == nil {
+				return token, nil
+			}
+			lastErr = err
+		}
+	}
+	return "", fmt.Errorf("failed to get XSRF token after %d attempts: %v", xsrfRetries, lastErr)
+}
+
+// visitPage loads a page like a browser, only to receive its cookies
+func visitPage(client *http.Client, pageURL string) error {
+	req, err := http.NewRequest("GET", pageURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	for k, v := range config.DefaultHeaders {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed request: %v", err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// xsrfToken returns the decoded XSRF-TOKEN cookie from the client's jar
+func xsrfToken(client *http.Client, site Site) (string, error) {
+	siteURL, _ := url.Parse(site.BaseURL())
+	for _, cookie := range client.Jar.Cookies(siteURL) {
+		if cookie.Name == "XSRF-TOKEN" {
+			decoded, err := url.QueryUnescape(cookie.Value)
+			if err == nil {
+				return decoded, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("XSRF token not found in cookies")
+}
+
+// isSignedIn loads the home page and checks the Inertia auth props for a user
+func isSignedIn(client *http.Client, site Site) (bool, error) {
+	req, err := http.NewRequest("GET", site.BaseURL(), nil)
+	if err != nil {
+		return false, err
+	}
+	for k, v := range config.DefaultHeaders {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+
+	jsonData := extractPageJSON(body)
+	if jsonData == "" {
+		return false, fmt.Errorf("no page data on the home page")
+	}
+
+	if !json.Valid([]byte(jsonData)) {
+		return false, fmt.Errorf("failed to parse page data")
+	}
+	_, user := pageAuth(jsonData)
+	return user, nil
+}
+
+// totpCode generates the RFC 6238 code (SHA-1, 30 seconds, 6 digits) for a
+// base32 secret at time t
+func totpCode(secret string, t time.Time) (string, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "="))
+	if err != nil {
+		return "", fmt.Errorf("invalid TOTP_SECRET: %v", err)
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(t.Unix()/30))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", code%1000000), nil
+}
@@ -0,0 +1,205 @@
+package downloader_test
+
+import (
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/config"
+	"github.com/sajjadanwar0/laracasts-dl/internal/downloader"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sessionCookie returns the laravel_session cookie left in the downloader's jar
+func sessionCookie(t *testing.T, dl *downloader.Downloader) string {
+	t.Helper()
+
+	u, _ := url.Parse(config.LaracastsBaseUrl)
+	for _, cookie := range dl.Client.Jar.Cookies(u) {
+		if cookie.Name == "laravel_session" {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+func TestPasswordAuthenticator(t *testing.T) {
+	newMockLaracasts(t)
+
+	tests := []struct {
+		name     string
+		auth     downloader.PasswordAuthenticator
+		wantErr  bool
+		wantAuth bool
+	}{
+		{"valid credentials", downloader.PasswordAuthenticator{Email: mockEmail, Password: mockPassword}, false, true},
+		{"wrong password", downloader.PasswordAuthenticator{Email: mockEmail, Password: "wrong"}, true, false},
+		{"two-factor account", downloader.PasswordAuthenticator{Email: mockTOTPEmail, Password: mockPassword}, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dl := newTestDownloader(t, t.TempDir())
+
+			err := dl.Authenticate(&tt.auth)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Authenticate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := sessionCookie(t, dl) == mockSession; got != tt.wantAuth {
+				t.Errorf("signed in = %v, want %v", got, tt.wantAuth)
+			}
+		})
+	}
+}
+
+func TestCookieAuthenticator(t *testing.T) {
+	newMockLaracasts(t)
+
+	tests := []struct {
+		name    string
+		cookies string
+		wantErr bool
+	}{
+		{"valid session", "laravel_session=" + mockSession + "; remember_web=abc", false},
+		{"expired session", "laravel_session=expired", true},
+		{"no cookies", " ; ", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dl := newTestDownloader(t, t.TempDir())
+
+			err := dl.Authenticate(&downloader.CookieAuthenticator{Cookies: tt.cookies})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Authenticate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTotpAuthenticator(t *testing.T) {
+	newMockLaracasts(t)
+
+	tests := []struct {
+		name    string
+		secret  string
+		wantErr bool
+	}{
+		{"valid secret", mockTOTPSecret, false},
+		{"lowercase spaced secret", "jbsw y3dp ehpk 3pxp", false},
+		{"wrong secret", "GEZDGNBVGY3TQOJQ", true},
+		{"invalid secret", "not base32!", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dl := newTestDownloader(t, t.TempDir())
+
+			err := dl.Authenticate(&downloader.TotpAuthenticator{
+				PasswordAuthenticator: downloader.PasswordAuthenticator{Email: mockTOTPEmail, Password: mockPassword},
+				Secret:                tt.secret,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Authenticate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && sessionCookie(t, dl) != mockSession {
+				t.Error("session not established after the two-factor challenge")
+			}
+		})
+	}
+}
+
+func TestNewAuthenticatorSelectsMethod(t *testing.T) {
+	tests := []struct {
+		method  string
+		want    string
+		wantErr bool
+	}{
+		{"", "*downloader.PasswordAuthenticator", false},
+		{config.AuthMethodPassword, "*downloader.PasswordAuthenticator", false},
+		{config.AuthMethodCookie, "*downloader.CookieAuthenticator", false},
+		{config.AuthMethodTOTP, "*downloader.TotpAuthenticator", false},
+		{"oauth", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			t.Setenv("AUTH_METHOD", tt.method)
+
+			auth, err := downloader.NewAuthenticator()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewAuthenticator() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := fmt.Sprintf("%T", auth); !tt.wantErr && got != tt.want {
+				t.Errorf("NewAuthenticator() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginRefreshesXSRFToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		dropXSRF   int
+		expireXSRF int
+		wantErr    bool
+		wantHome   int
+	}{
+		{"cookie missing on the first visit", 1, 0, false, 2},
+		{"token expired", 0, 1, false, 2},
+		{"token never set", 10, 0, true, 3},
+		{"token keeps expiring", 0, 10, true, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newMockLaracasts(t)
+			server.dropXSRF, server.expireXSRF = tt.dropXSRF, tt.expireXSRF
+			dl := newTestDownloader(t, t.TempDir())
+
+			err := dl.Login(mockEmail, mockPassword)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Login() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := sessionCookie(t, dl) == mockSession; got == tt.wantErr {
+				t.Errorf("signed in = %v, want %v", got, !tt.wantErr)
+			}
+			if got := server.Hits("GET", "/"); got != tt.wantHome {
+				t.Errorf("home page visited %d times, want %d", got, tt.wantHome)
+			}
+		})
+	}
+}
+
+func TestLoginChecksClockSkew(t *testing.T) {
+	tests := []struct {
+		name     string
+		offset   time.Duration
+		password string
+		wantErr  bool
+		wantSkew bool // the error names the clock
+	}{
+		{"in sync", 0, mockPassword, false, false},
+		{"a few minutes off", -5 * time.Minute, mockPassword, false, false},
+		{"local clock hours ahead", -3 * time.Hour, mockPassword, false, false},
+		{"rejected with the local clock hours ahead", -3 * time.Hour, "wrong", true, true},
+		{"rejected with the local clock hours behind", 3 * time.Hour, "wrong", true, true},
+		{"rejected in sync", 0, "wrong", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newMockLaracasts(t)
+			server.clockOffset = tt.offset
+			dl := newTestDownloader(t, t.TempDir())
+
+			err := dl.Login(mockEmail, tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Login() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && strings.Contains(err.Error(), "system clock") != tt.wantSkew {
+				t.Errorf("Login() error = %v, want the clock named: %v", err, tt.wantSkew)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package downloader
+
+import (
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/fsutil"
+	"github.com/sajjadanwar0/laracasts-dl/internal/naming"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Layouts selectable with -layout
+const (
+	LayoutTopics  = "topics"  // series saved by topic, or by slug when downloaded alone
+	LayoutAuthors = "authors" // additionally linked under authors/<instructor>
+)
+
+// AuthorsDir is the folder of the authors layout inside the download path
+const AuthorsDir = "authors"
+
+// LinkAuthors links every downloaded series into authors/<instructor>/, once
+// for its instructor and once for each guest teaching some of its episodes.
+// The series stay where they were downloaded; the links only add a view by
+// teacher, so they can be rebuilt at any time.
+func (d *Downloader) LinkAuthors() error {
+	authorsDir := filepath.Join(d.BasePath, AuthorsDir)
+	if !d.Symlinks {
+		fmt.Printf("Not linking series by instructor in %s, the download path has no symlinks\n", authorsDir)
+		return nil
+	}
+	linked := 0
+
+	for _, key := range d.Cache.Keys("series_") {
+		var seriesData SeriesMetadata
+		if found, err := d.Cache.Get(key, &seriesData); err != nil || !found {
+			continue
+		}
+
+		seriesDir := d.downloadedSeriesDir(strings.TrimPrefix(key, "series_"), seriesData.Title)
+		if seriesDir == "" {
+			continue // not downloaded
+		}
+
+		for _, instructor := range seriesInstructors(&seriesData) {
+			link := filepath.Join(authorsDir, naming.Sanitize(instructor), filepath.Base(seriesDir))
+			if err := naming.Within(authorsDir, link); err != nil {
+				return err
+			}
+			if err := linkView(link, seriesDir); err != nil {
+				return fmt.Errorf("failed to link %s under %s: %v", seriesData.Title, instructor, err)
+			}
+			linked++
+		}
+	}
+
+	fmt.Printf("Linked %d series by instructor in %s\n", linked, authorsDir)
+	return nil
+}
+
+// downloadedSeriesDir returns the directory the series with slug was
+// downloaded to, or "" when it is not on disk
+func (d *Downloader) downloadedSeriesDir(slug, title string) string {
+	for _, dir := range d.seriesDirs(slug, title) {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+	}
+	return ""
+}
+
+// seriesInstructors returns the instructor of a series followed by the
+// guests teaching any of its episodes
+func seriesInstructors(seriesData *SeriesMetadata) []string {
+	seen := make(map[string]bool)
+	var instructors []string
+	add := func(name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			instructors = append(instructors, name)
+		}
+	}
+
+	add(seriesData.Instructor)
+	var guests []string
+	for _, chapter := range seriesData.Chapters {
+		for _, episode := range chapter.Episodes {
+			if episode.Instructor != "" && !seen[episode.Instructor] {
+				guests = append(guests, episode.Instructor)
+			}
+		}
+	}
+	sort.Strings(guests)
+	for _, guest := range guests {
+		add(guest)
+	}
+	return instructors
+}
+
+// linkView points link in the authors or collections layout at seriesDir,
+// replacing an outdated link but never a real directory someone put there
+func linkView(link, seriesDir string) error {
+	relPath, err := filepath.Rel(filepath.Dir(link), seriesDir)
+	if err != nil {
+		return err
+	}
+
+	if info, err := os.Lstat(link); err == nil {
+		if info.Mode()&os.ModeSymlink == 0 {
+			return fmt.Errorf("%s exists and is not a link", link)
+		}
+		if target, err := os.Readlink(link); err == nil && target == relPath {
+			return nil
+		}
+		if err := os.Remove(link); err != nil {
+			return err
+		}
+	}
+
+	if err := fsutil.MkdirAll(filepath.Dir(link)); err != nil {
+		return err
+	}
+	return fsutil.Symlink(relPath, link)
+}
@@ -0,0 +1,42 @@
+package downloader_test
+
+import (
+	"bytes"
+	"github.com/sajjadanwar0/laracasts-dl/internal/downloader"
+	"github.com/sajjadanwar0/laracasts-dl/internal/naming"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLinkAuthors(t *testing.T) {
+	newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+	// Linking twice keeps the links in place
+	for i := 0; i < 2; i++ {
+		if err := dl.LinkAuthors(); err != nil {
+			t.Fatalf("LinkAuthors() error = %v", err)
+		}
+	}
+
+	// The instructor and the guest of episode 2 both list the series
+	for _, instructor := range []string{"Jeffrey Way", "Taylor Otwell"} {
+		path := filepath.Join(downloadPath, downloader.AuthorsDir, naming.Sanitize(instructor), "laravel-basics", "02-routing-basics.mp4")
+		if got, err := os.ReadFile(path); err != nil || !bytes.Equal(got, mockVideo("1002-1080.mp4")) {
+			t.Errorf("series not linked under %s: %v", instructor, err)
+		}
+	}
+
+	readme, err := os.ReadFile(filepath.Join(downloadPath, "laravel-basics", "README.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(readme), "| 2 | Routing Basics (with Taylor Otwell) |") {
+		t.Errorf("README.md does not credit the guest instructor:\n%s", readme)
+	}
+}
@@ -0,0 +1,59 @@
+package downloader
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// ReadSlugList reads series slugs one per line. Blank lines and everything
+// after a "#" are ignored, and series and episode URLs are reduced to the
+// slug of their series, so a curated list can be kept with notes and links
+// copied from the browser.
+func ReadSlugList(r io.Reader) ([]string, error) {
+	var slugs []string
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		slug := strings.TrimPrefix(cleanSeriesSlug(line), "series/")
+		if slug == "" || seen[slug] {
+			continue
+		}
+		seen[slug] = true
+		slugs = append(slugs, slug)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read series list: %v", err)
+	}
+	return slugs, nil
+}
+
+// DownloadBatch downloads every series in slugs, continuing past failures
+func (d *Downloader) DownloadBatch(slugs []string) error {
+	PrintBox(fmt.Sprintf("Downloading %d series from list", len(slugs)))
+
+	slugs = append([]string(nil), slugs...)
+	d.orderSlugs(slugs)
+
+	var failed []string
+	for i, slug := range slugs {
+		fmt.Printf("\n[%d/%d] 📚 %s\n", i+1, len(slugs), slug)
+		if d.skipIgnored(slug, slug, filepath.Join(d.BasePath, checkpointSlug(slug))) {
+			continue
+		}
+		if err := d.DownloadSeries(slug); err != nil {
+			fmt.Printf("❌ Error processing series '%s': %v\n", slug, err)
+			failed = append(failed, slug)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to download %d of %d series: %s",
+			len(failed), len(slugs), strings.Join(failed, ", "))
+	}
+	return nil
+}
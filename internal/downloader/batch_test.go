@@ -0,0 +1,148 @@
+package downloader_test
+
+import (
+	"github.com/sajjadanwar0/laracasts-dl/internal/downloader"
+	"github.com/sajjadanwar0/laracasts-dl/internal/naming"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadSlugList(t *testing.T) {
+	list := `# Weekend plan
+laravel-basics
+  https://laracasts.com/series/removed-videos/  # watch first
+
+series/duplicate-titles
+laravel-basics
+https://laracasts.com/series/laravel-basics/episodes/3?autoplay=true
+https://laracasts.com/series/pest-datasets?tab=episodes
+`
+	got, err := downloader.ReadSlugList(strings.NewReader(list))
+	if err != nil {
+		t.Fatalf("ReadSlugList() error = %v", err)
+	}
+
+	want := []string{"laravel-basics", "removed-videos", "duplicate-titles", "pest-datasets"}
+	if !slices.Equal(got, want) {
+		t.Errorf("ReadSlugList() = %q, want %q", got, want)
+	}
+}
+
+func TestDownloadBatchContinuesPastFailures(t *testing.T) {
+	newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+
+	err := dl.DownloadBatch([]string{"no-such-series", "laravel-basics"})
+	if err == nil || !strings.Contains(err.Error(), "no-such-series") {
+		t.Errorf("DownloadBatch() error = %v, want the missing series reported", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(downloadPath, "laravel-basics", "03-controllers.mp4")); err != nil {
+		t.Errorf("series after the failing one not downloaded: %v", err)
+	}
+}
+
+func TestDownloadBatchLeavesOutIgnoredSeries(t *testing.T) {
+	server := newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+
+	// Watched and deleted on purpose
+	seriesDir := filepath.Join(downloadPath, "laravel-basics")
+	if err := os.MkdirAll(seriesDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(seriesDir, downloader.IgnoreMarker), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	dl.IgnoredSeries["no-such-series"] = true
+
+	if err := dl.DownloadBatch([]string{"series/no-such-series", "laravel-basics"}); err != nil {
+		t.Errorf("DownloadBatch() error = %v, want ignored series left out", err)
+	}
+	if hits := server.Hits("GET", "/series/laravel-basics"); hits != 0 {
+		t.Errorf("ignored series fetched %d times", hits)
+	}
+	if want := []string{"no-such-series", "laravel-basics"}; !slices.Equal(dl.Report.Ignored, want) {
+		t.Errorf("Report.Ignored = %v, want %v", dl.Report.Ignored, want)
+	}
+
+	// A single series asked for by name is still downloaded
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(seriesDir, "01-introduction-to-laravel.mp4")); err != nil {
+		t.Errorf("ignored series not downloaded when asked for: %v", err)
+	}
+}
+
+func TestDownloadBatchFindsIgnoreMarkerInDownloadedFolder(t *testing.T) {
+	server := newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	if err := dl.DownloadAllByTopics(); err != nil {
+		t.Fatalf("DownloadAllByTopics() error = %v", err)
+	}
+
+	// The marker is in the topic folder the series was downloaded to, not
+	// in the folder a download by slug would use
+	seriesDir := filepath.Join(downloadPath, "topics", naming.Sanitize("Laravel"), "laravel-basics")
+	if err := os.WriteFile(filepath.Join(seriesDir, downloader.IgnoreMarker), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	pages := server.Hits("GET", "/series/laravel-basics")
+	if err := dl.DownloadBatch([]string{"laravel-basics"}); err != nil {
+		t.Fatalf("DownloadBatch() error = %v", err)
+	}
+	if hits := server.Hits("GET", "/series/laravel-basics"); hits != pages {
+		t.Errorf("ignored series fetched %d more times", hits-pages)
+	}
+	if !slices.Contains(dl.Report.Ignored, "laravel-basics") {
+		t.Errorf("Report.Ignored = %v, want laravel-basics", dl.Report.Ignored)
+	}
+}
+
+func TestDownloadCollection(t *testing.T) {
+	newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	t.Setenv("COLLECTIONS", "interview-prep: laravel-basics, no-such-series | testing: duplicate-titles")
+	dl := signedInDownloader(t, downloadPath)
+	if err := dl.DownloadCollection("interview"); err == nil {
+		t.Error("DownloadCollection() of an undefined collection succeeded")
+	}
+
+	err := dl.DownloadCollection("interview-prep")
+	if err == nil || !strings.Contains(err.Error(), "no-such-series") {
+		t.Errorf("DownloadCollection() error = %v, want the missing series reported", err)
+	}
+	want := downloader.CollectionResult{Name: "interview-prep", Series: 2, Complete: 1, Incomplete: []string{"no-such-series"}}
+	if len(dl.Report.Collections) != 1 || !reflect.DeepEqual(dl.Report.Collections[0], want) {
+		t.Errorf("Report.Collections = %+v, want %+v", dl.Report.Collections, want)
+	}
+
+	// Series of a collection not downloaded yet are not linked
+	if err := dl.LinkCollections(); err != nil {
+		t.Fatalf("LinkCollections() error = %v", err)
+	}
+	video := filepath.Join(downloadPath, downloader.CollectionsDir, "interview-prep", "laravel-basics", "03-controllers.mp4")
+	if _, err := os.Stat(video); err != nil {
+		t.Errorf("series not linked into its collection: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(downloadPath, downloader.CollectionsDir, "testing", "duplicate-titles")); !os.IsNotExist(err) {
+		t.Errorf("series not downloaded linked into a collection: %v", err)
+	}
+
+	// A series taken out of a collection loses its link
+	dl.Collections["interview-prep"] = []string{"no-such-series"}
+	if err := dl.LinkCollections(); err != nil {
+		t.Fatalf("LinkCollections() error = %v", err)
+	}
+	if _, err := os.Lstat(filepath.Dir(video)); !os.IsNotExist(err) {
+		t.Errorf("link of a series taken out of its collection kept: %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package downloader
+
+import (
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/config"
+	"github.com/sajjadanwar0/laracasts-dl/internal/vimeo"
+	"net/http"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	benchBytes    = 16 * 1024 * 1024 // downloaded per worker count
+	benchRequests = 3                // laracasts.com requests, the median is reported
+	benchGain     = 1.1              // more workers must be this much faster to be recommended
+)
+
+// benchWorkers are the chunk concurrencies compared
+var benchWorkers = []int{1, 2, 4, 8, 16}
+
+// Bench measures the latency to laracasts.com and every Vimeo CDN, and the
+// throughput of ranged downloads at several concurrencies, then recommends a
+// chunk size and CHUNK_CONCURRENCY for this network. It uses a plain client
+// without the session, so nothing sent identifies the account.
+func (d *Downloader) Bench() error {
+	PrintBox("Benchmarking the network")
+
+	tlsConfig, err := config.GetTLSConfig()
+	if err != nil {
+		return err
+	}
+	network, err := config.GetNetworkPreference()
+	if err != nil {
+		return err
+	}
+	client := &http.Client{
+		Timeout: 60 * time.Second,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+			DialContext:     networkDialer(network),
+		},
+	}
+	v := vimeo.NewClient(client)
+
+	var samples []time.Duration
+	for i := 0; i < benchRequests; i++ {
+		latency, err := v.Latency(config.LaracastsBaseUrl)
+		if err != nil {
+			fmt.Printf("laracasts.com: %v\n", err)
+			break
+		}
+		samples = append(samples, latency)
+	}
+	if len(samples) > 0 {
+		sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+		fmt.Printf("\nlaracasts.com latency: %s\n", samples[len(samples)/2].Round(time.Millisecond))
+	}
+
+	videoConfig, err := v.GetVideoConfig(vimeo.BenchVideoID, "")
+	if err != nil {
+		return fmt.Errorf("failed to fetch the benchmark video: %v", err)
+	}
+
+	fmt.Printf("\nVimeo CDN latency:\n")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, cdn := range v.CDNLatencies(videoConfig) {
+		if cdn.Err != nil {
+			fmt.Fprintf(w, "  %s\t%v\n", cdn.Name, cdn.Err)
+		} else {
+			fmt.Fprintf(w, "  %s\t%s\n", cdn.Name, cdn.Latency.Round(time.Millisecond))
+		}
+	}
+	w.Flush()
+
+	url := vimeo.BenchURL(videoConfig)
+	if url == "" {
+		return fmt.Errorf("the benchmark video has no progressive file")
+	}
+
+	fmt.Printf("\nThroughput (%s per run):\n", formatBytes(benchBytes))
+	var bestWorkers int
+	var bestRate, maxRate float64
+	for _, workers := range benchWorkers {
+		rate, err := v.Throughput(url, benchBytes, workers)
+		if err != nil {
+			fmt.Printf("  %2d workers: %v\n", workers, err)
+			continue
+		}
+		fmt.Printf("  %2d workers: %s/s\n", workers, formatBytes(int64(rate)))
+
+		// Only recommend more connections when they pay off noticeably
+		if bestWorkers == 0 || rate > bestRate*benchGain {
+			bestWorkers, bestRate = workers, rate
+		}
+		maxRate = max(maxRate, rate)
+	}
+	if bestWorkers == 0 {
+		return fmt.Errorf("no throughput measurement succeeded")
+	}
+
+	// A chunk should take a few seconds per connection, so the request
+	// latency is small against its transfer time
+	perConnection := bestRate / float64(bestWorkers)
+	chunkMB := min(max(int(perConnection*5/1024/1024), 4), 64)
+
+	fmt.Printf("\nRecommendation for this network (best measured %s/s):\n", formatBytes(int64(maxRate)))
+	fmt.Printf("  CHUNK_CONCURRENCY=%d in .env\n", bestWorkers)
+	fmt.Printf("  -chunk-size %d\n", chunkMB)
+	return nil
+}
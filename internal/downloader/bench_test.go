@@ -0,0 +1,25 @@
+package downloader_test
+
+import (
+	"github.com/sajjadanwar0/laracasts-dl/internal/vimeo"
+	"testing"
+)
+
+func TestBench(t *testing.T) {
+	server := newMockLaracasts(t)
+	dl := newTestDownloader(t, t.TempDir())
+
+	benchVideo := vimeo.BenchVideoID
+	vimeo.BenchVideoID = "1001"
+	t.Cleanup(func() { vimeo.BenchVideoID = benchVideo })
+
+	if err := dl.Bench(); err != nil {
+		t.Fatalf("Bench() error = %v", err)
+	}
+	if hits := server.Hits("GET", "/files/1001-720.mp4"); hits == 0 {
+		t.Error("Bench() did not download the lowest quality file")
+	}
+	if hits := server.Hits("POST", "/sessions"); hits != 0 {
+		t.Errorf("Bench() signed in %d times, want an anonymous run", hits)
+	}
+}
@@ -3,13 +3,16 @@
 package downloader
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/sajjadanwar0/laracasts-dl/internal/config"
+	"github.com/sajjadanwar0/laracasts-dl/internal/fsutil"
+	"github.com/sajjadanwar0/laracasts-dl/internal/vimeo"
 	"html"
 	"io"
 	"net/http"
-	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -19,10 +22,12 @@ import (
 )
 
 type Bit struct {
-	Title   string
-	VimeoId string
-	Path    string
-	Series  struct {
+	ID        int
+	Title     string
+	VimeoId   string
+	VimeoHash string // of the signed player URL, for private videos
+	Path      string
+	Series    struct {
 		Title string
 	}
 	Author struct {
@@ -33,6 +38,7 @@ type Bit struct {
 
 type BitsDownloadState struct {
 	Completed map[string]bool `json:"completed"`
+	Dir       string          `json:"dir,omitempty"` // absolute bits directory
 	LastSync  time.Time       `json:"last_sync"`
 }
 
@@ -54,11 +60,17 @@ func (d *Downloader) saveBitsDownloadState(state *BitsDownloadState) error {
 }
 
 func (d *Downloader) DownloadAllBits() error {
-	printBox("Downloading all Laracasts Bits")
+	PrintBox("Downloading all Laracasts Bits")
+
+	lock, err := d.lock("bits")
+	if err != nil {
+		return fmt.Errorf("bits are being downloaded by another instance: %w", err)
+	}
+	defer lock.Unlock()
 
 	// Create bits directory in the base path
 	bitsDir := filepath.Join(d.BasePath, "bits")
-	if err := os.MkdirAll(bitsDir, 0755); err != nil {
+	if err := fsutil.MkdirAll(bitsDir); err != nil {
 		return fmt.Errorf("failed to create bits directory: %v", err)
 	}
 
@@ -75,31 +87,46 @@ func (d *Downloader) DownloadAllBits() error {
 	if err != nil {
 		fmt.Printf("Warning: Failed to load download state: %v\n", err)
 	}
+	if dir, err := filepath.Abs(bitsDir); err == nil && state.Dir != dir {
+		state.Dir = dir
+		if err := d.saveBitsDownloadState(state); err != nil {
+			fmt.Printf("Warning: Failed to save download state: %v\n", err)
+		}
+	}
 
-	// Count already downloaded bits
+	// Count already downloaded bits, none when forced to download them
+	// again; they stay completed until their new copy replaces the old one
 	var alreadyDownloaded int
 	for _, bit := range bits {
-		if state.Completed[bit.Path] {
+		if state.Completed[bit.Path] && !d.ForceDownload {
 			alreadyDownloaded++
 		}
 	}
 
+	// Series episodes on disk, for bits that are also part of a series
+	var episodes map[string]map[string]string
+	if d.DuplicatePolicy != config.DuplicatePolicyDownload {
+		episodes = d.buildOriginIndex()
+	}
+
+	d.Report.AddExistingBits(alreadyDownloaded)
 	fmt.Printf("Already downloaded: %d bits\n", alreadyDownloaded)
 	fmt.Printf("Remaining to download: %d bits\n", len(bits)-alreadyDownloaded)
 
 	// Create worker pool for concurrent downloads
-	sem := make(chan bool, MaxEpisodeWorkers)
+	sem := make(chan bool, d.Concurrency.Episodes)
 	var wg sync.WaitGroup
 	var (
 		completedBits int32
 		failedBits    int32
+		skippedBits   int32
 		mu            sync.Mutex
 	)
 
 	// Process each bit
 	for i, bit := range bits {
 		// Skip if already downloaded (from cache)
-		if state.Completed[bit.Path] {
+		if state.Completed[bit.Path] && !d.ForceDownload {
 			continue
 		}
 
@@ -114,15 +141,38 @@ func (d *Downloader) DownloadAllBits() error {
 			fmt.Printf("\n[%d/%d] 📹 Starting bit: %s\n", idx+1, len(bits), bit.Title)
 			mu.Unlock()
 
-			if err := d.downloadBit(bitsDir, bit); err != nil {
+			content, err := bit.content(bitsDir)
+			if err == nil {
+				err = d.downloadBit(content, bit, episodes)
+			}
+			if errors.Is(err, ErrMonthlyCapReached) {
+				d.Report.AddPaused()
+				atomic.AddInt32(&skippedBits, 1)
+				return
+			}
+			if err != nil {
+				failure := content.failure(err)
+				skipped := failure.Skipped
+				d.Report.AddFailure(failure)
+
 				mu.Lock()
-				fmt.Printf("❌ Error downloading bit '%s': %v\n", bit.Title, err)
+				if skipped {
+					fmt.Printf("⏭️  Skipping unavailable bit '%s': %v\n", bit.Title, err)
+				} else {
+					fmt.Printf("❌ Error downloading bit '%s': %v\n", bit.Title, err)
+				}
 				mu.Unlock()
-				atomic.AddInt32(&failedBits, 1)
+
+				if skipped {
+					atomic.AddInt32(&skippedBits, 1)
+				} else {
+					atomic.AddInt32(&failedBits, 1)
+				}
 				return
 			}
 
 			atomic.AddInt32(&completedBits, 1)
+			d.Report.AddBit()
 			mu.Lock()
 			fmt.Printf("✅ Completed bit: %s\n", bit.Title)
 			progress := fmt.Sprintf("\nProgress: %.1f%% (%d/%d) Bits Completed\n",
@@ -131,9 +181,6 @@ func (d *Downloader) DownloadAllBits() error {
 				len(bits)-alreadyDownloaded)
 			fmt.Print(progress)
 			mu.Unlock()
-
-			// Small delay between downloads
-			time.Sleep(500 * time.Millisecond)
 		}(i, bit)
 	}
 
@@ -149,6 +196,7 @@ func (d *Downloader) DownloadAllBits() error {
 	fmt.Printf("Previously Downloaded: %d\n", alreadyDownloaded)
 	fmt.Printf("Newly Downloaded: %d\n", completed)
 	fmt.Printf("Failed Downloads: %d\n", failed)
+	fmt.Printf("Unavailable (skipped): %d\n", atomic.LoadInt32(&skippedBits))
 
 	if failed > 0 {
 		return fmt.Errorf("%d bits failed to download", failed)
@@ -157,130 +205,202 @@ func (d *Downloader) DownloadAllBits() error {
 	return nil
 }
 
-// fetchBits retrieves all bits from all pages
+// bitsIndexKey is the cache key of the bits index
+const bitsIndexKey = "bits_index"
+
+// bitsIndex caches the bits listed across every page, newest first. While
+// NextPage is set, a fetch of all pages was interrupted before it and the
+// next one resumes there.
+type bitsIndex struct {
+	Bits      []Bit     `json:"bits"`
+	NextPage  int       `json:"next_page,omitempty"`
+	FetchedAt time.Time `json:"fetched_at"` // when the fetch of all pages started
+}
+
+// newestID returns the highest ID of the indexed bits, zero when the site
+// lists none
+func (index bitsIndex) newestID() int {
+	newest := 0
+	for _, bit := range index.Bits {
+		newest = max(newest, bit.ID)
+	}
+	return newest
+}
+
+// fetchBits retrieves all bits. The index cached by the last run only needs
+// the pages listing bits newer than its newest one; every page is fetched
+// again once it is older than SeriesCacheMaxAge, to drop removed bits.
 func (d *Downloader) fetchBits() ([]Bit, error) {
-	var allBits []Bit
-	page := 1
-	maxPages := 1
-	hasMore := true
+	var index bitsIndex
+	found, err := d.Cache.Get(bitsIndexKey, &index)
+	if err != nil {
+		fmt.Printf("Cache error: %v, fetching fresh data\n", err)
+		found = false
+	}
+	if d.RefreshMetadata || d.NoCache || time.Since(index.FetchedAt) > SeriesCacheMaxAge {
+		found = false
+	}
 
-	fmt.Println("Starting to fetch all bits...")
+	switch {
+	case found && index.NextPage > 0:
+		fmt.Printf("Resuming to fetch bits from page %d...\n", index.NextPage)
+	case found && index.newestID() > 0:
+		return d.fetchNewBits(index)
+	default:
+		index = bitsIndex{NextPage: 1, FetchedAt: time.Now()}
+		fmt.Println("Starting to fetch all bits...")
+	}
 
-	for hasMore {
+	for index.NextPage > 0 {
+		page := index.NextPage
 		fmt.Printf("\nFetching page %d...\n", page)
 		bits, totalPages, err := d.fetchBitsPage(page)
 		if err != nil {
 			return nil, fmt.Errorf("failed to fetch page %d: %v", page, err)
 		}
-
-		if maxPages == 1 {
-			maxPages = totalPages
-			fmt.Printf("Found %d total pages\n", maxPages)
+		if page == 1 {
+			fmt.Printf("Found %d total pages\n", totalPages)
 		}
-
-		allBits = append(allBits, bits...)
 		fmt.Printf("Found %d bits on page %d\n", len(bits), page)
 
-		page++
-		hasMore = page <= maxPages
-
-		if hasMore {
-			// Add a small delay between requests
-			time.Sleep(500 * time.Millisecond)
+		// Saved after every page, so an interrupted fetch resumes here
+		index.Bits = appendNewBits(index.Bits, bits)
+		index.NextPage = page + 1
+		if index.NextPage > totalPages {
+			index.NextPage = 0
+		}
+		if err := d.Cache.Set(bitsIndexKey, index); err != nil {
+			fmt.Printf("Warning: Failed to cache bits index: %v\n", err)
 		}
 	}
 
-	fmt.Printf("\nTotal bits found: %d\n", len(allBits))
-	return allBits, nil
+	fmt.Printf("\nTotal bits found: %d\n", len(index.Bits))
+	return index.Bits, nil
 }
 
-func (d *Downloader) fetchBitsPage(page int) ([]Bit, int, error) {
-	bitsURL := fmt.Sprintf("%s%s", config.LaracastsBaseUrl, config.LaracastsBitsPath)
-	if page > 1 {
-		bitsURL = fmt.Sprintf("%s?page=%d", bitsURL, page)
-	}
+// fetchNewBits adds the bits published since index was cached, fetching
+// pages until one lists a bit it has already
+func (d *Downloader) fetchNewBits(index bitsIndex) ([]Bit, error) {
+	newest := index.newestID()
+	fmt.Printf("Bits index cached %s ago, fetching bits newer than #%d...\n",
+		time.Since(index.FetchedAt).Round(time.Second), newest)
 
-	fmt.Printf("Fetching from URL: %s\n", bitsURL)
-
-	req, err := http.NewRequest("GET", bitsURL, nil)
-	if err != nil {
-		return nil, 0, fmt.Errorf("failed to create request: %v", err)
+	var added []Bit
+	for page, totalPages := 1, 1; page <= totalPages; page++ {
+		bits, pages, err := d.fetchBitsPage(page)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch page %d: %v", page, err)
+		}
+		totalPages = pages
+
+		seen := false
+		for _, bit := range bits {
+			if bit.ID > newest {
+				added = append(added, bit)
+			} else {
+				seen = true
+			}
+		}
+		if seen {
+			break
+		}
 	}
 
-	for k, v := range config.DefaultHeaders {
-		req.Header.Set(k, v)
+	index.Bits = appendNewBits(added, index.Bits)
+	if len(added) > 0 {
+		if err := d.Cache.Set(bitsIndexKey, index); err != nil {
+			fmt.Printf("Warning: Failed to cache bits index: %v\n", err)
+		}
 	}
 
-	resp, err := d.Client.Do(req)
-	if err != nil {
-		return nil, 0, fmt.Errorf("failed request: %v", err)
-	}
-	defer resp.Body.Close()
+	fmt.Printf("\nNew bits found: %d, total bits: %d\n", len(added), len(index.Bits))
+	return index.Bits, nil
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, 0, fmt.Errorf("failed to read response: %v", err)
+// appendNewBits appends the bits of more not in bits yet, as pages shift
+// while bits are published between two of them
+func appendNewBits(bits, more []Bit) []Bit {
+	seen := make(map[string]bool, len(bits))
+	for _, bit := range bits {
+		seen[bit.Path] = true
 	}
-
-	// Save raw response for debugging
-	err = os.WriteFile("bits_response.html", body, 0644)
-	if err != nil {
-		fmt.Printf("Warning: Failed to save debug file: %v\n", err)
-	}
-
-	// Extract JSON data from script tag
-	scriptPattern := regexp.MustCompile(`<script\s+id="page-data"\s+type="application/json"[^>]*>(.*?)</script>`)
-	matches := scriptPattern.FindSubmatch(body)
-
-	var jsonData string
-	if len(matches) > 1 {
-		jsonData = html.UnescapeString(string(matches[1]))
-	} else {
-		// Try alternative data-page attribute
-		dataPagePattern := regexp.MustCompile(`data-page="([^"]+)"`)
-		matches = dataPagePattern.FindSubmatch(body)
-		if len(matches) > 1 {
-			jsonData = html.UnescapeString(string(matches[1]))
+	for _, bit := range more {
+		if !seen[bit.Path] {
+			seen[bit.Path] = true
+			bits = append(bits, bit)
 		}
 	}
+	return bits
+}
 
-	if jsonData == "" {
-		return nil, 0, fmt.Errorf("could not find page data")
+// laracastsBit is an entry of the bits listed on a page of bits
+type laracastsBit struct {
+	ID       int    `json:"id"`
+	Title    string `json:"title"`
+	VimeoId  string `json:"vimeoId"`
+	VimeoURL string `json:"vimeoUrl"`
+	Path     string `json:"path"`
+	Series   struct {
+		Title string `json:"title"`
+	} `json:"series"`
+	Author struct {
+		Username string `json:"username"`
+	} `json:"author"`
+	LengthForHumans string `json:"lengthForHumans"`
+}
+
+// fetchBitsPage returns the bits listed on page and the number of pages.
+// The bits are either a plain list, on a single page, or paginated.
+func (d *Downloader) fetchBitsPage(page int) ([]Bit, int, error) {
+	if d.Site.Paths().Bits == "" {
+		return nil, 0, fmt.Errorf("%s has no bits", d.Site.Name())
 	}
+	bitsURL := fmt.Sprintf("%s%s", d.Site.BaseURL(), d.Site.Paths().Bits)
+	if page > 1 {
+		bitsURL = fmt.Sprintf("%s?page=%d", bitsURL, page)
+	}
+
+	fmt.Printf("Fetching from URL: %s\n", bitsURL)
 
-	// Save extracted JSON for debugging
-	err = os.WriteFile("bits_data_extracted.json", []byte(jsonData), 0644)
+	jsonData, err := d.fetchPageData(bitsURL)
 	if err != nil {
-		fmt.Printf("Warning: Failed to save debug JSON: %v\n", err)
+		return nil, 0, fmt.Errorf("could not find page data: %v", err)
 	}
 
 	var pageData struct {
 		Props struct {
-			Bits []struct {
-				ID      int    `json:"id"`
-				Title   string `json:"title"`
-				VimeoId string `json:"vimeoId"`
-				Path    string `json:"path"`
-				Series  struct {
-					Title string `json:"title"`
-				} `json:"series"`
-				Author struct {
-					Username string `json:"username"`
-				} `json:"author"`
-				LengthForHumans string `json:"lengthForHumans"`
-			} `json:"bits"`
+			Bits json.RawMessage `json:"bits"`
 		} `json:"props"`
 	}
-
 	if err := json.Unmarshal([]byte(jsonData), &pageData); err != nil {
-		return nil, 0, fmt.Errorf("failed to parse JSON data: %v, JSON: %s", err, jsonData)
+		return nil, 0, fmt.Errorf("failed to parse JSON data: %v", err)
 	}
 
+	var paginated struct {
+		Data     []laracastsBit `json:"data"`
+		LastPage int            `json:"last_page"`
+		Meta     struct {
+			LastPage int `json:"last_page"`
+		} `json:"meta"`
+	}
+	raw := bytes.TrimSpace(pageData.Props.Bits)
+	if len(raw) > 0 && raw[0] == '[' {
+		err = json.Unmarshal(raw, &paginated.Data)
+	} else if len(raw) > 0 {
+		err = json.Unmarshal(raw, &paginated)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to parse bits: %v", err)
+	}
+	totalPages := max(paginated.LastPage, paginated.Meta.LastPage, 1)
+
 	var bits []Bit
-	for _, rawBit := range pageData.Props.Bits {
+	for _, rawBit := range paginated.Data {
 		bit := Bit{
+			ID:              rawBit.ID,
 			Title:           rawBit.Title,
 			VimeoId:         rawBit.VimeoId,
+			VimeoHash:       vimeo.PlayerHash(rawBit.VimeoURL),
 			Path:            rawBit.Path,
 			Series:          struct{ Title string }(rawBit.Series),
 			Author:          struct{ Username string }(rawBit.Author),
@@ -290,7 +410,7 @@ func (d *Downloader) fetchBitsPage(page int) ([]Bit, int, error) {
 		fmt.Printf("Found bit: %s by %s (%s)\n", bit.Title, bit.Author.Username, bit.LengthForHumans)
 	}
 
-	return bits, 1, nil // Just one page since pagination info isn't in the JSON
+	return bits, totalPages, nil
 }
 
 func (d *Downloader) fetchBitDetails(bit *Bit) error {
@@ -300,7 +420,7 @@ func (d *Downloader) fetchBitDetails(bit *Bit) error {
 		episodePath = fmt.Sprintf("/episodes/%s", strings.TrimPrefix(episodePath, "/"))
 	}
 
-	episodeURL := fmt.Sprintf("%s%s", config.LaracastsBaseUrl, episodePath)
+	episodeURL := fmt.Sprintf("%s%s", d.Site.BaseURL(), episodePath)
 	fmt.Printf("\nFetching details from: %s\n", episodeURL)
 
 	// Create new request
@@ -314,7 +434,7 @@ func (d *Downloader) fetchBitDetails(bit *Bit) error {
 	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
 	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
 	req.Header.Set("Connection", "keep-alive")
-	req.Header.Set("Referer", config.LaracastsBaseUrl)
+	req.Header.Set("Referer", d.Site.BaseURL())
 	req.Header.Set("Cache-Control", "no-cache")
 
 	// Get XSRF token if available
@@ -351,12 +471,6 @@ func (d *Downloader) fetchBitDetails(bit *Bit) error {
 		return fmt.Errorf("failed to read response: %v", err)
 	}
 
-	// Save response for debugging
-	debugFile := fmt.Sprintf("debug_episode_%s.html", strings.TrimPrefix(episodePath, "/episodes/"))
-	if err := os.WriteFile(debugFile, body, 0644); err != nil {
-		fmt.Printf("Warning: Failed to save debug file: %v\n", err)
-	}
-
 	// Try to find vimeoId in the page content
 	bodyStr := string(body)
 
@@ -418,7 +532,9 @@ func extractVimeoIdFromJSON(jsonData string) string {
 	return ""
 }
 
-func (d *Downloader) downloadBit(bitsDir string, bit Bit) error {
+// downloadBit saves bit as content, unless it is one of the downloaded series
+// episodes and DuplicatePolicy deduplicates it
+func (d *Downloader) downloadBit(content Content, bit Bit, episodes map[string]map[string]string) error {
 	// Load download state
 	state, err := d.loadBitsDownloadState()
 	if err != nil {
@@ -426,38 +542,29 @@ func (d *Downloader) downloadBit(bitsDir string, bit Bit) error {
 	}
 
 	// Check if bit is already downloaded in cache
-	if state.Completed[bit.Path] {
+	if state.Completed[content.ID] && !d.ForceDownload {
 		fmt.Printf("Bit already downloaded (from cache): %s\n", bit.Title)
 		return nil
 	}
 
-	// Create series subdirectory if we have series info
-	var outputDir string
-	if bit.Series.Title != "" {
-		seriesDir := sanitizeFilename(bit.Series.Title)
-		outputDir = filepath.Join(bitsDir, seriesDir)
-		if err := os.MkdirAll(outputDir, 0755); err != nil {
-			return fmt.Errorf("failed to create series directory: %v", err)
-		}
-	} else {
-		outputDir = bitsDir
-	}
-
-	// Create filename with just title and duration
-	filename := sanitizeFilename(bit.Title)
-
-	if bit.LengthForHumans != "" {
-		filename += fmt.Sprintf(" (%s)", bit.LengthForHumans)
+	if err := fsutil.MkdirAll(filepath.Dir(content.Path)); err != nil {
+		return fmt.Errorf("failed to create series directory: %v", err)
 	}
-	filename += ".mp4"
-
-	outputPath := filepath.Join(outputDir, filename)
 
 	// Check if file already exists on disk
-	if info, err := os.Stat(outputPath); err == nil && info.Size() > 0 {
+	filename := filepath.Base(content.Path)
+	if d.variantsExist(content.Path) && !d.ForceDownload {
 		fmt.Printf("Bit already downloaded (from disk): %s\n", filename)
 		// Update cache state
-		state.Completed[bit.Path] = true
+		state.Completed[content.ID] = true
+		if err := d.saveBitsDownloadState(state); err != nil {
+			fmt.Printf("Warning: Failed to save download state: %v\n", err)
+		}
+		return nil
+	}
+
+	if !d.ForceDownload && d.dedupBit(episodes, bit, content.Path) {
+		state.Completed[content.ID] = true
 		if err := d.saveBitsDownloadState(state); err != nil {
 			fmt.Printf("Warning: Failed to save download state: %v\n", err)
 		}
@@ -467,19 +574,12 @@ func (d *Downloader) downloadBit(bitsDir string, bit Bit) error {
 	fmt.Printf("\nDownloading bit: %s\n", filename)
 	fmt.Printf("Using VimeoId: %s\n", bit.VimeoId)
 
-	// Get video configuration
-	videoConfig, err := d.Vimeo.GetVideoConfig(bit.VimeoId)
-	if err != nil {
-		return fmt.Errorf("failed to get video config: %v", err)
-	}
-
-	// Download the video
-	if err := d.Vimeo.DownloadVideo(videoConfig, outputPath); err != nil {
+	if err := d.downloadContent(content); err != nil {
 		return err
 	}
 
 	// Update cache state after successful download
-	state.Completed[bit.Path] = true
+	state.Completed[content.ID] = true
 	if err := d.saveBitsDownloadState(state); err != nil {
 		fmt.Printf("Warning: Failed to save download state: %v\n", err)
 	}
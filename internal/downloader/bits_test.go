@@ -0,0 +1,76 @@
+package downloader_test
+
+import (
+	"github.com/sajjadanwar0/laracasts-dl/internal/naming"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDownloadAllBitsFetchesOnlyNewPages(t *testing.T) {
+	server := newMockLaracasts(t)
+	downloadPath := t.TempDir()
+
+	download := func() {
+		t.Helper()
+		dl := signedInDownloader(t, downloadPath)
+		if err := dl.DownloadAllBits(); err != nil {
+			t.Fatalf("DownloadAllBits() error = %v", err)
+		}
+	}
+	countBits := func() int {
+		t.Helper()
+		var n int
+		filepath.WalkDir(filepath.Join(downloadPath, "bits"), func(path string, entry os.DirEntry, err error) error {
+			if err == nil && strings.HasSuffix(path, ".mp4") {
+				n++
+			}
+			return nil
+		})
+		return n
+	}
+
+	download()
+	if got := server.Hits("GET", "/bits"); got != 2 {
+		t.Errorf("first run fetched %d pages of bits, want 2", got)
+	}
+	if got := countBits(); got != 3 {
+		t.Fatalf("first run downloaded %d bits, want 3", got)
+	}
+
+	// The cached index covers every page but the first, which lists the bit
+	// published since
+	server.mu.Lock()
+	server.publishBit = true
+	server.mu.Unlock()
+	download()
+	if got := server.Hits("GET", "/bits"); got != 3 {
+		t.Errorf("second run fetched %d pages of bits, want 1", got-2)
+	}
+	if got := countBits(); got != 4 {
+		t.Errorf("second run left %d bits, want 4", got)
+	}
+	if _, err := os.Stat(filepath.Join(downloadPath, "bits", naming.Sanitize("Pest Datasets")+" (4m 2s).mp4")); err != nil {
+		t.Errorf("published bit not downloaded: %v", err)
+	}
+}
+
+func TestDownloadAllBitsRetriesLikeEpisodes(t *testing.T) {
+	server := newMockLaracasts(t)
+	server.overloadFile = "1002-1080.mp4"
+	server.overloadCount = 1
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	if err := dl.DownloadAllBits(); err != nil {
+		t.Fatalf("DownloadAllBits() error = %v", err)
+	}
+
+	path := filepath.Join(downloadPath, "bits", naming.Sanitize("Collection Pipelines")+" (3m 5s).mp4")
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("bit not downloaded on retry: %v", err)
+	}
+	if len(dl.Report.Failures) != 0 {
+		t.Errorf("Report.Failures = %+v, want none", dl.Report.Failures)
+	}
+}
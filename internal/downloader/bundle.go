@@ -0,0 +1,253 @@
+package downloader
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/config"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+)
+
+// bundleEvents is how many of the latest events go into a support bundle
+const bundleEvents = 1000
+
+// redacted replaces secrets in a support bundle
+const redacted = "[redacted]"
+
+// secretWords mark the settings whose values are secrets
+var secretWords = []string{"PASSWORD", "SECRET", "TOKEN", "COOKIE", "HEADERS", "KEY", "WEBHOOK"}
+
+var (
+	emailPattern    = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	userinfoPattern = regexp.MustCompile(`://[^/\s"@]+@`)
+	queryPattern    = regexp.MustCompile(`(https?://[^\s"?]+)\?[^\s"]*`)
+)
+
+// SupportBundle writes a zip to path for attaching to a GitHub issue: the
+// settings read from .env and the problems validating them, the latest
+// events of the event log, the report of the last run, the version and the
+// environment. The console output and HAR traces are not part of it.
+// Passwords, cookies, tokens, email addresses, signed URL parameters and the
+// home directory are redacted. It needs neither valid settings nor a
+// Downloader, so a configuration that keeps the tool from starting can be
+// reported too.
+func SupportBundle(path string, settings map[string]string, problems error) error {
+	r := newRedactor(settings)
+	basePath := config.GetDownloadPath()
+
+	var settingsText strings.Builder
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&settingsText, "%s=%s\n", name, r.setting(name, settings[name]))
+	}
+
+	validation := "no problems found\n"
+	if problems != nil {
+		validation = problems.Error() + "\n"
+	}
+
+	// Files missing before the first run are left out
+	names = []string{"config.env", "validation.txt", "version.txt", "environment.txt"}
+	files := map[string]string{
+		"config.env":      settingsText.String(),
+		"validation.txt":  r.text(validation),
+		"version.txt":     versionInfo(),
+		"environment.txt": r.text(environmentInfo(basePath)),
+	}
+	if events, err := latestLines(filepath.Join(basePath, ".cache", EventsFile), bundleEvents); err == nil {
+		names = append(names, EventsFile)
+		files[EventsFile] = r.text(events)
+	}
+	if report, err := os.ReadFile(filepath.Join(basePath, reportFile)); err == nil {
+		names = append(names, reportFile)
+		files[reportFile] = r.text(string(report))
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range names {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			return fmt.Errorf("failed to write the support bundle: %w", err)
+		}
+		if _, err := w.Write([]byte(files[name])); err != nil {
+			return fmt.Errorf("failed to write the support bundle: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to write the support bundle: %w", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to write the support bundle: %w", err)
+	}
+	return nil
+}
+
+// environmentInfo describes the system and the settings in effect, as far
+// as they are valid, for the download path basePath
+func environmentInfo(basePath string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "os: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&b, "cpus: %d\n", runtime.NumCPU())
+	fmt.Fprintf(&b, "ffmpeg: %s\n", ffmpegVersion())
+	fmt.Fprintf(&b, "site: %s\n", config.GetSite())
+	fmt.Fprintf(&b, "download path: %s\n", basePath)
+	if free, ok := freeSpace(basePath); ok {
+		fmt.Fprintf(&b, "free space: %s\n", formatBytes(free))
+	}
+	if c, err := config.GetConcurrency(); err == nil {
+		fmt.Fprintf(&b, "concurrency: %d topics, %d series, %d episodes, %d chunks, %d ffmpeg\n",
+			c.Topics, c.Series, c.Episodes, c.Chunks, c.FFmpeg)
+	}
+	for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY"} {
+		if os.Getenv(name) != "" || os.Getenv(strings.ToLower(name)) != "" {
+			fmt.Fprintf(&b, "%s: set\n", name)
+		}
+	}
+	return b.String()
+}
+
+// versionInfo describes the build of the running binary
+func versionInfo() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return fmt.Sprintf("go: %s\nbuild info unavailable\n", runtime.Version())
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "module: %s %s\n", info.Main.Path, info.Main.Version)
+	fmt.Fprintf(&b, "go: %s\n", info.GoVersion)
+	for _, setting := range info.Settings {
+		if strings.HasPrefix(setting.Key, "vcs.") {
+			fmt.Fprintf(&b, "%s: %s\n", setting.Key, setting.Value)
+		}
+	}
+	return b.String()
+}
+
+// ffmpegVersion is the first line of ffmpeg -version
+func ffmpegVersion() string {
+	output, err := exec.Command("ffmpeg", "-version").Output()
+	if err != nil {
+		return "not found"
+	}
+	line, _, _ := strings.Cut(string(output), "\n")
+	return strings.TrimSpace(line)
+}
+
+// latestLines returns the last n lines of the file at path
+func latestLines(path string, n int) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+		if len(lines) > n {
+			lines = lines[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	if len(lines) == 0 {
+		return "", nil
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// redactor removes secrets from the files of a support bundle
+type redactor struct {
+	secrets []string // values to replace wherever they appear
+	home    string
+}
+
+// newRedactor collects the secrets among settings and the environment
+func newRedactor(settings map[string]string) *redactor {
+	r := &redactor{}
+	if home, err := os.UserHomeDir(); err == nil && len(home) > 1 {
+		r.home = home
+	}
+
+	add := func(value string) {
+		if value = strings.TrimSpace(value); len(value) >= 6 {
+			r.secrets = append(r.secrets, value)
+		}
+	}
+	values := make(map[string]string, len(settings))
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		values[name] = value
+	}
+	for name, value := range settings {
+		values[name] = value
+	}
+	for name, value := range values {
+		if !secretSetting(name) {
+			continue
+		}
+		add(value)
+		// Cookies and headers are also redacted one value at a time
+		for _, part := range strings.Split(value, ";") {
+			if _, v, ok := strings.Cut(part, "="); ok {
+				add(v)
+			}
+		}
+	}
+
+	// The longest first, so no part of a secret is left behind
+	sort.Slice(r.secrets, func(i, j int) bool { return len(r.secrets[i]) > len(r.secrets[j]) })
+	return r
+}
+
+// secretSetting reports whether the value of the setting name is a secret
+func secretSetting(name string) bool {
+	for _, word := range secretWords {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// setting returns the value of the setting name to put in the bundle,
+// keeping empty values so unset secrets still show
+func (r *redactor) setting(name, value string) string {
+	if value != "" && secretSetting(name) {
+		return redacted
+	}
+	return r.text(value)
+}
+
+// text returns s without secrets, email addresses, URL credentials and
+// parameters, and with the home directory as ~
+func (r *redactor) text(s string) string {
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	s = userinfoPattern.ReplaceAllString(s, "://"+redacted+"@")
+	s = emailPattern.ReplaceAllString(s, redacted)
+	s = queryPattern.ReplaceAllString(s, "$1?"+redacted)
+	if r.home != "" {
+		s = strings.ReplaceAll(s, r.home, "~")
+	}
+	return s
+}
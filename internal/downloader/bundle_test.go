@@ -0,0 +1,77 @@
+package downloader_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"github.com/sajjadanwar0/laracasts-dl/internal/config"
+	"github.com/sajjadanwar0/laracasts-dl/internal/downloader"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSupportBundleRedactsSecrets(t *testing.T) {
+	server := newMockLaracasts(t)
+	server.forbidFile = "1002-1080.mp4"
+
+	dl := signedInDownloader(t, t.TempDir())
+	if err := dl.DownloadSeries("laravel-basics"); err == nil {
+		t.Fatal("DownloadSeries() error = nil, want the forbidden episode failed")
+	}
+	if err := dl.Report.Save(dl.BasePath); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	cookie := "laracasts_session=s3ss10nc00k1e"
+	path := filepath.Join(t.TempDir(), "bundle.zip")
+	problems := &config.ValidationError{Problems: []string{"VIDEO_QUALITY \"1081p\" is not supported"}}
+	if err := downloader.SupportBundle(path, map[string]string{
+		"EMAIL":           mockEmail,
+		"PASSWORD":        mockPassword,
+		"SESSION_COOKIES": cookie,
+		"VIDEO_QUALITY":   "1080p",
+		"TOTP_SECRET":     "",
+	}, problems); err != nil {
+		t.Fatalf("SupportBundle() error = %v", err)
+	}
+
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatalf("bundle is not a zip: %v", err)
+	}
+	defer zr.Close()
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		_, _ = buf.ReadFrom(rc)
+		rc.Close()
+		files[f.Name] = buf.String()
+
+		for _, secret := range []string{mockEmail, mockPassword, "s3ss10nc00k1e"} {
+			if strings.Contains(files[f.Name], secret) {
+				t.Errorf("%s contains %q", f.Name, secret)
+			}
+		}
+	}
+
+	for _, name := range []string{"config.env", "validation.txt", "version.txt", "environment.txt", downloader.EventsFile, "report.json"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("bundle has no %s", name)
+		}
+	}
+	for _, want := range []string{"PASSWORD=[redacted]\n", "SESSION_COOKIES=[redacted]\n", "VIDEO_QUALITY=1080p\n", "TOTP_SECRET=\n"} {
+		if !strings.Contains(files["config.env"], want) {
+			t.Errorf("config.env = %q, want it to contain %q", files["config.env"], want)
+		}
+	}
+	if !strings.Contains(files["report.json"], `"category": "access"`) {
+		t.Errorf("report.json = %q, want the failure of the forbidden episode", files["report.json"])
+	}
+	if !strings.Contains(files["validation.txt"], `VIDEO_QUALITY "1081p" is not supported`) {
+		t.Errorf("validation.txt = %q, want the problems of the settings", files["validation.txt"])
+	}
+}
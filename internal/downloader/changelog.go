@@ -0,0 +1,175 @@
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/fsutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	changelogFile       = "changelog.json"
+	changelogICalFile   = "changelog.ics"
+	changelogMaxEntries = 1000
+)
+
+// ChangelogEntry is a series or episode discovered since the previous run
+type ChangelogEntry struct {
+	Kind         string    `json:"kind"` // "series", "episode" or "reupload"
+	Series       string    `json:"series"`
+	SeriesSlug   string    `json:"series_slug"`
+	Title        string    `json:"title,omitempty"`
+	VimeoId      string    `json:"vimeo_id,omitempty"`
+	URL          string    `json:"url"`
+	DiscoveredAt time.Time `json:"discovered_at"`
+}
+
+// Changelog collects newly published content during a sync and appends it
+// to changelog.json (and optionally an iCal feed) in the download directory
+type Changelog struct {
+	mu      sync.Mutex
+	entries []ChangelogEntry
+	baseURL string // of the site the entries link to
+
+	// ICal also writes changelog.ics for calendar subscriptions
+	ICal bool
+}
+
+func (c *Changelog) add(entry ChangelogEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry.DiscoveredAt = time.Now()
+	c.entries = append(c.entries, entry)
+}
+
+// recordSeriesDiff adds the episodes of fresh that were added or re-uploaded
+// since the cached metadata
+func (c *Changelog) recordSeriesDiff(cleanSlug string, fresh *SeriesMetadata, diff seriesDiff) {
+	record := func(kind string, episode Episode) {
+		c.add(ChangelogEntry{
+			Kind:       kind,
+			Series:     fresh.Title,
+			SeriesSlug: cleanSlug,
+			Title:      episode.Title,
+			VimeoId:    episode.VimeoId,
+			URL:        fmt.Sprintf("%s/series/%s/episodes/%d", c.baseURL, cleanSlug, episode.Number),
+		})
+	}
+	for _, episode := range diff.added {
+		record("episode", episode)
+	}
+	for _, change := range diff.reuploaded {
+		record("reupload", change.after)
+	}
+}
+
+// recordNewSeries adds series of fresh that were not in the previous catalog
+func (c *Changelog) recordNewSeries(previous, fresh *Catalog) {
+	known := make(map[string]bool)
+	for _, series := range previous.Topics {
+		for _, s := range series {
+			known[s.Slug] = true
+		}
+	}
+
+	for _, series := range fresh.Topics {
+		for _, s := range series {
+			if known[s.Slug] {
+				continue
+			}
+			known[s.Slug] = true
+
+			cleanSlug := strings.TrimPrefix(cleanSeriesSlug(s.Slug), "series/")
+			c.add(ChangelogEntry{
+				Kind:       "series",
+				Series:     s.Title,
+				SeriesSlug: cleanSlug,
+				URL:        fmt.Sprintf("%s/series/%s", c.baseURL, cleanSlug),
+			})
+		}
+	}
+}
+
+// Save appends this run's entries to the changelog in basePath
+func (c *Changelog) Save(basePath string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) == 0 {
+		return nil
+	}
+
+	path := filepath.Join(basePath, changelogFile)
+
+	var all []ChangelogEntry
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &all); err != nil {
+			return fmt.Errorf("failed to parse %s: %v", changelogFile, err)
+		}
+	}
+
+	all = append(all, c.entries...)
+	if len(all) > changelogMaxEntries {
+		all = all[len(all)-changelogMaxEntries:]
+	}
+
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal changelog: %v", err)
+	}
+	if err := fsutil.WriteFile(path, data); err != nil {
+		return fmt.Errorf("failed to write changelog: %v", err)
+	}
+
+	fmt.Printf("\n🆕 %d new items since the last run (see %s)\n", len(c.entries), path)
+
+	if c.ICal {
+		icsPath := filepath.Join(basePath, changelogICalFile)
+		if err := fsutil.WriteFile(icsPath, []byte(changelogICal(all))); err != nil {
+			return fmt.Errorf("failed to write iCal feed: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// changelogICal renders entries as an iCalendar feed with one all-day event
+// per discovered item
+func changelogICal(entries []ChangelogEntry) string {
+	var b strings.Builder
+	b.WriteString("BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//laracasts-dl//changelog//EN\r\n")
+	b.WriteString("X-WR-CALNAME:New on Laracasts\r\n")
+
+	for _, e := range entries {
+		summary := "New series: " + e.Series
+		uid := fmt.Sprintf("series-%s@laracasts-dl", e.SeriesSlug)
+		switch e.Kind {
+		case "episode":
+			summary = fmt.Sprintf("New episode: %s (%s)", e.Title, e.Series)
+			uid = fmt.Sprintf("episode-%s-%s@laracasts-dl", e.SeriesSlug, e.VimeoId)
+		case "reupload":
+			summary = fmt.Sprintf("Re-uploaded episode: %s (%s)", e.Title, e.Series)
+			uid = fmt.Sprintf("reupload-%s-%s@laracasts-dl", e.SeriesSlug, e.VimeoId)
+		}
+
+		b.WriteString("BEGIN:VEVENT\r\n")
+		fmt.Fprintf(&b, "UID:%s\r\n", uid)
+		fmt.Fprintf(&b, "DTSTAMP:%s\r\n", e.DiscoveredAt.UTC().Format("20060102T150405Z"))
+		fmt.Fprintf(&b, "DTSTART;VALUE=DATE:%s\r\n", e.DiscoveredAt.Format("20060102"))
+		fmt.Fprintf(&b, "SUMMARY:%s\r\n", icalEscape(summary))
+		fmt.Fprintf(&b, "URL:%s\r\n", e.URL)
+		b.WriteString("END:VEVENT\r\n")
+	}
+
+	b.WriteString("END:VCALENDAR\r\n")
+	return b.String()
+}
+
+func icalEscape(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(text)
+}
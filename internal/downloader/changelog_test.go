@@ -0,0 +1,47 @@
+package downloader_test
+
+import (
+	"encoding/json"
+	"github.com/sajjadanwar0/laracasts-dl/internal/downloader"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestRefreshedSeriesFeedsChangelog(t *testing.T) {
+	server := newMockLaracasts(t)
+	server.republish = true
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	if err := dl.SyncMetadata("revised-course"); err != nil {
+		t.Fatalf("SyncMetadata() error = %v", err)
+	}
+
+	// The refreshed page retitles 1001, drops 1002, re-uploads Controllers
+	// as 1005 and adds 1006
+	dl = newTestDownloader(t, downloadPath)
+	dl.RefreshMetadata = true
+	if err := dl.SyncMetadata("revised-course"); err != nil {
+		t.Fatalf("refreshed SyncMetadata() error = %v", err)
+	}
+	if err := dl.Changelog.Save(downloadPath); err != nil {
+		t.Fatalf("Changelog.Save() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(downloadPath, "changelog.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []downloader.ChangelogEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Kind+" "+e.VimeoId+" "+e.Title)
+	}
+	if want := []string{"episode 1006 Middleware", "reupload 1005 Controllers"}; !slices.Equal(got, want) {
+		t.Errorf("changelog = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,134 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Chaos configures fault injection for checking that retries, fallbacks and
+// resuming recover from a misbehaving network. It is a developer tool and
+// not meant for real downloads.
+type Chaos struct {
+	Rate  float64       // probability that a request is disrupted
+	Delay time.Duration // longest slowdown added to a disrupted request
+	Seed  int64         // makes the sequence of faults reproducible
+}
+
+// errChaos is the connection failure injected by chaos mode
+var errChaos = errors.New("chaos: connection reset")
+
+// EnableChaos makes a fraction of all HTTP requests fail, slow down, get
+// rate limited or have their body cut short
+func (d *Downloader) EnableChaos(chaos Chaos) {
+	base := d.Client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	d.Client.Transport = &chaosTransport{
+		base:  base,
+		chaos: chaos,
+		rand:  rand.New(rand.NewSource(chaos.Seed)),
+	}
+	fmt.Printf("⚠️  Chaos mode: disrupting %.0f%% of requests\n", chaos.Rate*100)
+}
+
+// chaosTransport injects faults into requests passing through it
+type chaosTransport struct {
+	base  http.RoundTripper
+	chaos Chaos
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// Faults chaosTransport picks from for a disrupted request
+const (
+	chaosReset = iota
+	chaosTooManyRequests
+	chaosSlow
+	chaosTruncate
+	chaosFaults
+)
+
+var chaosNames = [chaosFaults]string{"resetting", "rate limiting", "slowing down", "truncating"}
+
+// next decides whether the request is disrupted and how
+func (t *chaosTransport) next() (fault int, disrupt bool, delay time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.rand.Float64() >= t.chaos.Rate {
+		return 0, false, 0
+	}
+	fault = t.rand.Intn(chaosFaults)
+	if t.chaos.Delay > 0 {
+		delay = time.Duration(t.rand.Int63n(int64(t.chaos.Delay)))
+	}
+	return fault, true, delay
+}
+
+func (t *chaosTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	fault, disrupt, delay := t.next()
+	if !disrupt {
+		return t.base.RoundTrip(req)
+	}
+
+	fmt.Printf("\n🐒 Chaos: %s %s %s\n", chaosNames[fault], req.Method, req.URL.Path)
+
+	switch fault {
+	case chaosReset:
+		return nil, errChaos
+
+	case chaosTooManyRequests:
+		return &http.Response{
+			Status:     "429 Too Many Requests",
+			StatusCode: http.StatusTooManyRequests,
+			Proto:      req.Proto,
+			ProtoMajor: req.ProtoMajor,
+			ProtoMinor: req.ProtoMinor,
+			Header:     http.Header{"Retry-After": {"1"}},
+			Body:       io.NopCloser(strings.NewReader("")),
+			Request:    req,
+		}, nil
+
+	case chaosSlow:
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		return t.base.RoundTrip(req)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.ContentLength <= 1 {
+		return resp, err
+	}
+	resp.Body = &truncatedBody{ReadCloser: resp.Body, remaining: resp.ContentLength / 2}
+	return resp, nil
+}
+
+// truncatedBody fails with an unexpected EOF after remaining bytes, like a
+// connection dropped halfway through a response
+type truncatedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
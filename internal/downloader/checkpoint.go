@@ -0,0 +1,192 @@
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/fsutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// CheckpointFile is where bulk downloads record their progress by
+	// default, in the download path
+	CheckpointFile = "checkpoint.json"
+
+	// DefaultCheckpointEvery is how many finished series a checkpoint is
+	// written after by default
+	DefaultCheckpointEvery = 10
+)
+
+// Checkpoints are kept per bulk download, a checkpoint of one does not
+// resume the other
+const (
+	checkpointTopics = "topics"
+	checkpointSeries = "series"
+)
+
+// Checkpoint records how far DownloadAllByTopics or DownloadAllSeries got, so
+// a bulk download interrupted by a reboot continues where it stopped
+type Checkpoint struct {
+	Mode string `json:"mode"`
+
+	// Topic is the index of the first topic not scraped yet; Topics keeps the
+	// series of every scraped topic so they are not fetched again
+	Topic  int                      `json:"topic,omitempty"`
+	Topics map[string][]TopicSeries `json:"topics,omitempty"`
+
+	// Completed lists the slugs of the series downloaded in full; series
+	// with videos paused by the monthly cap are left out
+	Completed []string  `json:"completed"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ResumeFrom makes the next bulk download skip what the checkpoint at path
+// records as done, and keep updating it
+func (d *Downloader) ResumeFrom(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read checkpoint: %v", err)
+	}
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return fmt.Errorf("failed to parse checkpoint %s: %v", path, err)
+	}
+	if checkpoint.Mode != checkpointTopics && checkpoint.Mode != checkpointSeries {
+		return fmt.Errorf("checkpoint %s has unknown mode %q", path, checkpoint.Mode)
+	}
+
+	d.resume = &checkpoint
+	d.Checkpoint = path
+	return nil
+}
+
+// checkpointer writes the checkpoint of a bulk download as it progresses
+type checkpointer struct {
+	path  string
+	every int
+
+	mu         sync.Mutex
+	checkpoint Checkpoint
+	done       map[string]bool // completed series
+	scraped    map[int]bool    // indexes of scraped topics
+	unsaved    int             // series completed since the last save
+}
+
+// newCheckpointer starts the checkpoint of a bulk download in mode, from the
+// checkpoint resumed if it was written by the same mode
+func (d *Downloader) newCheckpointer(mode string) *checkpointer {
+	c := &checkpointer{
+		path:       d.Checkpoint,
+		every:      d.CheckpointEvery,
+		checkpoint: Checkpoint{Mode: mode, Topics: make(map[string][]TopicSeries)},
+		done:       make(map[string]bool),
+		scraped:    make(map[int]bool),
+	}
+
+	if d.resume == nil {
+		return c
+	}
+	if d.resume.Mode != mode {
+		fmt.Printf("Warning: The checkpoint is of a download by %s, starting over\n", d.resume.Mode)
+		return c
+	}
+	for _, slug := range d.resume.Completed {
+		c.done[slug] = true
+	}
+	for name, series := range d.resume.Topics {
+		c.checkpoint.Topics[name] = series
+	}
+	c.checkpoint.Completed = append(c.checkpoint.Completed, d.resume.Completed...)
+	fmt.Printf("Resuming from checkpoint: %d topics scraped, %d series completed\n", len(d.resume.Topics), len(d.resume.Completed))
+	return c
+}
+
+// topicSeries returns the series of a topic scraped before the checkpoint
+func (c *checkpointer) topicSeries(name string) ([]TopicSeries, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	series, ok := c.checkpoint.Topics[name]
+	return series, ok
+}
+
+// topicScraped records the series of the topic at idx
+func (c *checkpointer) topicScraped(idx int, name string, series []TopicSeries) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checkpoint.Topics[name] = series
+	c.scraped[idx] = true
+	for c.scraped[c.checkpoint.Topic] {
+		c.checkpoint.Topic++
+	}
+}
+
+// skip reports whether the series was completed before the checkpoint
+func (c *checkpointer) skip(slug string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.done[checkpointSlug(slug)]
+}
+
+// seriesCompleted records a downloaded series, writing the checkpoint every
+// so many series
+func (c *checkpointer) seriesCompleted(slug string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	slug = checkpointSlug(slug)
+	if !c.done[slug] {
+		c.done[slug] = true
+		c.checkpoint.Completed = append(c.checkpoint.Completed, slug)
+	}
+	c.unsaved++
+	if c.every > 0 && c.unsaved >= c.every {
+		c.save()
+	}
+}
+
+// finish removes the checkpoint of a bulk download that completed, or
+// writes it for the next run to resume from
+func (c *checkpointer) finish(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.path == "" {
+		return
+	}
+	if err == nil {
+		if rmErr := os.Remove(c.path); rmErr != nil && !os.IsNotExist(rmErr) {
+			fmt.Printf("Warning: Failed to remove checkpoint: %v\n", rmErr)
+		}
+		return
+	}
+	c.save()
+	fmt.Printf("Progress saved, continue with -resume-from %s\n", c.path)
+}
+
+// save writes the checkpoint; the caller holds c.mu
+func (c *checkpointer) save() {
+	c.unsaved = 0
+	if c.path == "" {
+		return
+	}
+
+	c.checkpoint.UpdatedAt = time.Now()
+	sort.Strings(c.checkpoint.Completed)
+	data, err := json.MarshalIndent(c.checkpoint, "", "  ")
+	if err == nil {
+		err = fsutil.WriteFile(c.path, data)
+	}
+	if err != nil {
+		fmt.Printf("Warning: Failed to save checkpoint: %v\n", err)
+	}
+}
+
+// checkpointSlug drops the "series/" prefix listings may give slugs
+func checkpointSlug(slug string) string {
+	return strings.TrimPrefix(cleanSeriesSlug(slug), "series/")
+}
@@ -0,0 +1,84 @@
+package downloader_test
+
+import (
+	"encoding/json"
+	"github.com/sajjadanwar0/laracasts-dl/internal/downloader"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDownloadAllSeriesResumesFromCheckpoint(t *testing.T) {
+	server := newMockLaracasts(t)
+	// Both topics list laravel-basics, the second also a missing series
+	server.browsePage = "browse/catalog"
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	dl.CheckpointEvery = 1
+
+	if err := dl.DownloadAllSeries(); err == nil {
+		t.Fatal("DownloadAllSeries() succeeded, want no-such-series to fail")
+	}
+
+	checkpointPath := filepath.Join(downloadPath, downloader.CheckpointFile)
+	data, err := os.ReadFile(checkpointPath)
+	if err != nil {
+		t.Fatalf("checkpoint not kept after a failed run: %v", err)
+	}
+	var checkpoint downloader.Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(checkpoint.Completed, []string{"laravel-basics"}) {
+		t.Errorf("checkpoint = %+v, want laravel-basics completed", checkpoint)
+	}
+
+	resumed := newTestDownloader(t, downloadPath)
+	if err := resumed.ResumeFrom(checkpointPath); err != nil {
+		t.Fatalf("ResumeFrom() error = %v", err)
+	}
+	if err := resumed.Login(mockEmail, mockPassword); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	pages := server.Hits("GET", "/series/laravel-basics")
+	if err := resumed.DownloadAllSeries(); err == nil {
+		t.Fatal("resumed DownloadAllSeries() succeeded, want no-such-series to fail")
+	}
+	if hits := server.Hits("GET", "/series/laravel-basics"); hits != pages {
+		t.Errorf("completed series fetched again after resuming (%d requests)", hits-pages)
+	}
+}
+
+func TestDownloadAllSeriesKeepsPausedSeriesOutOfCheckpoint(t *testing.T) {
+	server := newMockLaracasts(t)
+	server.browsePage = "browse/catalog"
+	t.Setenv("MAX_MONTHLY_GB", "1")
+	downloadPath := t.TempDir()
+	dl := newTestDownloader(t, downloadPath)
+	dl.CheckpointEvery = 1
+	month := time.Now().Format("2006-01")
+	if err := dl.Cache.Set("catalog", downloader.Catalog{Usage: map[string]int64{month: 2 << 30}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dl.Login(mockEmail, mockPassword); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if err := dl.DownloadAllSeries(); err == nil {
+		t.Fatal("DownloadAllSeries() succeeded, want no-such-series to fail")
+	}
+
+	data, err := os.ReadFile(filepath.Join(downloadPath, downloader.CheckpointFile))
+	if err != nil {
+		t.Fatalf("checkpoint not kept after a failed run: %v", err)
+	}
+	var checkpoint downloader.Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		t.Fatal(err)
+	}
+	if len(checkpoint.Completed) != 0 {
+		t.Errorf("checkpoint.Completed = %v, want the paused series left to resume", checkpoint.Completed)
+	}
+}
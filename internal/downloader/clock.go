@@ -0,0 +1,75 @@
+package downloader
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// ClockSkewWarning is the difference to the site's clock past which a
+	// warning is printed: two-factor codes are only valid for 30 seconds
+	ClockSkewWarning = 30 * time.Second
+
+	// ClockSkewLimit is the difference past which a failed sign-in is put
+	// down to the clock, as the session cookies of the site would appear
+	// expired on arrival
+	ClockSkewLimit = time.Hour
+)
+
+// clockSkew is how far the local clock is ahead of the site's, measured from
+// the Date header of the first response of the site
+type clockSkew struct {
+	once     sync.Once
+	warnOnce sync.Once
+	skew     atomic.Int64 // nanoseconds
+	measured atomic.Bool
+}
+
+// observe measures the skew from resp unless it was measured already
+func (c *clockSkew) observe(resp *http.Response) {
+	if c == nil || c.measured.Load() {
+		return
+	}
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return
+	}
+	c.once.Do(func() {
+		c.skew.Store(int64(time.Since(date)))
+		c.measured.Store(true)
+	})
+}
+
+// get returns the skew, and whether a response of the site measured it
+func (c *clockSkew) get() (time.Duration, bool) {
+	return time.Duration(c.skew.Load()), c.measured.Load()
+}
+
+// checkClock warns when the local clock is off by more than ClockSkewWarning
+// from the site's. When signing in failed, it fails instead past
+// ClockSkewLimit, so a login rejected for the time shows up as such.
+func (d *Downloader) checkClock(signInFailed bool) error {
+	skew, ok := d.clock.get()
+	if !ok {
+		return nil
+	}
+
+	drift, direction := skew, "ahead of"
+	if skew < 0 {
+		drift, direction = -skew, "behind"
+	}
+	drift = drift.Round(time.Second)
+	switch {
+	case drift > ClockSkewLimit && signInFailed:
+		return fmt.Errorf("the system clock is %s %s %s, so its session cookies appear expired; sync the clock (e.g. timedatectl set-ntp true) and try again",
+			drift, direction, d.Site.Name())
+	case drift > ClockSkewWarning:
+		d.clock.warnOnce.Do(func() {
+			fmt.Printf("⚠️  The system clock is %s %s %s; sign-ins may fail, consider syncing it\n", drift, direction, d.Site.Name())
+		})
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package downloader
+
+import (
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/naming"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CollectionsDir is the folder inside the download path where every
+// collection defined in COLLECTIONS links the series it lists
+const CollectionsDir = "collections"
+
+// CollectionResult is how much of a collection a run left downloaded
+type CollectionResult struct {
+	Name       string   `json:"name"`
+	Series     int      `json:"series"`
+	Complete   int      `json:"complete"`
+	Incomplete []string `json:"incomplete,omitempty"` // slugs
+}
+
+// CollectionSlugs returns the series slugs of the collection called name
+func (d *Downloader) CollectionSlugs(name string) ([]string, error) {
+	slugs, ok := d.Collections[name]
+	if !ok {
+		if len(d.Collections) == 0 {
+			return nil, fmt.Errorf("unknown collection %q (define collections in COLLECTIONS)", name)
+		}
+		return nil, fmt.Errorf("unknown collection %q (defined: %s)", name, strings.Join(sortedKeys(d.Collections), ", "))
+	}
+	return slugs, nil
+}
+
+// DownloadCollection downloads the series of a collection like a list of
+// series, and records in the report how many of them are now complete
+func (d *Downloader) DownloadCollection(name string) error {
+	slugs, err := d.CollectionSlugs(name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("📚 Collection %s\n", name)
+	err = d.DownloadBatch(slugs)
+
+	result := CollectionResult{Name: name, Series: len(slugs)}
+	for _, slug := range slugs {
+		if d.Report.seriesComplete(checkpointSlug(slug)) {
+			result.Complete++
+		} else {
+			result.Incomplete = append(result.Incomplete, checkpointSlug(slug))
+		}
+	}
+	d.Report.AddCollection(result)
+	return err
+}
+
+// LinkCollections links the downloaded series of every collection into
+// collections/<name>/, next to the topics, dropping links to series the
+// collection no longer lists. Like the authors layout, the links only add a
+// view and are rebuilt on every run.
+func (d *Downloader) LinkCollections() error {
+	collectionsDir := filepath.Join(d.BasePath, CollectionsDir)
+	if !d.Symlinks {
+		fmt.Printf("Not linking collections in %s, the download path has no symlinks\n", collectionsDir)
+		return nil
+	}
+	linked := 0
+
+	for _, name := range sortedKeys(d.Collections) {
+		dir := filepath.Join(collectionsDir, naming.Sanitize(name))
+		if err := naming.Within(collectionsDir, dir); err != nil {
+			return err
+		}
+
+		wanted := make(map[string]bool)
+		for _, slug := range d.Collections[name] {
+			slug = checkpointSlug(slug)
+			var seriesData SeriesMetadata
+			if _, err := d.Cache.Get("series_"+slug, &seriesData); err != nil {
+				continue
+			}
+			seriesDir := d.downloadedSeriesDir(slug, seriesData.Title)
+			if seriesDir == "" {
+				continue // not downloaded yet
+			}
+
+			link := filepath.Join(dir, filepath.Base(seriesDir))
+			if err := linkView(link, seriesDir); err != nil {
+				return fmt.Errorf("failed to link %s into collection %s: %v", slug, name, err)
+			}
+			wanted[filepath.Base(seriesDir)] = true
+			linked++
+		}
+
+		entries, _ := os.ReadDir(dir)
+		for _, entry := range entries {
+			if entry.Type()&os.ModeSymlink != 0 && !wanted[entry.Name()] {
+				_ = os.Remove(filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+
+	fmt.Printf("Linked %d series into %d collections in %s\n", linked, len(d.Collections), collectionsDir)
+	return nil
+}
@@ -0,0 +1,83 @@
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/fsutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CompleteMarker is the file written into a series folder once every
+// selected episode of the series is downloaded, so external tools (media
+// scanners, backup jobs) can act on finished series only. It is removed
+// while further episodes of the series are downloading.
+const CompleteMarker = ".complete"
+
+// Completion is the content of CompleteMarker
+type Completion struct {
+	Series      string    `json:"series"` // slug
+	Title       string    `json:"title"`
+	CompletedAt time.Time `json:"completed_at"`
+	Episodes    int       `json:"episodes"`   // listed on the series page
+	Filtered    int       `json:"filtered"`   // left out by the episode filters
+	Downloaded  int       `json:"downloaded"` // by the run that completed it
+	Existing    int       `json:"existing"`   // downloaded by earlier runs
+}
+
+// ReadCompletion reads the CompleteMarker of the series folder dir, reporting
+// false when the series is not complete
+func ReadCompletion(dir string) (Completion, bool) {
+	var completion Completion
+	data, err := os.ReadFile(filepath.Join(dir, CompleteMarker))
+	if err != nil || json.Unmarshal(data, &completion) != nil {
+		return Completion{}, false
+	}
+	return completion, true
+}
+
+// markComplete writes the CompleteMarker of the series in outputDir when
+// result left nothing to download, keeping the one of an earlier run when
+// this one had nothing to add, and removes it otherwise. Failures only warn.
+func (d *Downloader) markComplete(outputDir string, result SeriesResult) {
+	path := filepath.Join(outputDir, CompleteMarker)
+	if result.Failed > 0 || result.Skipped > 0 {
+		d.clearComplete(outputDir)
+		return
+	}
+	if _, err := os.Stat(path); err == nil && result.Downloaded == 0 {
+		return
+	}
+
+	data, err := json.MarshalIndent(Completion{
+		Series:      result.Slug,
+		Title:       result.Title,
+		CompletedAt: time.Now(),
+		Episodes:    result.Total,
+		Filtered:    result.Filtered,
+		Downloaded:  result.Downloaded,
+		Existing:    result.Existing,
+	}, "", "  ")
+	if err != nil {
+		return
+	}
+
+	// Renamed into place, so a tool watching the folder never reads half of it
+	tmpPath := path + ".tmp"
+	if err := fsutil.WriteFile(tmpPath, append(data, '\n')); err != nil {
+		fmt.Printf("Warning: Failed to write %s: %v\n", CompleteMarker, err)
+		return
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		fmt.Printf("Warning: Failed to write %s: %v\n", CompleteMarker, err)
+	}
+}
+
+// clearComplete removes the CompleteMarker of the series in outputDir
+func (d *Downloader) clearComplete(outputDir string) {
+	if err := os.Remove(filepath.Join(outputDir, CompleteMarker)); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Warning: Failed to remove %s: %v\n", CompleteMarker, err)
+	}
+}
@@ -0,0 +1,178 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/fsutil"
+	"github.com/sajjadanwar0/laracasts-dl/internal/naming"
+	"github.com/sajjadanwar0/laracasts-dl/internal/vimeo"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// StagingPrefix starts the name of the hidden folder, next to a video, that
+// -force-download saves its new copy in until it is complete
+const StagingPrefix = ".redownload-"
+
+// Content is a single video to download, whichever section lists it. Series
+// episodes and bits are turned into Content and go through downloadContent,
+// which retries, checks sizes and reports failures the same way for both.
+type Content struct {
+	ID        string // key of the video in the download state of its section
+	Title     string
+	VimeoId   string
+	VimeoHash string // of the signed player URL, for private videos
+	Source    string // what lists it in reports: the series title, or "bits"
+	Path      string // file it is saved to, before any quality suffix
+}
+
+// content returns the episode of the series titled source, saved in outputDir
+func (episode Episode) content(source, outputDir string) Content {
+	return Content{
+		ID:        episode.VimeoId,
+		Title:     episode.Title,
+		VimeoId:   episode.VimeoId,
+		VimeoHash: episode.VimeoHash,
+		Source:    source,
+		Path:      filepath.Join(outputDir, episodeFilename(episode)),
+	}
+}
+
+// content returns the bit saved under bitsDir, in the folder of its series
+// if it has one. When that folder is not valid, the Content returned has no
+// Path but still names the bit, for reporting the failure.
+func (bit Bit) content(bitsDir string) (Content, error) {
+	content := Content{
+		ID:        bit.Path,
+		Title:     bit.Title,
+		VimeoId:   bit.VimeoId,
+		VimeoHash: bit.VimeoHash,
+		Source:    "bits",
+	}
+
+	outputDir := bitsDir
+	if bit.Series.Title != "" {
+		outputDir = filepath.Join(bitsDir, naming.Sanitize(bit.Series.Title))
+		if err := naming.Within(bitsDir, outputDir); err != nil {
+			return content, err
+		}
+	}
+
+	// Just the title and duration
+	filename := naming.Sanitize(bit.Title)
+	if bit.LengthForHumans != "" {
+		filename += fmt.Sprintf(" (%s)", bit.LengthForHumans)
+	}
+
+	content.Path = filepath.Join(outputDir, filename+".mp4")
+	return content, nil
+}
+
+// failure reports err downloading content, skipped when the video will not
+// come back by retrying
+func (content Content) failure(err error) Failure {
+	return Failure{
+		Source:      content.Source,
+		Title:       content.Title,
+		VimeoId:     content.VimeoId,
+		Reason:      err.Error(),
+		Category:    FailureCategory(err),
+		Skipped:     vimeo.IsPermanent(err),
+		NeedsFFmpeg: errors.Is(err, vimeo.ErrFFmpegMissing),
+	}
+}
+
+// removeSegments removes the HLS segments cached for every quality variant
+// of content
+func (d *Downloader) removeSegments(content Content) {
+	for _, v := range d.variants(content.Path) {
+		if err := d.Vimeo.RemoveHLSCache(v.Path); err != nil {
+			fmt.Printf("Warning: Failed to remove cached segments of %s: %v\n", content.Title, err)
+		}
+	}
+}
+
+// downloadContent saves content to its Path, retrying failed attempts
+func (d *Downloader) downloadContent(content Content) error {
+	maxRetries := 3
+	var err error
+	for i := 0; i < maxRetries; i++ {
+		err = d.tryDownload(content)
+		if err == nil {
+			return nil
+		}
+		// Removed or region-blocked videos will not come back by retrying,
+		// nor will space on a full disk, this month's download cap or a path
+		// outside the download directory
+		if vimeo.IsPermanent(err) {
+			// Segments cached by earlier attempts will not be used either
+			d.removeSegments(content)
+			return err
+		}
+		if isDiskError(err) || errors.Is(err, ErrMonthlyCapReached) || errors.Is(err, naming.ErrOutsideBase) {
+			return err
+		}
+		time.Sleep(time.Duration(i*i) * time.Second)
+	}
+	return fmt.Errorf("failed after %d retries: %w", maxRetries, err)
+}
+
+func (d *Downloader) tryDownload(content Content) error {
+	if d.ForceDownload {
+		return d.redownload(content)
+	}
+
+	// A file on disk the download state does not know yet is compared with
+	// the remote file once, reporting a mismatch; it is only replaced with
+	// RedownloadMismatched. Completed episodes are rechecked with it alone.
+	if d.variantsExist(content.Path) && !d.checkSizes(content.Title, content.VimeoId, content.Path) {
+		return nil
+	}
+
+	// Ensure the directory exists
+	if err := fsutil.MkdirAll(filepath.Dir(content.Path)); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	d.rememberPlayerHash(content.VimeoId, content.VimeoHash)
+	return d.downloadVideo(content.VimeoId, content.Path)
+}
+
+// redownload downloads content again into a staging folder next to its Path,
+// and only once every variant is complete trashes the videos there and moves
+// the new ones into place, so a failed or paused download keeps the old copy
+func (d *Downloader) redownload(content Content) error {
+	dir := filepath.Dir(content.Path)
+	staged := filepath.Join(dir, StagingPrefix+filepath.Base(content.Path), filepath.Base(content.Path))
+	if err := fsutil.MkdirAll(filepath.Dir(staged)); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	defer os.Remove(filepath.Dir(staged)) // once empty
+
+	// Left by an attempt that failed, maybe incomplete
+	for _, v := range d.variants(staged) {
+		if path, ok := d.existingVideo(v.Path); ok {
+			os.Remove(path)
+		}
+	}
+
+	d.rememberPlayerHash(content.VimeoId, content.VimeoHash)
+	if err := d.downloadVideo(content.VimeoId, staged); err != nil {
+		return err
+	}
+
+	d.trashVideos(content.Path)
+	for _, v := range d.variants(staged) {
+		path, ok := d.existingVideo(v.Path)
+		if !ok {
+			continue
+		}
+		target := filepath.Join(dir, filepath.Base(path))
+		if err := os.Rename(path, target); err != nil {
+			return fmt.Errorf("failed to move the new download into place: %w", err)
+		}
+		d.hashed.move(path, target)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package downloader
+
+import (
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/config"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dedupBit handles a bit whose video is already on disk as a series episode,
+// per DuplicatePolicy. The bit is matched by its Vimeo ID against index from
+// buildOriginIndex, which also says where the episode is, as series may be
+// saved in either layout and container. It reports whether the bit needs no
+// download.
+func (d *Downloader) dedupBit(index map[string]map[string]string, bit Bit, outputPath string) bool {
+	if d.DuplicatePolicy == config.DuplicatePolicyDownload || bit.VimeoId == "" {
+		return false
+	}
+
+	// Every quality has to be on disk, otherwise the bit is downloaded
+	variants := d.variants(outputPath)
+	sources := make([]string, len(variants))
+	for i, v := range variants {
+		source, ok := index[bit.VimeoId][v.Quality]
+		if !ok {
+			return false
+		}
+		sources[i] = source
+	}
+
+	var saved int64
+	for i, v := range variants {
+		info, err := os.Stat(sources[i])
+		if err != nil {
+			return false
+		}
+
+		if d.DuplicatePolicy == config.DuplicatePolicyHardlink {
+			// Keep the container of the episode, which may be MKV
+			target := strings.TrimSuffix(v.Path, filepath.Ext(v.Path)) + filepath.Ext(sources[i])
+			if err := os.Link(sources[i], target); err != nil && !os.IsExist(err) {
+				fmt.Printf("Warning: Failed to hardlink %s, downloading it instead: %v\n", filepath.Base(target), err)
+				return false
+			}
+		}
+		saved += info.Size()
+	}
+
+	if d.DuplicatePolicy == config.DuplicatePolicyHardlink {
+		fmt.Printf("🔗 Linked bit %s to the series episode %s\n", bit.Title, d.relativePath(sources[0]))
+	} else {
+		fmt.Printf("⏭️  Skipping bit %s, already downloaded as %s\n", bit.Title, d.relativePath(sources[0]))
+	}
+	d.Report.AddDuplicate(saved)
+	return true
+}
@@ -0,0 +1,193 @@
+package downloader_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/sajjadanwar0/laracasts-dl/internal/config"
+	"github.com/sajjadanwar0/laracasts-dl/internal/downloader"
+	"github.com/sajjadanwar0/laracasts-dl/internal/naming"
+	"github.com/sajjadanwar0/laracasts-dl/internal/vimeo"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// duplicateBits maps the bits of the mock server that share their Vimeo ID
+// with a laravel-basics episode to that episode, both relative to the
+// download path
+var duplicateBits = map[string]string{
+	filepath.Join("bits", naming.Sanitize("Blade Components")+" (1m 40s).mp4"):                                       filepath.Join("laravel-basics", "01-introduction-to-laravel.mp4"),
+	filepath.Join("bits", naming.Sanitize("Collection Pipelines")+" (3m 5s).mp4"):                                    filepath.Join("laravel-basics", "02-routing-basics.mp4"),
+	filepath.Join("bits", naming.Sanitize("Laravel Basics"), naming.Sanitize("Route Model Binding")+" (2m 10s).mp4"): filepath.Join("laravel-basics", "03-controllers.mp4"),
+}
+
+// downloadSeriesThenBits downloads laravel-basics, then every bit with a new
+// downloader set to policy, which it returns
+func downloadSeriesThenBits(t *testing.T, downloadPath, policy string, configure func(*downloader.Downloader)) *downloader.Downloader {
+	t.Helper()
+
+	dl := signedInDownloader(t, downloadPath)
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+
+	dl = signedInDownloader(t, downloadPath)
+	dl.DuplicatePolicy = policy
+	if configure != nil {
+		configure(dl)
+	}
+	if err := dl.DownloadAllBits(); err != nil {
+		t.Fatalf("DownloadAllBits() error = %v", err)
+	}
+	return dl
+}
+
+func sameFile(t *testing.T, a, b string) bool {
+	t.Helper()
+	infoA, err := os.Stat(a)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	return os.SameFile(infoA, infoB)
+}
+
+func TestDownloadAllBitsHardlinksSeriesEpisodes(t *testing.T) {
+	server := newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := downloadSeriesThenBits(t, downloadPath, config.DuplicatePolicyHardlink, nil)
+
+	for bit, episode := range duplicateBits {
+		if !sameFile(t, filepath.Join(downloadPath, bit), filepath.Join(downloadPath, episode)) {
+			t.Errorf("%s is not a hardlink of %s", bit, episode)
+		}
+	}
+	if hits := server.HitsWithPrefix("GET", "/files/"); hits != len(duplicateBits) {
+		t.Errorf("made %d video requests, want only the %d of the series", hits, len(duplicateBits))
+	}
+
+	want := downloader.DedupStats{Videos: len(duplicateBits), BytesSaved: int64(len(duplicateBits) * mockVideoSize)}
+	if dl.Report.Dedup != want {
+		t.Errorf("Report.Dedup = %+v, want %+v", dl.Report.Dedup, want)
+	}
+
+	// The space saved is part of the saved report
+	if err := dl.Report.Save(downloadPath); err != nil {
+		t.Fatalf("Report.Save() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(downloadPath, "report.json"))
+	if err != nil {
+		t.Fatalf("report not saved: %v", err)
+	}
+	var report struct {
+		Dedup *downloader.DedupStats `json:"dedup"`
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if report.Dedup == nil || *report.Dedup != want {
+		t.Errorf("report.json dedup = %+v, want %+v", report.Dedup, want)
+	}
+}
+
+func TestDownloadAllBitsSkipsSeriesEpisodes(t *testing.T) {
+	server := newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := downloadSeriesThenBits(t, downloadPath, config.DuplicatePolicySkip, nil)
+
+	for bit := range duplicateBits {
+		if _, err := os.Stat(filepath.Join(downloadPath, bit)); !os.IsNotExist(err) {
+			t.Errorf("%s stored although the policy skips duplicates", bit)
+		}
+	}
+	if hits := server.HitsWithPrefix("GET", "/files/"); hits != len(duplicateBits) {
+		t.Errorf("made %d video requests, want only the %d of the series", hits, len(duplicateBits))
+	}
+
+	want := downloader.DedupStats{Videos: len(duplicateBits), BytesSaved: int64(len(duplicateBits) * mockVideoSize)}
+	if dl.Report.Dedup != want {
+		t.Errorf("Report.Dedup = %+v, want %+v", dl.Report.Dedup, want)
+	}
+}
+
+func TestDownloadAllBitsDownloadsSeriesEpisodes(t *testing.T) {
+	server := newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := downloadSeriesThenBits(t, downloadPath, config.DuplicatePolicyDownload, nil)
+
+	for bit, episode := range duplicateBits {
+		if sameFile(t, filepath.Join(downloadPath, bit), filepath.Join(downloadPath, episode)) {
+			t.Errorf("%s is a hardlink of %s, want a separate copy", bit, episode)
+		}
+	}
+	if hits := server.HitsWithPrefix("GET", "/files/"); hits != 2*len(duplicateBits) {
+		t.Errorf("made %d video requests, want %d for the series and its bits", hits, 2*len(duplicateBits))
+	}
+	if dl.Report.Dedup != (downloader.DedupStats{}) {
+		t.Errorf("Report.Dedup = %+v, want none", dl.Report.Dedup)
+	}
+}
+
+func TestDownloadAllBitsDownloadsPartialDuplicates(t *testing.T) {
+	server := newMockLaracasts(t)
+	downloadPath := t.TempDir()
+
+	// The series has only the 1080p variant of each episode
+	dl := downloadSeriesThenBits(t, downloadPath, config.DuplicatePolicyHardlink, func(dl *downloader.Downloader) {
+		dl.Qualities = []string{"720p", "1080p"}
+	})
+
+	var links int
+	filepath.WalkDir(filepath.Join(downloadPath, "bits"), func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || filepath.Ext(path) != ".mp4" {
+			return nil
+		}
+		for _, episode := range duplicateBits {
+			if sameFile(t, path, filepath.Join(downloadPath, episode)) {
+				links++
+			}
+		}
+		return nil
+	})
+	if links != 0 {
+		t.Errorf("linked %d variants of bits missing a quality in the series, want them downloaded", links)
+	}
+	if hits := server.HitsWithPrefix("GET", "/files/"); hits != 3*len(duplicateBits) {
+		t.Errorf("made %d video requests, want %d for the series and both qualities of its bits", hits, 3*len(duplicateBits))
+	}
+	if dl.Report.Dedup != (downloader.DedupStats{}) {
+		t.Errorf("Report.Dedup = %+v, want none", dl.Report.Dedup)
+	}
+}
+
+func TestDownloadAllBitsLinksInTheContainerOfTheEpisode(t *testing.T) {
+	newMockLaracasts(t)
+	downloadPath := t.TempDir()
+
+	dl := downloadSeriesThenBits(t, downloadPath, config.DuplicatePolicyHardlink, func(dl *downloader.Downloader) {
+		// The first episode was remuxed into MKV
+		episode := filepath.Join(downloadPath, "laravel-basics", "01-introduction-to-laravel.mp4")
+		if err := os.Rename(episode, vimeo.ContainerPath(episode, vimeo.ContainerMKV)); err != nil {
+			t.Fatal(err)
+		}
+		dl.Vimeo.Container = vimeo.ContainerMKV
+	})
+
+	bit := filepath.Join(downloadPath, "bits", naming.Sanitize("Blade Components")+" (1m 40s).mkv")
+	episode := filepath.Join(downloadPath, "laravel-basics", "01-introduction-to-laravel.mkv")
+	if !sameFile(t, bit, episode) {
+		t.Errorf("%s is not a hardlink of %s", bit, episode)
+	}
+	if _, err := os.Stat(filepath.Join(downloadPath, "bits", naming.Sanitize("Blade Components")+" (1m 40s).mp4")); !os.IsNotExist(err) {
+		t.Errorf("bit linked as MP4 although the episode is MKV")
+	}
+	if got, err := os.ReadFile(bit); err != nil || !bytes.Equal(got, mockVideo("1001-1080.mp4")) {
+		t.Errorf("linked bit does not hold the episode (%v)", err)
+	}
+	if dl.Report.Dedup.Videos != len(duplicateBits) {
+		t.Errorf("Report.Dedup.Videos = %d, want %d", dl.Report.Dedup.Videos, len(duplicateBits))
+	}
+}
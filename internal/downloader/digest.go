@@ -0,0 +1,214 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/config"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// emailTimeout bounds sending the summary, so a mail server that stops
+// answering cannot keep an unattended run from exiting
+const emailTimeout = time.Minute
+
+// EmailSummary emails a digest of the run to SummaryEmail, for unattended
+// runs nobody reads the output of: the outcome, the new episodes, the
+// failures and how much the download path grew. runErr is the error the run
+// ended with, e.g. a failed login, nil when it finished. It does nothing
+// when SummaryEmail is nil.
+func (d *Downloader) EmailSummary(runErr error) error {
+	if d.SummaryEmail == nil {
+		return nil
+	}
+
+	var disk string
+	if free, ok := freeSpace(d.BasePath); ok && d.startFree > 0 {
+		change := "used"
+		delta := d.startFree - free
+		if delta < 0 {
+			change, delta = "freed", -delta
+		}
+		disk = fmt.Sprintf("Disk: %s %s during the run, %s free\n", formatBytes(delta), change, formatBytes(free))
+	}
+	subject, body := d.Report.digest(runErr)
+	if err := sendEmail(d.SummaryEmail, subject, body+disk); err != nil {
+		return fmt.Errorf("failed to email the summary: %w", err)
+	}
+	fmt.Printf("📧 Summary emailed to %s\n", strings.Join(d.SummaryEmail.To, ", "))
+	return nil
+}
+
+// digest returns the subject and body of the summary email of a run that
+// ended with runErr
+func (r *Report) digest(runErr error) (string, string) {
+	outcome := r.Outcome(runErr)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Laracasts download finished at %s: %s\n\n", time.Now().Format("2006-01-02 15:04"), outcome)
+	if runErr != nil {
+		fmt.Fprintf(&body, "Error: %v\n\n", runErr)
+	}
+
+	total := r.totals()
+	if total.Downloaded > 0 {
+		fmt.Fprintf(&body, "New episodes: %d (%s)\n", total.Downloaded, formatBytes(total.Bytes))
+		for _, s := range r.Series {
+			if s.Downloaded > 0 {
+				fmt.Fprintf(&body, "- %s: %d\n", s.Title, s.Downloaded)
+			}
+		}
+		body.WriteString("\n")
+	}
+	if r.Bits > 0 {
+		fmt.Fprintf(&body, "New bits: %d\n\n", r.Bits)
+	}
+	if total.Downloaded == 0 && r.Bits == 0 {
+		body.WriteString("Nothing new was downloaded.\n\n")
+	}
+
+	var failed, skipped []Failure
+	for _, f := range r.Failures {
+		if f.Skipped {
+			skipped = append(skipped, f)
+		} else {
+			failed = append(failed, f)
+		}
+	}
+	if len(failed) > 0 {
+		fmt.Fprintf(&body, "Failed videos: %d\n", len(failed))
+		for _, f := range failed {
+			fmt.Fprintf(&body, "- [%s] %s (%s): %s\n", f.Source, f.Title, f.Category, f.Reason)
+		}
+		body.WriteString("\n")
+	}
+	if len(skipped) > 0 {
+		fmt.Fprintf(&body, "Unavailable videos skipped: %d\n\n", len(skipped))
+	}
+	if r.Paused > 0 {
+		fmt.Fprintf(&body, "The monthly download cap is reached, %d videos are left for next month\n\n", r.Paused)
+	}
+
+	var news []string
+	if total.Downloaded > 0 {
+		news = append(news, fmt.Sprintf("%d new episodes", total.Downloaded))
+	}
+	if r.Bits > 0 {
+		news = append(news, fmt.Sprintf("%d new bits", r.Bits))
+	}
+	if len(failed) > 0 {
+		news = append(news, fmt.Sprintf("%d failed", len(failed)))
+	}
+	if len(news) == 0 && outcome == OutcomeFailed {
+		news = append(news, "failed")
+	}
+	if len(news) == 0 {
+		news = append(news, "nothing new")
+	}
+	return "Laracasts: " + strings.Join(news, ", "), body.String()
+}
+
+// sendEmail sends a plain text email through the sendmail command of
+// settings, or its SMTP server otherwise
+func sendEmail(settings *config.SummaryEmail, subject, body string) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", settings.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(settings.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	if settings.Sendmail != "" {
+		// Recipients come from the headers, as with sendmail -t
+		ctx, cancel := context.WithTimeout(context.Background(), emailTimeout)
+		defer cancel()
+		args := strings.Fields(settings.Sendmail)
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Stdin = &msg
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%s: %v: %s", settings.Sendmail, err, bytes.TrimSpace(output))
+		}
+		return nil
+	}
+
+	// The envelope takes the bare addresses of "Name <address>" headers
+	from, err := mail.ParseAddress(settings.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender %q: %v", settings.From, err)
+	}
+	var to []string
+	for _, recipient := range settings.To {
+		address, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return fmt.Errorf("invalid recipient %q: %v", recipient, err)
+		}
+		to = append(to, address.Address)
+	}
+	return sendSMTP(settings, from.Address, to, msg.Bytes())
+}
+
+// sendSMTP delivers msg like smtp.SendMail, upgrading to TLS when the server
+// offers STARTTLS and refusing to send the password over a connection
+// without it, within emailTimeout
+func sendSMTP(settings *config.SummaryEmail, from string, to []string, msg []byte) error {
+	addr := net.JoinHostPort(settings.SMTPHost, strconv.Itoa(settings.SMTPPort))
+	conn, err := net.DialTimeout("tcp", addr, emailTimeout)
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(emailTimeout)); err != nil {
+		conn.Close()
+		return err
+	}
+	client, err := smtp.NewClient(conn, settings.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: settings.SMTPHost}); err != nil {
+			return err
+		}
+	}
+	if settings.Username != "" {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return fmt.Errorf("%s does not support authentication", addr)
+		}
+		if err := client.Auth(smtp.PlainAuth("", settings.Username, settings.Password, settings.SMTPHost)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	for _, recipient := range to {
+		if err := client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,143 @@
+package downloader_test
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEmailSummaryThroughSendmail(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake sendmail is a shell script")
+	}
+	server := newMockLaracasts(t)
+	server.forbidFile = "1002-1080.mp4"
+
+	// Saves the message it is piped, like sendmail -t would send it
+	dir := t.TempDir()
+	message := filepath.Join(dir, "message.eml")
+	sendmail := filepath.Join(dir, "sendmail")
+	if err := os.WriteFile(sendmail, []byte("#!/bin/sh\ncat > \""+message+"\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SUMMARY_EMAIL_TO", "nas@example.com")
+	t.Setenv("SENDMAIL_COMMAND", sendmail+" -t")
+
+	dl := newTestDownloader(t, t.TempDir())
+	if err := dl.Preflight(); err != nil {
+		t.Fatalf("Preflight() error = %v", err)
+	}
+	if err := dl.Login(mockEmail, mockPassword); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	downloadErr := dl.DownloadSeries("laravel-basics")
+	if downloadErr == nil {
+		t.Fatal("DownloadSeries() error = nil, want the forbidden episode failed")
+	}
+	if err := dl.EmailSummary(downloadErr); err != nil {
+		t.Fatalf("EmailSummary() error = %v", err)
+	}
+
+	data, err := os.ReadFile(message)
+	if err != nil {
+		t.Fatalf("no email sent: %v", err)
+	}
+	for _, want := range []string{
+		"To: nas@example.com\r\n",
+		"Subject: Laracasts: 2 new episodes, 1 failed\r\n",
+		": partial\r\n",
+		"Error: ",
+		"- Laravel Basics: 2\r\n",
+		"(access): ",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("email lacks %q:\n%s", want, data)
+		}
+	}
+
+	// A run that could not start is reported too
+	failed := newTestDownloader(t, t.TempDir())
+	if err := failed.EmailSummary(errors.New("login failed: invalid credentials")); err != nil {
+		t.Fatalf("EmailSummary() error = %v", err)
+	}
+	data, err = os.ReadFile(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Subject: Laracasts: failed\r\n", "Error: login failed: invalid credentials\r\n"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("email of the failed run lacks %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestEmailSummaryOverSMTP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	// Answers just enough SMTP to take one message, recording the envelope
+	envelope := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		fmt.Fprint(conn, "220 localhost ESMTP\r\n")
+		var commands []string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimSpace(line)
+			switch verb := strings.ToUpper(strings.Fields(line + " ")[0]); verb {
+			case "EHLO", "HELO":
+				fmt.Fprint(conn, "250 localhost\r\n")
+			case "MAIL", "RCPT":
+				commands = append(commands, line)
+				fmt.Fprint(conn, "250 OK\r\n")
+			case "DATA":
+				fmt.Fprint(conn, "354 go ahead\r\n")
+				for {
+					if line, err := r.ReadString('\n'); err != nil || line == ".\r\n" {
+						break
+					}
+				}
+				fmt.Fprint(conn, "250 OK\r\n")
+			case "QUIT":
+				fmt.Fprint(conn, "221 bye\r\n")
+				envelope <- commands
+				return
+			default:
+				fmt.Fprint(conn, "502 unknown\r\n")
+			}
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	t.Setenv("SUMMARY_EMAIL_TO", "NAS <nas@example.com>")
+	t.Setenv("SUMMARY_EMAIL_FROM", "Downloader <dl@example.com>")
+	t.Setenv("SMTP_HOST", host)
+	t.Setenv("SMTP_PORT", port)
+	dl := newTestDownloader(t, t.TempDir())
+	if err := dl.EmailSummary(nil); err != nil {
+		t.Fatalf("EmailSummary() error = %v", err)
+	}
+
+	want := []string{"MAIL FROM:<dl@example.com>", "RCPT TO:<nas@example.com>"}
+	if got := <-envelope; !slices.Equal(got, want) {
+		t.Errorf("envelope = %q, want %q", got, want)
+	}
+}
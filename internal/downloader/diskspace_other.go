@@ -0,0 +1,8 @@
+//go:build !(linux || darwin || freebsd)
+
+package downloader
+
+// freeSpace is unknown where there is no statfs
+func freeSpace(path string) (int64, bool) {
+	return 0, false
+}
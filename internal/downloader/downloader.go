@@ -4,35 +4,198 @@ import (
 	"fmt"
 	"github.com/sajjadanwar0/laracasts-dl/internal/cache"
 	"github.com/sajjadanwar0/laracasts-dl/internal/config"
+	"github.com/sajjadanwar0/laracasts-dl/internal/fsutil"
+	"github.com/sajjadanwar0/laracasts-dl/internal/naming"
 	"github.com/sajjadanwar0/laracasts-dl/internal/vimeo"
-	"io"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
 const (
-	MaxEpisodeWorkers = 15  // Concurrent episode downloads
 	JobBufferSize     = 200 // Buffer for job channel
 	ResultsBufferSize = 200 // Buffer for results channel
 
+	SeriesCacheMaxAge  = 7 * 24 * time.Hour  // Refetch series metadata after a week
+	SeriesListedMaxAge = 90 * 24 * time.Hour // Refetch it even when listings keep matching its episode count
+
+	SeriesRetryBackoff    = 30 * time.Second // Wait before the first series retry pass
+	SeriesRetryMaxBackoff = 10 * time.Minute // Longest wait between series retry passes
+
+	DefaultCatchUpAfter = 10 * time.Minute // Recheck series whose download took longer
 )
 
+// RequestTimeout limits a page or player config request from when it is sent,
+// after any politeness wait
+var RequestTimeout = 30 * time.Second
+
 type Downloader struct {
 	Client   *http.Client
 	Vimeo    *vimeo.Client
 	BasePath string
 	Cache    *cache.Cache
+	Report   *Report
+
+	// Site is the adapter of the course site scraped, Laracasts unless SITE
+	// selects another
+	Site Site
+
+	// Changelog records series and episodes discovered since the last run
+	Changelog *Changelog
+
+	// DeletedPolicy decides whether completed episodes deleted from disk
+	// are downloaded again or left alone
+	DeletedPolicy string
+
+	// DuplicatePolicy decides whether bits already downloaded as a series
+	// episode are hardlinked, skipped or downloaded again
+	DuplicatePolicy string
+
+	// Filter limits which episodes are planned for download
+	Filter EpisodeFilter
+
+	// Events logs episode, chunk and series outcomes for later analysis
+	Events *EventLog
+
+	// IgnoredSeries holds the slugs of series bulk downloads leave out, as
+	// an IgnoreMarker in their folder does
+	IgnoredSeries map[string]bool
+
+	// Collections maps the names of the collections in COLLECTIONS to the
+	// slugs of their series
+	Collections map[string][]string
+
+	// Qualities lists the progressive qualities saved for every video. More
+	// than one quality stores quality-suffixed copies side by side.
+	Qualities []string
+
+	// Order is the order series and episodes are downloaded in, one of the
+	// Order constants; empty keeps the order they are listed in
+	Order string
+
+	// Concurrency limits the topics, series and episodes processed at once
+	Concurrency config.Concurrency
+
+	// EmbedSubs muxes the video's subtitle tracks into newly downloaded files
+	EmbedSubs bool
+
+	// AutoRetrySeries is how many more passes retry the episodes of a series
+	// that failed, with RetryBackoff doubling between passes up to
+	// SeriesRetryMaxBackoff
+	AutoRetrySeries int
+
+	// RetryBackoff is the wait before the first retry pass of a series
+	RetryBackoff time.Duration
+
+	// RedownloadMismatched replaces videos whose size differs from the
+	// remote file, and checks episodes already recorded as completed too
+	RedownloadMismatched bool
+
+	// RefreshMetadata fetches the metadata of every series again instead of
+	// using the cached one
+	RefreshMetadata bool
+
+	// NoCache bypasses every metadata lookup in the cache: series metadata,
+	// probed video sizes and the Inertia version. What is fetched instead is
+	// still written back, and download state is kept.
+	NoCache bool
+
+	// ForceDownload downloads every selected episode and bit again, ignoring
+	// the completed state and the videos on disk, which go to the trash once
+	// their new copy is complete
+	ForceDownload bool
+
+	// Origin is the URL of another instance running Serve; videos and series
+	// metadata it already has are copied from it instead of Laracasts
+	Origin string
+
+	// OriginToken is the shared secret Serve requires and requests to an
+	// origin send, empty when the origin is open to the network
+	OriginToken string
+
+	// Webhook receives per-episode progress events, nil when not configured
+	Webhook *ProgressWebhook
+
+	// SummaryEmail is where EmailSummary sends the summary of the run, nil
+	// when not configured
+	SummaryEmail *config.SummaryEmail
+
+	// Fingerprint is the browser whose headers this session sends
+	Fingerprint config.Fingerprint
+
+	// TrashRetention is how long removed or replaced videos are kept in
+	// TrashDir; zero deletes them right away
+	TrashRetention time.Duration
+
+	// Checkpoint is the file bulk downloads record their progress in every
+	// CheckpointEvery completed series, empty to not record it
+	Checkpoint      string
+	CheckpointEvery int
+
+	// AutoRelogin signs back in with fewer episode workers when Laracasts
+	// signs the session out mid-run, instead of failing the remaining pages
+	AutoRelogin bool
+
+	// CatchUpAfter is how old the episode list of a series may get by the end
+	// of its download before its page is fetched again for episodes published
+	// meanwhile; zero never checks. In bulk runs the list is as old as the
+	// listing of the series it was checked against.
+	CatchUpAfter time.Duration
+
+	// IncludeArchived downloads the series Laracasts archived as outdated
+	// along with the others in bulk downloads, which leave them out otherwise
+	IncludeArchived bool
+
+	// Symlinks is whether the download path supports symbolic links.
+	// Preflight clears it for shares without them, which leaves out the links
+	// of series listed under several topics, authors and collections.
+	Symlinks bool
+
+	// Color highlights the changes of refreshed series with ANSI colors; New
+	// sets it when stdout is a terminal and NO_COLOR is empty
+	Color bool
+
+	sizes           *sizeProber
+	fingerprintOnce sync.Once
+	inertia         inertiaState
+	har             *harRecorder // set by RecordHAR
+	trashOnce       sync.Once
+	trashBatch      string // folder of the videos trashed by this run
+	usage           *usageMeter
+	hashed          downloadHashes // pieces of the videos hashed while downloaded
+	resume          *Checkpoint    // set by ResumeFrom
+	session         sessionState
+	activity        *activity // what the run is doing, for WriteStatus
+	clock           clockSkew
+	playerHashes    sync.Map      // vimeo id to the hash of its signed player URL
+	playerSeries    sync.Map      // vimeo id to the slug of the cached series it is in
+	hashRefreshes   sync.Map      // series slug to the *sync.Once fetching it again for hashes
+	slowdowns       sync.Map      // series output dir to the halvings of its concurrency, see slowdown.go
+	unreleased      sync.Map      // slugs of the series skipped without episodes, see skipUnreleased
+	startFree       int64         // free bytes of the download path before the run, zero when unknown
+	listed          time.Time     // when the bulk run fetched the series listing the downloads plan on
+	seriesSlots     chan struct{} // series downloading at once in bulk runs, nil otherwise
 }
 
 type Episode struct {
-	Title   string
-	VimeoId string
-	Number  int
+	Title       string
+	VimeoId     string
+	VimeoHash   string // of the signed player URL, for private videos
+	Number      int
+	Length      int       // duration in seconds, 0 when unknown
+	PublishedAt time.Time // zero when unknown
+	Tags        []string  // the series' topics and tags plus the episode's own
+	Difficulty  string    // e.g. beginner, empty when unknown
+	Instructor  string    // the series' instructor unless a guest teaches it
+
+	// Filename overrides the default file name when two episodes of a
+	// series would otherwise be saved under the same name
+	Filename string `json:"-"`
 }
 
 //downloader.go
@@ -47,7 +210,7 @@ func New() (*Downloader, error) {
 	basePath := config.GetDownloadPath()
 
 	// Create downloads directory if it doesn't exist
-	if err := os.MkdirAll(basePath, 0755); err != nil {
+	if err := fsutil.MkdirAll(basePath); err != nil {
 		return nil, fmt.Errorf("failed to create downloads directory: %v", err)
 	}
 
@@ -57,98 +220,338 @@ func New() (*Downloader, error) {
 		return nil, fmt.Errorf("failed to initialize cache: %v", err)
 	}
 
-	client := &http.Client{
-		Jar:     jar,
-		Timeout: 30 * time.Second,
-		Transport: &http.Transport{
-			MaxIdleConns:        100,
-			IdleConnTimeout:     90 * time.Second,
-			DisableCompression:  true,
-			MaxIdleConnsPerHost: 100,
+	site, err := LookupSite(config.GetSite())
+	if err != nil {
+		return nil, err
+	}
+
+	// Extra headers and cookies, e.g. a Cloudflare clearance cookie
+	extraHeaders, err := config.GetExtraHeaders()
+	if err != nil {
+		return nil, err
+	}
+	extraCookies, err := config.GetExtraCookies()
+	if err != nil {
+		return nil, err
+	}
+	if len(extraCookies) > 0 {
+		siteURL, err := url.Parse(site.BaseURL())
+		if err != nil {
+			return nil, fmt.Errorf("invalid base URL: %v", err)
+		}
+		jar.SetCookies(siteURL, extraCookies)
+	}
+
+	mirrors, err := config.GetMirrors()
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := config.GetTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	network, err := config.GetNetworkPreference()
+	if err != nil {
+		return nil, err
+	}
+
+	politeness, err := config.GetPoliteness()
+	if err != nil {
+		return nil, err
+	}
+
+	// Pages and configs are fetched compressed; video transfers keep
+	// compression off on connections of their own
+	metadataTransport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSClientConfig:     tlsConfig,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+		MaxIdleConnsPerHost: 100,
+		DialContext:         networkDialer(network),
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	// Video bodies are read without an overall timeout (see
+	// vimeo.Client.Stream), so waiting for the headers is bounded here
+	videoTransport := metadataTransport.Clone()
+	videoTransport.DisableCompression = true
+	videoTransport.ResponseHeaderTimeout = 30 * time.Second
+
+	usage := newUsageMeter(config.GetMonthlyCap())
+	headers := &headerTransport{
+		base: &usageTransport{
+			base: &compressionTransport{
+				metadata: newPoliteTransport(&deadlineTransport{base: newMirrorTransport(metadataTransport, mirrors, site), timeout: RequestTimeout}, politeness),
+				video:    newMirrorTransport(videoTransport, mirrors, site),
+				site:     site,
+			},
+			meter: usage,
 		},
+		site:    site,
+		headers: extraHeaders,
 	}
+	// Without an overall Timeout, which would include the politeness wait
+	// of queued requests; deadlineTransport bounds them once sent
+	client := &http.Client{
+		Jar:       jar,
+		Transport: headers,
+	}
+
+	vimeoClient := vimeo.NewClient(client)
+	vimeoClient.Referer = site.BaseURL() + "/"
 
-	return &Downloader{
+	d := &Downloader{
 		Client:   client,
-		Vimeo:    vimeo.NewClient(client),
+		Vimeo:    vimeoClient,
 		BasePath: basePath,
 		Cache:    newCache,
-	}, nil
-}
+		Report:   &Report{Transfer: vimeoClient.Stats, Cache: newCache.Stats},
 
-func (d *Downloader) getXSRFToken() (string, error) {
-	req, err := http.NewRequest("GET", config.LaracastsBaseUrl, nil)
-	if err != nil {
-		return "", err
+		Site:      site,
+		Changelog: &Changelog{baseURL: site.BaseURL()},
+		Events:    NewEventLog(filepath.Join(newCache.BasePath, EventsFile)),
+
+		DeletedPolicy:   config.GetDeletedEpisodePolicy(),
+		DuplicatePolicy: config.GetDuplicatePolicy(),
+		TrashRetention:  config.GetTrashRetention(),
+		OriginToken:     config.GetOriginToken(),
+		IgnoredSeries:   make(map[string]bool),
+		Checkpoint:      filepath.Join(basePath, CheckpointFile),
+		CheckpointEvery: DefaultCheckpointEvery,
+		CatchUpAfter:    DefaultCatchUpAfter,
+		RetryBackoff:    SeriesRetryBackoff,
+		AutoRelogin:     true,
+		Symlinks:        true,
+		Color:           colorOutput(),
+		usage:           usage,
+		activity:        newActivity(),
+	}
+	if d.Collections, err = config.GetCollections(); err != nil {
+		return nil, err
+	}
+	d.sizes = &sizeProber{d: d}
+	for _, slug := range config.GetIgnoredSeries() {
+		d.IgnoredSeries[checkpointSlug(slug)] = true
 	}
 
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	// One browser per session; switching mid-session looks more like a bot
+	d.Fingerprint = d.pickFingerprint(config.GetFingerprint())
+	headers.fingerprint = d.Fingerprint.Headers
+	headers.blocked = d.fingerprintBlocked
+	headers.clock = &d.clock
 
-	resp, err := d.Client.Do(req)
-	if err != nil {
-		return "", err
+	if d.Concurrency, err = config.GetConcurrency(); err != nil {
+		return nil, err
+	}
+	vimeoClient.ChunkWorkers = d.Concurrency.Chunks
+	if webhookURL := config.GetProgressWebhook(); webhookURL != "" {
+		d.Webhook = NewProgressWebhook(webhookURL)
+	}
+	if d.SummaryEmail, err = config.GetSummaryEmail(); err != nil {
+		return nil, err
+	}
+	vimeoClient.Progress = d.videoProgress
+	vimeoClient.ChunkRetry = d.chunkRetried
+	vimeoClient.ChunkLimit = d.chunkLimit
+	vimeoClient.FFmpegWorkers = d.Concurrency.FFmpeg
+	vimeoClient.PieceSize = PieceSize
+	vimeoClient.Hashed = d.hashed.record
+
+	if quality := config.GetVideoQuality(); quality != "" {
+		d.Qualities = []string{quality}
 	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			printBox("Failed to close body")
-		}
-	}(resp.Body)
 
-	laracastsURL, _ := url.Parse(config.LaracastsBaseUrl)
-	cookies := d.Client.Jar.Cookies(laracastsURL)
+	return d, nil
+}
 
-	for _, cookie := range cookies {
-		if cookie.Name == "XSRF-TOKEN" {
-			decoded, err := url.QueryUnescape(cookie.Value)
-			if err == nil {
-				return decoded, nil
-			}
+// episodeFilename returns the file name an episode is saved under
+func episodeFilename(episode Episode) string {
+	if episode.Filename != "" {
+		return episode.Filename
+	}
+	return fmt.Sprintf("%02d-%s.mp4", episode.Number, naming.Sanitize(episode.Title))
+}
+
+// qualityVariant is one requested quality of a video and the file it is saved to
+type qualityVariant struct {
+	Quality string
+	Path    string
+}
+
+// variants returns the files a video is saved to, one per requested quality.
+// A single quality keeps the plain filename; archive mode adds a suffix.
+func (d *Downloader) variants(outputPath string) []qualityVariant {
+	if len(d.Qualities) <= 1 {
+		var quality string
+		if len(d.Qualities) == 1 {
+			quality = d.Qualities[0]
 		}
+		return []qualityVariant{{Quality: quality, Path: outputPath}}
 	}
 
-	return "", fmt.Errorf("XSRF token not found in cookies")
+	ext := filepath.Ext(outputPath)
+	base := strings.TrimSuffix(outputPath, ext)
+
+	variants := make([]qualityVariant, 0, len(d.Qualities))
+	for _, quality := range d.Qualities {
+		variants = append(variants, qualityVariant{
+			Quality: quality,
+			Path:    fmt.Sprintf("%s-%s%s", base, quality, ext),
+		})
+	}
+	return variants
 }
 
-func (d *Downloader) downloadEpisode(outputDir string, episode Episode) error {
-	maxRetries := 3
-	for i := 0; i < maxRetries; i++ {
-		err := d.tryDownload(outputDir, episode)
-		if err == nil {
-			return nil
+// variantsExist reports whether every quality variant of outputPath is on disk
+func (d *Downloader) variantsExist(outputPath string) bool {
+	for _, v := range d.variants(outputPath) {
+		if !d.videoExists(v.Path) {
+			return false
 		}
-		time.Sleep(time.Duration(i*i) * time.Second)
 	}
-	return fmt.Errorf("failed after %d retries", maxRetries)
+	return true
 }
 
-func (d *Downloader) tryDownload(outputDir string, episode Episode) error {
-	filename := fmt.Sprintf("%02d-%s.mp4", episode.Number, sanitizeFilename(episode.Title))
-	outputPath := filepath.Join(outputDir, filename) // Use the provided outputDir
+// downloadVideo fetches the Vimeo config once and saves every quality variant
+// of the video that is not on disk yet
+func (d *Downloader) downloadVideo(vimeoId, outputPath string) error {
+	if err := naming.Within(d.BasePath, outputPath); err != nil {
+		return err
+	}
 
-	// Check if file already exists and is complete
-	if info, err := os.Stat(outputPath); err == nil && info.Size() > 0 {
-		// File exists and has content
+	var missing []qualityVariant
+	for _, v := range d.variants(outputPath) {
+		if !d.videoExists(v.Path) {
+			missing = append(missing, v)
+		}
+	}
+	if len(missing) == 0 {
 		return nil
 	}
+	if d.usageExceeded() {
+		return ErrMonthlyCapReached
+	}
 
-	// Ensure the directory exists
-	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
-		return fmt.Errorf("failed to create directory: %v", err)
+	if d.Origin != "" {
+		if missing = d.fetchFromOrigin(vimeoId, missing); len(missing) == 0 {
+			return nil
+		}
 	}
 
 	// Get video configuration
-	videoConfig, err := d.Vimeo.GetVideoConfig(episode.VimeoId)
+	videoConfig, err := d.videoConfig(vimeoId)
 	if err != nil {
-		return fmt.Errorf("failed to get video config: %v", err)
+		return fmt.Errorf("failed to get video config: %w", err)
 	}
+	if d.sizes.recordQuality(vimeoId, d.Vimeo.SelectQuality(videoConfig, "")) {
+		d.sizes.save()
+	}
+
+	// Download the video in each missing quality
+	for _, v := range missing {
+		finished := d.activity.startVideo(v.Path)
+		err := d.Vimeo.DownloadVideo(videoConfig, v.Quality, v.Path)
+		finished()
+		if err != nil {
+			return err
+		}
+		if selected := d.Vimeo.SelectQuality(videoConfig, v.Quality); v.Quality != "" && selected != "" && selected != v.Quality {
+			d.Report.AddDowngrade(Downgrade{Path: d.relativePath(v.Path), VimeoId: vimeoId, Requested: v.Quality, Quality: selected})
+		}
+
+		if d.EmbedSubs {
+			// Missing captions should not fail an otherwise complete download
+			if path, ok := d.existingVideo(v.Path); ok {
+				if err := d.Vimeo.EmbedSubtitles(videoConfig, path); err != nil {
+					fmt.Printf("Warning: %v\n", err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// rememberPlayerHash keeps the hash of the signed player URL of a video for
+// fetching its config
+func (d *Downloader) rememberPlayerHash(vimeoId, hash string) {
+	if hash != "" {
+		d.playerHashes.Store(vimeoId, hash)
+	}
+}
+
+// videoConfig fetches the player config of a video, signed with the hash
+// its episode or bit came with. A video refused without a hash may be a
+// private one of series metadata cached before hashes were kept, so its
+// series is fetched again, once, for the hash.
+func (d *Downloader) videoConfig(vimeoId string) (*vimeo.VideoConfig, error) {
+	signature := d.playerHash(vimeoId)
+	videoConfig, err := d.Vimeo.GetVideoConfig(vimeoId, signature)
+	if signature != "" || vimeo.StatusCode(err) != http.StatusForbidden {
+		return videoConfig, err
+	}
+
+	slug, ok := d.playerSeries.Load(vimeoId)
+	if !ok {
+		return videoConfig, err
+	}
+	once, _ := d.hashRefreshes.LoadOrStore(slug, &sync.Once{})
+	once.(*sync.Once).Do(func() { d.refreshPlayerHashes(slug.(string)) })
+	if signature = d.playerHash(vimeoId); signature == "" {
+		return videoConfig, err
+	}
+	return d.Vimeo.GetVideoConfig(vimeoId, signature)
+}
+
+// playerHash returns the hash remembered for a video, "" when it has none
+func (d *Downloader) playerHash(vimeoId string) string {
+	hash, _ := d.playerHashes.Load(vimeoId)
+	signature, _ := hash.(string)
+	return signature
+}
+
+// refreshPlayerHashes fetches the metadata of a cached series again,
+// replacing the cached copy, and remembers the player hashes it lists
+func (d *Downloader) refreshPlayerHashes(cleanSlug string) {
+	fmt.Printf("Vimeo refused a video of %s, fetching its metadata again for private video hashes\n", cleanSlug)
+	seriesData, err := d.scrapeSeriesMetadata("series/" + cleanSlug)
+	if err != nil {
+		fmt.Printf("Warning: Failed to refresh series metadata: %v\n", err)
+		return
+	}
+	if err := d.Cache.Set("series_"+cleanSlug, seriesData); err != nil {
+		fmt.Printf("Warning: Failed to cache series metadata: %v\n", err)
+	}
+	for _, chapter := range seriesData.Chapters {
+		for _, episode := range chapter.Episodes {
+			d.rememberPlayerHash(episode.VimeoId, episode.VimeoHash)
+		}
+	}
+}
+
+// videoBytes returns the size on disk of every quality variant of outputPath
+func (d *Downloader) videoBytes(outputPath string) int64 {
+	var total int64
+	for _, v := range d.variants(outputPath) {
+		if path, ok := d.existingVideo(v.Path); ok {
+			if info, err := os.Stat(path); err == nil {
+				total += info.Size()
+			}
+		}
+	}
+	return total
+}
 
-	// Download the video
-	return d.Vimeo.DownloadVideo(videoConfig, outputPath)
+// videoExists reports whether outputPath, or its ffmpeg fallback counterpart
+// in the configured container, already exists with content
+func (d *Downloader) videoExists(outputPath string) bool {
+	_, ok := d.existingVideo(outputPath)
+	return ok
 }
 
-func printBox(text string) {
+// PrintBox prints text framed as a heading
+func PrintBox(text string) {
 	width := len(text) + 4
 	line := strings.Repeat("=", width)
 	fmt.Printf("\n%s\n  %s\n%s\n", line, text, line)
@@ -0,0 +1,1479 @@
+package downloader_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/config"
+	"github.com/sajjadanwar0/laracasts-dl/internal/downloader"
+	"github.com/sajjadanwar0/laracasts-dl/internal/fsutil"
+	"github.com/sajjadanwar0/laracasts-dl/internal/naming"
+	"github.com/sajjadanwar0/laracasts-dl/internal/vimeo"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestLoginRejectsBadCredentials(t *testing.T) {
+	newMockLaracasts(t)
+	dl := newTestDownloader(t, t.TempDir())
+
+	if err := dl.Login(mockEmail, "wrong"); err == nil {
+		t.Fatal("Login() with bad password succeeded, want error")
+	}
+}
+
+func TestFingerprintRotatesAfterBlock(t *testing.T) {
+	server := newMockLaracasts(t)
+	downloadPath := t.TempDir()
+
+	blocked := newTestDownloader(t, downloadPath)
+	server.blockAgent = blocked.Fingerprint.Headers["User-Agent"]
+	if err := blocked.Login(mockEmail, mockPassword); err == nil {
+		t.Fatal("Login() with a blocked fingerprint succeeded, want error")
+	}
+	server.Agents()
+
+	// The next session avoids the blocked fingerprint and keeps its own
+	// headers for every request
+	dl := newTestDownloader(t, downloadPath)
+	if dl.Fingerprint.Name == blocked.Fingerprint.Name {
+		t.Fatalf("new session uses the blocked fingerprint %s again", blocked.Fingerprint.Name)
+	}
+	if err := dl.Login(mockEmail, mockPassword); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+	agents := server.Agents()
+	if len(agents) != 1 || agents[dl.Fingerprint.Headers["User-Agent"]] == 0 {
+		t.Errorf("requests used User-Agents %v, want only %q", agents, dl.Fingerprint.Headers["User-Agent"])
+	}
+
+	// A pinned fingerprint is used even when it was blocked
+	t.Setenv("HEADER_FINGERPRINT", blocked.Fingerprint.Name)
+	if pinned := newTestDownloader(t, downloadPath); pinned.Fingerprint.Name != blocked.Fingerprint.Name {
+		t.Errorf("pinned fingerprint = %s, want %s", pinned.Fingerprint.Name, blocked.Fingerprint.Name)
+	}
+}
+
+func TestDownloadSeries(t *testing.T) {
+	server := newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+
+	seriesDir := filepath.Join(downloadPath, "laravel-basics")
+	want := map[string]string{
+		"01-introduction-to-laravel.mp4": "1001-1080.mp4",
+		"02-routing-basics.mp4":          "1002-1080.mp4",
+		"03-controllers.mp4":             "1003-1080.mp4",
+	}
+	for filename, source := range want {
+		got, err := os.ReadFile(filepath.Join(seriesDir, filename))
+		if err != nil {
+			t.Errorf("episode %s not downloaded: %v", filename, err)
+			continue
+		}
+		if !bytes.Equal(got, mockVideo(source)) {
+			t.Errorf("episode %s content does not match %s", filename, source)
+		}
+	}
+
+	entries, err := os.ReadDir(seriesDir)
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	if len(entries) != len(want)+2 {
+		t.Errorf("series directory has %d entries, want %d episodes, README.md and %s", len(entries), len(want), downloader.CompleteMarker)
+	}
+
+	readme, err := os.ReadFile(filepath.Join(seriesDir, "README.md"))
+	if err != nil {
+		t.Fatalf("series README not written: %v", err)
+	}
+	for _, line := range []string{
+		"# Laravel Basics",
+		"Everything you need to build your first Laravel app & ship it.",
+		"- Instructor: Jeffrey Way",
+		"- Source: " + server.URL + "/series/laravel-basics",
+		"## 2. Going Further",
+		"| 3 | Controllers | - | [03-controllers.mp4](03-controllers.mp4) |",
+	} {
+		if !strings.Contains(string(readme), line) {
+			t.Errorf("README.md is missing %q:\n%s", line, readme)
+		}
+	}
+
+	// Videos below the small file threshold take a single request each
+	if hits := server.HitsWithPrefix("GET", "/files/"); hits != len(want) {
+		t.Errorf("made %d video requests, want %d", hits, len(want))
+	}
+}
+
+func TestDownloadSeriesInChunks(t *testing.T) {
+	server := newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	dl.Vimeo.SmallFileThreshold = 0
+
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(downloadPath, "laravel-basics", "02-routing-basics.mp4"))
+	if err != nil || !bytes.Equal(got, mockVideo("1002-1080.mp4")) {
+		t.Errorf("chunked episode content does not match: %v", err)
+	}
+	if hits := server.HitsWithPrefix("GET", "/files/"); hits == 0 {
+		t.Error("no ranged video requests were made")
+	}
+
+	// Segments cached for an unfinished HLS download are not videos
+	segments := filepath.Join(downloadPath, "laravel-basics", "04-next.mp4.hls")
+	if err := os.MkdirAll(segments, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(segments, "video-0.mp4"), []byte("segment"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The pieces hashed while downloading match the file
+	manifest, err := dl.UpdateManifest()
+	if err != nil {
+		t.Fatalf("UpdateManifest() error = %v", err)
+	}
+	sum := sha256.Sum256(got)
+	if file := manifest.Files["laravel-basics/02-routing-basics.mp4"]; file == nil || !slices.Equal(file.Pieces, []string{hex.EncodeToString(sum[:])}) {
+		t.Errorf("manifest entry = %+v, want the SHA-256 of the episode", file)
+	}
+	if file := manifest.Files["laravel-basics/04-next.mp4.hls/video-0.mp4"]; file != nil {
+		t.Errorf("cached segment hashed into the manifest: %+v", file)
+	}
+}
+
+func TestPolitenessSpacesMetadataRequests(t *testing.T) {
+	server := newMockLaracasts(t)
+	t.Setenv("POLITENESS_DELAY_MS", "1")
+	t.Setenv("POLITENESS_JITTER_MS", "0")
+	t.Setenv("POLITENESS_HOSTS", "127.0.0.1=50")
+	dl := signedInDownloader(t, t.TempDir())
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+
+	// Player configs are fetched by several episode workers at once, and
+	// still arrive one at a time
+	times := server.PageTimes()
+	if len(times) < 5 {
+		t.Fatalf("%d metadata requests, want at least 5", len(times))
+	}
+	// Measured from the first request, as a request held up on its way
+	// shortens the gap to the next one
+	for i := 1; i < len(times); i++ {
+		if since := times[i].Sub(times[0]); since < time.Duration(i)*40*time.Millisecond {
+			t.Errorf("metadata request %d came %v after the first one, want at least %d x 50ms", i, since, i)
+		}
+	}
+}
+
+func TestPolitenessWaitIsNotTimedOut(t *testing.T) {
+	server := newMockLaracasts(t)
+	t.Setenv("POLITENESS_JITTER_MS", "0")
+	t.Setenv("POLITENESS_HOSTS", "127.0.0.1=150")
+	timeout := downloader.RequestTimeout
+	downloader.RequestTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { downloader.RequestTimeout = timeout })
+	dl := signedInDownloader(t, t.TempDir())
+	// The episode workers queue their player configs for longer than a
+	// request may take
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+	for _, vimeoID := range []string{"1001", "1002"} {
+		if hits := server.Hits("GET", "/video/"+vimeoID+"/config"); hits != 1 {
+			t.Errorf("config of video %s requested %d times, want the queued request to wait rather than time out", vimeoID, hits)
+		}
+	}
+}
+
+func TestDownloadSeriesCompressesOnlyMetadata(t *testing.T) {
+	server := newMockLaracasts(t)
+	dl := signedInDownloader(t, t.TempDir())
+	dl.Vimeo.SmallFileThreshold = 0
+
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.gzipped == 0 {
+		t.Error("no pages or configs were fetched compressed")
+	}
+	if server.rangedGzip > 0 {
+		t.Errorf("%d ranged video requests accepted gzip, want none", server.rangedGzip)
+	}
+}
+
+func TestDownloadSeriesSurvivesChaos(t *testing.T) {
+	newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	dl.Vimeo.SmallFileThreshold = 0
+
+	dl.EnableChaos(downloader.Chaos{Rate: 0.3, Delay: 50 * time.Millisecond, Seed: 1})
+
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+
+	for filename, source := range map[string]string{
+		"01-introduction-to-laravel.mp4": "1001-1080.mp4",
+		"02-routing-basics.mp4":          "1002-1080.mp4",
+		"03-controllers.mp4":             "1003-1080.mp4",
+	} {
+		got, err := os.ReadFile(filepath.Join(downloadPath, "laravel-basics", filename))
+		if err != nil || !bytes.Equal(got, mockVideo(source)) {
+			t.Errorf("episode %s is not intact after chaos: %v", filename, err)
+		}
+	}
+}
+
+func TestDownloadSeriesRespectsLockOfAnotherInstance(t *testing.T) {
+	server := newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+
+	lockDir := filepath.Join(downloadPath, ".cache", "locks")
+	if err := os.MkdirAll(lockDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	lockPath := filepath.Join(lockDir, "series_laravel-basics.lock")
+	other, err := fsutil.TryLock(lockPath)
+	if err != nil {
+		t.Fatalf("TryLock() error = %v", err)
+	}
+
+	err = dl.DownloadSeries("laravel-basics")
+	var lockErr *fsutil.LockError
+	if !errors.As(err, &lockErr) {
+		t.Fatalf("DownloadSeries() error = %v, want *fsutil.LockError", err)
+	}
+	if hits := server.Hits("GET", "/series/laravel-basics"); hits != 0 {
+		t.Errorf("locked series page fetched %d times, want 0", hits)
+	}
+	if err := other.Unlock(); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+
+	// A lock whose owner stopped refreshing it is taken over
+	if err := os.WriteFile(lockPath, []byte(`{"pid":1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stale := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(lockPath, stale, stale); err != nil {
+		t.Fatal(err)
+	}
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() with stale lock error = %v", err)
+	}
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Errorf("lock file left behind after the download: %v", err)
+	}
+}
+
+func TestDownloadSeriesResumesFromState(t *testing.T) {
+	server := newMockLaracasts(t)
+	downloadPath := t.TempDir()
+
+	first := signedInDownloader(t, downloadPath)
+	if err := first.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+
+	configHits := server.HitsWithPrefix("GET", "/video/")
+	pageHits := server.Hits("GET", "/series/laravel-basics")
+
+	// A second run with a fresh downloader must rely on the cached metadata
+	// and download state instead of touching the network again
+	second := signedInDownloader(t, downloadPath)
+	if err := second.DownloadSeries("series/laravel-basics"); err != nil {
+		t.Fatalf("second DownloadSeries() error = %v", err)
+	}
+
+	if got := server.HitsWithPrefix("GET", "/video/"); got != configHits {
+		t.Errorf("resumed run fetched %d Vimeo configs, want 0", got-configHits)
+	}
+	if got := server.Hits("GET", "/series/laravel-basics"); got != pageHits {
+		t.Errorf("resumed run fetched the series page %d times, want cached metadata", got-pageHits)
+	}
+}
+
+func TestDownloadSeriesRecoversMissingEpisode(t *testing.T) {
+	server := newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+
+	// Clearing the cache forgets the download state, so the next run has to
+	// refetch metadata and fill in only the episode missing on disk
+	missing := filepath.Join(downloadPath, "laravel-basics", "02-routing-basics.mp4")
+	if err := os.Remove(missing); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if err := dl.Cache.Clear(); err != nil {
+		t.Fatalf("Cache.Clear() error = %v", err)
+	}
+
+	pageHits := server.Hits("GET", "/series/laravel-basics")
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() after cache clear error = %v", err)
+	}
+
+	if got := server.Hits("GET", "/series/laravel-basics"); got != pageHits+1 {
+		t.Errorf("series page fetched %d times after cache clear, want 1", got-pageHits)
+	}
+	got, err := os.ReadFile(missing)
+	if err != nil {
+		t.Fatalf("missing episode was not downloaded again: %v", err)
+	}
+	if !bytes.Equal(got, mockVideo("1002-1080.mp4")) {
+		t.Error("re-downloaded episode content does not match")
+	}
+}
+
+func TestSeriesPagesUseInertiaJSON(t *testing.T) {
+	server := newMockLaracasts(t)
+	downloadPath := t.TempDir()
+
+	// The first page is scraped to learn the asset version
+	dl := signedInDownloader(t, downloadPath)
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+	if got := server.InertiaPages(); got != 0 {
+		t.Fatalf("%d pages served as JSON before the version was known, want 0", got)
+	}
+
+	// Later sessions request JSON with the version saved by the first
+	dl = signedInDownloader(t, downloadPath)
+	if err := dl.DownloadSeries("duplicate-titles"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+	if got := server.InertiaPages(); got != 1 {
+		t.Errorf("%d pages served as JSON, want 1", got)
+	}
+
+	// After a deploy the 409 falls back to the HTML, which has the new version
+	server.assetVersion = "5a2b3c"
+	if err := dl.DownloadSeries("removed-videos"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+	if got := server.Hits("GET", "/series/removed-videos"); got != 2 {
+		t.Errorf("series page requested %d times after a deploy, want 2 (409 and HTML)", got)
+	}
+	if got := server.InertiaPages(); got != 1 {
+		t.Errorf("%d pages served as JSON, want still 1", got)
+	}
+}
+
+func TestDownloadSeriesMigratesLegacyFiles(t *testing.T) {
+	server := newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+
+	// Named by title in a folder named after the series, and by vimeo id
+	legacy := map[string]string{
+		filepath.Join("Laravel Basics", "1 - Introduction to Laravel.mp4"): "1001-1080.mp4",
+		filepath.Join("laravel-basics", "1002.mp4"):                        "1002-1080.mp4",
+	}
+	for path, source := range legacy {
+		path = filepath.Join(downloadPath, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, mockVideo(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+
+	seriesDir := filepath.Join(downloadPath, "laravel-basics")
+	for filename, source := range map[string]string{
+		"01-introduction-to-laravel.mp4": "1001-1080.mp4",
+		"02-routing-basics.mp4":          "1002-1080.mp4",
+	} {
+		got, err := os.ReadFile(filepath.Join(seriesDir, filename))
+		if err != nil {
+			t.Errorf("legacy file not migrated to %s: %v", filename, err)
+			continue
+		}
+		if !bytes.Equal(got, mockVideo(source)) {
+			t.Errorf("%s content does not match %s", filename, source)
+		}
+	}
+	for path := range legacy {
+		if _, err := os.Stat(filepath.Join(downloadPath, path)); !os.IsNotExist(err) {
+			t.Errorf("legacy file %s still exists", path)
+		}
+	}
+
+	// Only the episode missing from the legacy library is downloaded
+	if hits := server.HitsWithPrefix("GET", "/files/"); hits != 1 {
+		t.Errorf("made %d video requests, want 1", hits)
+	}
+	if len(dl.Report.Mismatches) != 0 {
+		t.Errorf("Report.Mismatches = %+v, want migrated files matching the remote size", dl.Report.Mismatches)
+	}
+}
+
+func TestDownloadSeriesSkipsRemovedVideos(t *testing.T) {
+	server := newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+
+	// Segments an earlier attempt cached before the video was taken down
+	segments := filepath.Join(downloadPath, "removed-videos", "02-taken-down.mp4.hls")
+	if err := os.MkdirAll(segments, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(segments, "video-0.ts"), []byte("segment"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dl.DownloadSeries("removed-videos"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v, want removed video skipped", err)
+	}
+
+	if got := server.Hits("GET", "/video/9999/config"); got != 1 {
+		t.Errorf("removed video config requested %d times, want 1", got)
+	}
+	if len(dl.Report.Failures) != 1 || !dl.Report.Failures[0].Skipped {
+		t.Fatalf("Report.Failures = %+v, want one skipped video", dl.Report.Failures)
+	}
+	if dl.Report.Failures[0].VimeoId != "9999" {
+		t.Errorf("skipped VimeoId = %q, want 9999", dl.Report.Failures[0].VimeoId)
+	}
+	if got := dl.Report.Failures[0].Category; got != downloader.FailureUnavailable {
+		t.Errorf("skipped Category = %q, want %q", got, downloader.FailureUnavailable)
+	}
+	if _, err := os.Stat(segments); !os.IsNotExist(err) {
+		t.Errorf("segment cache of the removed video kept: %v", err)
+	}
+}
+
+func TestDownloadSeriesCategorizesFailures(t *testing.T) {
+	server := newMockLaracasts(t)
+	server.forbidFile = "1002-1080.mp4"
+	dl := signedInDownloader(t, t.TempDir())
+	if err := dl.DownloadSeries("laravel-basics"); err == nil {
+		t.Fatal("DownloadSeries() error = nil, want the forbidden episode failed")
+	}
+
+	if len(dl.Report.Failures) != 1 {
+		t.Fatalf("Report.Failures = %+v, want one failed video", dl.Report.Failures)
+	}
+	failure := dl.Report.Failures[0]
+	if failure.Skipped || failure.VimeoId != "1002" {
+		t.Errorf("failure = %+v, want episode 1002 failed", failure)
+	}
+	if failure.Category != downloader.FailureAccess {
+		t.Errorf("Category = %q, want %q", failure.Category, downloader.FailureAccess)
+	}
+}
+
+func TestReportOutcome(t *testing.T) {
+	server := newMockLaracasts(t)
+	server.forbidFile = "1002-1080.mp4"
+	dl := signedInDownloader(t, t.TempDir())
+	err := dl.DownloadSeries("no-such-series")
+	if got := dl.Report.Outcome(err); got != downloader.OutcomeFailed {
+		t.Errorf("Outcome() of a missing series = %q, want %q", got, downloader.OutcomeFailed)
+	}
+
+	err = dl.DownloadSeries("laravel-basics")
+	if got := dl.Report.Outcome(err); got != downloader.OutcomePartial {
+		t.Errorf("Outcome() with a forbidden episode = %q, want %q", got, downloader.OutcomePartial)
+	}
+	if got := dl.Report.FailedVideos(); got != 1 {
+		t.Errorf("FailedVideos() = %d, want 1", got)
+	}
+
+	server.mu.Lock()
+	server.forbidFile = ""
+	server.mu.Unlock()
+	dl.Report = &downloader.Report{}
+	err = dl.DownloadSeries("laravel-basics")
+	if got := dl.Report.Outcome(err); got != downloader.OutcomeSucceeded {
+		t.Errorf("Outcome() = %q, want %q", got, downloader.OutcomeSucceeded)
+	}
+
+	// Videos left for next month keep the run from succeeding
+	dl.Report.AddPaused()
+	if got := dl.Report.Outcome(nil); got != downloader.OutcomePartial {
+		t.Errorf("Outcome() with a paused video = %q, want %q", got, downloader.OutcomePartial)
+	}
+
+	// Bits on disk from an earlier run count like the videos of series do
+	bits := &downloader.Report{}
+	bits.AddExistingBits(2)
+	if got := bits.Outcome(errors.New("bit failed")); got != downloader.OutcomePartial {
+		t.Errorf("Outcome() with existing bits = %q, want %q", got, downloader.OutcomePartial)
+	}
+}
+
+func TestFailureCategoryOfDiskErrors(t *testing.T) {
+	for _, tt := range []struct {
+		errno syscall.Errno
+		want  string
+	}{
+		{syscall.ENOSPC, downloader.FailureDisk},
+		{syscall.EDQUOT, downloader.FailureDisk},
+		{syscall.EROFS, downloader.FailureDisk},
+		{syscall.EIO, downloader.FailureDisk},
+		// Only the file at hand is affected, the other videos can still be saved
+		{syscall.EACCES, downloader.FailureOther},
+		{syscall.ENAMETOOLONG, downloader.FailureOther},
+	} {
+		err := fmt.Errorf("failed to write video: %w", &os.PathError{Op: "write", Path: "video.mp4", Err: tt.errno})
+		if got := downloader.FailureCategory(err); got != tt.want {
+			t.Errorf("FailureCategory(%v) = %q, want %q", tt.errno, got, tt.want)
+		}
+	}
+}
+
+func TestDownloadSeriesSlowsDownAfterFailures(t *testing.T) {
+	server := newMockLaracasts(t)
+	// Every attempt of the first pass at one of the three episodes fails
+	server.overloadFile = "1002-1080.mp4"
+	server.overloadCount = 9
+	dl := signedInDownloader(t, t.TempDir())
+	dl.Concurrency.Episodes = 4
+	dl.Vimeo.ChunkWorkers = 4
+
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v, want the failed episode retried", err)
+	}
+
+	if len(dl.Report.Series) != 1 {
+		t.Fatalf("Report.Series = %+v, want one series", dl.Report.Series)
+	}
+	result := dl.Report.Series[0]
+	if result.Downloaded != 3 || result.Failed != 0 {
+		t.Errorf("downloaded %d, failed %d, want all 3 episodes downloaded", result.Downloaded, result.Failed)
+	}
+	if result.Workers != 2 || result.Chunks != 2 {
+		t.Errorf("finished with %d workers and %d chunks, want both halved to 2", result.Workers, result.Chunks)
+	}
+	if len(dl.Report.Failures) != 0 {
+		t.Errorf("Report.Failures = %+v, want the retried episode not reported", dl.Report.Failures)
+	}
+}
+
+func TestDownloadAllByTopicsRetriesOutsideTheSeriesSlot(t *testing.T) {
+	server := newMockLaracasts(t)
+	server.browsePage = "browse/legacy"
+	// Every attempt of the first pass at one episode of laravel-basics fails
+	server.overloadFile = "1002-1080.mp4"
+	server.overloadCount = 9
+	dl := signedInDownloader(t, t.TempDir())
+	dl.IncludeArchived = true
+	dl.Concurrency.Series = 1
+	dl.Concurrency.Episodes = 1
+	dl.Vimeo.ChunkWorkers = 1
+	dl.AutoRetrySeries = 1
+	dl.RetryBackoff = 200 * time.Millisecond
+
+	if err := dl.DownloadAllByTopics(); err != nil {
+		t.Fatalf("DownloadAllByTopics() error = %v, want the failed episode retried", err)
+	}
+
+	var slugs []string
+	for _, result := range dl.Report.Series {
+		slugs = append(slugs, result.Slug)
+		if result.Downloaded != 3 || result.Failed != 0 {
+			t.Errorf("%s: downloaded %d, failed %d, want all 3 episodes downloaded", result.Slug, result.Downloaded, result.Failed)
+		}
+	}
+	// The only series slot was free while laravel-basics waited to retry
+	if want := []string{"revised-course", "laravel-basics"}; !reflect.DeepEqual(slugs, want) {
+		t.Errorf("series finished in order %v, want %v", slugs, want)
+	}
+}
+
+func TestDownloadSeriesMarksCompletion(t *testing.T) {
+	server := newMockLaracasts(t)
+	server.forbidFile = "1002-1080.mp4"
+	downloadPath := t.TempDir()
+	seriesDir := filepath.Join(downloadPath, "laravel-basics")
+	dl := signedInDownloader(t, downloadPath)
+	if err := dl.DownloadSeries("laravel-basics"); err == nil {
+		t.Fatal("DownloadSeries() error = nil, want the forbidden episode failed")
+	}
+	if _, ok := downloader.ReadCompletion(seriesDir); ok {
+		t.Fatal("incomplete series marked complete")
+	}
+
+	server.mu.Lock()
+	server.forbidFile = ""
+	server.mu.Unlock()
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+	completion, ok := downloader.ReadCompletion(seriesDir)
+	if !ok {
+		t.Fatalf("completed series has no %s", downloader.CompleteMarker)
+	}
+	if completion.Series != "laravel-basics" || completion.Episodes != 3 || completion.Downloaded != 1 || completion.Existing != 2 || completion.CompletedAt.IsZero() {
+		t.Errorf("completion = %+v, want 3 episodes, 1 downloaded and 2 existing", completion)
+	}
+
+	// A run with nothing to add keeps the marker of the run that completed it
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+	if again, _ := downloader.ReadCompletion(seriesDir); !again.CompletedAt.Equal(completion.CompletedAt) {
+		t.Errorf("completed_at = %v after a run with nothing new, want %v kept", again.CompletedAt, completion.CompletedAt)
+	}
+}
+
+func TestDownloadSeriesSkipsStreamsWithoutFFmpeg(t *testing.T) {
+	server := newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	dl.Vimeo.HasFFmpeg = false
+
+	if err := dl.DownloadSeries("stream-only"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v, want the stream skipped", err)
+	}
+
+	if got := server.Hits("GET", "/video/1004/config"); got != 1 {
+		t.Errorf("stream config requested %d times, want 1 without retries", got)
+	}
+	if len(dl.Report.Failures) != 1 || !dl.Report.Failures[0].Skipped {
+		t.Fatalf("Report.Failures = %+v, want one skipped video", dl.Report.Failures)
+	}
+	if got := dl.Report.Failures[0].Reason; got != vimeo.ErrFFmpegMissing.Error() {
+		t.Errorf("skip reason = %q, want %q", got, vimeo.ErrFFmpegMissing.Error())
+	}
+	if !dl.Report.Failures[0].NeedsFFmpeg {
+		t.Errorf("failure = %+v, want it marked as needing ffmpeg", dl.Report.Failures[0])
+	}
+	if _, err := os.Stat(filepath.Join(downloadPath, "stream-only", "01-progressive.mp4")); err != nil {
+		t.Errorf("progressive episode not downloaded: %v", err)
+	}
+}
+
+func TestDownloadSeriesArchivesMultipleQualities(t *testing.T) {
+	newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	dl.Qualities = []string{"720p", "1080p"}
+
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+
+	for filename, source := range map[string]string{
+		"01-introduction-to-laravel-720p.mp4":  "1001-720.mp4",
+		"01-introduction-to-laravel-1080p.mp4": "1001-1080.mp4",
+	} {
+		got, err := os.ReadFile(filepath.Join(downloadPath, "laravel-basics", filename))
+		if err != nil {
+			t.Errorf("variant %s not downloaded: %v", filename, err)
+			continue
+		}
+		if !bytes.Equal(got, mockVideo(source)) {
+			t.Errorf("variant %s content does not match %s", filename, source)
+		}
+	}
+}
+
+func TestDownloadSeriesReportsUnavailableQuality(t *testing.T) {
+	newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	dl.Qualities = []string{"2160p"}
+
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(downloadPath, "laravel-basics", "01-introduction-to-laravel.mp4"))
+	if err != nil || !bytes.Equal(got, mockVideo("1001-1080.mp4")) {
+		t.Errorf("episode not downloaded in the best quality offered: %v", err)
+	}
+
+	if len(dl.Report.Downgrades) != 3 {
+		t.Fatalf("Report.Downgrades = %+v, want the 3 episodes", dl.Report.Downgrades)
+	}
+	for _, d := range dl.Report.Downgrades {
+		if d.Requested != "2160p" || d.Quality != "1080p" {
+			t.Errorf("downgrade of %s = %s instead of %s, want 1080p instead of 2160p", d.Path, d.Quality, d.Requested)
+		}
+	}
+
+	var qualities map[string]string
+	if found, err := dl.Cache.Get("video_qualities", &qualities); err != nil || !found {
+		t.Fatalf("best qualities not cached: found=%v, err=%v", found, err)
+	}
+	if qualities["1001"] != "1080p" {
+		t.Errorf("cached best quality of 1001 = %q, want 1080p", qualities["1001"])
+	}
+}
+
+func TestDownloadSeriesInOrder(t *testing.T) {
+	server := newMockLaracasts(t)
+	dl := signedInDownloader(t, t.TempDir())
+	dl.Concurrency.Episodes = 1
+	dl.Order = downloader.OrderAlpha
+
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if want := []string{"1003", "1001", "1002"}; !slices.Equal(server.configs, want) {
+		t.Errorf("episodes downloaded in order %v, want %v (by title)", server.configs, want)
+	}
+}
+
+func TestDownloadSeriesFailsWithoutEpisodes(t *testing.T) {
+	newMockLaracasts(t)
+	dl := signedInDownloader(t, t.TempDir())
+	err := dl.DownloadBatch([]string{"new-layout", "laravel-basics"})
+	if err == nil || !strings.Contains(err.Error(), "failed to download 1 of 2 series: new-layout") {
+		t.Fatalf("DownloadBatch() error = %v, want new-layout failed", err)
+	}
+
+	if len(dl.Report.Unparsed) != 1 {
+		t.Fatalf("unparsed series = %+v, want new-layout", dl.Report.Unparsed)
+	}
+	if reason := dl.Report.Unparsed[0].Reason; !strings.Contains(reason, "series: sections, slug, title") {
+		t.Errorf("reason = %q, want the keys of the series props", reason)
+	}
+}
+
+func TestDownloadAllByTopicsSkipsUpToDateSeries(t *testing.T) {
+	server := newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	if err := dl.DownloadAllByTopics(); err != nil {
+		t.Fatalf("DownloadAllByTopics() error = %v", err)
+	}
+	if dl.Report.UpToDate != 0 {
+		t.Errorf("first run found %d series up to date, want 0", dl.Report.UpToDate)
+	}
+
+	// Nothing changed: the listings alone tell the library is up to date
+	pages, configs := server.Hits("GET", "/series/laravel-basics"), len(server.configs)
+	dl = newTestDownloader(t, downloadPath)
+	if err := dl.DownloadAllByTopics(); err != nil {
+		t.Fatalf("second DownloadAllByTopics() error = %v", err)
+	}
+	if hits := server.Hits("GET", "/series/laravel-basics"); hits != pages {
+		t.Errorf("up to date series fetched again (%d requests)", hits-pages)
+	}
+	if n := len(server.configs) - configs; n != 0 {
+		t.Errorf("%d player configs fetched for an up to date library", n)
+	}
+	if series := dl.Report.Series; dl.Report.UpToDate != 1 || len(series) != 1 || series[0].Existing != 3 {
+		t.Errorf("report = %d up to date, series %+v, want laravel-basics with 3 existing episodes", dl.Report.UpToDate, series)
+	}
+
+	// A missing video sends the series through the full sync again
+	episode := filepath.Join(downloadPath, "topics", naming.Sanitize("Laravel"), "laravel-basics", "02-routing-basics.mp4")
+	if err := os.Remove(episode); err != nil {
+		t.Fatal(err)
+	}
+	dl = newTestDownloader(t, downloadPath)
+	dl.DeletedPolicy = config.DeletedPolicyRedownload
+	if err := dl.DownloadAllByTopics(); err != nil {
+		t.Fatalf("third DownloadAllByTopics() error = %v", err)
+	}
+	if dl.Report.UpToDate != 0 || !fileExists(episode) {
+		t.Errorf("deleted episode not downloaded again (%d series up to date)", dl.Report.UpToDate)
+	}
+}
+
+func TestDownloadAllByTopicsRenamesSeriesUnderLock(t *testing.T) {
+	newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	if err := dl.DownloadAllByTopics(); err != nil {
+		t.Fatalf("DownloadAllByTopics() error = %v", err)
+	}
+
+	// The series was saved under its old title before being renamed
+	seriesDir := filepath.Join(downloadPath, "topics", naming.Sanitize("Laravel"), "laravel-basics")
+	oldDir := seriesDir + "-old"
+	if err := os.Rename(seriesDir, oldDir); err != nil {
+		t.Fatal(err)
+	}
+	catalog, _, err := dl.LoadCatalog()
+	if err != nil || catalog == nil {
+		t.Fatalf("LoadCatalog() = %v, %v", catalog, err)
+	}
+	catalog.Locations["series/laravel-basics"] = oldDir
+	if err := dl.Cache.Set("catalog", catalog); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another instance downloading the series keeps its folder in place
+	lockDir := filepath.Join(downloadPath, ".cache", "locks")
+	other, err := fsutil.TryLock(filepath.Join(lockDir, "series_laravel-basics.lock"))
+	if err != nil {
+		t.Fatalf("TryLock() error = %v", err)
+	}
+	dl = newTestDownloader(t, downloadPath)
+	if err := dl.DownloadAllByTopics(); err != nil {
+		t.Fatalf("locked DownloadAllByTopics() error = %v", err)
+	}
+	if !fileExists(filepath.Join(oldDir, "01-introduction-to-laravel.mp4")) || fileExists(seriesDir) {
+		t.Errorf("folder of a locked series renamed")
+	}
+	if catalog, _, _ := dl.LoadCatalog(); catalog.Locations["series/laravel-basics"] != oldDir {
+		t.Errorf("catalog location = %q, want the old folder kept for the next run", catalog.Locations["series/laravel-basics"])
+	}
+	if err := other.Unlock(); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+
+	dl = newTestDownloader(t, downloadPath)
+	if err := dl.DownloadAllByTopics(); err != nil {
+		t.Fatalf("DownloadAllByTopics() after unlock error = %v", err)
+	}
+	if fileExists(oldDir) || !fileExists(filepath.Join(seriesDir, "01-introduction-to-laravel.mp4")) {
+		t.Errorf("folder not renamed once the lock was released")
+	}
+	if catalog, _, _ := dl.LoadCatalog(); catalog.Locations["series/laravel-basics"] != seriesDir {
+		t.Errorf("catalog location = %q, want %q", catalog.Locations["series/laravel-basics"], seriesDir)
+	}
+}
+
+func TestDownloadAllByTopicsTrustsListedEpisodeCount(t *testing.T) {
+	server := newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	if err := dl.DownloadAllByTopics(); err != nil {
+		t.Fatalf("DownloadAllByTopics() error = %v", err)
+	}
+
+	cached := filepath.Join(downloadPath, ".cache", "series", "series_laravel-basics.json")
+	age := func(age time.Duration) {
+		t.Helper()
+		data, err := os.ReadFile(cached)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var entry map[string]any
+		if err := json.Unmarshal(data, &entry); err != nil {
+			t.Fatal(err)
+		}
+		entry["timestamp"] = time.Now().Add(-age)
+		if data, err = json.Marshal(entry); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(cached, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sync := func() int {
+		t.Helper()
+		pages := server.Hits("GET", "/series/laravel-basics")
+		dl := newTestDownloader(t, downloadPath)
+		dl.DeletedPolicy = config.DeletedPolicyRedownload
+		if err := dl.DownloadAllByTopics(); err != nil {
+			t.Fatalf("DownloadAllByTopics() error = %v", err)
+		}
+		return server.Hits("GET", "/series/laravel-basics") - pages
+	}
+
+	// Metadata older than a week is kept while the listing's episode count
+	// matches it, also by the full sync a missing episode sends it through
+	age(downloader.SeriesCacheMaxAge + time.Hour)
+	if err := os.Remove(filepath.Join(downloadPath, "topics", naming.Sanitize("Laravel"), "laravel-basics", "02-routing-basics.mp4")); err != nil {
+		t.Fatal(err)
+	}
+	if hits := sync(); hits != 0 {
+		t.Errorf("series page with a matching episode count fetched %d times, want none", hits)
+	}
+
+	// Past the safety net it is fetched again, though nothing is missing
+	age(downloader.SeriesListedMaxAge + time.Hour)
+	if hits := sync(); hits != 1 {
+		t.Errorf("series page older than SeriesListedMaxAge fetched %d times, want once", hits)
+	}
+}
+
+func TestDownloadAllByTopicsKeepsFailedTopicsInCatalog(t *testing.T) {
+	server := newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	if err := dl.DownloadAllByTopics(); err != nil {
+		t.Fatalf("DownloadAllByTopics() error = %v", err)
+	}
+	before, _, err := dl.LoadCatalog()
+	if err != nil || before == nil {
+		t.Fatalf("LoadCatalog() = %v, %v", before, err)
+	}
+
+	server.mu.Lock()
+	server.failTopic = "/topics/laravel"
+	server.mu.Unlock()
+	dl = newTestDownloader(t, downloadPath)
+	if err := dl.DownloadAllByTopics(); err == nil {
+		t.Fatal("DownloadAllByTopics() with a failing topic succeeded")
+	}
+
+	after, _, err := dl.LoadCatalog()
+	if err != nil || after == nil {
+		t.Fatalf("LoadCatalog() = %v, %v", after, err)
+	}
+	if !reflect.DeepEqual(after.Topics, before.Topics) || !reflect.DeepEqual(after.Locations, before.Locations) {
+		t.Errorf("catalog after a failed topic = %+v, %v, want the previous listing %+v, %v",
+			after.Topics, after.Locations, before.Topics, before.Locations)
+	}
+}
+
+func TestDownloadAllByTopicsMovesFoldersOfOlderNames(t *testing.T) {
+	server := newMockLaracasts(t)
+	// Older versions kept the trailing dots of the topic name
+	server.browsePage = "browse/dotted"
+	downloadPath := t.TempDir()
+	oldDir := filepath.Join(downloadPath, "topics", "laravel...", "laravel-basics")
+	if err := os.MkdirAll(oldDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(oldDir, "01-introduction-to-laravel.mp4"), mockVideo("1001-1080.mp4"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dl := signedInDownloader(t, downloadPath)
+	if err := dl.DownloadAllByTopics(); err != nil {
+		t.Fatalf("DownloadAllByTopics() error = %v", err)
+	}
+	if fileExists(oldDir) {
+		t.Error("folder of the older name left in place")
+	}
+	if !fileExists(filepath.Join(downloadPath, "topics", "laravel", "laravel-basics", "01-introduction-to-laravel.mp4")) {
+		t.Error("episode of the older folder not moved to the current one")
+	}
+	// Only the episodes missing from the older folder are downloaded
+	if hits := server.HitsWithPrefix("GET", "/files/"); hits != 2 {
+		t.Errorf("made %d video requests, want 2", hits)
+	}
+}
+
+func TestDownloadAllByTopicsSkipsArchivedSeries(t *testing.T) {
+	server := newMockLaracasts(t)
+	// The topic lists revised-course as archived, and coming-soon without
+	// episodes
+	server.browsePage = "browse/legacy"
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	if err := dl.DownloadAllByTopics(); err != nil {
+		t.Fatalf("DownloadAllByTopics() error = %v", err)
+	}
+	if hits := server.Hits("GET", "/series/revised-course"); hits != 0 {
+		t.Errorf("archived series fetched %d times, want it skipped", hits)
+	}
+	if !slices.Equal(dl.Report.Archived, []string{"revised-course"}) {
+		t.Errorf("Report.Archived = %v, want revised-course", dl.Report.Archived)
+	}
+	// So is the series listed without episodes yet
+	if hits := server.Hits("GET", "/series/coming-soon"); hits != 0 || len(dl.Report.Unparsed) != 0 {
+		t.Errorf("series without episodes fetched %d times (unparsed %v), want it skipped", hits, dl.Report.Unparsed)
+	}
+
+	dl = newTestDownloader(t, downloadPath)
+	dl.IncludeArchived = true
+	if err := dl.DownloadAllByTopics(); err != nil {
+		t.Fatalf("DownloadAllByTopics() with archived series error = %v", err)
+	}
+	if len(dl.Report.Archived) != 0 || !fileExists(filepath.Join(downloadPath, "topics", naming.Sanitize("Laravel"), "revised-course", "03-controllers.mp4")) {
+		t.Errorf("archived series not downloaded with IncludeArchived (skipped %v)", dl.Report.Archived)
+	}
+
+	// Listings show the archived flag of the series page
+	for _, series := range dl.Inventory() {
+		if series.Slug == "revised-course" && series.Status() != "complete, archived" {
+			t.Errorf("Status() = %q, want complete, archived", series.Status())
+		}
+	}
+}
+
+func TestDownloadSeriesRefreshesMetadataAndForcesDownload(t *testing.T) {
+	server := newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+	episode := filepath.Join(downloadPath, "laravel-basics", "01-introduction-to-laravel.mp4")
+	if err := os.WriteFile(episode, []byte("edited"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Refreshing the metadata leaves completed episodes alone
+	dl = newTestDownloader(t, downloadPath)
+	dl.RefreshMetadata = true
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() with RefreshMetadata error = %v", err)
+	}
+	if hits := server.Hits("GET", "/series/laravel-basics"); hits != 2 {
+		t.Errorf("series page fetched %d times, want 2 with RefreshMetadata", hits)
+	}
+	if got, _ := os.ReadFile(episode); string(got) != "edited" {
+		t.Error("RefreshMetadata downloaded a completed episode again")
+	}
+
+	// Forcing the download replaces it, from the cached metadata
+	dl = newTestDownloader(t, downloadPath)
+	dl.ForceDownload = true
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() with ForceDownload error = %v", err)
+	}
+	if hits := server.Hits("GET", "/series/laravel-basics"); hits != 2 {
+		t.Errorf("series page fetched %d times, want the cached metadata used with ForceDownload", hits)
+	}
+	if got, _ := os.ReadFile(episode); !bytes.Equal(got, mockVideo("1001-1080.mp4")) {
+		t.Error("ForceDownload did not download the episode again")
+	}
+	if series := dl.Report.Series; len(series) != 1 || series[0].Downloaded != 3 {
+		t.Errorf("report series = %+v, want all 3 episodes downloaded", series)
+	}
+}
+
+func TestDownloadSeriesNoCacheBypassesMetadata(t *testing.T) {
+	server := newMockLaracasts(t)
+	downloadPath := t.TempDir()
+
+	// Sizes are probed and cached by the second run, fetched again without
+	// the cache by the third, and the fourth uses what the third cached
+	wantConfigs := []int{3, 3, 3, 0}
+	wantPages := []int{1, 1, 2, 2}
+	for run, noCache := range []bool{false, false, true, false} {
+		dl := newTestDownloader(t, downloadPath)
+		dl.RedownloadMismatched = run > 0
+		dl.NoCache = noCache
+
+		configs := len(server.configs)
+		if err := dl.DownloadSeries("laravel-basics"); err != nil {
+			t.Fatalf("run %d: DownloadSeries() error = %v", run+1, err)
+		}
+		if got := len(server.configs) - configs; got != wantConfigs[run] {
+			t.Errorf("run %d: %d player configs fetched, want %d", run+1, got, wantConfigs[run])
+		}
+		if got := server.Hits("GET", "/series/laravel-basics"); got != wantPages[run] {
+			t.Errorf("run %d: series page fetched %d times in total, want %d", run+1, got, wantPages[run])
+		}
+		if series := dl.Report.Series; len(series) != 1 || (run > 0 && series[0].Downloaded != 0) {
+			t.Errorf("run %d: report series = %+v, want nothing downloaded again", run+1, series)
+		}
+	}
+}
+
+func TestDownloadSeriesSignsBackInWhenSignedOut(t *testing.T) {
+	server := newMockLaracasts(t)
+	server.kickSession = true
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	dl.Concurrency.Episodes = 4
+
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+
+	if logins := server.Hits("POST", "/sessions"); logins != 2 {
+		t.Errorf("%d logins, want one more after being signed out", logins)
+	}
+	if _, err := os.Stat(filepath.Join(downloadPath, "laravel-basics", "03-controllers.mp4")); err != nil {
+		t.Errorf("series not downloaded after signing back in: %v", err)
+	}
+	if dl.Report.SignedOut != 1 {
+		t.Errorf("Report.SignedOut = %d, want 1", dl.Report.SignedOut)
+	}
+
+	// Without signing back in, the series fails instead of being parsed as
+	// a guest sees it
+	server.kickSession = true
+	dl = signedInDownloader(t, t.TempDir())
+	dl.AutoRelogin = false
+
+	if err := dl.DownloadSeries("laravel-basics"); !errors.Is(err, downloader.ErrLoggedOut) {
+		t.Fatalf("DownloadSeries() error = %v, want ErrLoggedOut", err)
+	}
+}
+
+func TestSignBackInOnceWhileLoginIsRateLimited(t *testing.T) {
+	server := newMockLaracasts(t)
+	// Both series are fetched at once, and signed out together
+	server.browsePage = "browse/legacy"
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	dl.IncludeArchived = true
+	dl.Concurrency.Series = 2
+
+	server.mu.Lock()
+	server.kickSession = true
+	server.throttleLogins = 1
+	server.mu.Unlock()
+	if err := dl.DownloadAllByTopics(); err != nil {
+		t.Fatalf("DownloadAllByTopics() error = %v", err)
+	}
+
+	// The first login, the rate limited one and the one after Retry-After
+	if logins := server.Hits("POST", "/sessions"); logins != 3 {
+		t.Errorf("%d logins, want 3", logins)
+	}
+	if dl.Report.SignedOut != 1 {
+		t.Errorf("Report.SignedOut = %d, want 1", dl.Report.SignedOut)
+	}
+	for _, series := range []string{"laravel-basics", "revised-course"} {
+		if _, err := os.Stat(filepath.Join(downloadPath, "topics", naming.Sanitize("Laravel"), series, downloader.CompleteMarker)); err != nil {
+			t.Errorf("%s not downloaded after signing back in: %v", series, err)
+		}
+	}
+}
+
+func TestGiveUpSigningBackInOnALongRetryAfter(t *testing.T) {
+	server := newMockLaracasts(t)
+	dl := signedInDownloader(t, t.TempDir())
+	server.mu.Lock()
+	server.kickSession = true
+	server.throttleLogins = 1
+	server.retryLogins = "3600"
+	server.mu.Unlock()
+
+	// Rather than waiting an hour with the run stalled
+	started := time.Now()
+	if err := dl.DownloadSeries("laravel-basics"); !errors.Is(err, downloader.ErrLoggedOut) {
+		t.Fatalf("DownloadSeries() error = %v, want ErrLoggedOut", err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Minute {
+		t.Errorf("gave up after %s", elapsed)
+	}
+	if logins := server.Hits("POST", "/sessions"); logins != 2 {
+		t.Errorf("%d logins, want 2", logins)
+	}
+}
+
+func TestDownloadSeriesCatchesUpOnNewEpisodes(t *testing.T) {
+	server := newMockLaracasts(t)
+	server.republish = true
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	dl.CatchUpAfter = time.Nanosecond
+
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(downloadPath, "laravel-basics", "04-middleware.mp4"))
+	if err != nil {
+		t.Fatalf("episode published during the download not fetched: %v", err)
+	}
+	if !bytes.Equal(got, mockVideo("1005-1080.mp4")) {
+		t.Error("04-middleware.mp4 content does not match 1005-1080.mp4")
+	}
+	if hits := server.Hits("GET", "/series/laravel-basics"); hits != 2 {
+		t.Errorf("series page fetched %d times, want 2", hits)
+	}
+	if series := dl.Report.Series; len(series) != 1 || series[0].Total != 4 || series[0].Downloaded != 4 {
+		t.Errorf("report series = %+v, want 4 of 4 episodes downloaded", series)
+	}
+}
+
+func TestDownloadSeriesDisambiguatesDuplicateFilenames(t *testing.T) {
+	newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	if err := dl.DownloadSeries("duplicate-titles"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+
+	seriesDir := filepath.Join(downloadPath, "duplicate-titles")
+	want := map[string]string{
+		"01-setup.mp4":      "1001-1080.mp4",
+		"01-setup-1002.mp4": "1002-1080.mp4",
+	}
+	for filename, source := range want {
+		got, err := os.ReadFile(filepath.Join(seriesDir, filename))
+		if err != nil {
+			t.Errorf("episode %s not downloaded: %v", filename, err)
+			continue
+		}
+		if !bytes.Equal(got, mockVideo(source)) {
+			t.Errorf("episode %s content does not match %s", filename, source)
+		}
+	}
+}
+
+func TestDownloadSeriesFailsOverToMirror(t *testing.T) {
+	server := newMockLaracasts(t)
+
+	// The primary edge fails every request; the mock is configured as mirror
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	}))
+	t.Cleanup(broken.Close)
+	config.LaracastsBaseUrl = broken.URL
+	t.Setenv("LARACASTS_MIRRORS", server.URL)
+
+	downloadPath := t.TempDir()
+	dl := newTestDownloader(t, downloadPath)
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+
+	if got := server.Hits("GET", "/series/laravel-basics"); got != 1 {
+		t.Errorf("mirror served the series page %d times, want 1", got)
+	}
+	if _, err := os.Stat(filepath.Join(downloadPath, "laravel-basics", "01-introduction-to-laravel.mp4")); err != nil {
+		t.Errorf("episode not downloaded through the mirror: %v", err)
+	}
+}
+
+func TestDownloadSeriesFiltersByTagAndDifficulty(t *testing.T) {
+	server := newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	dl.Filter.Tags = []string{"testing"}
+	dl.Filter.Difficulty = "beginner"
+
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+
+	seriesDir := filepath.Join(downloadPath, "laravel-basics")
+	for filename, want := range map[string]bool{
+		"01-introduction-to-laravel.mp4": false,
+		"02-routing-basics.mp4":          false,
+		"03-controllers.mp4":             true,
+	} {
+		if _, err := os.Stat(filepath.Join(seriesDir, filename)); (err == nil) != want {
+			t.Errorf("%s downloaded = %v, want %v", filename, err == nil, want)
+		}
+	}
+
+	// A beginner series has no advanced episodes
+	advanced := signedInDownloader(t, t.TempDir())
+	advanced.Filter.Difficulty = "advanced"
+
+	if err := advanced.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+	if got := advanced.Report.Series[0]; got.Filtered != 3 || got.Downloaded != 0 {
+		t.Errorf("advanced filter = %d filtered, %d downloaded, want all 3 filtered", got.Filtered, got.Downloaded)
+	}
+	// Metadata cached before tags and difficulties were kept is fetched
+	// again, rather than the filter passing every episode
+	cached := filepath.Join(downloadPath, ".cache", "series", "series_laravel-basics.json")
+	data, err := os.ReadFile(cached)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entry any
+	if err := json.Unmarshal(data, &entry); err != nil {
+		t.Fatal(err)
+	}
+	var strip func(any)
+	strip = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			delete(v, "Tags")
+			delete(v, "Difficulty")
+			for _, child := range v {
+				strip(child)
+			}
+		case []any:
+			for _, child := range v {
+				strip(child)
+			}
+		}
+	}
+	strip(entry)
+	if data, err = json.Marshal(entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cached, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	pages := server.Hits("GET", "/series/laravel-basics")
+	dl = newTestDownloader(t, downloadPath)
+	dl.Filter.Tags = []string{"testing"}
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() from metadata without tags error = %v", err)
+	}
+	if hits := server.Hits("GET", "/series/laravel-basics"); hits != pages+1 {
+		t.Errorf("series page fetched %d times, want once for the tags", hits-pages)
+	}
+	if got := dl.Report.Series[0]; got.Filtered != 2 {
+		t.Errorf("tag filter on refreshed metadata filtered %d episodes, want 2", got.Filtered)
+	}
+}
+
+func TestDownloadSeriesRefreshesMetadataLackingFilteredFields(t *testing.T) {
+	server := newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+
+	// No cached episode has a publish date, so the page is fetched again
+	// rather than the age filter passing everything
+	pages := server.Hits("GET", "/series/laravel-basics")
+	dl = newTestDownloader(t, downloadPath)
+	dl.Filter.MaxAge = 30 * 24 * time.Hour
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() with an age filter error = %v", err)
+	}
+	if hits := server.Hits("GET", "/series/laravel-basics"); hits != pages+1 {
+		t.Errorf("series page fetched %d times, want once for the publish dates", hits-pages)
+	}
+	if got := dl.Report.Series[0]; got.Filtered != 0 || got.Existing != 3 {
+		t.Errorf("report = %d filtered, %d existing, want the undated episodes kept", got.Filtered, got.Existing)
+	}
+}
+
+func TestDownloadSeriesSelectedChapters(t *testing.T) {
+	newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+
+	chapters, err := downloader.ParseChapters("2-2, 5")
+	if err != nil {
+		t.Fatalf("ParseChapters() error = %v", err)
+	}
+	dl.Filter.Chapters = chapters
+	for _, invalid := range []string{"0", "3-1", "a", ",", "1-10001", "1-9999999999999999999"} {
+		if _, err := downloader.ParseChapters(invalid); err == nil {
+			t.Errorf("ParseChapters(%q) succeeded, want error", invalid)
+		}
+	}
+
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+
+	for filename, want := range map[string]bool{
+		"01-introduction-to-laravel.mp4": false,
+		"02-routing-basics.mp4":          false,
+		"03-controllers.mp4":             true,
+	} {
+		_, err := os.Stat(filepath.Join(downloadPath, "laravel-basics", filename))
+		if got := err == nil; got != want {
+			t.Errorf("%s downloaded = %v, want %v", filename, got, want)
+		}
+	}
+}
+
+func TestDownloadSeriesCountsCacheHits(t *testing.T) {
+	newMockLaracasts(t)
+	downloadPath := t.TempDir()
+
+	first := signedInDownloader(t, downloadPath)
+	if err := first.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+	if stats := first.Cache.Stats.Snapshot(); stats.Misses != 1 || stats.Hits != 0 {
+		t.Errorf("first run cache stats = %+v, want one miss", stats)
+	}
+
+	second := newTestDownloader(t, downloadPath)
+	if err := second.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+	if stats := second.Cache.Stats.Snapshot(); stats.Hits != 1 || stats.BytesSaved == 0 {
+		t.Errorf("second run cache stats = %+v, want one hit saving the page data", stats)
+	}
+}
+
+func TestDownloadSeriesFallsBackWhenRangeIgnored(t *testing.T) {
+	server := newMockLaracasts(t)
+	server.ignoreRange = true
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	dl.Vimeo.SmallFileThreshold = 0
+
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(downloadPath, "laravel-basics", "03-controllers.mp4"))
+	if err != nil || !bytes.Equal(got, mockVideo("1003-1080.mp4")) {
+		t.Errorf("episode downloaded after range fallback does not match: %v", err)
+	}
+}
+
+func TestDownloadSeriesSignsPrivateVideoConfigs(t *testing.T) {
+	server := newMockLaracasts(t)
+	server.privateVideos = map[string]string{"1003": "5f3e9a1b2c"}
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	if err := dl.DownloadSeries("private-videos"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(downloadPath, "private-videos", "01-signed.mp4")); err != nil {
+		t.Errorf("private video not downloaded: %v", err)
+	}
+
+	// The hash is kept with the cached metadata for later runs
+	dl = signedInDownloader(t, downloadPath)
+	if err := os.Remove(filepath.Join(downloadPath, "private-videos", "01-signed.mp4")); err != nil {
+		t.Fatal(err)
+	}
+	dl.DeletedPolicy = config.DeletedPolicyRedownload
+	if err := dl.DownloadSeries("private-videos"); err != nil {
+		t.Errorf("DownloadSeries() from cached metadata error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(downloadPath, "private-videos", "01-signed.mp4")); err != nil {
+		t.Errorf("private video not downloaded again: %v", err)
+	}
+	// Metadata cached before hashes were kept is fetched again for them
+	cached := filepath.Join(downloadPath, ".cache", "series", "series_private-videos.json")
+	data, err := os.ReadFile(cached)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = bytes.ReplaceAll(data, []byte(`"5f3e9a1b2c"`), []byte(`""`))
+	if err := os.WriteFile(cached, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(downloadPath, "private-videos", "01-signed.mp4")); err != nil {
+		t.Fatal(err)
+	}
+	pages := server.Hits("GET", "/series/private-videos")
+	dl = newTestDownloader(t, downloadPath)
+	dl.DeletedPolicy = config.DeletedPolicyRedownload
+	if err := dl.DownloadSeries("private-videos"); err != nil {
+		t.Errorf("DownloadSeries() from metadata without hashes error = %v", err)
+	}
+	if hits := server.Hits("GET", "/series/private-videos"); hits != pages+1 {
+		t.Errorf("series page fetched %d times for the missing hash, want once", hits-pages)
+	}
+	if _, err := os.Stat(filepath.Join(downloadPath, "private-videos", "01-signed.mp4")); err != nil {
+		t.Errorf("private video not downloaded with the refreshed hash: %v", err)
+	}
+}
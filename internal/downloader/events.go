@@ -0,0 +1,210 @@
+package downloader
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/fsutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// EventsFile is the JSON Lines log of download events, in the cache directory
+const EventsFile = "events.ndjson"
+
+const (
+	// EventLogMaxSize is the size past which the event log is rotated
+	EventLogMaxSize = 10 * 1024 * 1024
+
+	// eventLogBackups is how many rotated logs are kept, as events.ndjson.1
+	// (the most recent) to events.ndjson.N
+	eventLogBackups = 3
+)
+
+// Event types
+const (
+	EventEpisodeCompleted = "episode_completed"
+	EventEpisodeFailed    = "episode_failed"
+	EventChunkRetry       = "chunk_retry"
+	EventSeriesFailed     = "series_failed"
+)
+
+// Event is one line of the event log. Fields that do not apply to its type
+// are left out.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Series  string    `json:"series,omitempty"` // slug
+	Episode string    `json:"episode,omitempty"`
+	VimeoId string    `json:"vimeo_id,omitempty"`
+	Path    string    `json:"path,omitempty"` // relative to the download path
+	Host    string    `json:"host,omitempty"`
+	Bytes   int64     `json:"bytes,omitempty"`
+	Seconds float64   `json:"seconds,omitempty"`
+	Attempt int       `json:"attempt,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// EventLog appends events to a JSON Lines file, for analysis after the fact
+// with jq or the stats command. Writing is best effort: a log that cannot be
+// written never fails a download.
+type EventLog struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewEventLog(path string) *EventLog {
+	return &EventLog{path: path}
+}
+
+// Record appends e, stamped with the current time, rotating the log first
+// when it grew past EventLogMaxSize
+func (l *EventLog) Record(e Event) {
+	if l == nil {
+		return
+	}
+	e.Time = time.Now().UTC()
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if info, err := os.Stat(l.path); err == nil && info.Size()+int64(len(line)) > EventLogMaxSize {
+		l.rotate()
+	}
+
+	file, err := fsutil.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	_, _ = file.Write(append(line, '\n'))
+}
+
+// rotate shifts the backups by one, dropping the oldest
+func (l *EventLog) rotate() {
+	for i := eventLogBackups - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+	}
+	_ = os.Rename(l.path, l.path+".1")
+}
+
+// ReadEvents returns the events of the log at path and its backups, oldest
+// first. Lines that do not parse, like one cut short by a crash, are skipped.
+func ReadEvents(path string) ([]Event, error) {
+	var events []Event
+	for i := eventLogBackups; i >= 0; i-- {
+		name := path
+		if i > 0 {
+			name = fmt.Sprintf("%s.%d", path, i)
+		}
+		file, err := os.Open(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var e Event
+			if json.Unmarshal(scanner.Bytes(), &e) == nil {
+				events = append(events, e)
+			}
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", name, err)
+		}
+	}
+	return events, nil
+}
+
+// chunkRetried records a chunk of the video saved to outputPath failing and
+// about to be fetched again
+func (d *Downloader) chunkRetried(outputPath, rawURL string, attempt int, err error) {
+	host := rawURL
+	if u, parseErr := url.Parse(rawURL); parseErr == nil {
+		host = u.Host
+	}
+	d.Events.Record(Event{
+		Type:    EventChunkRetry,
+		Path:    d.relativePath(outputPath),
+		Host:    host,
+		Attempt: attempt,
+		Error:   err.Error(),
+	})
+}
+
+// seriesFailed records a series that could not be downloaded completely
+func (d *Downloader) seriesFailed(seriesSlug string, err error) {
+	d.Events.Record(Event{Type: EventSeriesFailed, Series: checkpointSlug(seriesSlug), Error: err.Error()})
+}
+
+// PrintStats sums up the event log: what was downloaded how fast, which CDN
+// hosts needed retries and which series failed
+func (d *Downloader) PrintStats() error {
+	events, err := ReadEvents(filepath.Join(d.Cache.BasePath, EventsFile))
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		fmt.Println("No download events recorded yet")
+		return nil
+	}
+
+	var episodes, failedEpisodes int
+	var bytes int64
+	var seconds float64
+	retries := make(map[string]int)
+	seriesFailures := make(map[string]int)
+	for _, e := range events {
+		switch e.Type {
+		case EventEpisodeCompleted:
+			episodes++
+			bytes += e.Bytes
+			seconds += e.Seconds
+		case EventEpisodeFailed:
+			failedEpisodes++
+		case EventChunkRetry:
+			retries[e.Host]++
+		case EventSeriesFailed:
+			seriesFailures[e.Series]++
+		}
+	}
+
+	fmt.Printf("Events from %s to %s\n", events[0].Time.Local().Format("2006-01-02 15:04"),
+		events[len(events)-1].Time.Local().Format("2006-01-02 15:04"))
+	fmt.Printf("Episodes downloaded: %d (%s)", episodes, formatBytes(bytes))
+	if seconds > 0 {
+		fmt.Printf(", %s/s per episode on average", formatBytes(int64(float64(bytes)/seconds)))
+	}
+	fmt.Println()
+	fmt.Printf("Episodes failed: %d\n", failedEpisodes)
+
+	printCounts("Chunk retries by host", retries)
+	printCounts("Series failures", seriesFailures)
+	return nil
+}
+
+// printCounts lists counts by key, the most frequent first
+func printCounts(title string, counts map[string]int) {
+	if len(counts) == 0 {
+		return
+	}
+	keys := sortedKeys(counts)
+	sort.SliceStable(keys, func(i, j int) bool { return counts[keys[i]] > counts[keys[j]] })
+
+	fmt.Printf("\n%s:\n", title)
+	for _, key := range keys {
+		fmt.Printf("  %-40s %d\n", key, counts[key])
+	}
+}
@@ -0,0 +1,44 @@
+package downloader_test
+
+import (
+	"github.com/sajjadanwar0/laracasts-dl/internal/downloader"
+	"maps"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEventLogRecordsOutcomes(t *testing.T) {
+	server := newMockLaracasts(t)
+	server.forbidFile = "1002-1080.mp4"
+	dl := signedInDownloader(t, t.TempDir())
+	if err := dl.DownloadSeries("laravel-basics"); err == nil {
+		t.Fatal("DownloadSeries() error = nil, want the forbidden episode failed")
+	}
+
+	events, err := downloader.ReadEvents(filepath.Join(dl.Cache.BasePath, downloader.EventsFile))
+	if err != nil {
+		t.Fatalf("ReadEvents() error = %v", err)
+	}
+	counts := make(map[string]int)
+	for _, e := range events {
+		counts[e.Type]++
+		if e.Time.IsZero() {
+			t.Errorf("event %+v has no timestamp", e)
+		}
+		switch e.Type {
+		case downloader.EventEpisodeCompleted:
+			if e.Series != "laravel-basics" || e.Bytes == 0 || !strings.HasPrefix(e.Path, "laravel-basics") {
+				t.Errorf("completed event = %+v, want the series, path and size", e)
+			}
+		case downloader.EventEpisodeFailed:
+			if e.VimeoId != "1002" || e.Error == "" {
+				t.Errorf("failed event = %+v, want episode 1002 and the reason", e)
+			}
+		}
+	}
+	want := map[string]int{downloader.EventEpisodeCompleted: 2, downloader.EventEpisodeFailed: 1, downloader.EventSeriesFailed: 1}
+	if !maps.Equal(counts, want) {
+		t.Errorf("events by type = %v, want %v", counts, want)
+	}
+}
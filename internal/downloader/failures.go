@@ -0,0 +1,86 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"github.com/sajjadanwar0/laracasts-dl/internal/vimeo"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+// Failure categories, each calling for a different remedy
+const (
+	FailureNetwork     = "network"      // connection problems, worth retrying
+	FailureRateLimited = "rate_limited" // throttled, retry after a pause
+	FailureAccess      = "access"       // refused, check the login and subscription
+	FailureUnavailable = "unavailable"  // removed or region-blocked, never retried
+	FailureDisk        = "disk"         // the download path is full, read-only or failing
+	FailureFFmpeg      = "ffmpeg"       // stream conversion failed
+	FailureOther       = "other"
+)
+
+// failureCategories orders the categories in the summary
+var failureCategories = []string{
+	FailureAccess, FailureRateLimited, FailureNetwork, FailureDisk,
+	FailureFFmpeg, FailureUnavailable, FailureOther,
+}
+
+// failureHints tell what to do about each category of failed videos
+var failureHints = map[string]string{
+	FailureNetwork:     "check the connection and run again",
+	FailureRateLimited: "wait a while, or lower the concurrency, and run again",
+	FailureAccess:      "check that the session is logged in with an active subscription",
+	FailureDisk:        "free up space, or check that the download path is writable and its disk healthy",
+	FailureFFmpeg:      "check the ffmpeg output above, updating ffmpeg may help",
+}
+
+// FailureCategory classifies why a video failed to download
+func FailureCategory(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	switch {
+	case errors.Is(err, vimeo.ErrFFmpegFailed), errors.Is(err, vimeo.ErrFFmpegMissing):
+		return FailureFFmpeg
+	case vimeo.IsPermanent(err):
+		return FailureUnavailable
+	case isDiskError(err):
+		return FailureDisk
+	case errors.As(err, new(*fs.PathError)):
+		// Any other error of a file; its syscall error would pass for a
+		// network error below
+		return FailureOther
+	}
+
+	switch status := vimeo.StatusCode(err); {
+	case status == http.StatusTooManyRequests:
+		return FailureRateLimited
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return FailureAccess
+	case status >= 500:
+		return FailureNetwork
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, context.DeadlineExceeded) || errors.Is(err, syscall.ECONNRESET) {
+		return FailureNetwork
+	}
+	return FailureOther
+}
+
+// isDiskError reports whether err is the download path running out of space
+// or quota, turning read-only or failing, which no retry fixes. Other file
+// errors, e.g. a name the filesystem refuses, only fail their own video.
+func isDiskError(err error) bool {
+	for _, errno := range []syscall.Errno{syscall.ENOSPC, syscall.EDQUOT, syscall.EROFS, syscall.EIO} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
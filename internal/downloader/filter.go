@@ -0,0 +1,189 @@
+package downloader
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EpisodeFilter limits planning to recent episodes, a range of durations,
+// tags, a difficulty or some chapters. Zero values disable a bound, and
+// episodes whose metadata lacks the relevant field are always allowed (see
+// missingFields).
+type EpisodeFilter struct {
+	MaxAge      time.Duration
+	MinDuration time.Duration
+	MaxDuration time.Duration
+
+	// Tags keeps episodes with any of these tags and Difficulty those of
+	// that level, both compared case-insensitively
+	Tags       []string
+	Difficulty string
+
+	// Chapters keeps the chapters with these numbers, counted from 1 in the
+	// order the series lists them
+	Chapters []int
+}
+
+// AllowsSeries reports whether a series listed on a topic page can contain
+// episodes passing the filter, so series of another difficulty or without
+// any of the tags are not even fetched
+func (f EpisodeFilter) AllowsSeries(series TopicSeries) bool {
+	return f.allowsLabels(series.Tags, series.Difficulty)
+}
+
+// AllowsChapter reports whether the chapter with number n is selected
+func (f EpisodeFilter) AllowsChapter(n int) bool {
+	if len(f.Chapters) == 0 {
+		return true
+	}
+	for _, chapter := range f.Chapters {
+		if chapter == n {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether episode passes the filter at time now
+func (f EpisodeFilter) Allows(episode Episode, now time.Time) bool {
+	if f.MaxAge > 0 && !episode.PublishedAt.IsZero() && now.Sub(episode.PublishedAt) > f.MaxAge {
+		return false
+	}
+
+	length := time.Duration(episode.Length) * time.Second
+	if episode.Length > 0 {
+		if f.MinDuration > 0 && length < f.MinDuration {
+			return false
+		}
+		if f.MaxDuration > 0 && length > f.MaxDuration {
+			return false
+		}
+	}
+
+	return f.allowsLabels(episode.Tags, episode.Difficulty)
+}
+
+// missingFields names the fields the filter needs that episode lacks, which
+// Allows lets through whatever their value would have been
+func (f EpisodeFilter) missingFields(episode Episode) []string {
+	var missing []string
+	if f.MaxAge > 0 && episode.PublishedAt.IsZero() {
+		missing = append(missing, "publish date")
+	}
+	if (f.MinDuration > 0 || f.MaxDuration > 0) && episode.Length <= 0 {
+		missing = append(missing, "length")
+	}
+	if len(f.Tags) > 0 && len(episode.Tags) == 0 {
+		missing = append(missing, "tags")
+	}
+	if f.Difficulty != "" && episode.Difficulty == "" {
+		missing = append(missing, "difficulty")
+	}
+	return missing
+}
+
+// lacksEverywhere reports whether no episode of seriesData has a field the
+// filter needs, as in metadata cached before that field was kept
+func (f EpisodeFilter) lacksEverywhere(seriesData *SeriesMetadata) bool {
+	lacking := make(map[string]int)
+	episodes := 0
+	for _, chapter := range seriesData.Chapters {
+		for _, episode := range chapter.Episodes {
+			episodes++
+			for _, field := range f.missingFields(episode) {
+				lacking[field]++
+			}
+		}
+	}
+	for _, n := range lacking {
+		if n == episodes {
+			return true
+		}
+	}
+	return false
+}
+
+func (f EpisodeFilter) allowsLabels(tags []string, difficulty string) bool {
+	if f.Difficulty != "" && difficulty != "" && !strings.EqualFold(f.Difficulty, difficulty) {
+		return false
+	}
+	if len(f.Tags) == 0 || len(tags) == 0 {
+		return true
+	}
+	for _, want := range f.Tags {
+		for _, tag := range tags {
+			if strings.EqualFold(want, tag) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// maxChapter bounds the chapter numbers of a selection, far above the
+// chapters of any series, so a typo such as "1-1000000000" fails instead of
+// allocating every number of the range
+const maxChapter = 10000
+
+// ParseChapters parses a chapter selection such as "2,4-6" into the sorted
+// chapter numbers it covers
+func ParseChapters(selection string) ([]int, error) {
+	seen := make(map[int]bool)
+	var chapters []int
+	for _, part := range strings.Split(selection, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		first, last, isRange := strings.Cut(part, "-")
+		from, err := strconv.Atoi(strings.TrimSpace(first))
+		to := from
+		if err == nil && isRange {
+			to, err = strconv.Atoi(strings.TrimSpace(last))
+		}
+		if err != nil || from < 1 || to < from {
+			return nil, fmt.Errorf("invalid chapters %q, expected e.g. 2,4-6", part)
+		}
+		if to > maxChapter {
+			return nil, fmt.Errorf("invalid chapters %q, chapters go up to %d", part, maxChapter)
+		}
+
+		for n := from; n <= to; n++ {
+			if !seen[n] {
+				seen[n] = true
+				chapters = append(chapters, n)
+			}
+		}
+	}
+	if len(chapters) == 0 {
+		return nil, fmt.Errorf("no chapters selected")
+	}
+
+	sort.Ints(chapters)
+	return chapters, nil
+}
+
+// ParseAge parses an age such as "90d" or "2w", also accepting anything
+// time.ParseDuration understands
+func ParseAge(age string) (time.Duration, error) {
+	age = strings.TrimSpace(age)
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(age, suffix); ok {
+			count, err := strconv.Atoi(n)
+			if err != nil || count < 0 {
+				return 0, fmt.Errorf("invalid age %q", age)
+			}
+			return time.Duration(count) * unit, nil
+		}
+	}
+
+	duration, err := time.ParseDuration(age)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("invalid age %q, expected e.g. 90d, 2w or 48h", age)
+	}
+	return duration, nil
+}
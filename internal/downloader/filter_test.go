@@ -0,0 +1,30 @@
+package downloader_test
+
+import (
+	"github.com/sajjadanwar0/laracasts-dl/internal/downloader"
+	"testing"
+	"time"
+)
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		age     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"90d", 90 * 24 * time.Hour, false},
+		{"2w", 14 * 24 * time.Hour, false},
+		{"48h", 48 * time.Hour, false},
+		{" 1d ", 24 * time.Hour, false},
+		{"-1d", 0, true},
+		{"-48h", 0, true},
+		{"soon", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := downloader.ParseAge(tt.age)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseAge(%q) = %v, %v, want %v (error %v)", tt.age, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package downloader
+
+import (
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/config"
+	"math/rand"
+	"time"
+)
+
+const (
+	fingerprintCacheKey = "fingerprints"
+
+	// FingerprintCooldown keeps a fingerprint Laracasts blocked out of the
+	// rotation for a while
+	FingerprintCooldown = 24 * time.Hour
+)
+
+// fingerprintState remembers when each fingerprint was last blocked
+type fingerprintState struct {
+	Blocked map[string]time.Time `json:"blocked"`
+}
+
+// pickFingerprint returns the fingerprint named by setting, or a random one
+// not blocked within FingerprintCooldown when rotating
+func (d *Downloader) pickFingerprint(setting string) config.Fingerprint {
+	if setting != config.FingerprintRotate {
+		for _, f := range config.Fingerprints {
+			if f.Name == setting {
+				return f
+			}
+		}
+	}
+
+	var state fingerprintState
+	_, _ = d.Cache.Get(fingerprintCacheKey, &state)
+
+	var candidates []config.Fingerprint
+	for _, f := range config.Fingerprints {
+		if time.Since(state.Blocked[f.Name]) > FingerprintCooldown {
+			candidates = append(candidates, f)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = config.Fingerprints
+	}
+	return candidates[rand.Intn(len(candidates))]
+}
+
+// fingerprintBlocked records that Laracasts refused the session fingerprint,
+// so the next session starts with another one
+func (d *Downloader) fingerprintBlocked() {
+	d.fingerprintOnce.Do(func() {
+		var state fingerprintState
+		_, _ = d.Cache.Get(fingerprintCacheKey, &state)
+		if state.Blocked == nil {
+			state.Blocked = make(map[string]time.Time)
+		}
+		state.Blocked[d.Fingerprint.Name] = time.Now()
+		if err := d.Cache.Set(fingerprintCacheKey, state); err != nil {
+			fmt.Printf("Warning: failed to save fingerprint state: %v\n", err)
+		}
+
+		fmt.Printf("\n⚠️  Laracasts blocked the %s browser fingerprint; the next run will use another one\n", d.Fingerprint.Name)
+	})
+}
@@ -0,0 +1,294 @@
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/fsutil"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// harRedacted replaces the values of headers carrying credentials and of
+// query parameters, which sign video URLs, so a HAR file can be attached to a
+// bug report
+const harRedacted = "[redacted]"
+
+const (
+	harMaxEntries    = 10000 // Requests kept, the oldest are dropped beyond
+	harMaxValueBytes = 4096  // Longest header value kept whole
+)
+
+// harSecretHeaders are the headers whose values never end up in a HAR file
+var harSecretHeaders = map[string]bool{
+	"Authorization": true,
+	"Cookie":        true,
+	"Set-Cookie":    true,
+	"X-Xsrf-Token":  true,
+	"X-Csrf-Token":  true,
+}
+
+// HAR 1.2 as read by browser developer tools; bodies are left out, they are
+// videos or carry the password
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+	Comment string     `json:"comment,omitempty"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Error           string      `json:"_error,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// harRecorder keeps a HAR entry for the latest harMaxEntries requests
+// passing through it
+type harRecorder struct {
+	base http.RoundTripper
+
+	mu      sync.Mutex
+	entries []*harEntry
+	dropped int // oldest entries left out to stay within harMaxEntries
+}
+
+// RecordHAR traces every HTTP request from now on, with headers, status and
+// timings, for SaveHAR to export. Credentials are redacted.
+func (d *Downloader) RecordHAR() {
+	d.har = &harRecorder{}
+
+	// Below the header transport, to trace the headers actually sent
+	if headers, ok := d.Client.Transport.(*headerTransport); ok {
+		d.har.base, headers.base = headers.base, d.har
+		return
+	}
+	d.har.base = d.Client.Transport
+	if d.har.base == nil {
+		d.har.base = http.DefaultTransport
+	}
+	d.Client.Transport = d.har
+}
+
+// SaveHAR writes the requests traced since RecordHAR to path. Requests still
+// transferring are saved with the time spent so far.
+func (d *Downloader) SaveHAR(path string) error {
+	if d.har == nil {
+		return fmt.Errorf("requests are not being recorded")
+	}
+
+	d.har.mu.Lock()
+	log := harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "laracasts-dl", Version: "1.0"},
+		Entries: make([]harEntry, len(d.har.entries)),
+	}
+	for i, entry := range d.har.entries {
+		log.Entries[i] = *entry
+	}
+	if d.har.dropped > 0 {
+		log.Comment = fmt.Sprintf("%d earlier requests left out", d.har.dropped)
+	}
+	d.har.mu.Unlock()
+
+	data, err := json.MarshalIndent(map[string]harLog{"log": log}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal HAR: %v", err)
+	}
+	return fsutil.WriteFile(path, data)
+}
+
+func (h *harRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	rawURL, query := harURL(req.URL)
+	entry := &harEntry{
+		StartedDateTime: time.Now(),
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         rawURL,
+			HTTPVersion: req.Proto,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(req.Header),
+			QueryString: query,
+			HeadersSize: -1,
+			BodySize:    req.ContentLength,
+		},
+	}
+
+	h.mu.Lock()
+	if len(h.entries) >= harMaxEntries {
+		h.entries[0] = nil
+		h.entries = h.entries[1:]
+		h.dropped++
+	}
+	h.entries = append(h.entries, entry)
+	h.mu.Unlock()
+
+	resp, err := h.base.RoundTrip(req)
+	wait := msSince(entry.StartedDateTime)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	entry.Timings.Wait, entry.Time = wait, wait
+	if err != nil {
+		entry.Error = err.Error()
+		entry.Response = harResponse{Cookies: []harNameValue{}, Headers: []harNameValue{}, HeadersSize: -1, BodySize: -1}
+		return nil, err
+	}
+
+	entry.Response = harResponse{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HTTPVersion: resp.Proto,
+		Cookies:     []harNameValue{},
+		Headers:     harHeaders(resp.Header),
+		Content:     harContent{Size: max(resp.ContentLength, 0), MimeType: resp.Header.Get("Content-Type")},
+		RedirectURL: harLocation(resp.Header.Get("Location")),
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+	resp.Body = &harBody{ReadCloser: resp.Body, recorder: h, entry: entry}
+	return resp, nil
+}
+
+// harBody completes the entry of a response once its body was read
+type harBody struct {
+	io.ReadCloser
+	recorder *harRecorder
+	entry    *harEntry
+	read     int64
+	done     bool
+}
+
+func (b *harBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if err != nil {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *harBody) Close() error {
+	b.finish()
+	return b.ReadCloser.Close()
+}
+
+func (b *harBody) finish() {
+	if b.done {
+		return
+	}
+	b.done = true
+
+	b.recorder.mu.Lock()
+	defer b.recorder.mu.Unlock()
+	b.entry.Time = msSince(b.entry.StartedDateTime)
+	b.entry.Timings.Receive = b.entry.Time - b.entry.Timings.Wait
+	b.entry.Response.BodySize = b.read
+	b.entry.Response.Content.Size = b.read
+}
+
+// harHeaders lists headers in HAR form with credentials and query values
+// redacted and long values cut at harMaxValueBytes
+func harHeaders(header http.Header) []harNameValue {
+	headers := []harNameValue{}
+	for name, values := range header {
+		for _, value := range values {
+			switch name = http.CanonicalHeaderKey(name); {
+			case harSecretHeaders[name]:
+				value = harRedacted
+			case name == "Location" || name == "Referer":
+				value = harLocation(value)
+			}
+			if len(value) > harMaxValueBytes {
+				value = value[:harMaxValueBytes] + "..."
+			}
+			headers = append(headers, harNameValue{name, value})
+		}
+	}
+	return headers
+}
+
+// harURL returns u with the values of its query parameters redacted, and the
+// parameters in HAR form
+func harURL(u *url.URL) (string, []harNameValue) {
+	query := []harNameValue{}
+	if u.RawQuery == "" {
+		return u.String(), query
+	}
+
+	redacted := *u
+	values := u.Query()
+	for name := range values {
+		values[name] = []string{harRedacted}
+		query = append(query, harNameValue{name, harRedacted})
+	}
+	// Encoded without escaping the brackets, which keeps the URL readable
+	redacted.RawQuery = strings.ReplaceAll(values.Encode(), url.QueryEscape(harRedacted), harRedacted)
+	return redacted.String(), query
+}
+
+// harLocation redacts the query values of a URL in a header, keeping values
+// that are not URLs as they are
+func harLocation(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.RawQuery == "" {
+		return value
+	}
+	redacted, _ := harURL(u)
+	return redacted
+}
+
+func msSince(t time.Time) float64 {
+	return float64(time.Since(t)) / float64(time.Millisecond)
+}
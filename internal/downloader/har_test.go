@@ -0,0 +1,90 @@
+package downloader_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordHAR(t *testing.T) {
+	server := newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := newTestDownloader(t, downloadPath)
+	dl.RecordHAR()
+
+	if err := dl.Login(mockEmail, mockPassword); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+	// Signed URLs carry their signature in the query
+	resp, err := dl.Client.Get(server.URL + "/signed?token=secret&expires=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	harFile := filepath.Join(t.TempDir(), "out.har")
+	if err := dl.SaveHAR(harFile); err != nil {
+		t.Fatalf("SaveHAR() error = %v", err)
+	}
+	data, err := os.ReadFile(harFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type header struct{ Name, Value string }
+	var har struct {
+		Log struct {
+			Entries []struct {
+				Request struct {
+					Method      string
+					URL         string
+					Headers     []header
+					QueryString []header
+				}
+				Response struct {
+					Status   int
+					BodySize int64
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(data, &har); err != nil {
+		t.Fatalf("HAR is not valid JSON: %v", err)
+	}
+
+	if strings.Contains(string(data), "secret") {
+		t.Error("HAR has a query value that is not redacted")
+	}
+
+	var login, video, signed bool
+	for _, entry := range har.Log.Entries {
+		if strings.Contains(entry.Request.URL, "/signed?") {
+			signed = len(entry.Request.QueryString) == 2
+		}
+		for _, h := range entry.Request.Headers {
+			if h.Name == "Cookie" && h.Value != "[redacted]" {
+				t.Errorf("cookie of %s not redacted: %q", entry.Request.URL, h.Value)
+			}
+			if h.Name == "User-Agent" && h.Value != dl.Fingerprint.Headers["User-Agent"] {
+				t.Errorf("User-Agent of %s = %q, want the one sent", entry.Request.URL, h.Value)
+			}
+		}
+		switch {
+		case entry.Request.Method == "POST" && strings.HasSuffix(entry.Request.URL, "/sessions"):
+			login = entry.Response.Status != 0
+		case entry.Request.Method == "GET" && strings.Contains(entry.Request.URL, "/files/"):
+			video = true
+			if entry.Response.BodySize != mockVideoSize {
+				t.Errorf("video body size = %d, want %d", entry.Response.BodySize, mockVideoSize)
+			}
+		}
+	}
+	if !login || !video || !signed {
+		t.Errorf("HAR misses the login (%v), a video download (%v) or the signed URL (%v) among %d entries", login, video, signed, len(har.Log.Entries))
+	}
+}
@@ -0,0 +1,73 @@
+package downloader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// IgnoreMarker is the file that, dropped into a series folder, excludes the
+// series from bulk downloads and syncs for good, e.g. once it was watched and
+// deleted on purpose
+const IgnoreMarker = ".laracasts-ignore"
+
+// ignoredReason tells why the series with slug, saved to seriesDir, is left
+// out of bulk downloads, or returns "" when it is not. The marker is also
+// looked for in the folder the download state records, where a series
+// moved to another topic or downloaded on its own still is.
+func (d *Downloader) ignoredReason(slug, seriesDir string) string {
+	if d.IgnoredSeries[checkpointSlug(slug)] {
+		return "listed in IGNORED_SERIES"
+	}
+	if hasIgnoreMarker(seriesDir) {
+		return IgnoreMarker + " in its folder"
+	}
+	if state, err := d.loadDownloadState(checkpointSlug(slug)); err == nil && state.Dir != "" && hasIgnoreMarker(state.Dir) {
+		return IgnoreMarker + " in its folder"
+	}
+	return ""
+}
+
+// skipIgnored reports whether a bulk download leaves the series out, printing
+// and recording it when it does
+func (d *Downloader) skipIgnored(title, slug, seriesDir string) bool {
+	reason := d.ignoredReason(slug, seriesDir)
+	if reason == "" {
+		return false
+	}
+	if d.Report.AddIgnored(checkpointSlug(slug)) {
+		fmt.Printf("🙈 Ignoring series '%s' (%s)\n", title, reason)
+	}
+	return true
+}
+
+// skipArchived reports whether a bulk download leaves out the series because
+// Laracasts archived it and IncludeArchived is not set, printing and
+// recording it when it does
+func (d *Downloader) skipArchived(series TopicSeries) bool {
+	if !series.Archived || d.IncludeArchived {
+		return false
+	}
+	if d.Report.AddArchived(checkpointSlug(series.Slug)) {
+		fmt.Printf("🗄️  Skipping archived series '%s' (-include-archived downloads it)\n", series.Title)
+	}
+	return true
+}
+
+// skipUnreleased reports whether a bulk download leaves out the series because
+// it is listed without any episode yet, rather than fetching its page to fail
+// on it, printing it once when it does
+func (d *Downloader) skipUnreleased(series TopicSeries) bool {
+	if !series.Unreleased {
+		return false
+	}
+	if _, printed := d.unreleased.LoadOrStore(checkpointSlug(series.Slug), true); !printed {
+		fmt.Printf("⏭️  Skipping series '%s', it has no episodes yet\n", series.Title)
+	}
+	return true
+}
+
+func hasIgnoreMarker(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, IgnoreMarker))
+	return err == nil
+}
@@ -0,0 +1,224 @@
+package downloader
+
+import (
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/naming"
+	"github.com/sajjadanwar0/laracasts-dl/internal/vimeo"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ImportExisting walks the download path and marks the videos already there
+// as completed in the download state of their series, matching them to the
+// cached series metadata by normalized name and episode number without any
+// request. Only the folders a download of the series would use and folders
+// named after it are searched, never the folder of another series, and
+// videos under an older naming are renamed in place. It returns the number
+// of episodes imported.
+func (d *Downloader) ImportExisting() (int, error) {
+	files, err := d.scanVideos()
+	if err != nil {
+		return 0, err
+	}
+
+	catalog, found, err := d.LoadCatalog()
+	if err != nil {
+		fmt.Printf("Warning: Failed to load catalog: %v\n", err)
+	}
+	catalogChanged := false
+
+	// The folder each series downloads to, so no other series claims it
+	owners := make(map[string]string)
+	for _, key := range d.Cache.Keys("series_") {
+		slug := strings.TrimPrefix(key, "series_")
+		if state, err := d.loadDownloadState(slug); err == nil && state.Dir != "" {
+			owners[absDir(state.Dir)] = slug
+		}
+		if dir := catalog.location(slug); dir != "" {
+			owners[absDir(dir)] = slug
+		}
+	}
+
+	imported := 0
+	for _, key := range d.Cache.Keys("series_") {
+		var seriesData SeriesMetadata
+		if found, err := d.Cache.Get(key, &seriesData); err != nil || !found {
+			continue
+		}
+		disambiguateFilenames(&seriesData)
+		slug := strings.TrimPrefix(key, "series_")
+
+		// Episode titles like "Introduction" are shared by many series, so
+		// files are only matched in the folders of this one
+		candidates := d.importDirs(slug, seriesData.Title, catalog, files, owners)
+		target, matches := bestSeriesDir(files, &seriesData, candidates)
+		if len(matches) == 0 {
+			continue
+		}
+
+		lock, err := d.lock("series_" + slug)
+		if err != nil {
+			fmt.Printf("Skipping %s, it is being downloaded by another instance\n", seriesData.Title)
+			continue
+		}
+
+		state, err := d.loadDownloadState(slug)
+		if err != nil {
+			state = &DownloadState{}
+		}
+		if state.Completed == nil {
+			state.Completed = make(map[string]bool)
+		}
+		if state.Deleted == nil {
+			state.Deleted = make(map[string]bool)
+		}
+
+		count := 0
+		for path, episode := range matches {
+			outputPath := filepath.Join(target, episodeFilename(episode))
+			if !d.videoExists(outputPath) {
+				if !d.migrateLegacyFile(legacyFile{path: path}, episode, target) {
+					continue
+				}
+			}
+			if !state.Completed[episode.VimeoId] {
+				count++
+			}
+			state.Completed[episode.VimeoId] = true
+			delete(state.Deleted, episode.VimeoId)
+		}
+
+		if abs, err := filepath.Abs(target); err == nil {
+			state.Dir = abs
+			if found && catalog.Locations != nil && catalog.location(slug) != abs {
+				catalog.Locations[catalog.locationKey(slug)] = abs
+				catalogChanged = true
+			}
+		}
+		if state.LastSync.IsZero() {
+			state.LastSync = time.Now()
+		}
+		if err := d.saveDownloadState(slug, state); err != nil {
+			lock.Unlock()
+			return imported, fmt.Errorf("failed to save download state of %s: %v", seriesData.Title, err)
+		}
+		lock.Unlock()
+
+		if count > 0 {
+			fmt.Printf("%s: imported %d of %d episodes from %s\n",
+				seriesData.Title, count, len(matches), d.relativePath(target))
+		}
+		imported += count
+	}
+
+	if catalogChanged {
+		if err := d.Cache.Set(catalogCacheKey, catalog); err != nil {
+			return imported, fmt.Errorf("failed to save catalog: %v", err)
+		}
+	}
+	return imported, nil
+}
+
+// scanVideos lists the videos below the download path by directory, leaving
+// out the cache, segment caches and the links of the authors layout
+func (d *Downloader) scanVideos() (map[string][]string, error) {
+	exts := map[string]bool{".mp4": true, "." + d.Vimeo.Container: true}
+	files := make(map[string][]string)
+
+	err := filepath.WalkDir(d.BasePath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if d.skipLibraryDir(path) || filepath.Ext(entry.Name()) == vimeo.HLSCacheExt {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() || !exts[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil && info.Size() > 0 {
+			files[filepath.Dir(path)] = append(files[filepath.Dir(path)], path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %v", d.BasePath, err)
+	}
+	return files, nil
+}
+
+// bestSeriesDir returns the directory among dirs holding the most episodes
+// of a series, with the episode each of its videos was matched to
+func bestSeriesDir(files map[string][]string, seriesData *SeriesMetadata, dirs []string) (string, map[string]Episode) {
+	var bestDir string
+	var best map[string]Episode
+
+	for dir, paths := range files {
+		if !slices.ContainsFunc(dirs, func(candidate string) bool { return sameDir(candidate, dir) }) {
+			continue
+		}
+
+		remaining := make(map[string]Episode)
+		for _, chapter := range seriesData.Chapters {
+			for _, episode := range chapter.Episodes {
+				remaining[episode.VimeoId] = episode
+			}
+		}
+
+		matches := make(map[string]Episode)
+		for _, path := range paths {
+			if episode, ok := matchLegacyName(path, remaining); ok {
+				matches[path] = episode
+				delete(remaining, episode.VimeoId)
+			}
+		}
+		if len(matches) > len(best) || (len(matches) == len(best) && len(matches) > 0 && dir < bestDir) {
+			bestDir, best = dir, matches
+		}
+	}
+	return bestDir, best
+}
+
+// importDirs returns the folders a download of the series would use, the
+// one it downloads to first, and the folders among files named after the
+// series, leaving out the folders owners records for other series
+func (d *Downloader) importDirs(slug, title string, catalog *Catalog, files map[string][]string, owners map[string]string) []string {
+	var dirs []string
+	if dir := catalog.location(slug); dir != "" {
+		dirs = append(dirs, dir)
+	}
+	dirs = append(dirs, filepath.Join(d.BasePath, slug))
+	topicDirs, _ := filepath.Glob(filepath.Join(d.BasePath, "topics", "*", naming.Sanitize(title)))
+	dirs = append(dirs, topicDirs...)
+
+	// e.g. an archive kept by hand as "Laravel Basics"
+	for dir := range files {
+		if name := naming.Sanitize(filepath.Base(dir)); name == slug || name == naming.Sanitize(title) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return slices.DeleteFunc(dirs, func(dir string) bool {
+		owner, ok := owners[absDir(dir)]
+		return ok && owner != slug
+	})
+}
+
+// absDir returns dir as an absolute path, or cleaned when it cannot
+func absDir(dir string) string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		return abs
+	}
+	return filepath.Clean(dir)
+}
+
+// sameDir reports whether a and b name the same directory
+func sameDir(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
@@ -0,0 +1,138 @@
+package downloader_test
+
+import (
+	"github.com/sajjadanwar0/laracasts-dl/internal/downloader"
+	"github.com/sajjadanwar0/laracasts-dl/internal/naming"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImportExisting(t *testing.T) {
+	server := newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+
+	// An archive kept by hand: another folder and naming, without the last
+	// episode and without any download state
+	seriesDir := filepath.Join(downloadPath, "laravel-basics")
+	archiveDir := filepath.Join(downloadPath, "Laravel Basics")
+	if err := os.Rename(seriesDir, archiveDir); err != nil {
+		t.Fatal(err)
+	}
+	for from, to := range map[string]string{
+		"01-introduction-to-laravel.mp4": "1 - Introduction to Laravel.mp4",
+		"03-controllers.mp4":             "",
+	} {
+		from = filepath.Join(archiveDir, from)
+		if to == "" {
+			if err := os.Remove(from); err != nil {
+				t.Fatal(err)
+			}
+		} else if err := os.Rename(from, filepath.Join(archiveDir, to)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dl.Cache.Set("download_state_laravel-basics", downloader.DownloadState{}); err != nil {
+		t.Fatal(err)
+	}
+
+	imported, err := dl.ImportExisting()
+	if err != nil {
+		t.Fatalf("ImportExisting() error = %v", err)
+	}
+	if imported != 2 {
+		t.Errorf("ImportExisting() = %d, want 2", imported)
+	}
+	// Adopted where they are, under their current names
+	for _, filename := range []string{"01-introduction-to-laravel.mp4", "02-routing-basics.mp4"} {
+		if _, err := os.Stat(filepath.Join(archiveDir, filename)); err != nil {
+			t.Errorf("%s not renamed in the archive folder: %v", filename, err)
+		}
+	}
+
+	// Imported episodes are known as completed without any request
+	before := server.HitsWithPrefix("GET", "/files/")
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+	if hits := server.HitsWithPrefix("GET", "/files/") - before; hits != 1 {
+		t.Errorf("made %d video requests after importing, want 1", hits)
+	}
+	for _, vimeoID := range []string{"1001", "1002"} {
+		if got := server.Hits("GET", "/video/"+vimeoID+"/config"); got != 1 {
+			t.Errorf("config of imported video %s requested %d times, want only by the first download", vimeoID, got)
+		}
+	}
+}
+
+func TestImportExistingLeavesOtherFoldersAlone(t *testing.T) {
+	newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+
+	// Videos named like the episodes, in a folder not named after the series
+	otherDir := filepath.Join(downloadPath, "topics", "php", "another-series")
+	if err := os.MkdirAll(filepath.Dir(otherDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(downloadPath, "laravel-basics"), otherDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := dl.Cache.Set("download_state_laravel-basics", downloader.DownloadState{}); err != nil {
+		t.Fatal(err)
+	}
+
+	imported, err := dl.ImportExisting()
+	if err != nil {
+		t.Fatalf("ImportExisting() error = %v", err)
+	}
+	if imported != 0 {
+		t.Errorf("ImportExisting() = %d, want the videos of another folder left alone", imported)
+	}
+	for _, filename := range []string{"01-introduction-to-laravel.mp4", "02-routing-basics.mp4", "03-controllers.mp4"} {
+		if _, err := os.Stat(filepath.Join(otherDir, filename)); err != nil {
+			t.Errorf("%s moved out of another folder: %v", filename, err)
+		}
+	}
+}
+
+func TestImportExistingUsesCatalogLocation(t *testing.T) {
+	newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	if err := dl.DownloadAllByTopics(); err != nil {
+		t.Fatalf("DownloadAllByTopics() error = %v", err)
+	}
+
+	// The catalog records the folder of the series, whatever its name
+	seriesDir := filepath.Join(downloadPath, "topics", naming.Sanitize("Laravel"), "kept-by-hand")
+	if err := os.Rename(filepath.Join(filepath.Dir(seriesDir), "laravel-basics"), seriesDir); err != nil {
+		t.Fatal(err)
+	}
+	catalog, _, err := dl.LoadCatalog()
+	if err != nil || catalog == nil {
+		t.Fatalf("LoadCatalog() = %v, %v", catalog, err)
+	}
+	catalog.Locations["series/laravel-basics"] = seriesDir
+	if err := dl.Cache.Set("catalog", catalog); err != nil {
+		t.Fatal(err)
+	}
+	if err := dl.Cache.Set("download_state_laravel-basics", downloader.DownloadState{}); err != nil {
+		t.Fatal(err)
+	}
+
+	imported, err := dl.ImportExisting()
+	if err != nil {
+		t.Fatalf("ImportExisting() error = %v", err)
+	}
+	if imported != 3 {
+		t.Errorf("ImportExisting() = %d, want the 3 episodes in the recorded folder", imported)
+	}
+}
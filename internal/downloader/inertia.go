@@ -0,0 +1,183 @@
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/config"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+const inertiaVersionCacheKey = "inertia_version"
+
+// inertiaState is the asset version Laracasts last reported. Inertia only
+// answers with JSON while the client sends the current version.
+type inertiaState struct {
+	mu      sync.Mutex
+	loaded  bool
+	version string
+}
+
+// inertiaVersion returns the known asset version, loading the one saved by
+// a previous run the first time
+func (d *Downloader) inertiaVersion() string {
+	d.inertia.mu.Lock()
+	defer d.inertia.mu.Unlock()
+
+	if !d.inertia.loaded {
+		d.inertia.loaded = true
+		if !d.NoCache {
+			_, _ = d.Cache.Get(inertiaVersionCacheKey, &d.inertia.version)
+		}
+	}
+	return d.inertia.version
+}
+
+func (d *Downloader) setInertiaVersion(version string) {
+	d.inertia.mu.Lock()
+	defer d.inertia.mu.Unlock()
+
+	if version == d.inertia.version {
+		return
+	}
+	d.inertia.loaded, d.inertia.version = true, version
+	if err := d.Cache.Set(inertiaVersionCacheKey, version); err != nil {
+		fmt.Printf("Warning: failed to cache the Inertia version: %v\n", err)
+	}
+}
+
+// fetchPageData returns the Inertia page object of a Laracasts page. A page
+// served to a guest although the session was signed in means Laracasts
+// signed the session out; it is fetched again once signed back in.
+func (d *Downloader) fetchPageData(pageURL string) (string, error) {
+	generation, err := d.session.current()
+	if err != nil {
+		return "", err
+	}
+	data, err := d.fetchPage(pageURL)
+	if err != nil || !d.guestPage(data) {
+		return data, err
+	}
+
+	if err := d.sessionLost(generation); err != nil {
+		return "", err
+	}
+	if data, err = d.fetchPage(pageURL); err == nil && d.guestPage(data) {
+		return "", ErrLoggedOut
+	}
+	return data, err
+}
+
+// fetchPage returns the Inertia page object of a Laracasts page. While the
+// asset version is known the page is requested as JSON, which is a fraction
+// of the HTML; the HTML is only scraped to learn the version, after Laracasts
+// deploys new assets (409) or when it does not answer with JSON.
+func (d *Downloader) fetchPage(pageURL string) (string, error) {
+	if version := d.inertiaVersion(); version != "" {
+		data, location, err := d.fetchInertiaJSON(pageURL, version)
+		if err != nil || data != "" {
+			return data, err
+		}
+		if location != "" {
+			pageURL = resolveURL(pageURL, location)
+		}
+	}
+
+	req, err := http.NewRequest("GET", pageURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %v", err)
+	}
+	for k, v := range config.DefaultHeaders {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("page not found (404)")
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %v", err)
+	}
+
+	data := extractPageJSON(body)
+	if data == "" {
+		return "", fmt.Errorf("no page data found")
+	}
+	d.rememberInertiaVersion(data)
+	return data, nil
+}
+
+// fetchInertiaJSON requests pageURL the way the Inertia client does when
+// navigating. It returns no data and no error when the page has to be
+// scraped instead, along with the location Laracasts sent for that.
+func (d *Downloader) fetchInertiaJSON(pageURL, version string) (data, location string, err error) {
+	req, err := http.NewRequest("GET", pageURL, nil)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create request: %v", err)
+	}
+	for k, v := range config.DefaultHeaders {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Accept", "text/html, application/xhtml+xml")
+	req.Header.Set("X-Requested-With", "XMLHttpRequest")
+	req.Header.Set("X-Inertia", "true")
+	req.Header.Set("X-Inertia-Version", version)
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("failed request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusConflict:
+		// New assets were deployed, the HTML carries the new version
+		return "", resp.Header.Get("X-Inertia-Location"), nil
+	case resp.StatusCode == http.StatusNotFound:
+		return "", "", fmt.Errorf("page not found (404)")
+	case resp.StatusCode != http.StatusOK || resp.Header.Get("X-Inertia") != "true":
+		return "", "", nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read response: %v", err)
+	}
+	if !json.Valid(body) {
+		return "", "", nil
+	}
+	d.rememberInertiaVersion(string(body))
+	return string(body), "", nil
+}
+
+// resolveURL resolves a possibly relative location against base
+func resolveURL(base, location string) string {
+	b, err := url.Parse(base)
+	if err != nil {
+		return location
+	}
+	ref, err := url.Parse(location)
+	if err != nil {
+		return base
+	}
+	return b.ResolveReference(ref).String()
+}
+
+// rememberInertiaVersion keeps the asset version of a page object
+func (d *Downloader) rememberInertiaVersion(data string) {
+	var page struct {
+		Version string `json:"version"`
+	}
+	if json.Unmarshal([]byte(data), &page) == nil && page.Version != "" {
+		d.setInertiaVersion(page.Version)
+	}
+}
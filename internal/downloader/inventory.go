@@ -0,0 +1,199 @@
+package downloader
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Inventory formats accepted by WriteInventory
+const (
+	InventoryCSV      = "csv"
+	InventoryMarkdown = "md"
+)
+
+// InventoryEpisode is one episode of a series in the local library
+type InventoryEpisode struct {
+	Number     int
+	Title      string
+	Downloaded bool
+	Path       string    // relative to the download path, empty when missing
+	Size       int64     // summed over the saved qualities
+	ModTime    time.Time // when the file was written
+}
+
+// InventorySeries lists every episode of a series with at least one episode
+// on disk
+type InventorySeries struct {
+	Title      string
+	Slug       string
+	Archived   bool
+	Episodes   []InventoryEpisode
+	Downloaded int
+	Size       int64
+}
+
+// Status summarises how much of the series is on disk, and whether
+// Laracasts archived it
+func (s InventorySeries) Status() string {
+	status := "complete"
+	if s.Downloaded < len(s.Episodes) {
+		status = fmt.Sprintf("partial (%d/%d)", s.Downloaded, len(s.Episodes))
+	}
+	if s.Archived {
+		status += ", archived"
+	}
+	return status
+}
+
+// Inventory lists the locally downloaded series from the cached metadata,
+// sorted by title
+func (d *Downloader) Inventory() []InventorySeries {
+	var inventory []InventorySeries
+
+	for _, key := range d.Cache.Keys("series_") {
+		var seriesData SeriesMetadata
+		if found, err := d.Cache.Get(key, &seriesData); err != nil || !found {
+			continue
+		}
+		disambiguateFilenames(&seriesData)
+
+		slug := strings.TrimPrefix(key, "series_")
+		series := InventorySeries{Title: seriesData.Title, Slug: slug, Archived: seriesData.Archived}
+		dirs := d.seriesDirs(slug, seriesData.Title)
+
+		for _, chapter := range seriesData.Chapters {
+			for _, episode := range chapter.Episodes {
+				item := InventoryEpisode{Number: episode.Number, Title: episode.Title}
+				for _, dir := range dirs {
+					if d.inventoryVideo(&item, filepath.Join(dir, episodeFilename(episode))) {
+						break
+					}
+				}
+
+				if item.Downloaded {
+					series.Downloaded++
+					series.Size += item.Size
+				}
+				series.Episodes = append(series.Episodes, item)
+			}
+		}
+
+		if series.Downloaded > 0 {
+			inventory = append(inventory, series)
+		}
+	}
+
+	sort.Slice(inventory, func(i, j int) bool {
+		return strings.ToLower(inventory[i].Title) < strings.ToLower(inventory[j].Title)
+	})
+	return inventory
+}
+
+// inventoryVideo fills in item from the quality variants of outputPath on
+// disk, reporting whether any was found
+func (d *Downloader) inventoryVideo(item *InventoryEpisode, outputPath string) bool {
+	for _, v := range d.variants(outputPath) {
+		path, ok := d.existingVideo(v.Path)
+		if !ok {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+
+		if !item.Downloaded {
+			item.Downloaded = true
+			item.Path = filepath.ToSlash(d.relativePath(path))
+		}
+		item.Size += info.Size()
+		if info.ModTime().After(item.ModTime) {
+			item.ModTime = info.ModTime()
+		}
+	}
+	return item.Downloaded
+}
+
+// WriteInventory writes inventory to w as CSV, one row per episode, or as a
+// Markdown document with a table per series
+func WriteInventory(w io.Writer, inventory []InventorySeries, format string) error {
+	switch format {
+	case InventoryCSV:
+		return writeInventoryCSV(w, inventory)
+	case InventoryMarkdown:
+		return writeInventoryMarkdown(w, inventory)
+	}
+	return fmt.Errorf("unsupported inventory format %q (use csv or md)", format)
+}
+
+func writeInventoryCSV(w io.Writer, inventory []InventorySeries) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"series", "slug", "series_status", "episode", "title", "downloaded", "size_bytes", "modified", "path"})
+
+	for _, series := range inventory {
+		for _, episode := range series.Episodes {
+			out.Write([]string{
+				series.Title,
+				series.Slug,
+				series.Status(),
+				strconv.Itoa(episode.Number),
+				episode.Title,
+				strconv.FormatBool(episode.Downloaded),
+				strconv.FormatInt(episode.Size, 10),
+				formatInventoryDate(episode.ModTime),
+				episode.Path,
+			})
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+func writeInventoryMarkdown(w io.Writer, inventory []InventorySeries) error {
+	var b strings.Builder
+
+	var episodes, downloaded int
+	var size int64
+	for _, series := range inventory {
+		episodes += len(series.Episodes)
+		downloaded += series.Downloaded
+		size += series.Size
+	}
+
+	b.WriteString("# Library Inventory\n\n")
+	fmt.Fprintf(&b, "%d series, %d/%d episodes downloaded, %s.\n", len(inventory), downloaded, episodes, formatBytes(size))
+
+	for _, series := range inventory {
+		fmt.Fprintf(&b, "\n## %s\n\n", series.Title)
+		fmt.Fprintf(&b, "`%s`: %s, %s\n\n", series.Slug, series.Status(), formatBytes(series.Size))
+		b.WriteString("| # | Episode | Status | Size | Downloaded |\n")
+		b.WriteString("|---|---------|--------|------|------------|\n")
+
+		for _, episode := range series.Episodes {
+			status, size := "missing", ""
+			if episode.Downloaded {
+				status, size = "✓", formatBytes(episode.Size)
+			}
+			fmt.Fprintf(&b, "| %d | %s | %s | %s | %s |\n",
+				episode.Number, markdownCell(episode.Title), status, size, formatInventoryDate(episode.ModTime))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func formatInventoryDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
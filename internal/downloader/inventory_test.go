@@ -0,0 +1,53 @@
+package downloader_test
+
+import (
+	"bytes"
+	"github.com/sajjadanwar0/laracasts-dl/internal/downloader"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInventory(t *testing.T) {
+	newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+	if err := os.Remove(filepath.Join(downloadPath, "laravel-basics", "03-controllers.mp4")); err != nil {
+		t.Fatal(err)
+	}
+
+	inventory := dl.Inventory()
+	if len(inventory) != 1 {
+		t.Fatalf("Inventory() has %d series, want 1", len(inventory))
+	}
+	if got := inventory[0].Status(); got != "partial (2/3)" {
+		t.Errorf("Status() = %q, want partial (2/3)", got)
+	}
+
+	var out bytes.Buffer
+	if err := downloader.WriteInventory(&out, inventory, downloader.InventoryCSV); err != nil {
+		t.Fatalf("WriteInventory() error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("CSV has %d lines, want a header and 3 episodes:\n%s", len(lines), out.String())
+	}
+	if !strings.Contains(lines[1], "laravel-basics/01-introduction-to-laravel.mp4") {
+		t.Errorf("first episode row = %q, want its path", lines[1])
+	}
+	if !strings.Contains(lines[3], ",3,Controllers,false,0,,") {
+		t.Errorf("deleted episode row = %q, want it listed as not downloaded", lines[3])
+	}
+
+	out.Reset()
+	if err := downloader.WriteInventory(&out, inventory, downloader.InventoryMarkdown); err != nil {
+		t.Fatalf("WriteInventory() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "| 3 | Controllers | missing |") {
+		t.Errorf("Markdown inventory does not list the missing episode:\n%s", out.String())
+	}
+}
@@ -0,0 +1,43 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/fsutil"
+	"path/filepath"
+	"time"
+)
+
+// catalogLockWait is how long saving the catalog waits for another instance
+// to finish saving it
+const catalogLockWait = 10 * time.Second
+
+// lock takes the advisory lock name in the cache directory, so instances
+// sharing a download path do not write the same files at once
+func (d *Downloader) lock(name string) (*fsutil.Lock, error) {
+	dir := filepath.Join(d.Cache.BasePath, "locks")
+	if err := fsutil.MkdirAll(dir); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %v", err)
+	}
+	return fsutil.TryLock(filepath.Join(dir, name+".lock"))
+}
+
+// lockCatalog takes the catalog lock, waiting for another instance that is
+// saving it
+func (d *Downloader) lockCatalog() (*fsutil.Lock, error) {
+	deadline := time.Now().Add(catalogLockWait)
+	for {
+		lock, err := d.lock("catalog")
+		var lockErr *fsutil.LockError
+		if !errors.As(err, &lockErr) || time.Now().After(deadline) {
+			return lock, err
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// isLocked reports whether err means another instance holds a lock
+func isLocked(err error) bool {
+	var lockErr *fsutil.LockError
+	return errors.As(err, &lockErr)
+}
@@ -0,0 +1,242 @@
+package downloader
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const catalogCacheKey = "catalog"
+
+// Catalog is the local listing of every topic and its series. Together with
+// the cached series metadata it allows listing and planning without scraping.
+type Catalog struct {
+	Topics map[string][]TopicSeries `json:"topics"`
+
+	// Root is the absolute download path and Locations the absolute
+	// directory of every series by slug, rewritten by Relocate
+	Root      string            `json:"root,omitempty"`
+	Locations map[string]string `json:"locations,omitempty"`
+
+	// Usage is the bytes downloaded per calendar month, e.g. "2024-05"
+	Usage map[string]int64 `json:"usage,omitempty"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// failed names the topics whose series could not be scraped this run,
+	// which keep their listings from the previous catalog
+	failed []string
+}
+
+// locationKey returns the key of Locations recording the folder of the
+// series slug, which the topic listings key by its "series/" path
+func (c *Catalog) locationKey(slug string) string {
+	if _, ok := c.Locations["series/"+slug]; ok {
+		return "series/" + slug
+	}
+	return slug
+}
+
+// location returns the folder recorded for the series slug, if any
+func (c *Catalog) location(slug string) string {
+	if c == nil {
+		return ""
+	}
+	return c.Locations[c.locationKey(slug)]
+}
+
+// LoadCatalog returns the catalog written by the last metadata sync
+func (d *Downloader) LoadCatalog() (*Catalog, bool, error) {
+	var catalog Catalog
+	found, err := d.Cache.Get(catalogCacheKey, &catalog)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	return &catalog, true, nil
+}
+
+// saveCatalog stores catalog, recording series that were not in the
+// previously saved catalog in the changelog. Topics that failed to scrape
+// keep their series, and those series their locations, from the previous one.
+func (d *Downloader) saveCatalog(catalog *Catalog) error {
+	lock, err := d.lockCatalog()
+	if err != nil {
+		return fmt.Errorf("failed to lock catalog: %w", err)
+	}
+	defer lock.Unlock()
+
+	previous, found, err := d.LoadCatalog()
+	if err != nil {
+		fmt.Printf("Cache error: %v, replacing catalog\n", err)
+	}
+	if found {
+		previous.keepFailedTopics(catalog)
+	}
+	// A catalog holding only the usage has no series to compare with
+	if found && len(previous.Topics) > 0 {
+		d.Changelog.recordNewSeries(previous, catalog)
+	}
+
+	if root, err := filepath.Abs(d.BasePath); err == nil {
+		catalog.Root = root
+	}
+	if catalog.Locations == nil && found {
+		catalog.Locations = previous.Locations
+	}
+	if found {
+		catalog.Usage = previous.Usage
+	}
+
+	catalog.UpdatedAt = time.Now()
+	if err := d.Cache.Set(catalogCacheKey, catalog); err != nil {
+		return fmt.Errorf("failed to save catalog: %v", err)
+	}
+	return nil
+}
+
+// keepFailedTopics copies the listings of the topics catalog failed to scrape,
+// and the locations of their series, from c
+func (c *Catalog) keepFailedTopics(catalog *Catalog) {
+	for _, name := range catalog.failed {
+		series, ok := c.Topics[name]
+		if _, scraped := catalog.Topics[name]; scraped || !ok {
+			continue
+		}
+		catalog.Topics[name] = series
+		if catalog.Locations == nil {
+			continue
+		}
+		for _, s := range series {
+			if dir, ok := c.Locations[s.Slug]; ok && catalog.Locations[s.Slug] == "" {
+				catalog.Locations[s.Slug] = dir
+			}
+		}
+	}
+}
+
+// scrapeCatalog scrapes the series pages of every topic, Concurrency.Topics
+// at once. It returns the catalog, every series once in the order of the
+// topics and their listings, and how many topic pages failed.
+func (d *Downloader) scrapeCatalog(topics []Topic) (Catalog, []TopicSeries, int32) {
+	catalog := Catalog{Topics: make(map[string][]TopicSeries)}
+	listings := make([][]TopicSeries, len(topics))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var failedTopics int32
+	sem := make(chan bool, d.Concurrency.Topics)
+
+	for i, topic := range topics {
+		wg.Add(1)
+		sem <- true // Acquire semaphore
+
+		go func(idx int, topic Topic) {
+			defer wg.Done()
+			defer func() { <-sem }() // Release semaphore
+
+			series, err := d.getTopicSeries(topic.Path, topic.Name)
+			if err != nil {
+				fmt.Printf("❌ Error getting series for topic '%s': %v\n", topic.Name, err)
+				atomic.AddInt32(&failedTopics, 1)
+				mu.Lock()
+				catalog.failed = append(catalog.failed, topic.Name)
+				mu.Unlock()
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			catalog.Topics[topic.Name] = series
+			listings[idx] = series
+			fmt.Printf("[%d/%d] 📚 %s: %d series\n", idx+1, len(topics), topic.Name, len(series))
+		}(i, topic)
+	}
+	wg.Wait()
+
+	// A series listed under several topics is kept under the first
+	claimed := newSeriesSet()
+	var unique []TopicSeries
+	for _, series := range listings {
+		for _, s := range series {
+			if _, first := claimed.claim(s.Slug, s.Path); first {
+				unique = append(unique, s)
+			}
+		}
+	}
+	return catalog, unique, failedTopics
+}
+
+// SyncMetadata scrapes topics, series, chapters and episodes into the cache
+// without downloading any video. An empty seriesSlug syncs the whole catalog.
+func (d *Downloader) SyncMetadata(seriesSlug string) error {
+	if seriesSlug != "" {
+		PrintBox(fmt.Sprintf("Fetching metadata for series: %s", seriesSlug))
+
+		seriesData, err := d.loadSeriesMetadata(seriesSlug, 0)
+		if err != nil {
+			return err
+		}
+
+		episodes := 0
+		for _, chapter := range seriesData.Chapters {
+			episodes += len(chapter.Episodes)
+		}
+		fmt.Printf("✓ %s: %d chapters, %d episodes\n", seriesData.Title, len(seriesData.Chapters), episodes)
+		return nil
+	}
+
+	PrintBox("Building local catalog (metadata only)")
+
+	topics, err := d.fetchTopics()
+	if err != nil {
+		return err
+	}
+
+	catalog, unique, failedTopics := d.scrapeCatalog(topics)
+
+	// Fetch metadata for every unique series
+	var wg sync.WaitGroup
+	var failedSeries, chapters, episodes int32
+	seriesSem := make(chan bool, d.Concurrency.Series)
+
+	for _, s := range unique {
+		wg.Add(1)
+		seriesSem <- true
+
+		go func(s TopicSeries) {
+			defer wg.Done()
+			defer func() { <-seriesSem }()
+
+			seriesData, err := d.loadSeriesMetadata(s.Slug, s.EpisodeCount)
+			if err != nil {
+				fmt.Printf("❌ Error fetching metadata for '%s': %v\n", s.Title, err)
+				atomic.AddInt32(&failedSeries, 1)
+				return
+			}
+
+			atomic.AddInt32(&chapters, int32(len(seriesData.Chapters)))
+			for _, chapter := range seriesData.Chapters {
+				atomic.AddInt32(&episodes, int32(len(chapter.Episodes)))
+			}
+		}(s)
+	}
+	wg.Wait()
+
+	if err := d.saveCatalog(&catalog); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n🎉 Catalog Summary:\n")
+	fmt.Printf("Topics: %d (%d failed)\n", len(topics), failedTopics)
+	fmt.Printf("Series: %d (%d failed)\n", len(unique), failedSeries)
+	fmt.Printf("Chapters: %d\n", chapters)
+	fmt.Printf("Episodes: %d\n", episodes)
+
+	if failedTopics > 0 || failedSeries > 0 {
+		return fmt.Errorf("%d topics and %d series failed to sync", failedTopics, failedSeries)
+	}
+
+	return nil
+}
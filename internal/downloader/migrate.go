@@ -0,0 +1,215 @@
+package downloader
+
+import (
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/fsutil"
+	"github.com/sajjadanwar0/laracasts-dl/internal/naming"
+	"github.com/sajjadanwar0/laracasts-dl/internal/vimeo"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	digitsRe       = regexp.MustCompile(`\d+`)
+	leadingIndexRe = regexp.MustCompile(`^\s*(\d+)[\s._-]*`)
+)
+
+// legacyFile is a video on disk that is not named like any episode
+type legacyFile struct {
+	path string
+	size int64
+}
+
+// migrateLegacyFiles finds the videos of a series that older versions saved
+// under other names or folders, e.g. by title or by vimeo id, and renames
+// them to the current file names, so an upgrade does not download the whole
+// library again. Files are matched by vimeo id in the name, then by title,
+// then by an exact remote size; anything ambiguous is left alone. Migrated
+// files are then checked against the remote size like any video found on
+// disk before they are recorded as downloaded.
+func (d *Downloader) migrateLegacyFiles(outputDir string, seriesData *SeriesMetadata) {
+	// Archive mode cannot tell which quality a legacy file is
+	if len(d.variants("")) > 1 {
+		return
+	}
+
+	missing := make(map[string]Episode)
+	current := make(map[string]bool)
+	for _, chapter := range seriesData.Chapters {
+		for _, episode := range chapter.Episodes {
+			outputPath := filepath.Join(outputDir, episodeFilename(episode))
+			current[outputPath] = true
+			current[vimeo.ContainerPath(outputPath, d.Vimeo.Container)] = true
+			if !d.variantsExist(outputPath) {
+				missing[episode.VimeoId] = episode
+			}
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+
+	files := d.legacyFiles(outputDir, seriesData.Title, current)
+	if len(files) == 0 {
+		return
+	}
+
+	migrated := 0
+	claim := func(file legacyFile, episode Episode) {
+		if d.migrateLegacyFile(file, episode, outputDir) {
+			delete(missing, episode.VimeoId)
+			migrated++
+		}
+	}
+
+	var unmatched []legacyFile
+	for _, file := range files {
+		if episode, ok := matchLegacyName(file.path, missing); ok {
+			claim(file, episode)
+		} else {
+			unmatched = append(unmatched, file)
+		}
+	}
+
+	// Sizes take a request per episode, so they are only probed when some
+	// file could not be matched by its name
+	if len(unmatched) > 0 && len(missing) > 0 {
+		ids := make([]string, 0, len(missing))
+		for id := range missing {
+			ids = append(ids, id)
+		}
+		d.sizes.probe(ids)
+
+		bySize := make(map[int64][]Episode)
+		for id, episode := range missing {
+			if sizes, _, err := d.sizes.sizesOf(id); err == nil {
+				for _, size := range sizes {
+					if size > 0 {
+						bySize[size] = append(bySize[size], episode)
+					}
+				}
+			}
+		}
+		fileSizes := make(map[int64]int)
+		for _, file := range unmatched {
+			fileSizes[file.size]++
+		}
+		for _, file := range unmatched {
+			if candidates := bySize[file.size]; len(candidates) == 1 && fileSizes[file.size] == 1 {
+				claim(file, candidates[0])
+			}
+		}
+	}
+
+	if migrated > 0 {
+		fmt.Printf("Migrated %d videos saved by an older version to the current names\n", migrated)
+	}
+}
+
+// legacyFiles lists the videos in the series directory and in the folders
+// older versions named after the series title that are not current episode
+// files
+func (d *Downloader) legacyFiles(outputDir, title string, current map[string]bool) []legacyFile {
+	dirs := []string{outputDir}
+	for _, dir := range []string{
+		filepath.Join(d.BasePath, naming.Sanitize(title)),
+		filepath.Join(d.BasePath, naming.Legacy(title)),
+		filepath.Join(d.BasePath, strings.TrimSpace(title)),
+	} {
+		if dir != outputDir && !slices.Contains(dirs, dir) && naming.Within(d.BasePath, dir) == nil {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	exts := map[string]bool{".mp4": true, "." + d.Vimeo.Container: true}
+
+	var files []legacyFile
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			if !entry.Type().IsRegular() || current[path] || !exts[strings.ToLower(filepath.Ext(path))] {
+				continue
+			}
+			if info, err := entry.Info(); err == nil && info.Size() > 0 {
+				files = append(files, legacyFile{path: path, size: info.Size()})
+			}
+		}
+	}
+	return files
+}
+
+// matchLegacyName finds the missing episode a file name refers to, by a vimeo
+// id in it or else by its title and optional leading episode number
+func matchLegacyName(path string, missing map[string]Episode) (Episode, bool) {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	for _, digits := range digitsRe.FindAllString(name, -1) {
+		if episode, ok := missing[digits]; ok {
+			return episode, true
+		}
+	}
+
+	number := 0
+	if m := leadingIndexRe.FindStringSubmatch(name); m != nil {
+		number, _ = strconv.Atoi(m[1])
+		name = name[len(m[0]):]
+	}
+	key := titleKey(name)
+	if key == "" {
+		return Episode{}, false
+	}
+
+	var found []Episode
+	for _, episode := range missing {
+		if titleKey(episode.Title) == key && (number == 0 || number == episode.Number) {
+			found = append(found, episode)
+		}
+	}
+	if len(found) != 1 {
+		return Episode{}, false
+	}
+	return found[0], true
+}
+
+// titleKey reduces a title or file name to its lowercased letters and digits,
+// which every naming scheme kept
+func titleKey(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, naming.Sanitize(s))
+}
+
+// migrateLegacyFile renames file to the current name of episode, keeping a
+// stream container extension
+func (d *Downloader) migrateLegacyFile(file legacyFile, episode Episode, outputDir string) bool {
+	target := filepath.Join(outputDir, episodeFilename(episode))
+	if ext := strings.ToLower(filepath.Ext(file.path)); ext != filepath.Ext(target) {
+		target = vimeo.ContainerPath(target, strings.TrimPrefix(ext, "."))
+	}
+	if _, err := os.Stat(target); err == nil {
+		return false
+	}
+
+	if err := fsutil.MkdirAll(outputDir); err != nil {
+		fmt.Printf("Warning: Failed to migrate %s: %v\n", d.relativePath(file.path), err)
+		return false
+	}
+	if err := os.Rename(file.path, target); err != nil {
+		fmt.Printf("Warning: Failed to migrate %s: %v\n", d.relativePath(file.path), err)
+		return false
+	}
+	fmt.Printf("- [↻] Episode %d: %s (migrated from %s)\n", episode.Number, episode.Title, d.relativePath(file.path))
+	return true
+}
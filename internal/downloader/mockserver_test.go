@@ -0,0 +1,577 @@
+package downloader_test
+
+import (
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/config"
+	"github.com/sajjadanwar0/laracasts-dl/internal/downloader"
+	"github.com/sajjadanwar0/laracasts-dl/internal/vimeo"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	mockEmail     = "jeffrey@example.com"
+	mockPassword  = "secret"
+	mockXSRFToken = "mock-xsrf-token="
+	mockSession   = "mock-session"
+	mockVideoSize = 256 * 1024
+
+	// mockTOTPEmail has two-factor authentication enabled with mockTOTPSecret
+	mockTOTPEmail  = "taylor@example.com"
+	mockTOTPSecret = "JBSWY3DPEHPK3PXP"
+	mockTOTPFlag   = "mock-two-factor-pending"
+)
+
+// mockLaracasts replays captured page-data and Vimeo config fixtures from
+// testdata and serves deterministic video bytes with Range support
+type mockLaracasts struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	hits   map[string]int
+	agents map[string]int
+
+	// configs lists the vimeo ids whose config was requested, in order
+	configs []string
+
+	// pageTimes are when every request but those for video files arrived
+	pageTimes []time.Time
+
+	// gzipped counts responses served gzip-compressed, and rangedGzip the
+	// ranged requests that accepted gzip
+	gzipped    int
+	rangedGzip int
+
+	// assetVersion replaces the Inertia version of the page fixtures, like a
+	// deploy of new assets; inertiaPages counts pages served as JSON
+	assetVersion string
+	inertiaPages int
+
+	// blockAgent makes every request with this User-Agent fail like a
+	// Cloudflare bot challenge
+	blockAgent string
+
+	// ignoreRange makes video files behave like a CDN edge that advertises
+	// range support but always answers with the whole file
+	ignoreRange bool
+
+	// forbidFile is a video file refused with 403, like a CDN rejecting the
+	// account
+	forbidFile string
+
+	// overloadFile is a video file whose next overloadCount requests fail
+	// with 503, like a weak connection dropping parallel requests
+	overloadFile  string
+	overloadCount int
+
+	// dropXSRF is how many home pages are served without the XSRF cookie,
+	// like a CDN stripping it, and expireXSRF how many logins are refused
+	// with 419 as if the token had expired
+	dropXSRF   int
+	expireXSRF int
+
+	// throttleLogins is how many logins are refused with 429, like Laracasts
+	// rate limiting sign-ins, retryLogins the Retry-After they are sent
+	// with, one second when empty
+	throttleLogins int
+	retryLogins    string
+
+	// kickSession signs every session out when the next series page is
+	// requested, like Laracasts does on too many parallel requests, until
+	// the next login; kicked is set while they are signed out
+	kickSession bool
+	kicked      bool
+
+	// browsePage replaces the fixture of the browse page, e.g. with
+	// browse/catalog listing a second topic
+	browsePage string
+
+	// failTopic is the path of a topic page refused with 500
+	failTopic string
+
+	// publishBit lists one more bit on the first page of bits, like a bit
+	// published in between
+	publishBit bool
+
+	// republish serves pages from testdata/pages/republished once they were
+	// served once, like episodes published in between
+	republish bool
+
+	// privateVideos maps vimeo ids to the hash their config is refused
+	// without, like private videos embedded on Laracasts
+	privateVideos map[string]string
+
+	// clockOffset shifts the Date header of every response, like a server
+	// whose clock differs from the local one
+	clockOffset time.Duration
+
+	// stallFile is a video file whose requests hang until release is
+	// closed, signalling stalled when the first arrives
+	stallFile string
+	stalled   chan struct{}
+	release   chan struct{}
+}
+
+func newMockLaracasts(t *testing.T) *mockLaracasts {
+	t.Helper()
+
+	m := &mockLaracasts{hits: make(map[string]int), agents: make(map[string]int)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", m.handleHome)
+	mux.HandleFunc("/sessions", m.handleLogin)
+	mux.HandleFunc("/two-factor-challenge", m.handleTwoFactor)
+	mux.HandleFunc("/series", m.handlePage)
+	mux.HandleFunc("/series/", m.handlePage)
+	mux.HandleFunc("/browse/", m.handlePage)
+	mux.HandleFunc("/topics/", m.handlePage)
+	mux.HandleFunc("/bits", m.handleBits)
+	mux.HandleFunc("/video/", m.handleVimeoConfig)
+	mux.HandleFunc("/files/", m.handleFile)
+
+	m.Server = httptest.NewServer(m.count(mux))
+	t.Cleanup(m.Close)
+
+	// Point the downloader at the mock server for the duration of the test
+	baseURL, playerURL := config.LaracastsBaseUrl, vimeo.PlayerConfigURL
+	config.LaracastsBaseUrl = m.URL
+	vimeo.PlayerConfigURL = m.URL + "/video/%s/config"
+	t.Cleanup(func() {
+		config.LaracastsBaseUrl = baseURL
+		vimeo.PlayerConfigURL = playerURL
+	})
+
+	return m
+}
+
+// newTestDownloader creates a downloader rooted at downloadPath, the same way
+// the CLI does after loading the environment
+func newTestDownloader(t *testing.T, downloadPath string) *downloader.Downloader {
+	t.Helper()
+
+	t.Setenv("DOWNLOAD_PATH", downloadPath)
+	t.Setenv("VIDEO_QUALITY", "1080p")
+	if os.Getenv("POLITENESS_DELAY_MS") == "" {
+		// The mock server needs no politeness, unless a test asks for it
+		t.Setenv("POLITENESS_DELAY_MS", "0")
+	}
+
+	dl, err := downloader.New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return dl
+}
+
+// signedInDownloader is newTestDownloader signed in to the mock server as
+// mockEmail
+func signedInDownloader(t *testing.T, downloadPath string) *downloader.Downloader {
+	t.Helper()
+
+	dl := newTestDownloader(t, downloadPath)
+	if err := dl.Login(mockEmail, mockPassword); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	return dl
+}
+
+func (m *mockLaracasts) count(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		m.hits[r.Method+" "+r.URL.Path]++
+		m.agents[r.UserAgent()]++
+		if !strings.HasPrefix(r.URL.Path, "/files/") {
+			m.pageTimes = append(m.pageTimes, time.Now())
+		}
+		blocked := m.blockAgent != "" && r.UserAgent() == m.blockAgent
+		if m.clockOffset != 0 {
+			w.Header().Set("Date", time.Now().Add(m.clockOffset).UTC().Format(http.TimeFormat))
+		}
+		m.mu.Unlock()
+
+		if blocked {
+			w.Header().Set("Cf-Mitigated", "challenge")
+			http.Error(w, "Just a moment...", http.StatusForbidden)
+			return
+		}
+
+		// Compress everything but video files, as a CDN would
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			m.mu.Lock()
+			if r.Header.Get("Range") != "" {
+				m.rangedGzip++
+			}
+			if !strings.HasPrefix(r.URL.Path, "/files/") {
+				m.gzipped++
+				m.mu.Unlock()
+
+				gz := gzip.NewWriter(w)
+				defer gz.Close()
+				w.Header().Set("Content-Encoding", "gzip")
+				w = gzipResponseWriter{ResponseWriter: w, gz: gz}
+			} else {
+				m.mu.Unlock()
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz *gzip.Writer
+}
+
+func (w gzipResponseWriter) Write(p []byte) (int, error) {
+	return w.gz.Write(p)
+}
+
+// Hits returns how many requests were made for method and path
+func (m *mockLaracasts) Hits(method, path string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.hits[method+" "+path]
+}
+
+// PageTimes returns when every request but those for video files arrived
+func (m *mockLaracasts) PageTimes() []time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]time.Time(nil), m.pageTimes...)
+}
+
+// Agents returns the User-Agents requests were made with and resets them
+func (m *mockLaracasts) Agents() map[string]int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	agents := m.agents
+	m.agents = make(map[string]int)
+	return agents
+}
+
+// HitsWithPrefix returns how many requests were made under a path prefix
+func (m *mockLaracasts) HitsWithPrefix(method, prefix string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	total := 0
+	for key, n := range m.hits {
+		if strings.HasPrefix(key, method+" "+prefix) {
+			total += n
+		}
+	}
+	return total
+}
+
+func (m *mockLaracasts) handleHome(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	m.mu.Lock()
+	drop := m.dropXSRF > 0
+	if drop {
+		m.dropXSRF--
+	}
+	m.mu.Unlock()
+	if !drop {
+		http.SetCookie(w, &http.Cookie{Name: "XSRF-TOKEN", Value: "mock-xsrf-token%3D", Path: "/"})
+	}
+
+	fixture := "home-guest.json"
+	if m.signedIn(r) {
+		fixture = "home.json"
+	}
+	m.servePage(w, r, filepath.Join("testdata", "pages", fixture))
+}
+
+func (m *mockLaracasts) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	m.mu.Lock()
+	expired := m.expireXSRF > 0
+	if expired {
+		m.expireXSRF--
+	}
+	throttled := m.throttleLogins > 0
+	if throttled {
+		m.throttleLogins--
+	}
+	retryAfter := cmp.Or(m.retryLogins, "1")
+	m.mu.Unlock()
+	if throttled {
+		w.Header().Set("Retry-After", retryAfter)
+		http.Error(w, `{"message":"Too Many Attempts."}`, http.StatusTooManyRequests)
+		return
+	}
+	if expired || r.Header.Get("X-XSRF-TOKEN") != mockXSRFToken {
+		http.Error(w, "CSRF token mismatch", 419)
+		return
+	}
+
+	var auth struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&auth); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if (auth.Email != mockEmail && auth.Email != mockTOTPEmail) || auth.Password != mockPassword {
+		http.Error(w, `{"message":"These credentials do not match our records."}`, http.StatusUnprocessableEntity)
+		return
+	}
+
+	if auth.Email == mockTOTPEmail {
+		http.SetCookie(w, &http.Cookie{Name: "laravel_session", Value: mockTOTPFlag, Path: "/"})
+		fmt.Fprint(w, `{"two_factor":true}`)
+		return
+	}
+
+	m.mu.Lock()
+	m.kicked = false
+	m.mu.Unlock()
+	http.SetCookie(w, &http.Cookie{Name: "laravel_session", Value: mockSession, Path: "/"})
+	fmt.Fprint(w, `{"redirect":"/"}`)
+}
+
+// signedIn reports whether r comes from a session that is signed in
+func (m *mockLaracasts) signedIn(r *http.Request) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, err := r.Cookie("laravel_session")
+	return err == nil && session.Value == mockSession && !m.kicked
+}
+
+// handleTwoFactor accepts the current TOTP code, or the one of the previous
+// step, for a login waiting on its two-factor challenge
+func (m *mockLaracasts) handleTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-XSRF-TOKEN") != mockXSRFToken {
+		http.Error(w, "CSRF token mismatch", 419)
+		return
+	}
+	if session, err := r.Cookie("laravel_session"); err != nil || session.Value != mockTOTPFlag {
+		http.Error(w, "no pending login", http.StatusUnauthorized)
+		return
+	}
+
+	var challenge struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&challenge); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	if challenge.Code != mockTOTP(now) && challenge.Code != mockTOTP(now.Add(-30*time.Second)) {
+		http.Error(w, `{"message":"The provided two factor authentication code was invalid."}`, http.StatusUnprocessableEntity)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: "laravel_session", Value: mockSession, Path: "/"})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// mockTOTP computes the RFC 6238 code for mockTOTPSecret at t
+func mockTOTP(t time.Time) string {
+	key, _ := base32.StdEncoding.DecodeString(mockTOTPSecret)
+	mac := hmac.New(sha1.New, key)
+	binary.Write(mac, binary.BigEndian, uint64(t.Unix()/30))
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	return fmt.Sprintf("%06d", code%1000000)
+}
+
+func (m *mockLaracasts) handlePage(w http.ResponseWriter, r *http.Request) {
+	fixture := filepath.Join("testdata", "pages", filepath.FromSlash(strings.TrimPrefix(r.URL.Path, "/"))+".json")
+
+	m.mu.Lock()
+	republished := m.republish && m.hits[r.Method+" "+r.URL.Path] > 1
+	if r.URL.Path == "/browse/all" && m.browsePage != "" {
+		fixture = filepath.Join("testdata", "pages", filepath.FromSlash(m.browsePage)+".json")
+	}
+	if m.kickSession && strings.HasPrefix(r.URL.Path, "/series/") {
+		m.kickSession, m.kicked = false, true
+	}
+	failed := r.URL.Path == m.failTopic
+	m.mu.Unlock()
+	if failed {
+		http.Error(w, "Server Error", http.StatusInternalServerError)
+		return
+	}
+	if republished {
+		if path := filepath.Join("testdata", "pages", "republished", filepath.Base(fixture)); fileExists(path) {
+			fixture = path
+		}
+	}
+	m.servePage(w, r, fixture)
+}
+
+// handleBits serves the page of bits asked for by the page query, from
+// testdata/pages/bits
+func (m *mockLaracasts) handleBits(w http.ResponseWriter, r *http.Request) {
+	page := r.URL.Query().Get("page")
+	if page == "" {
+		page = "1"
+	}
+	name := "page-" + page
+
+	m.mu.Lock()
+	if page == "1" && m.publishBit {
+		name = "published"
+	}
+	m.mu.Unlock()
+	m.servePage(w, r, filepath.Join("testdata", "pages", "bits", name+".json"))
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// servePage renders a page-data fixture the way Inertia embeds it, or as
+// JSON for Inertia requests sending the current asset version
+func (m *mockLaracasts) servePage(w http.ResponseWriter, r *http.Request, fixture string) {
+	data, err := os.ReadFile(fixture)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	data = bytes.ReplaceAll(data, []byte("{{server}}"), []byte(m.URL))
+
+	var page map[string]interface{}
+	if err := json.Unmarshal(data, &page); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	m.mu.Lock()
+	if m.assetVersion != "" {
+		page["version"] = m.assetVersion
+	}
+	m.mu.Unlock()
+
+	// Every page shares the auth props of the session
+	if props, ok := page["props"].(map[string]interface{}); ok && props["auth"] == nil {
+		auth := map[string]interface{}{"signedIn": false, "user": nil}
+		if m.signedIn(r) {
+			auth = map[string]interface{}{"signedIn": true, "user": map[string]interface{}{"id": 1, "username": "jeffrey"}}
+		}
+		props["auth"] = auth
+	}
+	data, _ = json.Marshal(page)
+
+	if r.Header.Get("X-Inertia") == "true" {
+		if r.Header.Get("X-Inertia-Version") != page["version"] {
+			w.Header().Set("X-Inertia-Location", r.URL.String())
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
+		m.mu.Lock()
+		m.inertiaPages++
+		m.mu.Unlock()
+		w.Header().Set("X-Inertia", "true")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+		return
+	}
+
+	fmt.Fprintf(w, `<html><body><div id="app" data-page="%s"></div></body></html>`,
+		html.EscapeString(string(data)))
+}
+
+// InertiaPages returns how many pages were served as Inertia JSON
+func (m *mockLaracasts) InertiaPages() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.inertiaPages
+}
+
+func (m *mockLaracasts) handleVimeoConfig(w http.ResponseWriter, r *http.Request) {
+	vimeoID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/video/"), "/config")
+	m.mu.Lock()
+	m.configs = append(m.configs, vimeoID)
+	hash, private := m.privateVideos[vimeoID]
+	m.mu.Unlock()
+
+	if private && r.URL.Query().Get("h") != hash {
+		http.Error(w, `{"message":"Because of its privacy settings, this video cannot be played here."}`, http.StatusForbidden)
+		return
+	}
+
+	data, err := os.ReadFile(filepath.Join("testdata", "vimeo", vimeoID+".json"))
+	if err != nil {
+		http.Error(w, `{"message":"Sorry, we couldn't find that page"}`, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, strings.ReplaceAll(string(data), "{{server}}", m.URL))
+}
+
+func (m *mockLaracasts) handleFile(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/files/")
+	if name == m.stallFile {
+		select {
+		case m.stalled <- struct{}{}:
+		default:
+		}
+		<-m.release
+	}
+	if name == m.forbidFile {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if m.overloaded(name) {
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "video/mp4")
+	if m.ignoreRange {
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("Content-Length", fmt.Sprint(mockVideoSize))
+		if r.Method != http.MethodHead {
+			w.Write(mockVideo(name))
+		}
+		return
+	}
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(mockVideo(name)))
+}
+
+// overloaded reports whether a request for the video file name fails as
+// overloadFile, counting it
+func (m *mockLaracasts) overloaded(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if name != m.overloadFile || m.overloadCount == 0 {
+		return false
+	}
+	m.overloadCount--
+	return true
+}
+
+// mockVideo returns the deterministic content served for a video file
+func mockVideo(name string) []byte {
+	return bytes.Repeat([]byte(name), mockVideoSize/len(name)+1)[:mockVideoSize]
+}
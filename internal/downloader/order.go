@@ -0,0 +1,122 @@
+package downloader
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Orders selectable with -order, in which series and their episodes are
+// downloaded
+const (
+	OrderAsListed  = "as-listed"  // the order Laracasts lists them in
+	OrderAlpha     = "alpha"      // by title
+	OrderSizeAsc   = "size-asc"   // smallest first
+	OrderLengthAsc = "length-asc" // shortest first
+)
+
+// estimatedEpisodeLength stands in for the length of an episode of a series
+// whose metadata is not cached yet
+const estimatedEpisodeLength = 10 * time.Minute
+
+// ValidateOrder checks if the provided order is supported
+func ValidateOrder(order string) bool {
+	switch order {
+	case OrderAsListed, OrderAlpha, OrderSizeAsc, OrderLengthAsc:
+		return true
+	}
+	return false
+}
+
+// orderEpisodes sorts the episodes queued for download by Order. Sizes are
+// only known for videos probed before, the others go last.
+func (d *Downloader) orderEpisodes(episodes []Episode) {
+	switch d.Order {
+	case OrderAlpha:
+		sort.SliceStable(episodes, func(i, j int) bool {
+			return strings.ToLower(episodes[i].Title) < strings.ToLower(episodes[j].Title)
+		})
+	case OrderLengthAsc:
+		sort.SliceStable(episodes, func(i, j int) bool {
+			return episodes[i].Length < episodes[j].Length
+		})
+	case OrderSizeAsc:
+		sizes := make(map[string]int64, len(episodes))
+		for _, episode := range episodes {
+			var total int64
+			for _, v := range d.variants("") {
+				size, ok := d.sizes.cached(episode.VimeoId, v.Quality)
+				if !ok || size == 0 {
+					total = -1
+					break
+				}
+				total += size
+			}
+			sizes[episode.VimeoId] = total
+		}
+		sort.SliceStable(episodes, func(i, j int) bool {
+			a, b := sizes[episodes[i].VimeoId], sizes[episodes[j].VimeoId]
+			if a < 0 || b < 0 {
+				return b < 0 && a >= 0
+			}
+			return a < b
+		})
+	}
+}
+
+// orderSeries sorts series by Order. Series are compared by their total
+// length, as their size follows it at a given quality.
+func (d *Downloader) orderSeries(series []TopicSeries) {
+	switch d.Order {
+	case OrderAlpha:
+		sort.SliceStable(series, func(i, j int) bool {
+			return strings.ToLower(series[i].Title) < strings.ToLower(series[j].Title)
+		})
+	case OrderSizeAsc, OrderLengthAsc:
+		lengths := make(map[string]time.Duration, len(series))
+		for _, s := range series {
+			lengths[s.Slug] = d.seriesLength(s.Slug, s.EpisodeCount)
+		}
+		sort.SliceStable(series, func(i, j int) bool {
+			return lengths[series[i].Slug] < lengths[series[j].Slug]
+		})
+	}
+}
+
+// orderSlugs sorts series given by slug by Order
+func (d *Downloader) orderSlugs(slugs []string) {
+	if d.Order == OrderAsListed || d.Order == "" {
+		return
+	}
+	series := make([]TopicSeries, len(slugs))
+	for i, slug := range slugs {
+		series[i] = TopicSeries{Title: slug, Slug: slug}
+	}
+	d.orderSeries(series)
+	for i, s := range series {
+		slugs[i] = s.Slug
+	}
+}
+
+// seriesLength returns the total length of a series from its cached
+// metadata, or an estimate from its episode count
+func (d *Downloader) seriesLength(slug string, episodeCount int) time.Duration {
+	cleanSlug := strings.TrimPrefix(cleanSeriesSlug(slug), "series/")
+
+	var seriesData SeriesMetadata
+	if found, err := d.Cache.Get(fmt.Sprintf("series_%s", cleanSlug), &seriesData); err == nil && found {
+		var total time.Duration
+		for _, chapter := range seriesData.Chapters {
+			for _, episode := range chapter.Episodes {
+				if episode.Length > 0 {
+					total += time.Duration(episode.Length) * time.Second
+				} else {
+					total += estimatedEpisodeLength
+				}
+			}
+		}
+		return total
+	}
+	return time.Duration(episodeCount) * estimatedEpisodeLength
+}
@@ -0,0 +1,348 @@
+package downloader
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/fsutil"
+	"github.com/sajjadanwar0/laracasts-dl/internal/naming"
+	"github.com/sajjadanwar0/laracasts-dl/internal/vimeo"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// originIndexMaxAge limits how often a miss rebuilds the video index, and
+// how often the served manifest is brought up to date
+const originIndexMaxAge = 30 * time.Second
+
+var originSlugRe = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// originIndex maps vimeo ids to the files saved for them, by quality
+type originIndex struct {
+	mu      sync.Mutex
+	videos  map[string]map[string]string
+	builtAt time.Time
+}
+
+// originManifest is the piece manifest served to SyncFrom, updated by one
+// request at a time
+type originManifest struct {
+	mu       sync.Mutex
+	manifest *Manifest
+	builtAt  time.Time
+}
+
+// Serve makes this library a caching origin for other instances on the LAN.
+// It blocks until the server fails.
+func (d *Downloader) Serve(addr string) error {
+	fmt.Printf("Serving %s as a caching origin on %s\n", d.BasePath, addr)
+	if d.OriginToken == "" {
+		fmt.Println("Warning: Anyone who can reach it can read the library, set ORIGIN_TOKEN to require a shared secret")
+	}
+
+	// Copying a video takes as long as the network needs, so only reading
+	// the requests and idle connections are bounded
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           d.OriginHandler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+	return server.ListenAndServe()
+}
+
+// OriginHandler serves cached series metadata under /metadata/series/<slug>,
+// downloaded videos under /videos/<vimeo id>?quality=<quality>, and the piece
+// manifest with the files it lists for SyncFrom. With an OriginToken, requests
+// without it are refused.
+func (d *Downloader) OriginHandler() http.Handler {
+	index := &originIndex{}
+	manifest := &originManifest{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metadata/series/", d.serveSeriesMetadata)
+	mux.HandleFunc("/videos/", func(w http.ResponseWriter, r *http.Request) {
+		d.serveVideo(index, w, r)
+	})
+	mux.HandleFunc("/manifest", func(w http.ResponseWriter, r *http.Request) {
+		d.serveManifest(manifest, w, r)
+	})
+	mux.HandleFunc("/files/", d.serveFile)
+	if d.OriginToken == "" {
+		return mux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		want := "Bearer " + d.OriginToken
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(want)) != 1 {
+			http.Error(w, "origin token required", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// originRequest builds a GET request to an origin, carrying the OriginToken
+func originRequest(rawURL, token string) (*http.Request, error) {
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+func (d *Downloader) serveManifest(cached *originManifest, w http.ResponseWriter, r *http.Request) {
+	manifest, err := cached.get(d)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(manifest)
+}
+
+// serveFile serves a video listed in the manifest, supporting ranged requests
+func (d *Downloader) serveFile(w http.ResponseWriter, r *http.Request) {
+	rel := strings.TrimPrefix(r.URL.Path, "/files/")
+	if !safeRelativePath(rel) {
+		http.NotFound(w, r)
+		return
+	}
+
+	path := filepath.Join(d.BasePath, filepath.FromSlash(rel))
+	if info, err := os.Lstat(path); err != nil || !info.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeFile(w, r, path)
+}
+
+func (d *Downloader) serveSeriesMetadata(w http.ResponseWriter, r *http.Request) {
+	slug := strings.TrimPrefix(r.URL.Path, "/metadata/series/")
+	if !originSlugRe.MatchString(slug) {
+		http.NotFound(w, r)
+		return
+	}
+
+	var seriesData SeriesMetadata
+	found, err := d.Cache.Get("series_"+slug, &seriesData)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(seriesData)
+}
+
+func (d *Downloader) serveVideo(index *originIndex, w http.ResponseWriter, r *http.Request) {
+	vimeoId := strings.TrimPrefix(r.URL.Path, "/videos/")
+	quality := r.URL.Query().Get("quality")
+
+	path, ok := index.lookup(d, vimeoId, quality)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("X-Container", strings.TrimPrefix(filepath.Ext(path), "."))
+	http.ServeFile(w, r, path)
+}
+
+// get returns the manifest, hashing the videos changed since it was built
+// unless that was recently
+func (m *originManifest) get(d *Downloader) (*Manifest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.manifest == nil || time.Since(m.builtAt) > originIndexMaxAge {
+		manifest, err := d.UpdateManifest()
+		if err != nil {
+			return nil, err
+		}
+		m.manifest, m.builtAt = manifest, time.Now()
+	}
+	return m.manifest, nil
+}
+
+// lookup finds the file for a video, rebuilding the index on a miss unless it
+// was built recently
+func (idx *originIndex) lookup(d *Downloader, vimeoId, quality string) (string, bool) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	path, ok := idx.videos[vimeoId][quality]
+	if !ok && time.Since(idx.builtAt) > originIndexMaxAge {
+		idx.videos = d.buildOriginIndex()
+		idx.builtAt = time.Now()
+		path, ok = idx.videos[vimeoId][quality]
+	}
+	return path, ok
+}
+
+// buildOriginIndex locates the downloaded episodes of every cached series, in
+// both the single series and the topics layout, by the Vimeo ID and quality
+// the series metadata lists for them. Only the paths those episodes would be
+// saved under are looked at, the library itself is not walked.
+func (d *Downloader) buildOriginIndex() map[string]map[string]string {
+	videos := make(map[string]map[string]string)
+
+	for _, key := range d.Cache.Keys("series_") {
+		var seriesData SeriesMetadata
+		if found, err := d.Cache.Get(key, &seriesData); err != nil || !found {
+			continue
+		}
+		disambiguateFilenames(&seriesData)
+
+		dirs := d.seriesDirs(strings.TrimPrefix(key, "series_"), seriesData.Title)
+
+		for _, chapter := range seriesData.Chapters {
+			for _, episode := range chapter.Episodes {
+				for _, dir := range dirs {
+					for _, v := range d.variants(filepath.Join(dir, episodeFilename(episode))) {
+						path, ok := d.existingVideo(v.Path)
+						if !ok {
+							continue
+						}
+						if videos[episode.VimeoId] == nil {
+							videos[episode.VimeoId] = make(map[string]string)
+						}
+						videos[episode.VimeoId][v.Quality] = path
+					}
+				}
+			}
+		}
+	}
+	return videos
+}
+
+// seriesDirs returns the directories a series may be saved in, in both the
+// single series and the topics layout
+func (d *Downloader) seriesDirs(slug, title string) []string {
+	if state, err := d.loadDownloadState(slug); err == nil && state.Dir != "" {
+		return []string{state.Dir}
+	}
+
+	// Series downloaded before their directory was recorded
+	dirs := []string{filepath.Join(d.BasePath, slug)}
+	topicDirs, _ := filepath.Glob(filepath.Join(d.BasePath, "topics", "*", naming.Sanitize(title)))
+	return append(dirs, topicDirs...)
+}
+
+// existingVideo returns whichever of outputPath and its container counterpart
+// is on disk
+func (d *Downloader) existingVideo(outputPath string) (string, bool) {
+	for _, path := range []string{outputPath, vimeo.ContainerPath(outputPath, d.Vimeo.Container)} {
+		if info, err := os.Stat(path); err == nil && info.Size() > 0 {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// originSeriesMetadata fetches series metadata from the origin, returning nil
+// when it is unavailable there
+func (d *Downloader) originSeriesMetadata(cleanSlug string) *SeriesMetadata {
+	req, err := originRequest(fmt.Sprintf("%s/metadata/series/%s", d.Origin, url.PathEscape(cleanSlug)), d.OriginToken)
+	if err != nil {
+		return nil
+	}
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		fmt.Printf("Warning: Origin unavailable: %v\n", err)
+		return nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusUnauthorized {
+			fmt.Println("Warning: Origin refused the request, check ORIGIN_TOKEN")
+		}
+		return nil
+	}
+
+	var seriesData SeriesMetadata
+	if err := json.NewDecoder(resp.Body).Decode(&seriesData); err != nil {
+		fmt.Printf("Warning: Invalid metadata from origin: %v\n", err)
+		return nil
+	}
+
+	// Its cached copy may be older than one this instance would refresh
+	if time.Since(seriesData.UpdatedAt) > SeriesCacheMaxAge {
+		return nil
+	}
+	fmt.Println("Using series metadata from origin")
+	return &seriesData
+}
+
+// fetchFromOrigin copies the variants the origin already has, returning the
+// ones that still have to be downloaded from Vimeo
+func (d *Downloader) fetchFromOrigin(vimeoId string, variants []qualityVariant) []qualityVariant {
+	var remaining []qualityVariant
+	for _, v := range variants {
+		if err := d.copyFromOrigin(vimeoId, v); err != nil {
+			remaining = append(remaining, v)
+		}
+	}
+	return remaining
+}
+
+func (d *Downloader) copyFromOrigin(vimeoId string, v qualityVariant) error {
+	videoURL := fmt.Sprintf("%s/videos/%s?quality=%s", d.Origin, url.PathEscape(vimeoId), url.QueryEscape(v.Quality))
+	req, err := originRequest(videoURL, d.OriginToken)
+	if err != nil {
+		return err
+	}
+	// Without the overall timeout of d.Client, which would cut off a video
+	// taking longer than it to copy
+	resp, err := d.Vimeo.Stream(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("origin returned status %d", resp.StatusCode)
+	}
+
+	outputPath := v.Path
+	if container := resp.Header.Get("X-Container"); container == vimeo.ContainerMKV {
+		outputPath = vimeo.ContainerPath(v.Path, container)
+	}
+
+	tmpPath := outputPath + ".part"
+	file, err := fsutil.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+
+	written, err := io.Copy(file, resp.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && resp.ContentLength > 0 && written != resp.ContentLength {
+		err = fmt.Errorf("incomplete copy: got %d of %d bytes", written, resp.ContentLength)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	fmt.Printf("Copied %s from origin\n", filepath.Base(outputPath))
+	return os.Rename(tmpPath, outputPath)
+}
@@ -0,0 +1,189 @@
+package downloader_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/sajjadanwar0/laracasts-dl/internal/downloader"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestDownloadSeriesCopiesFromOrigin(t *testing.T) {
+	server := newMockLaracasts(t)
+
+	origin := signedInDownloader(t, t.TempDir())
+	if err := origin.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("origin DownloadSeries() error = %v", err)
+	}
+	originServer := httptest.NewServer(origin.OriginHandler())
+	t.Cleanup(originServer.Close)
+
+	pagesBefore := server.HitsWithPrefix("GET", "/series/")
+	configsBefore := server.HitsWithPrefix("GET", "/video/")
+
+	downloadPath := t.TempDir()
+	dl := newTestDownloader(t, downloadPath)
+	dl.Origin = originServer.URL
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+
+	if got := server.HitsWithPrefix("GET", "/series/") - pagesBefore; got != 0 {
+		t.Errorf("series page requested %d times, want metadata from origin", got)
+	}
+	if got := server.HitsWithPrefix("GET", "/video/") - configsBefore; got != 0 {
+		t.Errorf("video config requested %d times, want videos from origin", got)
+	}
+
+	got, err := os.ReadFile(filepath.Join(downloadPath, "laravel-basics", "02-routing-basics.mp4"))
+	if err != nil {
+		t.Fatalf("episode not copied: %v", err)
+	}
+	if !bytes.Equal(got, mockVideo("1002-1080.mp4")) {
+		t.Error("copied episode content does not match origin")
+	}
+}
+
+func TestOriginRequiresToken(t *testing.T) {
+	server := newMockLaracasts(t)
+
+	origin := signedInDownloader(t, t.TempDir())
+	origin.OriginToken = "shared-secret"
+
+	if err := origin.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("origin DownloadSeries() error = %v", err)
+	}
+	originServer := httptest.NewServer(origin.OriginHandler())
+	t.Cleanup(originServer.Close)
+
+	// Without the token everything comes from Laracasts
+	pagesBefore := server.HitsWithPrefix("GET", "/series/")
+	outsider := newTestDownloader(t, t.TempDir())
+	outsider.Origin = originServer.URL
+	if err := outsider.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() without token error = %v", err)
+	}
+	if got := server.HitsWithPrefix("GET", "/series/") - pagesBefore; got != 1 {
+		t.Errorf("series page requested %d times without the token, want 1", got)
+	}
+
+	pagesBefore = server.HitsWithPrefix("GET", "/series/")
+	configsBefore := server.HitsWithPrefix("GET", "/video/")
+	dl := newTestDownloader(t, t.TempDir())
+	dl.Origin = originServer.URL
+	dl.OriginToken = "shared-secret"
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() with token error = %v", err)
+	}
+	if got := server.HitsWithPrefix("GET", "/series/") - pagesBefore; got != 0 {
+		t.Errorf("series page requested %d times with the token, want metadata from origin", got)
+	}
+	if got := server.HitsWithPrefix("GET", "/video/") - configsBefore; got != 0 {
+		t.Errorf("video config requested %d times with the token, want videos from origin", got)
+	}
+	// The copy keeps the age of the origin's
+	var want, got downloader.SeriesMetadata
+	if _, err := origin.Cache.Get("series_laravel-basics", &want); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dl.Cache.Get("series_laravel-basics", &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.UpdatedAt.Equal(want.UpdatedAt) {
+		t.Errorf("UpdatedAt of the copied metadata = %v, want the origin's %v", got.UpdatedAt, want.UpdatedAt)
+	}
+}
+
+func TestOriginReusesManifest(t *testing.T) {
+	newMockLaracasts(t)
+
+	sourcePath := t.TempDir()
+	source := signedInDownloader(t, sourcePath)
+	if err := source.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("source DownloadSeries() error = %v", err)
+	}
+	originServer := httptest.NewServer(source.OriginHandler())
+	t.Cleanup(originServer.Close)
+
+	fetch := func() (*downloader.Manifest, error) {
+		resp, err := http.Get(originServer.URL + "/manifest")
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		var manifest downloader.Manifest
+		return &manifest, json.NewDecoder(resp.Body).Decode(&manifest)
+	}
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if manifest, err := fetch(); err != nil || len(manifest.Files) != 3 {
+				t.Errorf("concurrent manifest request = %v, %v, want 3 files", manifest, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// A video added since is only hashed once the manifest is due again
+	added := filepath.Join(sourcePath, "laravel-basics", "04-added.mp4")
+	if err := os.WriteFile(added, mockVideo("1001-720.mp4"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if manifest, err := fetch(); err != nil || len(manifest.Files) != 3 {
+		t.Errorf("manifest right after = %v, %v, want the one already built", manifest, err)
+	}
+}
+
+func TestSyncFromLibrary(t *testing.T) {
+	newMockLaracasts(t)
+
+	sourcePath := t.TempDir()
+	source := signedInDownloader(t, sourcePath)
+	if err := source.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("source DownloadSeries() error = %v", err)
+	}
+	originServer := httptest.NewServer(source.OriginHandler())
+	t.Cleanup(originServer.Close)
+
+	for name, from := range map[string]string{"directory": sourcePath, "origin": originServer.URL} {
+		t.Run(name, func(t *testing.T) {
+			downloadPath := t.TempDir()
+			dl := newTestDownloader(t, downloadPath)
+
+			// A stale copy of one episode that has to be patched
+			stale := filepath.Join(downloadPath, "laravel-basics", "01-introduction-to-laravel.mp4")
+			if err := os.MkdirAll(filepath.Dir(stale), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(stale, mockVideo("1001-720.mp4"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dl.SyncFrom(from); err != nil {
+				t.Fatalf("SyncFrom() error = %v", err)
+			}
+
+			for filename, content := range map[string]string{
+				"01-introduction-to-laravel.mp4": "1001-1080.mp4",
+				"02-routing-basics.mp4":          "1002-1080.mp4",
+				"03-controllers.mp4":             "1003-1080.mp4",
+			} {
+				got, err := os.ReadFile(filepath.Join(downloadPath, "laravel-basics", filename))
+				if err != nil {
+					t.Errorf("%s not synced: %v", filename, err)
+					continue
+				}
+				if !bytes.Equal(got, mockVideo(content)) {
+					t.Errorf("%s content does not match the source", filename)
+				}
+			}
+		})
+	}
+}
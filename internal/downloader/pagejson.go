@@ -0,0 +1,125 @@
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Browse and topic pages embed several megabytes of props, most of which the
+// scraper never reads. Decoding them whole into structs holds the page, its
+// byte copy and every value at once; these helpers instead walk the page
+// object with a streaming decoder, skipping what is not asked for and
+// decoding list entries one at a time.
+
+// pageDecoder returns a decoder over the page object in pageData
+func pageDecoder(pageData string) *json.Decoder {
+	return json.NewDecoder(strings.NewReader(pageData))
+}
+
+// descend moves dec into the value at path, a chain of object keys from the
+// current value, skipping the values before each key. It reports false when
+// a key is missing or a value on the way is not an object.
+func descend(dec *json.Decoder, path ...string) (bool, error) {
+	for _, key := range path {
+		found := false
+		err := forEachKey(dec, func(name string) (bool, error) {
+			if name != key {
+				return true, skipValue(dec)
+			}
+			found = true
+			return false, nil
+		})
+		if err != nil || !found {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// forEachKey calls fn with every key of the object dec is at. fn consumes
+// the value of the key, and stops the walk by returning false, leaving dec
+// at that value's end; the rest of the object is then left unread.
+func forEachKey(dec *json.Decoder, fn func(key string) (bool, error)) error {
+	ok, err := expectDelim(dec, '{')
+	if err != nil || !ok {
+		return err
+	}
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := token.(string)
+		more, err := fn(key)
+		if err != nil || !more {
+			return err
+		}
+	}
+	_, err = dec.Token() // '}'
+	return err
+}
+
+// forEachElement calls fn for every element of the array dec is at, which fn
+// decodes or skips. A null or missing array has no elements.
+func forEachElement(dec *json.Decoder, fn func() error) error {
+	ok, err := expectDelim(dec, '[')
+	if err != nil || !ok {
+		return err
+	}
+	for dec.More() {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	_, err = dec.Token() // ']'
+	return err
+}
+
+// expectDelim reads the opening delimiter of a value, reporting false when
+// the value is of another kind, which is read whole
+func expectDelim(dec *json.Decoder, delim json.Delim) (bool, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return false, err
+	}
+	if d, ok := token.(json.Delim); ok && d == delim {
+		return true, nil
+	}
+	if d, ok := token.(json.Delim); ok {
+		return false, skipRest(dec, d)
+	}
+	return false, nil
+}
+
+// skipValue reads past the next value without keeping any of it
+func skipValue(dec *json.Decoder) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := token.(json.Delim); ok {
+		return skipRest(dec, d)
+	}
+	return nil
+}
+
+// skipRest reads past the end of the object or array opened by d
+func skipRest(dec *json.Decoder, d json.Delim) error {
+	if d != '{' && d != '[' {
+		return fmt.Errorf("unexpected %v", d)
+	}
+	for depth := 1; depth > 0; {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+	return nil
+}
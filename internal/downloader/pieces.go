@@ -0,0 +1,474 @@
+package downloader
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/fsutil"
+	"github.com/sajjadanwar0/laracasts-dl/internal/vimeo"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// manifestFile holds the piece hashes of a library, in its root so a
+	// library can be synced from a plain directory
+	manifestFile = ".pieces.json"
+
+	// PieceSize is the length of every hashed piece but the last
+	PieceSize = 4 * 1024 * 1024
+)
+
+// FileManifest describes a completed video as a list of SHA-256 piece hashes
+type FileManifest struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Pieces  []string  `json:"pieces"`
+}
+
+// Manifest lists the videos of a library by slash-separated relative path
+type Manifest struct {
+	PieceSize int64                    `json:"piece_size"`
+	Files     map[string]*FileManifest `json:"files"`
+}
+
+// UpdateManifest hashes the videos added or changed since the manifest was
+// last written and saves it in the library root. Videos hashed while they
+// were downloaded are not read again.
+func (d *Downloader) UpdateManifest() (*Manifest, error) {
+	return updateManifest(d.BasePath, d.hashed.snapshot())
+}
+
+// updateManifest hashes the videos of basePath, taking the pieces of those
+// unchanged since the previous manifest or listed in hashed, by absolute path
+func updateManifest(basePath string, hashed map[string]*FileManifest) (*Manifest, error) {
+	previous := &Manifest{}
+	if data, err := os.ReadFile(filepath.Join(basePath, manifestFile)); err == nil {
+		if err := json.Unmarshal(data, previous); err != nil {
+			fmt.Printf("Warning: Ignoring invalid %s: %v\n", manifestFile, err)
+			previous = &Manifest{}
+		}
+	}
+	if previous.PieceSize != PieceSize {
+		previous.Files = nil
+	}
+
+	manifest := &Manifest{PieceSize: PieceSize, Files: make(map[string]*FileManifest)}
+	rehashed := 0
+
+	err := filepath.WalkDir(basePath, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if p != basePath && (strings.HasPrefix(entry.Name(), ".") || filepath.Ext(entry.Name()) == vimeo.HLSCacheExt) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isVideoFile(entry.Name()) || !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(basePath, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if old, ok := previous.Files[rel]; ok && old.Size == info.Size() && old.ModTime.Equal(info.ModTime()) {
+			manifest.Files[rel] = old
+			return nil
+		}
+		if abs, err := filepath.Abs(p); err == nil {
+			if file, ok := hashed[abs]; ok && file.Size == info.Size() && file.ModTime.Equal(info.ModTime()) {
+				manifest.Files[rel] = file
+				return nil
+			}
+		}
+
+		pieces, err := hashPieces(p)
+		if err != nil {
+			return fmt.Errorf("failed to hash %s: %v", rel, err)
+		}
+		manifest.Files[rel] = &FileManifest{Size: info.Size(), ModTime: info.ModTime(), Pieces: pieces}
+		rehashed++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal manifest: %v", err)
+	}
+	// A read-only source library can still be synced from
+	if err := fsutil.WriteFile(filepath.Join(basePath, manifestFile), data); err != nil {
+		fmt.Printf("Warning: Failed to write manifest: %v\n", err)
+	}
+
+	if rehashed > 0 {
+		fmt.Printf("Hashed %d new or changed videos into %s\n", rehashed, manifestFile)
+	}
+	return manifest, nil
+}
+
+// renameManifestDir moves the manifest entries of the videos in oldDir to
+// newDir, so a renamed folder is not hashed again
+func renameManifestDir(basePath, oldDir, newDir string) error {
+	path := filepath.Join(basePath, manifestFile)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	manifest := &Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return err
+	}
+
+	root, err := filepath.Abs(basePath)
+	if err != nil {
+		return err
+	}
+	oldRel, errOld := filepath.Rel(root, oldDir)
+	newRel, errNew := filepath.Rel(root, newDir)
+	if errOld != nil || errNew != nil || !filepath.IsLocal(oldRel) || !filepath.IsLocal(newRel) {
+		return nil
+	}
+	oldPrefix, newPrefix := filepath.ToSlash(oldRel)+"/", filepath.ToSlash(newRel)+"/"
+
+	renamed := false
+	for rel, file := range manifest.Files {
+		if strings.HasPrefix(rel, oldPrefix) {
+			delete(manifest.Files, rel)
+			manifest.Files[newPrefix+strings.TrimPrefix(rel, oldPrefix)] = file
+			renamed = true
+		}
+	}
+	if !renamed {
+		return nil
+	}
+
+	data, err = json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %v", err)
+	}
+	return fsutil.WriteFile(path, data)
+}
+
+// downloadHashes keeps the pieces of the videos hashed while downloaded,
+// until the manifest is updated
+type downloadHashes struct {
+	mu    sync.Mutex
+	files map[string]*FileManifest // by absolute path
+}
+
+// record is the vimeo.Client Hashed callback; the size and modification
+// time tell if the file was changed after, e.g. by embedding subtitles
+func (h *downloadHashes) record(outputPath string, pieces []string) {
+	info, err := os.Stat(outputPath)
+	if err != nil {
+		return
+	}
+	if abs, err := filepath.Abs(outputPath); err == nil {
+		outputPath = abs
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.files == nil {
+		h.files = make(map[string]*FileManifest)
+	}
+	h.files[outputPath] = &FileManifest{Size: info.Size(), ModTime: info.ModTime(), Pieces: pieces}
+}
+
+// move keeps the pieces recorded for the video at from for it renamed to to
+func (h *downloadHashes) move(from, to string) {
+	from, _ = filepath.Abs(from)
+	to, _ = filepath.Abs(to)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if file, ok := h.files[from]; ok {
+		delete(h.files, from)
+		h.files[to] = file
+	}
+}
+
+func (h *downloadHashes) snapshot() map[string]*FileManifest {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	files := make(map[string]*FileManifest, len(h.files))
+	for path, file := range h.files {
+		files[path] = file
+	}
+	return files
+}
+
+// isVideoFile reports whether name is a finished video, not an ffmpeg
+// ".part" output
+func isVideoFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return (ext == ".mp4" || ext == ".mkv") && !strings.HasSuffix(strings.TrimSuffix(name, filepath.Ext(name)), ".part")
+}
+
+// hashPieces returns the hex SHA-256 of every PieceSize piece of a file
+func hashPieces(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var pieces []string
+	buf := make([]byte, PieceSize)
+	for {
+		n, err := io.ReadFull(file, buf)
+		if n > 0 {
+			sum := sha256.Sum256(buf[:n])
+			pieces = append(pieces, hex.EncodeToString(sum[:]))
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return pieces, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// pieceSource reads pieces of another library, either a directory or an
+// instance running Serve
+type pieceSource interface {
+	manifest() (*Manifest, error)
+	readPiece(rel string, offset, length int64) ([]byte, error)
+}
+
+type dirSource string
+
+func (s dirSource) manifest() (*Manifest, error) {
+	return updateManifest(string(s), nil)
+}
+
+func (s dirSource) readPiece(rel string, offset, length int64) ([]byte, error) {
+	file, err := os.Open(filepath.Join(string(s), filepath.FromSlash(rel)))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	buf := make([]byte, length)
+	if _, err := file.ReadAt(buf, offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf, nil
+}
+
+type originSource struct {
+	client *http.Client
+	url    string
+	token  string
+}
+
+func (s originSource) manifest() (*Manifest, error) {
+	req, err := originRequest(s.url+"/manifest", s.token)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("origin returned status %d for manifest", resp.StatusCode)
+	}
+
+	var manifest Manifest
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest from origin: %v", err)
+	}
+	return &manifest, nil
+}
+
+func (s originSource) readPiece(rel string, offset, length int64) ([]byte, error) {
+	req, err := originRequest(s.url+"/files/"+rel, s.token)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("origin returned status %d for %s", resp.StatusCode, rel)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, length))
+}
+
+// SyncFrom mirrors the videos of another library, a directory or the URL of an
+// instance running Serve, fetching only the pieces that are missing or differ
+func (d *Downloader) SyncFrom(from string) error {
+	var source pieceSource = dirSource(from)
+	if strings.HasPrefix(from, "http://") || strings.HasPrefix(from, "https://") {
+		source = originSource{client: d.Client, url: strings.TrimSuffix(from, "/"), token: d.OriginToken}
+	}
+
+	remote, err := source.manifest()
+	if err != nil {
+		return fmt.Errorf("failed to read source manifest: %v", err)
+	}
+	if remote.PieceSize != PieceSize {
+		return fmt.Errorf("source uses %d byte pieces, expected %d", remote.PieceSize, PieceSize)
+	}
+
+	local, err := d.UpdateManifest()
+	if err != nil {
+		return fmt.Errorf("failed to hash local library: %v", err)
+	}
+
+	var files, fetched, failed, ignored int
+	for rel, remoteFile := range remote.Files {
+		if !safeRelativePath(rel) {
+			fmt.Printf("Skipping unsafe path from source: %s\n", rel)
+			continue
+		}
+		if hasIgnoreMarker(filepath.Join(d.BasePath, filepath.Dir(filepath.FromSlash(rel)))) {
+			ignored++
+			continue
+		}
+
+		n, changed, err := d.syncFile(source, rel, remoteFile, local.Files[rel])
+		fetched += n
+		if err != nil {
+			fmt.Printf("❌ %s: %v\n", rel, err)
+			failed++
+			continue
+		}
+		if changed {
+			files++
+		}
+	}
+
+	if _, err := d.UpdateManifest(); err != nil {
+		fmt.Printf("Warning: Failed to update manifest: %v\n", err)
+	}
+
+	fmt.Printf("\nSync Summary:\n")
+	fmt.Printf("Files in source: %d\n", len(remote.Files))
+	fmt.Printf("Files updated: %d (%d pieces fetched)\n", files, fetched)
+	if ignored > 0 {
+		fmt.Printf("Ignored: %d (in folders with %s)\n", ignored, IgnoreMarker)
+	}
+	fmt.Printf("Failed: %d\n", failed)
+
+	if failed > 0 {
+		return fmt.Errorf("failed to sync %d files", failed)
+	}
+	return nil
+}
+
+// syncFile brings one local file in line with remote, patching it in a
+// ".sync" copy so an interrupted sync never leaves a truncated video behind.
+// It returns the number of pieces fetched and whether the file changed.
+func (d *Downloader) syncFile(source pieceSource, rel string, remote, local *FileManifest) (int, bool, error) {
+	target := filepath.Join(d.BasePath, filepath.FromSlash(rel))
+	work := target + ".sync"
+
+	// Pieces already present locally, by index
+	have := make(map[int]bool)
+	if _, err := os.Stat(work); err == nil {
+		// Resume an interrupted sync; its pieces are checked below
+		if pieces, err := hashPieces(work); err == nil {
+			for i, hash := range pieces {
+				have[i] = i < len(remote.Pieces) && hash == remote.Pieces[i]
+			}
+		}
+	} else if local != nil {
+		if local.Size == remote.Size && slices.Equal(local.Pieces, remote.Pieces) {
+			return 0, false, nil
+		}
+		for i, hash := range local.Pieces {
+			have[i] = i < len(remote.Pieces) && hash == remote.Pieces[i]
+		}
+		if err := os.Rename(target, work); err != nil {
+			return 0, false, err
+		}
+	}
+
+	if err := fsutil.MkdirAll(filepath.Dir(work)); err != nil {
+		return 0, false, err
+	}
+	file, err := fsutil.OpenFile(work, os.O_CREATE|os.O_RDWR)
+	if err != nil {
+		return 0, false, err
+	}
+	defer file.Close()
+
+	if err := file.Truncate(remote.Size); err != nil {
+		return 0, false, err
+	}
+
+	fetched := 0
+	for i, want := range remote.Pieces {
+		if have[i] {
+			continue
+		}
+
+		offset := int64(i) * PieceSize
+		length := min(int64(PieceSize), remote.Size-offset)
+		data, err := source.readPiece(rel, offset, length)
+		if err != nil {
+			return fetched, false, err
+		}
+
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != want || int64(len(data)) != length {
+			return fetched, false, fmt.Errorf("piece %d does not match the source manifest", i)
+		}
+		if _, err := file.WriteAt(data, offset); err != nil {
+			return fetched, false, err
+		}
+		fetched++
+	}
+
+	if err := file.Close(); err != nil {
+		return fetched, false, err
+	}
+	if err := os.Rename(work, target); err != nil {
+		return fetched, false, err
+	}
+
+	fmt.Printf("✓ %s (%d/%d pieces fetched)\n", rel, fetched, len(remote.Pieces))
+	return fetched, true, nil
+}
+
+// safeRelativePath reports whether rel stays inside the library
+func safeRelativePath(rel string) bool {
+	clean := path.Clean(rel)
+	return clean == rel && clean != "." && !path.IsAbs(clean) &&
+		clean != ".." && !strings.HasPrefix(clean, "../") && isVideoFile(clean)
+}
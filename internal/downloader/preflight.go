@@ -0,0 +1,90 @@
+package downloader
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/fsutil"
+	"os"
+	"path/filepath"
+)
+
+// preflightSize is the size the probe file is pre-allocated to
+const preflightSize = 1 << 20
+
+// Preflight checks, before the first video, that the filesystem of the
+// download path supports what downloads rely on, as network shares (SMB,
+// NFS) often lack some of it. Creating, writing and renaming files over
+// others are required. Pre-allocation and symlinks are turned off when
+// missing, instead of failing every file that needs them mid-run.
+func (d *Downloader) Preflight() error {
+	if err := fsutil.MkdirAll(d.BasePath); err != nil {
+		return fmt.Errorf("cannot create DOWNLOAD_PATH %s: %w", d.BasePath, err)
+	}
+	dir, err := os.MkdirTemp(d.BasePath, ".preflight-")
+	if err != nil {
+		return fmt.Errorf("cannot create directories in DOWNLOAD_PATH %s: %w", d.BasePath, err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The summary email tells how much the run added to the disk
+	if free, ok := freeSpace(d.BasePath); ok {
+		d.startFree = free
+	}
+
+	probe := filepath.Join(dir, "probe.mp4")
+	if err := fsutil.WriteFile(probe, []byte("probe")); err != nil {
+		return fmt.Errorf("cannot write files in DOWNLOAD_PATH %s: %w", d.BasePath, err)
+	}
+
+	part := probe + ".part"
+	file, err := fsutil.OpenFile(part, os.O_CREATE|os.O_RDWR)
+	if err != nil {
+		return fmt.Errorf("cannot write files in DOWNLOAD_PATH %s: %w", d.BasePath, err)
+	}
+	preallocated := preallocates(file)
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("cannot write files in DOWNLOAD_PATH %s: %w", d.BasePath, err)
+	}
+
+	// Finished videos, caches and state files replace the previous ones by
+	// renaming a complete copy over them
+	if err := os.Rename(part, probe); err != nil {
+		return fmt.Errorf("cannot rename files over others in DOWNLOAD_PATH %s: %w", d.BasePath, err)
+	}
+
+	link := filepath.Join(dir, "link")
+	symlinks := fsutil.Symlink(filepath.Base(probe), link) == nil
+	if symlinks {
+		target, err := os.Readlink(link)
+		symlinks = err == nil && target == filepath.Base(probe)
+	}
+
+	if !preallocated {
+		d.Vimeo.Preallocate = false
+		fmt.Printf("⚠️  %s cannot pre-allocate files (common on network shares), videos are downloaded in one piece instead of parallel chunks\n", d.BasePath)
+	}
+	if !symlinks {
+		d.Symlinks = false
+		fmt.Printf("⚠️  %s does not support symlinks (common on network shares), series listed under several topics are only saved under the first, and authors and collections are not linked\n", d.BasePath)
+	}
+	return nil
+}
+
+// preallocates reports whether file can be extended to preflightSize and
+// written at an offset within, as chunked downloads do
+func preallocates(file *os.File) bool {
+	if err := file.Truncate(preflightSize); err != nil {
+		return false
+	}
+	data := []byte("chunk")
+	if _, err := file.WriteAt(data, preflightSize/2); err != nil {
+		return false
+	}
+	if info, err := file.Stat(); err != nil || info.Size() != preflightSize {
+		return false
+	}
+
+	got := make([]byte, len(data))
+	_, err := file.ReadAt(got, preflightSize/2)
+	return err == nil && bytes.Equal(got, data)
+}
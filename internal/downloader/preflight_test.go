@@ -0,0 +1,61 @@
+package downloader_test
+
+import (
+	"bytes"
+	"github.com/sajjadanwar0/laracasts-dl/internal/downloader"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPreflight(t *testing.T) {
+	newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := newTestDownloader(t, downloadPath)
+
+	if err := dl.Preflight(); err != nil {
+		t.Fatalf("Preflight() error = %v", err)
+	}
+	if !dl.Symlinks || !dl.Vimeo.Preallocate {
+		t.Errorf("Symlinks = %v, Preallocate = %v, want both supported on a local disk", dl.Symlinks, dl.Vimeo.Preallocate)
+	}
+	entries, _ := os.ReadDir(downloadPath)
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".preflight") {
+			t.Errorf("Preflight() left %s behind", entry.Name())
+		}
+	}
+
+	// Without pre-allocation videos are fetched in one piece, and without
+	// symlinks no author links are made
+	dl.Vimeo.Preallocate = false
+	dl.Vimeo.SmallFileThreshold = 0
+	dl.Vimeo.ChunkSize = mockVideoSize / 4
+	dl.Symlinks = false
+	if err := dl.Login(mockEmail, mockPassword); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(downloadPath, "laravel-basics", "02-routing-basics.mp4")); err != nil || !bytes.Equal(got, mockVideo("1002-1080.mp4")) {
+		t.Errorf("episode not downloaded without pre-allocation: %v", err)
+	}
+	if err := dl.LinkAuthors(); err != nil {
+		t.Fatalf("LinkAuthors() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(downloadPath, downloader.AuthorsDir)); !os.IsNotExist(err) {
+		t.Errorf("authors linked without symlinks: %v", err)
+	}
+
+	// A download path that cannot be created fails before any video
+	blocker := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	dl.BasePath = filepath.Join(blocker, "downloads")
+	if err := dl.Preflight(); err == nil {
+		t.Error("Preflight() of a path under a file succeeded, want error")
+	}
+}
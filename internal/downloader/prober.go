@@ -0,0 +1,216 @@
+package downloader
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// sizeCacheKey holds the remote size of every probed video variant
+	sizeCacheKey = "video_sizes"
+
+	// qualityCacheKey holds the best quality Vimeo offers for every video
+	// whose config was fetched
+	qualityCacheKey = "video_qualities"
+
+	// sizeMaxAge is how long a probed size is trusted before it is fetched
+	// again
+	sizeMaxAge = 24 * time.Hour
+)
+
+// probedSize is the remote size of one quality of a video
+type probedSize struct {
+	Size      int64     `json:"size"` // 0 when only streams are available
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// sizeProber looks up remote video sizes with bounded concurrency, keeping
+// them in the cache by vimeo id and quality so repeated checks of a large
+// library do not HEAD every file again. It also remembers the best quality of
+// every video, so a quality that is not offered is known before asking.
+type sizeProber struct {
+	d *Downloader
+
+	once      sync.Once
+	mu        sync.Mutex
+	sizes     map[string]probedSize
+	qualities map[string]string // vimeo id to best quality, "" for streams only
+
+	// loadedAt is when the cached sizes were read; with NoCache only sizes
+	// probed since are trusted, the others are kept to be saved back
+	loadedAt time.Time
+}
+
+// sizeKey keys the size of a video in quality. A quality above the best one
+// offered is keyed as the best one, which is what is downloaded for it.
+func (p *sizeProber) sizeKey(vimeoId, quality string) string {
+	if best, ok := p.qualities[vimeoId]; ok && best != "" && qualityHeight(best) < qualityHeight(quality) {
+		quality = best
+	}
+	return vimeoId + "@" + quality
+}
+
+// load reads the sizes probed by earlier runs
+func (p *sizeProber) load() {
+	p.once.Do(func() {
+		p.loadedAt = time.Now()
+		p.sizes = make(map[string]probedSize)
+		if _, err := p.d.Cache.Get(sizeCacheKey, &p.sizes); err != nil {
+			fmt.Printf("Cache error: %v, probing sizes again\n", err)
+		}
+		p.qualities = make(map[string]string)
+		if _, err := p.d.Cache.Get(qualityCacheKey, &p.qualities); err != nil {
+			fmt.Printf("Cache error: %v, probing qualities again\n", err)
+		}
+	})
+}
+
+// cached returns the remote size of a video variant when it was probed
+// recently
+func (p *sizeProber) cached(vimeoId, quality string) (int64, bool) {
+	p.load()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	size, ok := p.sizes[p.sizeKey(vimeoId, quality)]
+	if !ok || time.Since(size.CheckedAt) > sizeMaxAge || (p.d.NoCache && size.CheckedAt.Before(p.loadedAt)) {
+		return 0, false
+	}
+	return size.Size, true
+}
+
+// sizesOf returns the remote size of every requested quality of a video,
+// probing them unless all are cached. fetched reports whether it probed.
+func (p *sizeProber) sizesOf(vimeoId string) (sizes map[string]int64, fetched bool, err error) {
+	sizes = make(map[string]int64)
+	complete := true
+	for _, v := range p.d.variants("") {
+		size, ok := p.cached(vimeoId, v.Quality)
+		if !ok {
+			complete = false
+			break
+		}
+		sizes[v.Quality] = size
+	}
+	if complete {
+		return sizes, false, nil
+	}
+
+	videoConfig, err := p.d.videoConfig(vimeoId)
+	if err != nil {
+		return nil, false, err
+	}
+
+	p.recordQuality(vimeoId, p.d.Vimeo.SelectQuality(videoConfig, ""))
+
+	now := time.Now()
+	for _, v := range p.d.variants("") {
+		size, err := p.d.Vimeo.RemoteSize(videoConfig, v.Quality)
+		if err != nil {
+			return nil, false, err
+		}
+		sizes[v.Quality] = size
+
+		p.mu.Lock()
+		p.sizes[p.sizeKey(vimeoId, v.Quality)] = probedSize{Size: size, CheckedAt: now}
+		p.mu.Unlock()
+	}
+	return sizes, true, nil
+}
+
+// recordQuality remembers the best quality offered for a video, reporting
+// whether it changed
+func (p *sizeProber) recordQuality(vimeoId, best string) bool {
+	p.load()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if known, ok := p.qualities[vimeoId]; ok && known == best {
+		return false
+	}
+	p.qualities[vimeoId] = best
+	return true
+}
+
+// bestQuality returns the best quality a video was offered in when its
+// config was last fetched
+func (p *sizeProber) bestQuality(vimeoId string) (string, bool) {
+	p.load()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	best, ok := p.qualities[vimeoId]
+	return best, ok
+}
+
+// qualityNote tells, for the episode list, when a video is known not to be
+// offered in the requested quality
+func (d *Downloader) qualityNote(vimeoId string) string {
+	best, ok := d.sizes.bestQuality(vimeoId)
+	if !ok || best == "" {
+		return ""
+	}
+	for _, v := range d.variants("") {
+		if v.Quality != "" && qualityHeight(best) < qualityHeight(v.Quality) {
+			return fmt.Sprintf(", only %s available", best)
+		}
+	}
+	return ""
+}
+
+// probe fetches the sizes of many videos at once, bounded by the episode
+// concurrency, and saves them. Failures are left for sizesOf to report.
+func (p *sizeProber) probe(vimeoIds []string) {
+	if len(vimeoIds) == 0 {
+		return
+	}
+
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for w := 0; w < min(p.d.Concurrency.Episodes, len(vimeoIds)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for vimeoId := range jobs {
+				_, _, _ = p.sizesOf(vimeoId)
+			}
+		}()
+	}
+	for _, vimeoId := range vimeoIds {
+		jobs <- vimeoId
+	}
+	close(jobs)
+	wg.Wait()
+
+	p.save()
+}
+
+// save stores the probed sizes and qualities, dropping the expired ones
+func (p *sizeProber) save() {
+	p.load()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, size := range p.sizes {
+		if time.Since(size.CheckedAt) > sizeMaxAge {
+			delete(p.sizes, key)
+		}
+	}
+	if err := p.d.Cache.Set(sizeCacheKey, p.sizes); err != nil {
+		fmt.Printf("Warning: Failed to cache video sizes: %v\n", err)
+	}
+	if err := p.d.Cache.Set(qualityCacheKey, p.qualities); err != nil {
+		fmt.Printf("Warning: Failed to cache video qualities: %v\n", err)
+	}
+}
+
+// qualityHeight returns the height of a quality like "720p", or 0 when it is
+// empty or malformed
+func qualityHeight(quality string) int {
+	height := 0
+	if _, err := fmt.Sscanf(quality, "%dp", &height); err != nil {
+		return 0
+	}
+	return height
+}
@@ -0,0 +1,105 @@
+package downloader
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/fsutil"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// seriesReadmeFile describes a series inside its folder
+const seriesReadmeFile = "README.md"
+
+var htmlTagRe = regexp.MustCompile(`<[^>]*>`)
+
+// writeSeriesReadme writes README.md into the series folder with the
+// description, instructor, original URL and the episode listing, so the
+// archive still makes sense when browsed years later. Failures only warn.
+func (d *Downloader) writeSeriesReadme(outputDir string, seriesData *SeriesMetadata) {
+	content := d.seriesReadme(seriesData)
+
+	path := filepath.Join(outputDir, seriesReadmeFile)
+	if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, content) {
+		return
+	}
+	if err := fsutil.WriteFile(path, content); err != nil {
+		fmt.Printf("Warning: Failed to write %s: %v\n", seriesReadmeFile, err)
+	}
+}
+
+func (d *Downloader) seriesReadme(seriesData *SeriesMetadata) []byte {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "# %s\n\n", seriesData.Title)
+	if description := plainText(seriesData.Description); description != "" {
+		fmt.Fprintf(&b, "%s\n\n", description)
+	}
+
+	var episodes, seconds int
+	for _, chapter := range seriesData.Chapters {
+		for _, episode := range chapter.Episodes {
+			episodes++
+			seconds += episode.Length
+		}
+	}
+
+	if seriesData.Instructor != "" {
+		fmt.Fprintf(&b, "- Instructor: %s\n", seriesData.Instructor)
+	}
+	if seriesData.URL != "" {
+		fmt.Fprintf(&b, "- Source: %s\n", seriesData.URL)
+	}
+	fmt.Fprintf(&b, "- Episodes: %d", episodes)
+	if seconds > 0 {
+		fmt.Fprintf(&b, " (%s)", formatLength(seconds))
+	}
+	b.WriteString("\n")
+
+	for i, chapter := range seriesData.Chapters {
+		if len(chapter.Episodes) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&b, "\n## %d. %s\n\n", i+1, chapter.Title)
+		b.WriteString("| # | Episode | Duration | File |\n")
+		b.WriteString("|---|---------|----------|------|\n")
+		for _, episode := range chapter.Episodes {
+			length := "-"
+			if episode.Length > 0 {
+				length = formatLength(episode.Length)
+			}
+			title := episode.Title
+			if episode.Instructor != "" && episode.Instructor != seriesData.Instructor {
+				title += " (with " + episode.Instructor + ")"
+			}
+			file := filepath.Base(d.variants(episodeFilename(episode))[0].Path)
+			fmt.Fprintf(&b, "| %d | %s | %s | [%s](%s) |\n",
+				episode.Number, markdownCell(title), length, file, file)
+		}
+	}
+
+	return b.Bytes()
+}
+
+// formatLength formats seconds as m:ss, or h:mm:ss for an hour or more
+func formatLength(seconds int) string {
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds%3600/60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+// plainText strips the HTML markup Laracasts uses in descriptions
+func plainText(s string) string {
+	s = htmlTagRe.ReplaceAllString(s, "")
+	return strings.TrimSpace(html.UnescapeString(s))
+}
+
+// markdownCell escapes text for a Markdown table cell
+func markdownCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
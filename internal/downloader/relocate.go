@@ -0,0 +1,140 @@
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/fsutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// seriesLocationsFile maps series slugs to their directory in the topics layout
+const seriesLocationsFile = "series_locations.json"
+
+// Relocate rewrites the directories recorded in the catalog and download
+// states after the library was moved from oldPath to newPath, so completion
+// detection and the origin index keep working without a re-scan. It returns
+// the number of records updated.
+func (d *Downloader) Relocate(oldPath, newPath string) (int, error) {
+	oldAbs, err := filepath.Abs(oldPath)
+	if err != nil {
+		return 0, err
+	}
+	newAbs, err := filepath.Abs(newPath)
+	if err != nil {
+		return 0, err
+	}
+	if info, err := os.Stat(newAbs); err != nil || !info.IsDir() {
+		return 0, fmt.Errorf("%s is not a directory", newAbs)
+	}
+
+	rewrite := func(path *string) bool {
+		relocated, ok := relocatePath(*path, oldAbs, newAbs)
+		if ok {
+			*path = relocated
+		}
+		return ok
+	}
+
+	updated := 0
+
+	for _, key := range d.Cache.Keys("download_state_") {
+		var state DownloadState
+		if found, err := d.Cache.Get(key, &state); err != nil || !found {
+			continue
+		}
+		if !rewrite(&state.Dir) {
+			continue
+		}
+		// Set directly so LastSync keeps the time of the last download
+		if err := d.Cache.Set(key, &state); err != nil {
+			return updated, fmt.Errorf("failed to save %s: %v", key, err)
+		}
+		updated++
+	}
+
+	if state, err := d.loadBitsDownloadState(); err == nil && rewrite(&state.Dir) {
+		if err := d.Cache.Set("bits_download_state", state); err != nil {
+			return updated, fmt.Errorf("failed to save bits download state: %v", err)
+		}
+		updated++
+	}
+
+	catalog, found, err := d.LoadCatalog()
+	if err != nil {
+		fmt.Printf("Warning: Failed to load catalog: %v\n", err)
+	}
+	if found {
+		changed := rewrite(&catalog.Root)
+		for slug, dir := range catalog.Locations {
+			if rewrite(&dir) {
+				catalog.Locations[slug] = dir
+				changed = true
+			}
+		}
+		if changed {
+			if err := d.Cache.Set(catalogCacheKey, catalog); err != nil {
+				return updated, fmt.Errorf("failed to save catalog: %v", err)
+			}
+			updated++
+		}
+	}
+
+	if err := relocateSeriesLocations(filepath.Join(newAbs, "topics", seriesLocationsFile), oldAbs, newAbs); err != nil {
+		fmt.Printf("Warning: Failed to update %s: %v\n", seriesLocationsFile, err)
+	}
+
+	return updated, nil
+}
+
+// relocateSeriesLocations rewrites the paths in series_locations.json, which
+// are relative to the working directory the download ran in
+func relocateSeriesLocations(file, oldAbs, newAbs string) error {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var locations map[string]string
+	if err := json.Unmarshal(data, &locations); err != nil {
+		return err
+	}
+
+	changed := false
+	for slug, dir := range locations {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			continue
+		}
+		if relocated, ok := relocatePath(abs, oldAbs, newAbs); ok {
+			locations[slug] = relocated
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	data, err = json.MarshalIndent(locations, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFile(file, data)
+}
+
+// relocatePath moves path from under oldRoot to the same place under newRoot,
+// reporting false when path is not inside oldRoot
+func relocatePath(path, oldRoot, newRoot string) (string, bool) {
+	if path == "" {
+		return "", false
+	}
+	rel, err := filepath.Rel(oldRoot, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.Join(newRoot, rel), true
+}
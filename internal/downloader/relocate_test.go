@@ -0,0 +1,49 @@
+package downloader_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRelocateMovedLibrary(t *testing.T) {
+	newMockLaracasts(t)
+	oldPath := filepath.Join(t.TempDir(), "old")
+	dl := signedInDownloader(t, oldPath)
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+
+	newPath := filepath.Join(t.TempDir(), "new")
+	if err := os.Rename(oldPath, newPath); err != nil {
+		t.Fatalf("Rename() error = %v", err)
+	}
+
+	moved := newTestDownloader(t, newPath)
+	updated, err := moved.Relocate(oldPath, newPath)
+	if err != nil {
+		t.Fatalf("Relocate() error = %v", err)
+	}
+	if updated == 0 {
+		t.Error("Relocate() updated no records")
+	}
+
+	// The origin index finds videos through the recorded series directory
+	origin := httptest.NewServer(moved.OriginHandler())
+	defer origin.Close()
+
+	resp, err := http.Get(origin.URL + "/videos/1001?quality=1080p")
+	if err != nil {
+		t.Fatalf("GET video error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET relocated video status = %d, want 200", resp.StatusCode)
+	}
+
+	if again, err := moved.Relocate(oldPath, newPath); err != nil || again != 0 {
+		t.Errorf("second Relocate() = %d, %v, want nothing left to update", again, err)
+	}
+}
@@ -0,0 +1,122 @@
+package downloader
+
+import (
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/fsutil"
+	"github.com/sajjadanwar0/laracasts-dl/internal/naming"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// renameSeriesDir moves the folder of a series renamed on Laracasts to the
+// name its new title gives it, so the download continues there instead of
+// starting over in a new folder. The series is recognised by its slug in the
+// previous catalog; only a folder that kept its topic is renamed, as a series
+// listed under several topics may be claimed by another one from run to run.
+// Without a previous folder, one older versions named the topic and series
+// by, see naming.Legacy, is renamed instead. Links to the old folder and the
+// piece manifest are updated too.
+//
+// The folder is only renamed while holding the series lock; it returns false
+// when another instance holds it and the folder was left where it is.
+func (d *Downloader) renameSeriesDir(previous *Catalog, series TopicSeries, seriesDir string) bool {
+	if previous == nil {
+		previous = &Catalog{}
+	}
+	newDir, err := filepath.Abs(seriesDir)
+	if err != nil {
+		return true
+	}
+
+	oldDir, reason := previous.Locations[series.Slug], "was renamed"
+	if oldDir == "" || filepath.Dir(oldDir) != filepath.Dir(newDir) || !isDir(oldDir) {
+		oldDir, reason = absDir(legacySeriesDirectory(filepath.Dir(filepath.Dir(seriesDir)), series)), "was saved under an older name"
+	}
+	if oldDir == newDir || !isDir(oldDir) || naming.Within(d.BasePath, oldDir) != nil {
+		return true
+	}
+
+	lock, err := d.lock("series_" + strings.TrimPrefix(cleanSeriesSlug(series.Slug), "series/"))
+	if err != nil {
+		fmt.Printf("Warning: Not renaming %s yet: %v\n", d.relativePath(oldDir), err)
+		return !isLocked(err)
+	}
+	defer lock.Unlock()
+
+	if _, err := os.Lstat(newDir); err == nil {
+		// Both exist, e.g. the rename raced a download; leave them alone
+		return true
+	}
+
+	if err := fsutil.MkdirAll(filepath.Dir(newDir)); err != nil {
+		fmt.Printf("Warning: Failed to rename %s: %v\n", d.relativePath(oldDir), err)
+		return true
+	}
+	if err := os.Rename(oldDir, newDir); err != nil {
+		fmt.Printf("Warning: Failed to rename %s after its title changed: %v\n", d.relativePath(oldDir), err)
+		return true
+	}
+	fmt.Printf("📁 Series '%s' %s, moved %s to %s\n", series.Title, reason, d.relativePath(oldDir), d.relativePath(newDir))
+
+	d.relinkRenamedSeries(previous, series.Slug, oldDir, newDir)
+	if err := renameManifestDir(d.BasePath, oldDir, newDir); err != nil {
+		fmt.Printf("Warning: Failed to update %s: %v\n", manifestFile, err)
+	}
+	return true
+}
+
+// legacySeriesDirectory returns the folder older versions saved a topic series
+// in under topicsDir, see naming.Legacy
+func legacySeriesDirectory(topicsDir string, series TopicSeries) string {
+	return filepath.Join(topicsDir, naming.Legacy(series.TopicName), naming.Legacy(series.Title))
+}
+
+// isDir reports whether path is a directory, not following symlinks
+func isDir(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.IsDir()
+}
+
+// relinkRenamedSeries drops the links other topics had to a renamed series,
+// which are linked again under the new name, and renames its links in the
+// authors layout and the collections
+func (d *Downloader) relinkRenamedSeries(previous *Catalog, slug, oldDir, newDir string) {
+	topicsDir := filepath.Join(d.BasePath, "topics")
+	for _, series := range previous.Topics {
+		for _, s := range series {
+			if s.Slug != slug {
+				continue
+			}
+			link := seriesDirectory(topicsDir, s)
+			if filepath.Base(link) == filepath.Base(newDir) {
+				continue
+			}
+			if info, err := os.Lstat(link); err == nil && info.Mode()&os.ModeSymlink != 0 {
+				_ = os.Remove(link)
+			}
+		}
+	}
+
+	links, _ := filepath.Glob(filepath.Join(d.BasePath, AuthorsDir, "*", filepath.Base(oldDir)))
+	collectionLinks, _ := filepath.Glob(filepath.Join(d.BasePath, CollectionsDir, "*", filepath.Base(oldDir)))
+	links = append(links, collectionLinks...)
+	for _, link := range links {
+		target, err := os.Readlink(link)
+		if err != nil {
+			continue
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(link), target)
+		}
+		if !sameDir(target, oldDir) {
+			continue
+		}
+		if err := os.Remove(link); err != nil {
+			continue
+		}
+		if err := linkView(filepath.Join(filepath.Dir(link), filepath.Base(newDir)), newDir); err != nil {
+			fmt.Printf("Warning: Failed to link %s: %v\n", d.relativePath(newDir), err)
+		}
+	}
+}
@@ -0,0 +1,539 @@
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/cache"
+	"github.com/sajjadanwar0/laracasts-dl/internal/fsutil"
+	"github.com/sajjadanwar0/laracasts-dl/internal/vimeo"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// reportFile is the JSON copy of the run summary, in the download directory
+const reportFile = "report.json"
+
+// Failure records why a single video could not be downloaded
+type Failure struct {
+	Source   string `json:"source"` // series title or "bits"
+	Title    string `json:"title"`
+	VimeoId  string `json:"vimeo_id"`
+	Reason   string `json:"reason"`
+	Category string `json:"category"` // see FailureCategory
+	Skipped  bool   `json:"skipped"`  // permanently unavailable, not retried
+
+	// NeedsFFmpeg is set for videos only available as streams, skipped as
+	// ffmpeg is not installed
+	NeedsFFmpeg bool `json:"needs_ffmpeg,omitempty"`
+}
+
+// Mismatch is a video on disk whose size differs from the remote file, so it
+// may be outdated or corrupt
+type Mismatch struct {
+	Title        string `json:"title"`
+	Path         string `json:"path"`
+	LocalSize    int64  `json:"local_size"`
+	RemoteSize   int64  `json:"remote_size"`
+	Redownloaded bool   `json:"redownloaded"`
+}
+
+// Downgrade is a video downloaded in another quality than requested, because
+// Vimeo does not offer the requested one
+type Downgrade struct {
+	Path      string `json:"path"`
+	VimeoId   string `json:"vimeo_id"`
+	Requested string `json:"requested"`
+	Quality   string `json:"quality"`
+}
+
+// Unparsed is a series whose page yielded no episodes, likely because
+// Laracasts changed the layout of its page data
+type Unparsed struct {
+	Slug   string `json:"slug"`
+	Reason string `json:"reason"`
+}
+
+// SeriesResult is the outcome of syncing one series
+type SeriesResult struct {
+	Title      string        `json:"title"`
+	Slug       string        `json:"slug"`
+	Total      int           `json:"total"`
+	Filtered   int           `json:"filtered"`
+	Existing   int           `json:"existing"` // downloaded by an earlier run
+	Downloaded int           `json:"downloaded"`
+	Skipped    int           `json:"skipped"`
+	Paused     int           `json:"paused,omitempty"` // of Skipped, left for next month
+	Failed     int           `json:"failed"`
+	Bytes      int64         `json:"bytes"`
+	Duration   time.Duration `json:"duration_ns"`
+
+	// Workers and Chunks are the episode workers and chunk requests per
+	// video the series was finished with, when failures slowed it down
+	Workers int `json:"workers,omitempty"`
+	Chunks  int `json:"chunks,omitempty"`
+}
+
+// status returns the icon summarising the series outcome
+func (r SeriesResult) status() string {
+	switch {
+	case r.Failed > 0:
+		return "❌"
+	case r.Skipped > 0:
+		return "⚠️"
+	case r.Downloaded > 0:
+		return "✅"
+	}
+	return "✓"
+}
+
+func (r *SeriesResult) add(other SeriesResult) {
+	r.Total += other.Total
+	r.Filtered += other.Filtered
+	r.Existing += other.Existing
+	r.Downloaded += other.Downloaded
+	r.Skipped += other.Skipped
+	r.Paused += other.Paused
+	r.Failed += other.Failed
+	r.Bytes += other.Bytes
+	r.Duration += other.Duration
+}
+
+// DedupStats counts bits that were not stored again because they are also
+// series episodes already on disk
+type DedupStats struct {
+	Videos     int   `json:"videos"`
+	BytesSaved int64 `json:"bytes_saved"`
+}
+
+// Report collects the outcome of a run across all series and bits
+type Report struct {
+	mu           sync.Mutex
+	Series       []SeriesResult
+	Failures     []Failure
+	Mismatches   []Mismatch
+	Downgrades   []Downgrade
+	Unparsed     []Unparsed
+	Paused       int      // videos left for next month by MAX_MONTHLY_GB
+	SignedOut    int      // times Laracasts signed the session out
+	UpToDate     int      // series found complete without fetching them
+	Bits         int      // bits downloaded
+	BitsExisting int      // bits downloaded by an earlier run
+	Ignored      []string // slugs of series left out by IGNORED_SERIES or an ignore marker
+	Archived     []string // slugs of archived series left out of bulk downloads
+	Collections  []CollectionResult
+	Dedup        DedupStats
+	Transfer     *vimeo.TransferStats
+	Cache        *cache.Stats
+
+	// Verbose adds the cache statistics to the printed report
+	Verbose bool
+}
+
+func (r *Report) AddFailure(f Failure) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Failures = append(r.Failures, f)
+}
+
+func (r *Report) AddMismatch(m Mismatch) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Mismatches = append(r.Mismatches, m)
+}
+
+func (r *Report) AddDowngrade(d Downgrade) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Downgrades = append(r.Downgrades, d)
+}
+
+// AddUnparsed records a series whose page could not be parsed
+func (r *Report) AddUnparsed(u Unparsed) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Unparsed = append(r.Unparsed, u)
+}
+
+// AddPaused records a video left undownloaded by the monthly cap
+func (r *Report) AddPaused() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Paused++
+}
+
+// AddSignedOut records Laracasts signing the session out
+func (r *Report) AddSignedOut() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.SignedOut++
+}
+
+// AddBit records a downloaded bit
+func (r *Report) AddBit() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Bits++
+}
+
+// AddExistingBits records n bits downloaded by an earlier run
+func (r *Report) AddExistingBits(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.BitsExisting += n
+}
+
+// AddDuplicate records a bit deduplicated against a series episode of size bytes
+func (r *Report) AddDuplicate(size int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Dedup.Videos++
+	r.Dedup.BytesSaved += size
+}
+
+func (r *Report) AddSeries(result SeriesResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Series = append(r.Series, result)
+}
+
+// AddUpToDate records a series found complete without fetching it
+func (r *Report) AddUpToDate(result SeriesResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Series = append(r.Series, result)
+	r.UpToDate++
+}
+
+// AddIgnored records a series left out as ignored, reporting whether it was
+// not recorded before, as series listed under several topics are
+func (r *Report) AddIgnored(slug string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if slices.Contains(r.Ignored, slug) {
+		return false
+	}
+	r.Ignored = append(r.Ignored, slug)
+	return true
+}
+
+// AddArchived records an archived series left out, reporting whether it was
+// not recorded before
+func (r *Report) AddArchived(slug string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if slices.Contains(r.Archived, slug) {
+		return false
+	}
+	r.Archived = append(r.Archived, slug)
+	return true
+}
+
+// AddCollection records the outcome of downloading a collection
+func (r *Report) AddCollection(result CollectionResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Collections = append(r.Collections, result)
+}
+
+// seriesComplete reports whether the series with slug was synced by this run
+// without failed or skipped episodes
+func (r *Report) seriesComplete(slug string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.Series {
+		if s.Slug == slug && s.Failed == 0 && s.Skipped == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// seriesPaused reports whether the monthly cap left videos of the series
+// with slug for a later run
+func (r *Report) seriesPaused(slug string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.Series {
+		if s.Slug == slug && s.Paused > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Outcomes of a download run, see Outcome
+const (
+	OutcomeSucceeded = "succeeded" // every selected video is on disk
+	OutcomePartial   = "partial"   // some videos failed or were paused, others were downloaded or on disk
+	OutcomeFailed    = "failed"    // nothing could be downloaded
+)
+
+// Outcome classifies the run, given the error the download returned.
+// Unavailable videos that were skipped do not count as failed, videos left
+// for next month by the monthly cap keep the run from succeeding.
+func (r *Report) Outcome(err error) string {
+	failed := r.FailedVideos()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil && failed == 0 && len(r.Unparsed) == 0 && r.Paused == 0 {
+		return OutcomeSucceeded
+	}
+	total := r.totals()
+	if total.Downloaded+total.Existing+r.Bits+r.BitsExisting+r.UpToDate == 0 {
+		return OutcomeFailed
+	}
+	return OutcomePartial
+}
+
+// FailedVideos counts the videos that failed to download, leaving out the
+// unavailable ones that were skipped
+func (r *Report) FailedVideos() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	failed := 0
+	for _, f := range r.Failures {
+		if !f.Skipped {
+			failed++
+		}
+	}
+	return failed
+}
+
+// totals sums every series row; Duration is the summed series time, which
+// exceeds the wall clock time when series ran concurrently
+func (r *Report) totals() SeriesResult {
+	total := SeriesResult{Title: "Total"}
+	for _, s := range r.Series {
+		total.add(s)
+	}
+	return total
+}
+
+// Print writes the run report: the per-series table, transfer efficiency,
+// then the failures, listing skipped videos with their reason
+func (r *Report) Print() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.printSeries()
+
+	if len(r.Unparsed) > 0 {
+		fmt.Printf("\n🚨 %d series yielded no episodes, Laracasts may have changed its pages; please report this with the output below:\n", len(r.Unparsed))
+		for _, u := range r.Unparsed {
+			fmt.Printf("- %s: %s\n", u.Slug, u.Reason)
+		}
+	}
+
+	if r.UpToDate > 0 {
+		fmt.Printf("\n⚡ %d series were up to date and not fetched\n", r.UpToDate)
+	}
+	if len(r.Ignored) > 0 {
+		fmt.Printf("\n🙈 %d series ignored: %s\n", len(r.Ignored), strings.Join(r.Ignored, ", "))
+	}
+	if len(r.Archived) > 0 {
+		fmt.Printf("\n🗄️  %d archived series skipped (-include-archived downloads them): %s\n", len(r.Archived), strings.Join(r.Archived, ", "))
+	}
+	for _, c := range r.Collections {
+		fmt.Printf("\n📚 Collection %s: %d of %d series complete", c.Name, c.Complete, c.Series)
+		if len(c.Incomplete) > 0 {
+			fmt.Printf(", missing %s", strings.Join(c.Incomplete, ", "))
+		}
+		fmt.Println()
+	}
+
+	if r.Transfer != nil {
+		r.Transfer.Print()
+	}
+
+	if r.Verbose && r.Cache != nil {
+		stats := r.Cache.Snapshot()
+		fmt.Printf("\n🗄️  Metadata cache: %s, saved %s of page data\n", stats, formatBytes(stats.BytesSaved))
+	}
+
+	if r.Dedup.Videos > 0 {
+		fmt.Printf("\n🔗 %d bits are also series episodes, saved %s\n", r.Dedup.Videos, formatBytes(r.Dedup.BytesSaved))
+	}
+
+	r.printMismatches()
+
+	if len(r.Downgrades) > 0 {
+		fmt.Printf("\n📉 %d videos are not offered in the requested quality:\n", len(r.Downgrades))
+		for _, d := range r.Downgrades {
+			fmt.Printf("- %s: %s instead of %s\n", d.Path, d.Quality, d.Requested)
+		}
+	}
+
+	if r.Paused > 0 {
+		fmt.Printf("\n⏸️  The monthly download cap (MAX_MONTHLY_GB) is reached, %d videos are left for next month\n", r.Paused)
+	}
+
+	if r.SignedOut > 0 {
+		fmt.Printf("\n🔒 Laracasts signed the session out %d times, likely for too many parallel requests; consider lower SERIES_CONCURRENCY and EPISODE_CONCURRENCY\n", r.SignedOut)
+	}
+
+	for _, s := range r.Series {
+		if s.Workers > 0 {
+			fmt.Printf("\n🐢 %s failed often and was finished with %d episode workers and %d chunk requests per video; consider lower EPISODE_CONCURRENCY and CHUNK_CONCURRENCY\n",
+				s.Title, s.Workers, s.Chunks)
+		}
+	}
+
+	if len(r.Failures) == 0 {
+		return
+	}
+
+	var skipped, failed []Failure
+	for _, f := range r.Failures {
+		if f.Skipped {
+			skipped = append(skipped, f)
+		} else {
+			failed = append(failed, f)
+		}
+	}
+
+	if len(skipped) > 0 {
+		fmt.Printf("\n⏭️  Skipped %d unavailable videos:\n", len(skipped))
+		for _, f := range skipped {
+			fmt.Printf("- [%s] %s (vimeo %s): %s\n", f.Source, f.Title, f.VimeoId, f.Reason)
+		}
+		for _, f := range skipped {
+			if f.NeedsFFmpeg {
+				fmt.Printf("Videos that require ffmpeg are only available as streams; %s and run again\n", vimeo.FFmpegInstallHint())
+				break
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		fmt.Printf("\n❌ Failed %d videos:\n", len(failed))
+		byCategory := make(map[string][]Failure)
+		for _, f := range failed {
+			category := f.Category
+			if category == "" {
+				category = FailureOther
+			}
+			byCategory[category] = append(byCategory[category], f)
+		}
+		for _, category := range failureCategories {
+			failures := byCategory[category]
+			if len(failures) == 0 {
+				continue
+			}
+			fmt.Printf("%s (%d):\n", category, len(failures))
+			for _, f := range failures {
+				fmt.Printf("- [%s] %s (vimeo %s): %s\n", f.Source, f.Title, f.VimeoId, f.Reason)
+			}
+			if hint := failureHints[category]; hint != "" {
+				fmt.Printf("  → %s\n", hint)
+			}
+		}
+	}
+}
+
+func (r *Report) printMismatches() {
+	var kept []Mismatch
+	redownloaded := 0
+	for _, m := range r.Mismatches {
+		if m.Redownloaded {
+			redownloaded++
+		} else {
+			kept = append(kept, m)
+		}
+	}
+
+	if redownloaded > 0 {
+		fmt.Printf("\n🔁 Redownloaded %d videos whose size did not match the remote file\n", redownloaded)
+	}
+	if len(kept) > 0 {
+		fmt.Printf("\n⚠️  %d videos are possibly outdated or corrupt (rerun with -redownload-mismatched to replace them):\n", len(kept))
+		for _, m := range kept {
+			fmt.Printf("- %s: %s locally, %s remotely\n", m.Path, formatBytes(m.LocalSize), formatBytes(m.RemoteSize))
+		}
+	}
+}
+
+func (r *Report) printSeries() {
+	if len(r.Series) == 0 {
+		return
+	}
+
+	fmt.Printf("\n📋 Run Summary:\n")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\tSeries\tDownloaded\tExisting\tSkipped\tFailed\tSize\tTime\t")
+
+	row := func(icon string, s SeriesResult) {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%s\t%s\t\n",
+			icon, s.Title, s.Downloaded, s.Existing, s.Skipped, s.Failed,
+			formatBytes(s.Bytes), s.Duration.Round(time.Second))
+	}
+	for _, s := range r.Series {
+		row(s.status(), s)
+	}
+	total := r.totals()
+	row(total.status(), total)
+
+	w.Flush()
+}
+
+// Save writes the run report as JSON to report.json in basePath
+func (r *Report) Save(basePath string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, err := json.MarshalIndent(struct {
+		GeneratedAt time.Time            `json:"generated_at"`
+		Series      []SeriesResult       `json:"series"`
+		Totals      SeriesResult         `json:"totals"`
+		Failures    []Failure            `json:"failures"`
+		Mismatches  []Mismatch           `json:"mismatches,omitempty"`
+		Downgrades  []Downgrade          `json:"downgrades,omitempty"`
+		Unparsed    []Unparsed           `json:"unparsed,omitempty"`
+		Paused      int                  `json:"paused,omitempty"`
+		SignedOut   int                  `json:"signed_out,omitempty"`
+		UpToDate    int                  `json:"up_to_date,omitempty"`
+		Bits        int                  `json:"bits,omitempty"`
+		Ignored     []string             `json:"ignored,omitempty"`
+		Archived    []string             `json:"archived,omitempty"`
+		Collections []CollectionResult   `json:"collections,omitempty"`
+		Dedup       *DedupStats          `json:"dedup,omitempty"`
+		Transfer    *vimeo.TransferStats `json:"transfer,omitempty"`
+		Cache       *cache.StatsSnapshot `json:"cache,omitempty"`
+	}{time.Now(), r.Series, r.totals(), r.Failures, r.Mismatches, r.Downgrades, r.Unparsed, r.Paused, r.SignedOut, r.UpToDate, r.Bits, r.Ignored, r.Archived, r.Collections, r.dedup(), r.Transfer, r.cacheSnapshot()}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal report: %v", err)
+	}
+	return fsutil.WriteFile(filepath.Join(basePath, reportFile), data)
+}
+
+func (r *Report) dedup() *DedupStats {
+	if r.Dedup.Videos == 0 {
+		return nil
+	}
+	return &r.Dedup
+}
+
+func (r *Report) cacheSnapshot() *cache.StatsSnapshot {
+	if r.Cache == nil {
+		return nil
+	}
+	stats := r.Cache.Snapshot()
+	return &stats
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1024*1024*1024:
+		return fmt.Sprintf("%.1f GB", float64(n)/1024/1024/1024)
+	case n >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(n)/1024/1024)
+	case n >= 1024:
+		return fmt.Sprintf("%.1f KB", float64(n)/1024)
+	}
+	return fmt.Sprintf("%d B", n)
+}
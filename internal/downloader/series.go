@@ -1,10 +1,13 @@
 package downloader
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/sajjadanwar0/laracasts-dl/internal/config"
+	"github.com/sajjadanwar0/laracasts-dl/internal/fsutil"
+	"github.com/sajjadanwar0/laracasts-dl/internal/naming"
+	"github.com/sajjadanwar0/laracasts-dl/internal/vimeo"
 	"html"
 	"io"
 	"net/http"
@@ -12,14 +15,21 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// ErrNoEpisodes is returned for a series page that yields no chapters or
+// episodes, which means its page data is laid out differently than expected
+var ErrNoEpisodes = errors.New("no episodes found in series page data")
+
 type DownloadState struct {
 	Completed map[string]bool `json:"completed"`
+	Deleted   map[string]bool `json:"deleted,omitempty"` // completed but removed locally on purpose
+	Dir       string          `json:"dir,omitempty"`     // absolute directory the series is saved in
 	LastSync  time.Time       `json:"last_sync"`
 }
 
@@ -30,96 +40,44 @@ type TopicSeries struct {
 	Path      string `json:"path"`
 	TopicPath string `json:"topic_path"`
 	TopicName string `json:"topic_name"`
-}
 
-func (d *Downloader) getTopicSeries(topicURL string, topicName string) ([]TopicSeries, error) {
-	fmt.Printf("Fetching series from: %s\n", topicURL)
+	// EpisodeCount as listed on the topic page, used to tell whether the
+	// cached series metadata is out of date without fetching the series
+	EpisodeCount int `json:"episode_count,omitempty"`
 
-	req, err := http.NewRequest("GET", topicURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %v", err)
-	}
+	// Tags are the topics the series is listed under and Difficulty its
+	// level, both empty when the topic page does not include them
+	Tags       []string `json:"tags,omitempty"`
+	Difficulty string   `json:"difficulty,omitempty"`
 
-	for k, v := range config.DefaultHeaders {
-		req.Header.Set(k, v)
-	}
+	// Archived is set for series Laracasts retired as outdated, which bulk
+	// downloads leave out unless IncludeArchived is set
+	Archived bool `json:"archived,omitempty"`
 
-	resp, err := d.Client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed request: %v", err)
-	}
-	defer resp.Body.Close()
+	// Unreleased is set for series listed without any episode yet, e.g.
+	// announced ones, which bulk downloads leave out
+	Unreleased bool `json:"unreleased,omitempty"`
+}
 
-	if resp.StatusCode == http.StatusNotFound {
-		return nil, fmt.Errorf("topic page not found (404)")
-	}
+func (d *Downloader) getTopicSeries(topicURL string, topicName string) ([]TopicSeries, error) {
+	fmt.Printf("Fetching series from: %s\n", topicURL)
 
-	body, err := io.ReadAll(resp.Body)
+	jsonData, err := d.fetchPageData(topicURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %v", err)
-	}
-
-	// Parse page data
-	var pageData struct {
-		Props struct {
-			Topic struct {
-				Name   string `json:"name"`
-				Path   string `json:"path"`
-				Series []struct {
-					ID           int    `json:"id"`
-					Title        string `json:"title"`
-					Path         string `json:"path"`
-					Slug         string `json:"slug"`
-					EpisodeCount int    `json:"episodeCount"`
-					Topics       []struct {
-						Name string `json:"name"`
-						Path string `json:"path"`
-					} `json:"topics"`
-				} `json:"series"`
-			} `json:"topic"`
-		} `json:"props"`
+		return nil, err
 	}
 
-	jsonData := extractPageJSON(body)
-	if jsonData == "" {
-		return nil, fmt.Errorf("no page data found")
-	}
-
-	if err := json.Unmarshal([]byte(jsonData), &pageData); err != nil {
-		return nil, fmt.Errorf("failed to parse page data: %v", err)
+	series, err := d.Site.ParseTopicSeries(jsonData, topicName)
+	if err != nil {
+		return nil, err
 	}
-
-	var series []TopicSeries
-	downloadedSlugs := make(map[string]bool)
-
-	// Process series that are directly listed under this topic
-	for _, s := range pageData.Props.Topic.Series {
-		if s.Title == "" || downloadedSlugs[s.Slug] {
-			continue
-		}
-
-		// Get the clean slug
-		slug := s.Slug
-		if s.Path != "" {
-			slug = strings.TrimPrefix(s.Path, "/series/")
+	for _, s := range series {
+		var archived string
+		if s.Archived {
+			archived = ", archived"
 		}
-
-		// Ensure proper series slug format
-		if !strings.HasPrefix(slug, "series/") {
-			slug = fmt.Sprintf("series/%s", slug)
-		}
-
-		series = append(series, TopicSeries{
-			Title:     s.Title,
-			Slug:      slug,
-			Path:      s.Path,
-			TopicPath: pageData.Props.Topic.Path,
-			TopicName: topicName,
-		})
-
-		downloadedSlugs[s.Slug] = true
-		fmt.Printf("Found series for topic %s: %s (slug: %s)\n",
-			topicName, s.Title, slug)
+		fmt.Printf("Found series for topic %s: %s (slug: %s%s)\n",
+			topicName, s.Title, s.Slug, archived)
 	}
 
 	if len(series) == 0 {
@@ -132,9 +90,23 @@ func (d *Downloader) getTopicSeries(topicURL string, topicName string) ([]TopicS
 }
 
 type SeriesMetadata struct {
-	Title     string    `json:"title"`
-	Chapters  []Chapter `json:"chapters"`
-	UpdatedAt time.Time `json:"updated_at"`
+	Title       string    `json:"title"`
+	Description string    `json:"description,omitempty"` // may contain HTML
+	Instructor  string    `json:"instructor,omitempty"`
+	URL         string    `json:"url,omitempty"`
+	Difficulty  string    `json:"difficulty,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+	Archived    bool      `json:"archived,omitempty"` // retired by Laracasts as outdated
+	Chapters    []Chapter `json:"chapters"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	// EpisodeCount counts every listed episode, including those without a
+	// video, so it can be compared with the topic listings
+	EpisodeCount int `json:"episode_count,omitempty"`
+
+	// PageBytes is the size of the page data the metadata was scraped from,
+	// the traffic a cache hit saves
+	PageBytes int64 `json:"page_bytes,omitempty"`
 }
 
 type Chapter struct {
@@ -145,7 +117,7 @@ type Chapter struct {
 // Helper function to get consistent folder names
 func getSeriesFolderName(series TopicSeries) string {
 	// Use the series title for folder name, properly sanitized
-	folderName := sanitizeFilename(series.Title)
+	folderName := naming.Sanitize(series.Title)
 
 	// Convert to lowercase
 	folderName = strings.ToLower(folderName)
@@ -159,253 +131,143 @@ func getSeriesFolderName(series TopicSeries) string {
 	return folderName
 }
 
-// Main function to handle series download
-func (d *Downloader) handleSeriesDownload(topicsDir string, series TopicSeries, downloadedSeries map[string]string) error {
-	// Get consistent folder name for the topic and series
-	topicFolderName := sanitizeFilename(series.TopicName)
-	seriesFolderName := getSeriesFolderName(series)
-
-	// Create full path using consistent naming
-	// This now creates: topics/topic-name/series-name
-	seriesDir := filepath.Join(topicsDir, topicFolderName, seriesFolderName)
-
-	// Check if this series has already been downloaded to another topic
-	if existingPath, exists := downloadedSeries[series.Slug]; exists {
-		fmt.Printf("Series '%s' already exists at '%s', creating symlink...\n",
-			series.Title, existingPath)
-
-		// Create parent directory if it doesn't exist
-		if err := os.MkdirAll(filepath.Dir(seriesDir), 0755); err != nil {
-			return fmt.Errorf("failed to create directory: %v", err)
-		}
-
-		// Create relative symlink
-		relPath, err := filepath.Rel(filepath.Dir(seriesDir), existingPath)
-		if err != nil {
-			return fmt.Errorf("failed to create relative path: %v", err)
-		}
+// seriesSet tracks which series have already been claimed by a topic so that
+// a series listed under several topics is only downloaded once.
+type seriesSet struct {
+	mu    sync.Mutex
+	paths map[string]string // maps series slug to its directory
+}
 
-		// Remove existing symlink or folder if it exists
-		if _, err := os.Lstat(seriesDir); err == nil {
-			os.RemoveAll(seriesDir)
-		}
+func newSeriesSet() *seriesSet {
+	return &seriesSet{paths: make(map[string]string)}
+}
 
-		if err := os.Symlink(relPath, seriesDir); err != nil {
-			return fmt.Errorf("failed to create symlink: %v", err)
-		}
+// claim records dir as the location of the series. It returns the existing
+// location and false if the series was already claimed by another topic.
+func (s *seriesSet) claim(slug, dir string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-		return nil
+	if existing, ok := s.paths[slug]; ok {
+		return existing, false
 	}
+	s.paths[slug] = dir
+	return dir, true
+}
 
-	// This is the first time we're downloading this series
-	if err := os.MkdirAll(seriesDir, 0755); err != nil {
-		return fmt.Errorf("failed to create series directory: %v", err)
-	}
+// relocate records dir as the location of a series already claimed
+func (s *seriesSet) relocate(slug, dir string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paths[slug] = dir
+}
 
-	// Set BasePath to the series directory
-	d.BasePath = seriesDir
+func (s *seriesSet) snapshot() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	// Download series content directly to the folder
-	if err := d.downloadSeriesContent(series.Slug); err != nil {
-		return fmt.Errorf("failed to download series: %v", err)
+	paths := make(map[string]string, len(s.paths))
+	for slug, dir := range s.paths {
+		paths[slug] = dir
 	}
-
-	// Record this series as downloaded
-	downloadedSeries[series.Slug] = seriesDir
-
-	return nil
+	return paths
 }
 
-// Function to download series content without creating extra directories
-func (d *Downloader) downloadSeriesContent(seriesSlug string) error {
-	// Get series metadata
-	var seriesData SeriesMetadata
-	cacheKey := fmt.Sprintf("series_%s", strings.TrimPrefix(seriesSlug, "series/"))
+// seriesDirectory returns topics/topic-name/series-name for a topic series
+func seriesDirectory(topicsDir string, series TopicSeries) string {
+	topicFolderName := naming.Sanitize(series.TopicName)
+	seriesFolderName := getSeriesFolderName(series)
+	return filepath.Join(topicsDir, topicFolderName, seriesFolderName)
+}
 
-	found, err := d.Cache.Get(cacheKey, &seriesData)
-	if err != nil {
-		fmt.Printf("Cache error: %v, fetching fresh data\n", err)
-		found = false
+// linkSeries points seriesDir at a series already downloaded to another topic
+func (d *Downloader) linkSeries(seriesDir, existingPath string) error {
+	if err := naming.Within(d.BasePath, seriesDir); err != nil {
+		return err
 	}
 
-	if !found || d.Cache.IsStale(cacheKey, 3600*24*7) {
-		// Fetch and parse series data
-		seriesURL := fmt.Sprintf("%s/%s", config.LaracastsBaseUrl, seriesSlug)
-		jsonData, err := d.fetchSeriesData(seriesURL)
-		if err != nil {
-			return fmt.Errorf("failed to fetch series data: %v", err)
-		}
-
-		var rawData struct {
-			Props struct {
-				Series struct {
-					Title    string `json:"title"`
-					Chapters []struct {
-						Title    string `json:"title"`
-						Episodes []struct {
-							Title    string `json:"title"`
-							VimeoId  string `json:"vimeoId"`
-							Position int    `json:"position"`
-						} `json:"episodes"`
-					} `json:"chapters"`
-				} `json:"series"`
-			} `json:"props"`
-		}
-
-		if err := json.Unmarshal([]byte(jsonData), &rawData); err != nil {
-			return fmt.Errorf("failed to parse series data: %v", err)
-		}
-
-		// Convert to metadata structure
-		seriesData = SeriesMetadata{
-			Title:     rawData.Props.Series.Title,
-			UpdatedAt: time.Now(),
-		}
-
-		for _, chapter := range rawData.Props.Series.Chapters {
-			var episodes []Episode
-			for _, ep := range chapter.Episodes {
-				if ep.VimeoId != "" {
-					episodes = append(episodes, Episode{
-						Title:   ep.Title,
-						VimeoId: ep.VimeoId,
-						Number:  ep.Position,
-					})
-				}
-			}
-
-			seriesData.Chapters = append(seriesData.Chapters, Chapter{
-				Title:    chapter.Title,
-				Episodes: episodes,
-			})
-		}
-
-		// Cache the series metadata
-		if err := d.Cache.Set(cacheKey, seriesData); err != nil {
-			fmt.Printf("Warning: Failed to cache series metadata: %v\n", err)
-		}
+	// Create parent directory if it doesn't exist
+	if err := fsutil.MkdirAll(filepath.Dir(seriesDir)); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
 	}
 
-	// Create worker pool for episode downloads
-	jobs := make(chan struct {
-		episode   Episode
-		outputDir string
-	}, JobBufferSize)
-	results := make(chan struct {
-		episode Episode
-		err     error
-	}, ResultsBufferSize)
-
-	// Start workers
-	var wg sync.WaitGroup
-	for w := 1; w <= MaxEpisodeWorkers; w++ {
-		wg.Add(1)
-		go func(id int) {
-			defer wg.Done()
-			for job := range jobs {
-				fmt.Printf("\nWorker %d starting download: Episode %d - %s\n",
-					id, job.episode.Number, job.episode.Title)
-
-				err := d.downloadEpisode(job.outputDir, job.episode)
-				time.Sleep(time.Millisecond)
-
-				if err != nil {
-					fmt.Printf("❌ Worker %d failed episode %d: %v\n",
-						id, job.episode.Number, err)
-				} else {
-					fmt.Printf("✅ Worker %d completed episode %d: %s\n",
-						id, job.episode.Number, job.episode.Title)
-				}
-
-				results <- struct {
-					episode Episode
-					err     error
-				}{job.episode, err}
-			}
-		}(w)
-	}
-
-	// Send jobs to workers
-	totalEpisodes := 0
-	for _, chapter := range seriesData.Chapters {
-		fmt.Printf("\nChapter: %s\n", chapter.Title)
-		for _, episode := range chapter.Episodes {
-			totalEpisodes++
-			jobs <- struct {
-				episode   Episode
-				outputDir string
-			}{episode, d.BasePath}
-		}
+	// Create relative symlink
+	relPath, err := filepath.Rel(filepath.Dir(seriesDir), existingPath)
+	if err != nil {
+		return fmt.Errorf("failed to create relative path: %v", err)
 	}
-	close(jobs)
-
-	// Wait for all workers
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
 
-	// Process results
-	var failures int32
-	var successCount int32
-	for result := range results {
-		if result.err != nil {
-			atomic.AddInt32(&failures, 1)
-		} else {
-			atomic.AddInt32(&successCount, 1)
+	// Replace an existing symlink, or trash a folder downloaded there before
+	if info, err := os.Lstat(seriesDir); err == nil {
+		if info.Mode()&os.ModeSymlink != 0 {
+			os.Remove(seriesDir)
+		} else if err := d.trash(seriesDir); err != nil {
+			return fmt.Errorf("failed to move %s to the trash: %v", seriesDir, err)
 		}
-
-		completed := atomic.LoadInt32(&successCount) + atomic.LoadInt32(&failures)
-		fmt.Printf("\rProgress: %.1f%% (%d/%d) ✅ Success: %d ❌ Failed: %d",
-			float64(completed)/float64(totalEpisodes)*100,
-			completed, totalEpisodes,
-			atomic.LoadInt32(&successCount),
-			atomic.LoadInt32(&failures))
 	}
 
-	fmt.Println() // New line after progress bar
-
-	if failures > 0 {
-		return fmt.Errorf("%d episodes failed to download", failures)
+	if err := fsutil.Symlink(relPath, seriesDir); err != nil {
+		return fmt.Errorf("failed to create symlink: %v", err)
 	}
 
 	return nil
 }
 
-// Update the sanitizeFilename function to be more consistent
-func sanitizeFilename(filename string) string {
-	// Convert to lowercase
-	filename = strings.ToLower(filename)
-
-	// Replace spaces and invalid characters with dashes
-	invalids := []string{"/", "\\", ":", "*", "?", "\"", "<", ">", "|", " "}
-	result := filename
-
-	for _, char := range invalids {
-		result = strings.ReplaceAll(result, char, "-")
+// metadataOutdated reports whether the series metadata cached under cacheKey
+// is to be fetched again. A known episodeCount from a listing decides that:
+// a different count means episodes changed, while a matching one is trusted
+// until SeriesListedMaxAge, as a safety net for retitled episodes. Without
+// one the cache expires after SeriesCacheMaxAge.
+func (d *Downloader) metadataOutdated(cacheKey string, cached *SeriesMetadata, episodeCount int) bool {
+	if episodeCount > 0 && cached.EpisodeCount > 0 {
+		return episodeCount != cached.EpisodeCount || d.Cache.IsStale(cacheKey, SeriesListedMaxAge)
 	}
+	return d.Cache.IsStale(cacheKey, SeriesCacheMaxAge)
+}
 
-	// Replace multiple dashes with single dash
-	result = regexp.MustCompile(`-+`).ReplaceAllString(result, "-")
-
-	// Trim dashes from start and end
-	result = strings.Trim(result, "-")
+// disambiguateFilenames gives episodes whose file names collide with an
+// earlier episode of the series a name suffixed with their Vimeo id, so one
+// download never overwrites another. Names are compared ignoring case, as
+// they collide on case-insensitive file systems. The first episode keeps its
+// plain name so files from earlier runs are still recognised.
+func disambiguateFilenames(series *SeriesMetadata) {
+	owners := make(map[string]string) // lowercased file name -> vimeo id
+
+	for c := range series.Chapters {
+		for e := range series.Chapters[c].Episodes {
+			episode := &series.Chapters[c].Episodes[e]
+			name := episodeFilename(*episode)
+			key := strings.ToLower(name)
+
+			owner, taken := owners[key]
+			if !taken || owner == episode.VimeoId {
+				owners[key] = episode.VimeoId
+				continue
+			}
 
-	return result
+			episode.Filename = fmt.Sprintf("%s-%s.mp4", strings.TrimSuffix(name, ".mp4"), episode.VimeoId)
+			owners[strings.ToLower(episode.Filename)] = episode.VimeoId
+			fmt.Printf("Warning: Episode %d: %s has the same file name as another episode, saving it as %s\n",
+				episode.Number, episode.Title, episode.Filename)
+		}
+	}
 }
 
+var (
+	pageDataScriptRe = regexp.MustCompile(`<script\s+id="page-data"\s+type="application/json"[^>]*>(.*?)</script>`)
+	pageDataAttrRe   = regexp.MustCompile(`data-page="([^"]+)"`)
+)
+
 func extractPageJSON(body []byte) string {
 	// First try finding script tag with page data
-	scriptRe := regexp.MustCompile(`<script\s+id="page-data"\s+type="application/json"[^>]*>(.*?)</script>`)
-	matches := scriptRe.FindSubmatch(body)
+	matches := pageDataScriptRe.FindSubmatch(body)
 
 	if len(matches) > 1 {
 		return html.UnescapeString(string(matches[1]))
 	}
 
 	// Try data-page attribute as fallback
-	dataPageRe := regexp.MustCompile(`data-page="([^"]+)"`)
-	matches = dataPageRe.FindSubmatch(body)
+	matches = pageDataAttrRe.FindSubmatch(body)
 	if len(matches) > 1 {
 		return html.UnescapeString(string(matches[1]))
 	}
@@ -413,129 +275,212 @@ func extractPageJSON(body []byte) string {
 	return ""
 }
 
-func (d *Downloader) DownloadAllByTopics() error {
-	printBox("Downloading all series organized by topics")
-
-	// Store original base path
-	originalBasePath := d.BasePath
-
-	// Create tracking map for downloaded series
-	downloadedSeries := make(map[string]string) // maps series slug to its directory
-	var downloadMutex sync.Mutex
+// Topic is an entry of the browse page topic listing
+type Topic struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
 
+// fetchTopics returns all topics listed on the browse page
+func (d *Downloader) fetchTopics() ([]Topic, error) {
 	// Get the browse page with retries
-	var body []byte
+	var jsonData string
 	var err error
 	maxRetries := 3
 
-	browseURL := fmt.Sprintf("%s/browse/all", config.LaracastsBaseUrl)
+	browseURL := d.Site.BaseURL() + d.Site.Paths().Browse
 	for i := 0; i < maxRetries; i++ {
-		req, err := http.NewRequest("GET", browseURL, nil)
-		if err != nil {
-			continue
-		}
-
-		for k, v := range config.DefaultHeaders {
-			req.Header.Set(k, v)
-		}
-
-		resp, err := d.Client.Do(req)
-		if err != nil {
-			time.Sleep(time.Second * time.Duration(i+1))
-			continue
-		}
-
-		body, err = io.ReadAll(resp.Body)
-		resp.Body.Close()
-		if err == nil {
+		if jsonData, err = d.fetchPageData(browseURL); err == nil {
 			break
 		}
 		time.Sleep(time.Second * time.Duration(i+1))
 	}
 
 	if err != nil {
-		return fmt.Errorf("failed to fetch browse page after %d attempts: %v", maxRetries, err)
+		return nil, fmt.Errorf("failed to fetch browse page after %d attempts: %v", maxRetries, err)
 	}
 
-	// Parse the page data
-	jsonData := extractPageJSON(body)
-	if jsonData == "" {
-		return fmt.Errorf("no page data found")
-	}
+	return d.Site.ParseTopics(jsonData)
+}
 
-	var pageDataStruct struct {
-		Props struct {
-			Topics []struct {
-				Name         string `json:"name"`
-				EpisodeCount int    `json:"episode_count"`
-				SeriesCount  int    `json:"series_count"`
-				Path         string `json:"path"`
-			} `json:"topics"`
-		} `json:"props"`
-	}
+func (d *Downloader) DownloadAllByTopics() error {
+	PrintBox("Downloading all series organized by topics")
+	started := time.Now()
+	d.listed = started
 
-	if err := json.Unmarshal([]byte(jsonData), &pageDataStruct); err != nil {
-		return fmt.Errorf("failed to parse JSON data: %v", err)
+	topics, err := d.fetchTopics()
+	if err != nil {
+		return err
 	}
 
 	// Create topics directory
-	topicsDir := filepath.Join(originalBasePath, "topics")
-	if err := os.MkdirAll(topicsDir, 0755); err != nil {
+	topicsDir := filepath.Join(d.BasePath, "topics")
+	if err := fsutil.MkdirAll(topicsDir); err != nil {
 		return fmt.Errorf("failed to create topics directory: %v", err)
 	}
 
-	// Process each topic
-	var wg sync.WaitGroup
-	sem := make(chan bool, 4) // Limit concurrent topics
+	checkpoint := d.newCheckpointer(checkpointTopics)
+
+	// Topic scrapers feed a single deduplicated queue of series which is
+	// drained by the series workers while scraping is still in progress
+	queue := make(chan TopicSeries, JobBufferSize)
+	d.activity.setQueue(func() int { return len(queue) })
+	defer d.activity.setQueue(nil)
+	claimed := newSeriesSet()
+	catalog := Catalog{Topics: make(map[string][]TopicSeries)}
+
+	// Series are queued as topics are scraped, unless they are ordered, which
+	// waits for every topic
+	ordered := d.Order != "" && d.Order != OrderAsListed
+	var pending []TopicSeries
+
+	// The previous catalog tells which folder each series was saved to, to
+	// follow series renamed since
+	previous, _, err := d.LoadCatalog()
+	if err != nil {
+		fmt.Printf("Cache error: %v, renamed series are downloaded again\n", err)
+	}
+
 	var mu sync.Mutex
 	var (
 		completedTopics int32
 		failedTopics    int32
+		completedSeries int32
+		failedSeries    int32
+		upToDateSeries  int32 // completed without being fetched
 	)
 
-	for i, topic := range pageDataStruct.Props.Topics {
-		wg.Add(1)
+	// Start series workers, one per series, each holding one of the series
+	// slots while it downloads
+	d.seriesSlots = make(chan struct{}, d.Concurrency.Series)
+	var seriesWg sync.WaitGroup
+	seriesWg.Add(1)
+	go func() {
+		defer seriesWg.Done()
+		for s := range queue {
+			d.seriesSlots <- struct{}{} // Acquire semaphore
+			seriesWg.Add(1)
+			go func(s TopicSeries) {
+				defer seriesWg.Done()
+				defer func() { <-d.seriesSlots }() // Release semaphore
+
+				if checkpoint.skip(s.Slug) {
+					mu.Lock()
+					fmt.Printf("⏭️  Skipping series '%s', completed before the checkpoint\n", s.Title)
+					mu.Unlock()
+					atomic.AddInt32(&completedSeries, 1)
+					return
+				}
+
+				seriesDir := seriesDirectory(topicsDir, s)
+				if !d.renameSeriesDir(previous, s, seriesDir) {
+					// Keep the old folder in the catalog, so the next run
+					// renames it once the other instance is done
+					claimed.relocate(s.Slug, previous.Locations[s.Slug])
+				}
+				if result, ok := d.seriesUpToDate(s, seriesDir); ok {
+					mu.Lock()
+					fmt.Printf("✓ Series '%s' is up to date\n", s.Title)
+					mu.Unlock()
+					d.Report.AddUpToDate(result)
+					atomic.AddInt32(&completedSeries, 1)
+					atomic.AddInt32(&upToDateSeries, 1)
+					checkpoint.seriesCompleted(s.Slug)
+					return
+				}
+				err := d.downloadSeriesTo(s.Slug, seriesDir, s.EpisodeCount)
+				if isLocked(err) {
+					// The other instance downloads it, this is not a failure
+					mu.Lock()
+					fmt.Printf("⏭️  Skipping series '%s': %v\n", s.Title, err)
+					mu.Unlock()
+					return
+				}
+				if err != nil {
+					mu.Lock()
+					fmt.Printf("❌ Error processing series '%s': %v\n", s.Title, err)
+					mu.Unlock()
+					d.seriesFailed(s.Slug, err)
+					atomic.AddInt32(&failedSeries, 1)
+					return
+				}
+				atomic.AddInt32(&completedSeries, 1)
+				if !d.Report.seriesPaused(checkpointSlug(s.Slug)) {
+					checkpoint.seriesCompleted(s.Slug)
+				}
+			}(s)
+		}
+	}()
+
+	// Scrape topics
+	var topicWg sync.WaitGroup
+	sem := make(chan bool, d.Concurrency.Topics)
+
+	for i, topic := range topics {
+		topicWg.Add(1)
 		sem <- true // Acquire semaphore
 
-		go func(idx int, topic struct {
-			Name         string
-			EpisodeCount int
-			SeriesCount  int
-			Path         string
-		}) {
-			defer wg.Done()
+		go func(idx int, name, path string) {
+			defer topicWg.Done()
 			defer func() { <-sem }() // Release semaphore
 
-			// Add delay between topics
-			time.Sleep(time.Second * 2)
-
 			mu.Lock()
-			fmt.Printf("\n[%d/%d] 📚 Processing topic: %s\n",
-				idx+1, len(pageDataStruct.Props.Topics), topic.Name)
+			fmt.Printf("\n[%d/%d] 📚 Processing topic: %s\n", idx+1, len(topics), name)
 			mu.Unlock()
 
-			// Get series for this topic
-			series, err := d.getTopicSeries(topic.Path, topic.Name)
-			if err != nil {
-				mu.Lock()
-				fmt.Printf("❌ Error getting series for topic '%s': %v\n", topic.Name, err)
-				mu.Unlock()
-				atomic.AddInt32(&failedTopics, 1)
-				return
+			// Get series for this topic, unless scraped before the checkpoint
+			series, scraped := checkpoint.topicSeries(name)
+			if !scraped {
+				var err error
+				if series, err = d.getTopicSeries(path, name); err != nil {
+					mu.Lock()
+					fmt.Printf("❌ Error getting series for topic '%s': %v\n", name, err)
+					catalog.failed = append(catalog.failed, name)
+					mu.Unlock()
+					atomic.AddInt32(&failedTopics, 1)
+					return
+				}
 			}
+			checkpoint.topicScraped(idx, name, series)
+
+			mu.Lock()
+			catalog.Topics[name] = series
+			mu.Unlock()
 
-			// Download each series
 			var topicFailures int32
 			for _, s := range series {
-				downloadMutex.Lock()
-				err := d.handleSeriesDownload(topicsDir, s, downloadedSeries)
-				downloadMutex.Unlock()
+				if !d.Filter.AllowsSeries(s) {
+					continue
+				}
 
-				if err != nil {
+				seriesDir := seriesDirectory(topicsDir, s)
+				if d.skipIgnored(s.Title, s.Slug, seriesDir) || d.skipArchived(s) || d.skipUnreleased(s) {
+					continue
+				}
+				existingPath, first := claimed.claim(s.Slug, seriesDir)
+				if first && ordered {
+					mu.Lock()
+					pending = append(pending, s)
+					mu.Unlock()
+					continue
+				}
+				if first {
+					queue <- s
+					continue
+				}
+				if !d.Symlinks {
+					continue // only saved under its first topic
+				}
+
+				mu.Lock()
+				fmt.Printf("Series '%s' already exists at '%s', creating symlink...\n",
+					s.Title, existingPath)
+				mu.Unlock()
+				if err := d.linkSeries(seriesDir, existingPath); err != nil {
 					mu.Lock()
 					fmt.Printf("❌ Error processing series '%s': %v\n", s.Title, err)
 					mu.Unlock()
-					atomic.AddInt32(&topicFailures, 1)
+					topicFailures++
 				}
 			}
 
@@ -546,47 +491,61 @@ func (d *Downloader) DownloadAllByTopics() error {
 			}
 
 			mu.Lock()
-			fmt.Printf("✅ Completed topic: %s\n", topic.Name)
-			fmt.Printf("\nProgress: %.1f%% (%d/%d) Topics Completed\n",
-				float64(atomic.LoadInt32(&completedTopics))/float64(len(pageDataStruct.Props.Topics))*100,
-				atomic.LoadInt32(&completedTopics),
-				len(pageDataStruct.Props.Topics))
+			fmt.Printf("✅ Queued topic: %s\n", name)
+			fmt.Printf("\nProgress: %.1f%% (%d/%d) Topics Scraped\n",
+				float64(atomic.LoadInt32(&completedTopics)+atomic.LoadInt32(&failedTopics))/float64(len(topics))*100,
+				atomic.LoadInt32(&completedTopics)+atomic.LoadInt32(&failedTopics),
+				len(topics))
 			mu.Unlock()
+		}(i, topic.Name, topic.Path)
+	}
 
-		}(i, struct {
-			Name         string
-			EpisodeCount int
-			SeriesCount  int
-			Path         string
-		}(topic))
+	topicWg.Wait()
+	d.orderSeries(pending)
+	for _, s := range pending {
+		queue <- s
 	}
+	close(queue)
+	seriesWg.Wait()
+	d.seriesSlots = nil
 
-	wg.Wait()
+	locations := claimed.snapshot()
+	catalog.Locations = make(map[string]string, len(locations))
+	for slug, dir := range locations {
+		if abs, err := filepath.Abs(dir); err == nil {
+			catalog.Locations[slug] = abs
+		}
+	}
+	if err := d.saveCatalog(&catalog); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
 
 	// Save download mapping for debugging
-	downloadMap := filepath.Join(topicsDir, "series_locations.json")
-	if mapData, err := json.MarshalIndent(downloadedSeries, "", "  "); err == nil {
-		_ = os.WriteFile(downloadMap, mapData, 0644)
+	downloadMap := filepath.Join(topicsDir, seriesLocationsFile)
+	if mapData, err := json.MarshalIndent(locations, "", "  "); err == nil {
+		_ = fsutil.WriteFile(downloadMap, mapData)
 	}
 
-	// Restore original BasePath
-	d.BasePath = originalBasePath
-
 	// Print summary
-	completed := atomic.LoadInt32(&completedTopics)
-	failed := atomic.LoadInt32(&failedTopics)
-
 	fmt.Printf("\n🎉 Download Summary:\n")
-	fmt.Printf("Total Topics Found: %d\n", len(pageDataStruct.Props.Topics))
-	fmt.Printf("Topics Completed: %d\n", completed)
-	fmt.Printf("Topics Failed: %d\n", failed)
-
-	if failed > 0 {
-		return fmt.Errorf("%d topics failed to process", failed)
-	}
-
-	return nil
+	fmt.Printf("Total Topics Found: %d\n", len(topics))
+	fmt.Printf("Topics Completed: %d\n", atomic.LoadInt32(&completedTopics))
+	fmt.Printf("Topics Failed: %d\n", atomic.LoadInt32(&failedTopics))
+	fmt.Printf("Series Completed: %d\n", atomic.LoadInt32(&completedSeries))
+	fmt.Printf("Series Failed: %d\n", atomic.LoadInt32(&failedSeries))
+
+	var result error
+	if failed := atomic.LoadInt32(&failedTopics); failed > 0 {
+		result = fmt.Errorf("%d topics failed to process", failed)
+	} else if failed := atomic.LoadInt32(&failedSeries); failed > 0 {
+		result = fmt.Errorf("%d series failed to download", failed)
+	} else if upToDate := atomic.LoadInt32(&upToDateSeries); upToDate > 0 && upToDate == atomic.LoadInt32(&completedSeries) {
+		printUpToDate(int(upToDate), started)
+	}
+	checkpoint.finish(result)
+	return result
 }
+
 func (d *Downloader) extractSeriesFromJSON(body []byte, topicName string) ([]struct {
 	Title string
 	Slug  string
@@ -664,177 +623,686 @@ func (d *Downloader) extractSeriesFromJSON(body []byte, topicName string) ([]str
 	return series, nil
 }
 
-// Helper function to clean series slugs
+// cleanSeriesSlug returns a series slug, path or URL as series/<slug>,
+// without the episode, query or fragment of a URL copied from the browser
 func cleanSeriesSlug(slug string) string {
+	slug = strings.TrimSpace(slug)
+	if i := strings.IndexAny(slug, "?#"); i >= 0 {
+		slug = slug[:i]
+	}
+	if i := strings.Index(slug, "/series/"); i >= 0 {
+		slug = slug[i+len("/series/"):]
+	}
+	slug = strings.Trim(slug, "/")
 	// Remove any number of "series/" prefixes
 	for strings.HasPrefix(slug, "series/") {
 		slug = strings.TrimPrefix(slug, "series/")
 	}
+	// and whatever follows the slug, e.g. /episodes/3
+	slug, _, _ = strings.Cut(slug, "/")
 	// Add back a single "series/" prefix
 	return fmt.Sprintf("series/%s", slug)
 }
 
-func (d *Downloader) DownloadSeries(seriesSlug string) error {
-	printBox(fmt.Sprintf("Downloading series: %s", seriesSlug))
+func (d *Downloader) DownloadSeries(seriesSlug string) error {
+	PrintBox(fmt.Sprintf("Downloading series: %s", seriesSlug))
+
+	cleanSlug := strings.TrimPrefix(cleanSeriesSlug(seriesSlug), "series/")
+	err := d.downloadSeriesTo(seriesSlug, filepath.Join(d.BasePath, cleanSlug), 0)
+	if err != nil && !isLocked(err) {
+		d.seriesFailed(seriesSlug, err)
+	}
+	return err
+}
+
+// loadSeriesMetadata returns the series metadata from cache, fetching it from
+// Laracasts when it is missing or out of date, see metadataOutdated
+func (d *Downloader) loadSeriesMetadata(seriesSlug string, episodeCount int) (*SeriesMetadata, error) {
+	// Clean up the series slug by removing any "series/" prefixes
+	cleanSlug := strings.TrimPrefix(cleanSeriesSlug(seriesSlug), "series/")
+
+	// For API requests, ensure we have the series/ prefix
+	apiSlug := fmt.Sprintf("series/%s", cleanSlug)
+
+	// Try to get series metadata from cache
+	var seriesData SeriesMetadata
+	cacheKey := fmt.Sprintf("series_%s", cleanSlug)
+
+	found, err := d.Cache.Get(cacheKey, &seriesData)
+	if err != nil {
+		fmt.Printf("Cache error: %v, fetching fresh data\n", err)
+		found = false
+	}
+
+	outdated := d.metadataOutdated(cacheKey, &seriesData, episodeCount)
+	if found && seriesData.EpisodeCount == 0 {
+		// Cached by a version that did not catch a failed parse
+		outdated = true
+	}
+	if found && d.Filter.lacksEverywhere(&seriesData) {
+		// Cached before the field the filter needs was kept
+		outdated = true
+	}
+	if d.RefreshMetadata || d.NoCache {
+		outdated = true
+	}
+
+	// Fetch fresh data if not found in cache or out of date
+	scraped := false
+	if !found || outdated {
+		if found {
+			d.Cache.Stats.Refresh()
+		} else {
+			d.Cache.Stats.Miss()
+		}
+		previous := seriesData
+
+		// The origin serves its own cached copy, not a refreshed one
+		var fresh *SeriesMetadata
+		if d.Origin != "" && !d.RefreshMetadata && !d.NoCache {
+			fresh = d.originSeriesMetadata(cleanSlug)
+		}
+		if fresh == nil || fresh.EpisodeCount == 0 {
+			if fresh, err = d.scrapeSeriesMetadata(apiSlug); err != nil {
+				return nil, err
+			}
+			scraped = true
+		}
+		seriesData = *fresh
+
+		if found {
+			d.seriesRefreshed(cleanSlug, &previous, &seriesData)
+		}
+
+		// Cache the series metadata
+		if err := d.Cache.Set(cacheKey, seriesData); err != nil {
+			fmt.Printf("Warning: Failed to cache series metadata: %v\n", err)
+		}
+	} else {
+		d.Cache.Stats.Hit(seriesData.PageBytes)
+		fmt.Println("Using cached series metadata")
+	}
+
+	for _, chapter := range seriesData.Chapters {
+		for _, episode := range chapter.Episodes {
+			d.rememberPlayerHash(episode.VimeoId, episode.VimeoHash)
+			if !scraped {
+				// A copy that may predate player hashes, see videoConfig
+				d.playerSeries.Store(episode.VimeoId, cleanSlug)
+			}
+		}
+	}
+	return &seriesData, nil
+}
+
+// scrapeSeriesMetadata fetches a series page from Laracasts and converts its
+// page data to SeriesMetadata
+func (d *Downloader) scrapeSeriesMetadata(apiSlug string) (*SeriesMetadata, error) {
+	fmt.Println("Fetching series metadata from Laracasts...")
+
+	// Use full series URL for API request
+	seriesURL := fmt.Sprintf("%s/%s", d.Site.BaseURL(), apiSlug)
+	jsonData, err := d.fetchSeriesData(seriesURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch series data: %w", err)
+	}
+
+	seriesData, err := d.Site.ParseSeries(jsonData)
+	if err != nil {
+		return nil, err
+	}
+	seriesData.URL = seriesURL
+	seriesData.PageBytes = int64(len(jsonData))
+	seriesData.UpdatedAt = time.Now()
+
+	if seriesData.EpisodeCount == 0 {
+		return nil, fmt.Errorf("%w (%s)", ErrNoEpisodes, pageDataKeys(jsonData))
+	}
+	return seriesData, nil
+}
+
+// pageDataKeys lists the props of page data and of its series, to tell what
+// changed when a series page can no longer be parsed
+func pageDataKeys(jsonData string) string {
+	var page struct {
+		Props map[string]json.RawMessage `json:"props"`
+	}
+	if err := json.Unmarshal([]byte(jsonData), &page); err != nil || len(page.Props) == 0 {
+		return "no props"
+	}
+
+	keys := func(m map[string]json.RawMessage) string {
+		names := make([]string, 0, len(m))
+		for name := range m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return strings.Join(names, ", ")
+	}
+
+	result := "props: " + keys(page.Props)
+	var series map[string]json.RawMessage
+	if json.Unmarshal(page.Props["series"], &series) == nil && len(series) > 0 {
+		result += "; series: " + keys(series)
+	}
+	return result
+}
+
+// tagList decodes tags given either as names or as objects with a name, the
+// way Laracasts lists topics
+type tagList []string
+
+func (t *tagList) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil // not a list, no tags
+	}
+
+	for _, item := range raw {
+		var name string
+		if err := json.Unmarshal(item, &name); err != nil {
+			var named struct {
+				Name string `json:"name"`
+			}
+			if json.Unmarshal(item, &named) != nil {
+				continue
+			}
+			name = named.Name
+		}
+		if name = strings.TrimSpace(name); name != "" {
+			*t = append(*t, name)
+		}
+	}
+	return nil
+}
+
+// mergeTags combines tag lists, dropping case-insensitive duplicates
+func mergeTags(lists ...[]string) []string {
+	var merged []string
+	seen := make(map[string]bool)
+	for _, list := range lists {
+		for _, tag := range list {
+			if key := strings.ToLower(tag); !seen[key] {
+				seen[key] = true
+				merged = append(merged, tag)
+			}
+		}
+	}
+	return merged
+}
+
+// parsePublishedAt parses an episode's publish date, returning the zero time
+// when it is missing or in an unexpected format
+func parsePublishedAt(value string) time.Time {
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// downloadSeriesTo downloads every episode of a series into outputDir, skipping
+// episodes already recorded as completed in the download state
+func (d *Downloader) downloadSeriesTo(seriesSlug, outputDir string, episodeCount int) error {
+	cleanSlug := strings.TrimPrefix(cleanSeriesSlug(seriesSlug), "series/")
+	started := time.Now()
+
+	// Metadata checked against the episode count of a listing is as old as
+	// the listing, however late in the run the series starts
+	listed := started
+	if episodeCount > 0 && !d.listed.IsZero() {
+		listed = d.listed
+	}
+
+	lock, err := d.lock("series_" + cleanSlug)
+	if err != nil {
+		return fmt.Errorf("series is being downloaded by another instance: %w", err)
+	}
+	defer lock.Unlock()
+
+	seriesData, err := d.loadSeriesMetadata(seriesSlug, episodeCount)
+	if errors.Is(err, ErrNoEpisodes) {
+		d.Report.AddUnparsed(Unparsed{Slug: cleanSlug, Reason: err.Error()})
+	}
+	if err != nil {
+		return err
+	}
+
+	defer d.activity.startSeries(cleanSlug, seriesData.Title)()
+
+	// Load or initialize download state
+	state, err := d.loadDownloadState(cleanSlug)
+	if err != nil {
+		state = &DownloadState{
+			Completed: make(map[string]bool),
+			LastSync:  time.Now(),
+		}
+	}
+
+	if state.Deleted == nil {
+		state.Deleted = make(map[string]bool)
+	}
+
+	// Record where the series lives so it can be found without a scan, and
+	// rewritten by Relocate when the library moves
+	stateChanged := false
+	if dir, err := filepath.Abs(outputDir); err == nil && state.Dir != dir {
+		state.Dir = dir
+		stateChanged = true
+	}
+
+	// Create series directory
+	if err := naming.Within(d.BasePath, outputDir); err != nil {
+		return err
+	}
+	if err := fsutil.MkdirAll(outputDir); err != nil {
+		return fmt.Errorf("failed to create output directory: %v", err)
+	}
+
+	disambiguateFilenames(seriesData)
+	defer d.writeSeriesReadme(outputDir, seriesData)
+	d.migrateLegacyFiles(outputDir, seriesData)
+
+	// Probe the remote sizes of completed episodes up front, in parallel,
+	// rather than one by one while listing them
+	if d.RedownloadMismatched && !d.ForceDownload {
+		var completed []string
+		for _, chapter := range seriesData.Chapters {
+			for _, episode := range chapter.Episodes {
+				if state.Completed[episode.VimeoId] && d.variantsExist(filepath.Join(outputDir, episodeFilename(episode))) {
+					completed = append(completed, episode.VimeoId)
+				}
+			}
+		}
+		d.sizes.probe(completed)
+	}
+
+	// Prepare episodes for download
+	var episodesToDownload []Episode
+	var totalEpisodes, filteredEpisodes int
+	unfiltered := make(map[string]int) // episodes kept for lacking a field the filter needs
+	now := time.Now()
+
+	fmt.Printf("\nSeries: %s\n", seriesData.Title)
+
+	for _, n := range d.Filter.Chapters {
+		if n > len(seriesData.Chapters) {
+			fmt.Printf("Warning: chapter %d does not exist, the series has %d\n", n, len(seriesData.Chapters))
+		}
+	}
+
+	for chapterIdx, chapter := range seriesData.Chapters {
+		if !d.Filter.AllowsChapter(chapterIdx + 1) {
+			totalEpisodes += len(chapter.Episodes)
+			filteredEpisodes += len(chapter.Episodes)
+			fmt.Printf("\nChapter %d: %s (not selected, %d episodes skipped)\n",
+				chapterIdx+1, chapter.Title, len(chapter.Episodes))
+			continue
+		}
+
+		fmt.Printf("\nChapter %d: %s\n", chapterIdx+1, chapter.Title)
+		for _, episode := range chapter.Episodes {
+			totalEpisodes++
+
+			if !d.Filter.Allows(episode, now) {
+				filteredEpisodes++
+				fmt.Printf("- [~] Episode %d: %s (filtered out)\n",
+					episode.Number, episode.Title)
+				continue
+			}
+			for _, field := range d.Filter.missingFields(episode) {
+				unfiltered[field]++
+			}
+
+			// Completed until the new copy replaces the old one
+			if d.ForceDownload {
+				if state.Deleted[episode.VimeoId] {
+					delete(state.Deleted, episode.VimeoId)
+					stateChanged = true
+				}
+				fmt.Printf("- [ ] Episode %d: %s (forced, re-downloading)\n",
+					episode.Number, episode.Title)
+				episodesToDownload = append(episodesToDownload, episode)
+				continue
+			}
+
+			if state.Completed[episode.VimeoId] {
+				outputPath := filepath.Join(outputDir, episodeFilename(episode))
+				if d.variantsExist(outputPath) {
+					if d.RedownloadMismatched && d.checkSizes(episode.Title, episode.VimeoId, outputPath) {
+						delete(state.Completed, episode.VimeoId)
+						stateChanged = true
+						fmt.Printf("- [ ] Episode %d: %s (size mismatch, re-downloading)\n",
+							episode.Number, episode.Title)
+						episodesToDownload = append(episodesToDownload, episode)
+						continue
+					}
+					fmt.Printf("- [✓] Episode %d: %s (already downloaded)\n",
+						episode.Number, episode.Title)
+					continue
+				}
+
+				// The file was deleted after it was downloaded
+				if d.DeletedPolicy != config.DeletedPolicyRedownload {
+					if !state.Deleted[episode.VimeoId] {
+						state.Deleted[episode.VimeoId] = true
+						stateChanged = true
+					}
+					fmt.Printf("- [-] Episode %d: %s (deleted locally, skipping)\n",
+						episode.Number, episode.Title)
+					continue
+				}
 
-	// Clean up the series slug by removing any "series/" prefixes
-	cleanSlug := strings.TrimPrefix(seriesSlug, "series/")
-	cleanSlug = strings.TrimPrefix(cleanSlug, "series/") // Remove second "series/" if present
+				delete(state.Completed, episode.VimeoId)
+				delete(state.Deleted, episode.VimeoId)
+				stateChanged = true
+				fmt.Printf("- [ ] Episode %d: %s (deleted locally, re-downloading)\n",
+					episode.Number, episode.Title)
+				episodesToDownload = append(episodesToDownload, episode)
+				continue
+			}
 
-	// For API requests, ensure we have the series/ prefix
-	apiSlug := fmt.Sprintf("series/%s", cleanSlug)
+			episodesToDownload = append(episodesToDownload, episode)
+			fmt.Printf("- [ ] Episode %d: %s (queued%s)\n",
+				episode.Number, episode.Title, d.qualityNote(episode.VimeoId))
+		}
+	}
 
-	// Try to get series metadata from cache
-	var seriesData SeriesMetadata
-	cacheKey := fmt.Sprintf("series_%s", cleanSlug)
+	if stateChanged {
+		if err := d.saveDownloadState(cleanSlug, state); err != nil {
+			fmt.Printf("Warning: Failed to save download state: %v\n", err)
+		}
+	}
 
-	found, err := d.Cache.Get(cacheKey, &seriesData)
-	if err != nil {
-		fmt.Printf("Cache error: %v, fetching fresh data\n", err)
-		found = false
+	if filteredEpisodes > 0 {
+		fmt.Printf("\nFiltered out %d/%d episodes\n", filteredEpisodes, totalEpisodes)
+	}
+	fields := make([]string, 0, len(unfiltered))
+	for field := range unfiltered {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		fmt.Printf("Warning: Laracasts lists no %s for %d episodes, they were kept whatever the filter\n", field, unfiltered[field])
 	}
 
-	// Fetch fresh data if not found in cache or stale
-	if !found || d.Cache.IsStale(cacheKey, 3600*24*7) {
-		fmt.Println("Fetching series metadata from Laracasts...")
+	summary := SeriesResult{
+		Title:    seriesData.Title,
+		Slug:     cleanSlug,
+		Total:    totalEpisodes,
+		Filtered: filteredEpisodes,
+		Existing: totalEpisodes - filteredEpisodes - len(episodesToDownload),
+	}
 
-		// Use full series URL for API request
-		seriesURL := fmt.Sprintf("%s/%s", config.LaracastsBaseUrl, apiSlug)
-		jsonData, err := d.fetchSeriesData(seriesURL)
-		if err != nil {
-			return fmt.Errorf("failed to fetch series data: %v", err)
-		}
+	if len(episodesToDownload) == 0 {
+		fmt.Printf("\nAll %d episodes already downloaded!\n", totalEpisodes-filteredEpisodes)
+		summary.Duration = time.Since(started)
+		d.markComplete(outputDir, summary)
+		d.Report.AddSeries(summary)
+		return nil
+	}
+	d.clearComplete(outputDir)
 
-		var rawData struct {
-			Props struct {
-				Series struct {
-					Title    string `json:"title"`
-					Chapters []struct {
-						Title    string `json:"title"`
-						Episodes []struct {
-							Title    string `json:"title"`
-							VimeoId  string `json:"vimeoId"`
-							Position int    `json:"position"`
-						} `json:"episodes"`
-					} `json:"chapters"`
-				} `json:"series"`
-			} `json:"props"`
-		}
+	fmt.Printf("\nPreparing to download %d/%d episodes with %d workers\n",
+		len(episodesToDownload), totalEpisodes, d.episodeWorkers())
+	d.orderEpisodes(episodesToDownload)
+
+	// Process results, retrying the episodes that failed in further passes
+	// when AutoRetrySeries allows it
+	var successCount, failedCount, skippedCount, pausedCount int
+	var downloadedBytes int64
+	pending := episodesToDownload
+	caughtUp := false
+	for pass := 0; ; pass++ {
+		var failed []Episode
+		var failures []Failure
+		diskFailed := false
+		for result := range d.downloadEpisodes(cleanSlug, seriesData.Title, outputDir, pending) {
+			switch {
+			case result.err == nil:
+				successCount++
+				episodePath := result.content.Path
+				episodeBytes := d.videoBytes(episodePath)
+				downloadedBytes += episodeBytes
+				d.Events.Record(Event{
+					Type:    EventEpisodeCompleted,
+					Series:  cleanSlug,
+					Episode: result.episode.Title,
+					VimeoId: result.episode.VimeoId,
+					Path:    d.relativePath(episodePath),
+					Bytes:   episodeBytes,
+					Seconds: result.elapsed.Seconds(),
+				})
+				state.Completed[result.content.ID] = true
+				if err := d.saveDownloadState(cleanSlug, state); err != nil {
+					fmt.Printf("Warning: Failed to save download state: %v\n", err)
+				}
+			case errors.Is(result.err, ErrMonthlyCapReached):
+				// Left queued for the next run after the month ends
+				skippedCount++
+				pausedCount++
+				d.Report.AddPaused()
+			case vimeo.IsPermanent(result.err):
+				skippedCount++
+				d.Report.AddFailure(result.content.failure(result.err))
+			default:
+				failed = append(failed, result.episode)
+				failures = append(failures, result.content.failure(result.err))
+				diskFailed = diskFailed || result.category == FailureDisk
+			}
 
-		if err := json.Unmarshal([]byte(jsonData), &rawData); err != nil {
-			return fmt.Errorf("failed to parse series data: %v", err)
+			completed := successCount + len(failed) + skippedCount
+			progress := fmt.Sprintf("Progress: %.1f%% (%d/%d) ✅ Success: %d ❌ Failed: %d",
+				float64(completed)/float64(len(episodesToDownload))*100,
+				completed, len(episodesToDownload),
+				successCount, len(failed))
+			if vimeo.Interactive() {
+				fmt.Print("\r" + progress)
+			} else {
+				fmt.Println(progress)
+			}
 		}
 
-		// Convert to metadata structure
-		seriesData = SeriesMetadata{
-			Title:     rawData.Props.Series.Title,
-			UpdatedAt: time.Now(),
-		}
+		// Another pass cannot help while the disk is full or read-only.
+		// Connection failures of many of the episodes are retried with less
+		// parallelism first, on top of the passes of AutoRetrySeries.
+		slowed := len(failed) > 0 && !diskFailed && d.slowDown(outputDir, failures, len(pending))
+		if len(failed) == 0 || diskFailed || (pass >= d.AutoRetrySeries && !slowed) {
+			failedCount = len(failed)
+			for _, failure := range failures {
+				d.Report.AddFailure(failure)
+				d.Events.Record(Event{
+					Type:    EventEpisodeFailed,
+					Series:  cleanSlug,
+					Episode: failure.Title,
+					VimeoId: failure.VimeoId,
+					Error:   failure.Reason,
+				})
+			}
 
-		for _, chapter := range rawData.Props.Series.Chapters {
-			var episodes []Episode
-			for _, ep := range chapter.Episodes {
-				if ep.VimeoId != "" {
-					episodes = append(episodes, Episode{
-						Title:   ep.Title,
-						VimeoId: ep.VimeoId,
-						Number:  ep.Position,
-					})
+			// Before the series counts as complete, queue the episodes
+			// published while it was downloading, once
+			if failedCount == 0 && !caughtUp && d.CatchUpAfter > 0 && time.Since(listed) >= d.CatchUpAfter {
+				caughtUp = true
+				added, filtered := d.catchUpEpisodes(cleanSlug, seriesData, state)
+				summary.Total += len(added) + filtered
+				summary.Filtered += filtered
+				if len(added) > 0 {
+					fmt.Printf("\n\n🆕 %d episodes of %s were published during the download, fetching them too\n",
+						len(added), seriesData.Title)
+					episodesToDownload = append(episodesToDownload, added...)
+					pending = added
+					pass = -1
+					continue
 				}
 			}
-
-			seriesData.Chapters = append(seriesData.Chapters, Chapter{
-				Title:    chapter.Title,
-				Episodes: episodes,
-			})
+			break
 		}
 
-		// Cache the series metadata
-		if err := d.Cache.Set(cacheKey, seriesData); err != nil {
-			fmt.Printf("Warning: Failed to cache series metadata: %v\n", err)
+		if slowed {
+			fmt.Printf("\n\n🐢 %d/%d episodes of %s failed, retrying them with %d episode workers and %d chunk requests per video\n",
+				len(failed), len(pending), seriesData.Title, d.seriesWorkers(outputDir), d.seriesChunks(outputDir))
+			pending = failed
+			pass--
+			continue
 		}
-	} else {
-		fmt.Println("Using cached series metadata")
+
+		backoff := d.retryBackoff(pass)
+		fmt.Printf("\n\n🔁 Retrying %d failed episodes of %s in %s (pass %d/%d)\n",
+			len(failed), seriesData.Title, backoff, pass+1, d.AutoRetrySeries)
+		d.waitOutsideSlot(backoff)
+		pending = failed
 	}
 
-	// Load or initialize download state
-	state, err := d.loadDownloadState(seriesSlug)
-	if err != nil {
-		state = &DownloadState{
-			Completed: make(map[string]bool),
-			LastSync:  time.Now(),
-		}
+	fmt.Println()
+
+	summary.Downloaded = successCount
+	summary.Failed = failedCount
+	summary.Skipped = skippedCount
+	summary.Paused = pausedCount
+	summary.Bytes = downloadedBytes
+	summary.Duration = time.Since(started)
+	if d.slowedDown(outputDir) {
+		summary.Workers = d.seriesWorkers(outputDir)
+		summary.Chunks = d.seriesChunks(outputDir)
+		d.slowdowns.Delete(outputDir)
 	}
+	d.markComplete(outputDir, summary)
+	d.Report.AddSeries(summary)
 
-	// Create series directory
-	outputDir := filepath.Join(d.BasePath, cleanSlug) // Modified line
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %v", err)
+	if failedCount > 0 {
+		return fmt.Errorf("some episodes failed to download")
 	}
 
-	// Prepare episodes for download
-	var episodesToDownload []Episode
-	var totalEpisodes int
+	return nil
+}
 
-	fmt.Printf("\nSeries: %s\n", seriesData.Title)
+// retryBackoff is the wait before the given retry pass of a series, doubling
+// from RetryBackoff for each pass up to SeriesRetryMaxBackoff
+func (d *Downloader) retryBackoff(pass int) time.Duration {
+	backoff := d.RetryBackoff
+	for i := 0; i < pass && backoff < SeriesRetryMaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, SeriesRetryMaxBackoff)
+}
 
-	for chapterIdx, chapter := range seriesData.Chapters {
-		fmt.Printf("\nChapter %d: %s\n", chapterIdx+1, chapter.Title)
-		for _, episode := range chapter.Episodes {
-			totalEpisodes++
+// waitOutsideSlot sleeps with the series slot of a bulk run released, so
+// another series downloads meanwhile, and takes a slot again afterwards
+func (d *Downloader) waitOutsideSlot(wait time.Duration) {
+	if slots := d.seriesSlots; slots != nil {
+		<-slots
+		defer func() { slots <- struct{}{} }()
+	}
+	time.Sleep(wait)
+}
 
-			if state.Completed[episode.VimeoId] {
-				fmt.Printf("- [✓] Episode %d: %s (already downloaded)\n",
-					episode.Number, episode.Title)
-				continue
-			}
+// catchUpEpisodes fetches the page of a series again and returns the
+// episodes it lists that seriesData did not, published while the series was
+// downloading, along with how many of them the filter left out. seriesData
+// and its cache entry are updated to the fresh metadata.
+func (d *Downloader) catchUpEpisodes(cleanSlug string, seriesData *SeriesMetadata, state *DownloadState) ([]Episode, int) {
+	fmt.Printf("\n\nChecking %s for episodes published during the download...\n", seriesData.Title)
+
+	var fresh *SeriesMetadata
+	if d.Origin != "" {
+		fresh = d.originSeriesMetadata(cleanSlug)
+	}
+	if fresh == nil || fresh.EpisodeCount == 0 {
+		var err error
+		if fresh, err = d.scrapeSeriesMetadata("series/" + cleanSlug); err != nil {
+			fmt.Printf("Warning: Failed to check for new episodes: %v\n", err)
+			return nil, 0
+		}
+	}
+	if fresh.EpisodeCount <= seriesData.EpisodeCount {
+		return nil, 0
+	}
 
-			episodesToDownload = append(episodesToDownload, episode)
-			fmt.Printf("- [ ] Episode %d: %s (queued)\n",
-				episode.Number, episode.Title)
+	known := make(map[string]bool)
+	for _, chapter := range seriesData.Chapters {
+		for _, episode := range chapter.Episodes {
+			known[episode.VimeoId] = true
 		}
 	}
 
-	if len(episodesToDownload) == 0 {
-		fmt.Printf("\nAll %d episodes already downloaded!\n", totalEpisodes)
-		return nil
+	d.seriesRefreshed(cleanSlug, seriesData, fresh)
+	if err := d.Cache.Set(fmt.Sprintf("series_%s", cleanSlug), *fresh); err != nil {
+		fmt.Printf("Warning: Failed to cache series metadata: %v\n", err)
 	}
+	disambiguateFilenames(fresh)
+	*seriesData = *fresh
 
-	fmt.Printf("\nPreparing to download %d/%d episodes with %d workers\n",
-		len(episodesToDownload), totalEpisodes, MaxEpisodeWorkers)
+	var added []Episode
+	filtered := 0
+	now := time.Now()
+	for chapterIdx, chapter := range seriesData.Chapters {
+		for _, episode := range chapter.Episodes {
+			if episode.VimeoId == "" || known[episode.VimeoId] || state.Completed[episode.VimeoId] {
+				continue
+			}
+			known[episode.VimeoId] = true
+			if !d.Filter.AllowsChapter(chapterIdx+1) || !d.Filter.Allows(episode, now) {
+				filtered++
+				continue
+			}
+			fmt.Printf("- [ ] Episode %d: %s (new, queued%s)\n",
+				episode.Number, episode.Title, d.qualityNote(episode.VimeoId))
+			added = append(added, episode)
+		}
+	}
+	return added, filtered
+}
+
+// episodeResult is the outcome of downloading one episode
+type episodeResult struct {
+	episode  Episode
+	content  Content
+	err      error
+	category string // FailureCategory of err
+	elapsed  time.Duration
+}
 
-	// Create worker pool
+// downloadEpisodes downloads the episodes of the series titled title into
+// outputDir with the configured number of workers, sending each outcome on the returned channel,
+// which is closed once all are done
+func (d *Downloader) downloadEpisodes(seriesSlug, title, outputDir string, episodes []Episode) <-chan episodeResult {
 	jobs := make(chan Episode, JobBufferSize)
-	results := make(chan struct {
-		episode   Episode
-		outputDir string
-		err       error
-	}, ResultsBufferSize)
+	results := make(chan episodeResult, ResultsBufferSize)
 
 	// Start workers
 	var wg sync.WaitGroup
-	for w := 1; w <= MaxEpisodeWorkers; w++ {
+	for w := 1; w <= d.seriesWorkers(outputDir); w++ {
 		wg.Add(1)
 		go func(id int) {
 			defer wg.Done()
 			for episode := range jobs {
-				fmt.Printf("\nWorker %d starting download: Episode %d - %s\n",
+				vimeo.Printf("Worker %d starting download: Episode %d - %s\n",
 					id, episode.Number, episode.Title)
 
-				err := d.downloadEpisode(outputDir, episode)
-				time.Sleep(time.Millisecond)
-				results <- struct {
-					episode   Episode
-					outputDir string
+				content := episode.content(title, outputDir)
+				var paths []string
+				if d.Webhook != nil {
+					for _, v := range d.variants(content.Path) {
+						paths = append(paths, v.Path)
+					}
+					d.Webhook.Start(seriesSlug, episode, paths)
+				}
 
-					err error
-				}{episode, outputDir, err}
+				start := time.Now()
+				err := d.downloadContent(content)
+				if d.Webhook != nil {
+					d.Webhook.Finish(paths, err)
+				}
+				time.Sleep(time.Millisecond)
+				results <- episodeResult{episode, content, err, FailureCategory(err), time.Since(start)}
 
 				if err != nil {
-					fmt.Printf("❌ Worker %d failed episode %d: %v\n",
+					vimeo.Printf("❌ Worker %d failed episode %d: %v\n",
 						id, episode.Number, err)
 				} else {
-					fmt.Printf("✅ Worker %d completed episode %d: %s\n",
+					vimeo.Printf("✅ Worker %d completed episode %d: %s\n",
 						id, episode.Number, episode.Title)
 				}
 			}
@@ -843,7 +1311,7 @@ func (d *Downloader) DownloadSeries(seriesSlug string) error {
 
 	// Send jobs to workers
 	go func() {
-		for _, episode := range episodesToDownload {
+		for _, episode := range episodes {
 			jobs <- episode
 		}
 		close(jobs)
@@ -855,104 +1323,26 @@ func (d *Downloader) DownloadSeries(seriesSlug string) error {
 		close(results)
 	}()
 
-	// Process results
-	var successCount, failedCount int
-	for result := range results {
-		if result.err == nil {
-			successCount++
-			state.Completed[result.episode.VimeoId] = true
-			if err := d.saveDownloadState(cleanSlug, state); err != nil {
-				fmt.Printf("Warning: Failed to save download state: %v\n", err)
-			}
-		} else {
-			failedCount++
-		}
-
-		completed := successCount + failedCount
-		fmt.Printf("\rProgress: %.1f%% (%d/%d) ✅ Success: %d ❌ Failed: %d",
-			float64(completed)/float64(len(episodesToDownload))*100,
-			completed, len(episodesToDownload),
-			successCount, failedCount)
-	}
-
-	fmt.Printf("\n\nDownload Summary for %s:\n", seriesData.Title)
-	fmt.Printf("Total Episodes: %d\n", totalEpisodes)
-	fmt.Printf("Previously Downloaded: %d\n", totalEpisodes-len(episodesToDownload))
-	fmt.Printf("Successfully Downloaded: %d\n", successCount)
-	fmt.Printf("Failed Downloads: %d\n", failedCount)
-
-	if failedCount > 0 {
-		return fmt.Errorf("some episodes failed to download")
-	}
-
-	return nil
+	return results
 }
 
+// fetchSeriesData fetches the page data of a series, retrying failed requests
+// and truncated or rate limited pages
 func (d *Downloader) fetchSeriesData(url string) (string, error) {
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %v", err)
-	}
-
-	token, _ := d.getXSRFToken()
-	if token != "" {
-		req.Header.Set("X-XSRF-TOKEN", token)
-	}
-
-	resp, err := d.Client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed request: %v", err)
-	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			printBox("Failed to close response body")
-		}
-	}(resp.Body)
-
-	if resp.StatusCode == http.StatusConflict {
-		req, err = http.NewRequest("GET", url, nil)
-		if err != nil {
-			return "", fmt.Errorf("failed to create regular request: %v", err)
-		}
-
-		for k, v := range config.DefaultHeaders {
-			req.Header.Set(k, v)
+	maxRetries := 3
+	var lastErr error
+	for i := 0; i < maxRetries; i++ {
+		if i > 0 {
+			time.Sleep(time.Second * time.Duration(i))
 		}
 
-		resp, err = d.Client.Do(req)
-		if err != nil {
-			return "", fmt.Errorf("failed regular request: %v", err)
+		jsonData, err := d.fetchPageData(url)
+		if err == nil || errors.Is(err, ErrLoggedOut) {
+			return jsonData, err
 		}
-		defer func(Body io.ReadCloser) {
-			err := Body.Close()
-			if err != nil {
-				printBox("Failed to close response body")
-			}
-		}(resp.Body)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response: %v", err)
-	}
-
-	return extractSeriesJSON(string(body))
-}
-
-func extractSeriesJSON(content string) (string, error) {
-	dataPageRe := regexp.MustCompile(`data-page="([^"]+)"`)
-	if matches := dataPageRe.FindStringSubmatch(content); len(matches) > 1 {
-		decoded := html.UnescapeString(matches[1])
-		return decoded, nil
-	}
-
-	scriptRe := regexp.MustCompile(`<script\s+id="page-data"\s+type="application/json"[^>]*>(.*?)</script>`)
-	if matches := scriptRe.FindStringSubmatch(content); len(matches) > 1 {
-		return html.UnescapeString(matches[1]), nil
+		lastErr = err
 	}
-
-	return "", fmt.Errorf("no series data found in response")
+	return "", fmt.Errorf("%v (after %d attempts)", lastErr, maxRetries)
 }
 
 func (d *Downloader) loadDownloadState(seriesSlug string) (*DownloadState, error) {
@@ -969,127 +1359,69 @@ func (d *Downloader) saveDownloadState(seriesSlug string, state *DownloadState)
 	return d.Cache.Set(fmt.Sprintf("download_state_%s", seriesSlug), state)
 }
 
+// DownloadAllSeries downloads every series of the catalog into the download
+// path, without the topic folders. The series are discovered from the pages
+// of every topic on the browse page, each once however many topics list it.
 func (d *Downloader) DownloadAllSeries() error {
-	printBox("Downloading all series")
-
-	// Get the series listing page
-	seriesURL := fmt.Sprintf("%s/series", config.LaracastsBaseUrl)
-
-	req, err := http.NewRequest("GET", seriesURL, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
-	}
-
-	for k, v := range config.DefaultHeaders {
-		req.Header.Set(k, v)
-	}
-
-	resp, err := d.Client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed request: %v", err)
-	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			printBox("Failed to close response body")
-		}
-	}(resp.Body)
+	PrintBox("Downloading all series")
 
-	body, err := io.ReadAll(resp.Body)
+	topics, err := d.fetchTopics()
 	if err != nil {
-		return fmt.Errorf("failed to read response: %v", err)
-	}
-
-	// Try to extract data from data-page attribute first
-	dataPageRe := regexp.MustCompile(`data-page="([^"]+)"`)
-	var pageData string
-
-	if matches := dataPageRe.FindSubmatch(body); len(matches) > 1 {
-		pageData = html.UnescapeString(string(matches[1]))
-	} else {
-		// Fallback to script tag
-		scriptRe := regexp.MustCompile(`<script\s+id="page-data"\s+type="application/json"[^>]*>(.*?)</script>`)
-		if matches := scriptRe.FindSubmatch(body); len(matches) > 1 {
-			pageData = html.UnescapeString(string(matches[1]))
-		}
-	}
-
-	if pageData == "" {
-		return fmt.Errorf("no series data found in page")
-	}
-
-	// Parse the JSON structure
-	var jsonData struct {
-		Props struct {
-			PublicCollections []struct {
-				Items []struct {
-					Slug string `json:"slug"`
-				} `json:"items"`
-			} `json:"publicCollections"`
-			FeaturedCollection struct {
-				Items []struct {
-					Slug string `json:"slug"`
-				} `json:"items"`
-			} `json:"featuredCollection"`
-		} `json:"props"`
-	}
-
-	if err := json.Unmarshal([]byte(pageData), &jsonData); err != nil {
-		return fmt.Errorf("failed to parse JSON data: %v", err)
-	}
-
-	// Collect unique slugs and add "series/" prefix
-	slugMap := make(map[string]bool)
-	var slugs []string
-
-	// Add featured collection slugs
-	for _, item := range jsonData.Props.FeaturedCollection.Items {
-		if item.Slug != "" && !slugMap[item.Slug] {
-			slugMap[item.Slug] = true
-			// Add "series/" prefix to match working format
-			cleanSlug := cleanSeriesSlug(item.Slug)
-
-			slugs = append(slugs, cleanSlug)
-		}
+		return err
 	}
+	_, catalog, failedTopics := d.scrapeCatalog(topics)
 
-	// Add public collections slugs
-	for _, collection := range jsonData.Props.PublicCollections {
-		for _, item := range collection.Items {
-			if item.Slug != "" && !slugMap[item.Slug] {
-				slugMap[item.Slug] = true
-				// Add "series/" prefix to match working format
-				slugs = append(slugs, fmt.Sprintf("series/%s", item.Slug))
-			}
+	slugs := make([]string, 0, len(catalog))
+	for _, s := range catalog {
+		if !d.skipArchived(s) && !d.skipUnreleased(s) {
+			slugs = append(slugs, s.Slug)
 		}
 	}
-
 	if len(slugs) == 0 {
-		return fmt.Errorf("no series slugs found in page data")
+		return fmt.Errorf("no series found in %d topics", len(topics))
 	}
 
+	d.orderSlugs(slugs)
 	fmt.Printf("\nFound %d series to download\n", len(slugs))
 	for i, slug := range slugs {
 		fmt.Printf("%d. %s\n", i+1, slug)
 	}
+	checkpoint := d.newCheckpointer(checkpointSeries)
 
 	// Create channels for concurrent downloads
-	sem := make(chan bool, 6) // Limit concurrent downloads
+	d.seriesSlots = make(chan struct{}, d.Concurrency.Series)
 	var wg sync.WaitGroup
 	var (
 		completedSeries int32
 		failedSeries    int32
+		startedSeries   int32
 		mu              sync.Mutex
 	)
+	d.activity.setQueue(func() int { return len(slugs) - int(atomic.LoadInt32(&startedSeries)) })
+	defer d.activity.setQueue(nil)
 
 	// Process each series
 	for i, slug := range slugs {
 		wg.Add(1)
-		sem <- true // Acquire semaphore
+		d.seriesSlots <- struct{}{} // Acquire semaphore
+		atomic.AddInt32(&startedSeries, 1)
 
 		go func(idx int, seriesSlug string) {
 			defer wg.Done()
-			defer func() { <-sem }() // Release semaphore
+			defer func() { <-d.seriesSlots }() // Release semaphore
+
+			if checkpoint.skip(seriesSlug) {
+				mu.Lock()
+				fmt.Printf("\n[%d/%d] ⏭️  Skipping series %s, completed before the checkpoint\n", idx+1, len(slugs), seriesSlug)
+				mu.Unlock()
+				atomic.AddInt32(&completedSeries, 1)
+				return
+			}
+
+			if d.skipIgnored(seriesSlug, seriesSlug, filepath.Join(d.BasePath, checkpointSlug(seriesSlug))) {
+				atomic.AddInt32(&completedSeries, 1)
+				return
+			}
 
 			mu.Lock()
 			fmt.Printf("\n[%d/%d] 📺 Starting series: %s\n", idx+1, len(slugs), seriesSlug)
@@ -1105,6 +1437,9 @@ func (d *Downloader) DownloadAllSeries() error {
 			}
 
 			atomic.AddInt32(&completedSeries, 1)
+			if !d.Report.seriesPaused(checkpointSlug(seriesSlug)) {
+				checkpoint.seriesCompleted(seriesSlug)
+			}
 			mu.Lock()
 			fmt.Printf("✅ Completed series: %s\n", seriesSlug)
 
@@ -1114,36 +1449,38 @@ func (d *Downloader) DownloadAllSeries() error {
 				len(slugs))
 			fmt.Print(progress)
 			mu.Unlock()
-
-			// Small delay between series
-			time.Sleep(500 * time.Millisecond)
 		}(i, slug)
 	}
 
 	// Wait for all downloads to complete
 	wg.Wait()
+	d.seriesSlots = nil
 
 	// Print summary
 	completed := atomic.LoadInt32(&completedSeries)
 	failed := atomic.LoadInt32(&failedSeries)
 
 	fmt.Printf("\n🎉 Download Summary:\n")
-	fmt.Printf("Total Series Found: %d\n", len(slugs))
+	fmt.Printf("Total Series Found: %d in %d topics (%d failed)\n", len(slugs), len(topics), failedTopics)
 	fmt.Printf("Series Completed: %d\n", completed)
 	fmt.Printf("Series Failed: %d\n", failed)
 
-	if failed > 0 {
-		return fmt.Errorf("%d series failed to download", failed)
+	var result error
+	switch {
+	case failed > 0:
+		result = fmt.Errorf("%d series failed to download", failed)
+	case failedTopics > 0:
+		result = fmt.Errorf("%d topics failed to scrape, their series may be missing", failedTopics)
 	}
-
-	return nil
+	checkpoint.finish(result)
+	return result
 }
 
 func (d *Downloader) getSeriesPage() ([]struct {
 	Title string `json:"title"`
 	Slug  string `json:"slug"`
 }, string, error) {
-	seriesURL := fmt.Sprintf("%s%s", config.LaracastsBaseUrl, config.LaracastsSeriesPath)
+	seriesURL := d.Site.BaseURL() + d.Site.Paths().Series
 	fmt.Printf("Fetching series list from: %s\n", seriesURL)
 
 	req, err := http.NewRequest("GET", seriesURL, nil)
@@ -1186,11 +1523,6 @@ func (d *Downloader) getSeriesPage() ([]struct {
 	}
 
 	if pageData == "" {
-		// Save the response for debugging
-		debugFile := "debug_series_page.html"
-		if err := os.WriteFile(debugFile, body, 0644); err == nil {
-			fmt.Printf("Saved HTML content to %s for debugging\n", debugFile)
-		}
 		return nil, "", fmt.Errorf("no series data found in page")
 	}
 
@@ -1279,8 +1611,8 @@ func (d *Downloader) getSeriesPage() ([]struct {
 
 // Helper function to get raw XSRF token
 func (d *Downloader) getXSRFTokenRaw() string {
-	laracastsURL, _ := url.Parse(config.LaracastsBaseUrl)
-	cookies := d.Client.Jar.Cookies(laracastsURL)
+	siteURL, _ := url.Parse(d.Site.BaseURL())
+	cookies := d.Client.Jar.Cookies(siteURL)
 
 	for _, cookie := range cookies {
 		if cookie.Name == "XSRF-TOKEN" {
@@ -1289,76 +1621,3 @@ func (d *Downloader) getXSRFTokenRaw() string {
 	}
 	return ""
 }
-
-// Login Update the cookie handling function to handle the initial request
-func (d *Downloader) Login(email, password string) error {
-	printBox("Authenticating")
-
-	// First visit the site to get cookies
-	homeReq, err := http.NewRequest("GET", config.LaracastsBaseUrl, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create home request: %v", err)
-	}
-
-	homeReq.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
-	homeReq.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
-
-	homeResp, err := d.Client.Do(homeReq)
-	if err != nil {
-		return fmt.Errorf("failed home request: %v", err)
-	}
-	err = homeResp.Body.Close()
-	if err != nil {
-		return err
-	}
-
-	// Get XSRF token
-	token, err := d.getXSRFToken()
-	if err != nil {
-		return fmt.Errorf("failed to get XSRF token: %v", err)
-	}
-
-	// Prepare login data
-	auth := map[string]interface{}{
-		"email":    email,
-		"password": password,
-		"remember": true,
-	}
-
-	jsonData, err := json.Marshal(auth)
-	if err != nil {
-		return fmt.Errorf("failed to marshal auth data: %v", err)
-	}
-
-	// Send login request
-	loginURL := config.LaracastsBaseUrl + config.LaracastsPostLoginPath
-	req, err := http.NewRequest("POST", loginURL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to create login request: %v", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("X-XSRF-TOKEN", token)
-	req.Header.Set("X-Requested-With", "XMLHttpRequest")
-	req.Header.Set("Referer", config.LaracastsBaseUrl)
-
-	resp, err := d.Client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed login request: %v", err)
-	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			print("failed to close response body")
-		}
-	}(resp.Body)
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("login failed with status %d: %s", resp.StatusCode, string(body))
-	}
-
-	fmt.Printf("✓ Logged in as %s\n", email)
-	return nil
-}
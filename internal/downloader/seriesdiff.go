@@ -0,0 +1,148 @@
+package downloader
+
+import (
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/vimeo"
+	"golang.org/x/term"
+	"os"
+	"strings"
+)
+
+// ANSI colors of the series diff
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorCyan   = "\033[36m"
+)
+
+// seriesDiff is what changed in a series between the cached metadata and a
+// fresh fetch of its page
+type seriesDiff struct {
+	added      []Episode
+	removed    []Episode
+	retitled   []episodeChange // same video, new title
+	reuploaded []episodeChange // same title, new video
+}
+
+// episodeChange is an episode as cached and as fetched now
+type episodeChange struct {
+	before, after Episode
+}
+
+// diffSeries compares the episodes of previous and fresh by Vimeo ID. An
+// episode that disappeared while another with the same title appeared is
+// counted as re-uploaded rather than removed and added.
+func diffSeries(previous, fresh *SeriesMetadata) seriesDiff {
+	before := make(map[string]Episode)
+	for _, chapter := range previous.Chapters {
+		for _, episode := range chapter.Episodes {
+			if episode.VimeoId != "" {
+				before[episode.VimeoId] = episode
+			}
+		}
+	}
+
+	var diff seriesDiff
+	var appeared []Episode
+	seen := make(map[string]bool)
+	for _, chapter := range fresh.Chapters {
+		for _, episode := range chapter.Episodes {
+			if episode.VimeoId == "" {
+				continue
+			}
+			seen[episode.VimeoId] = true
+			old, known := before[episode.VimeoId]
+			switch {
+			case !known:
+				appeared = append(appeared, episode)
+			case old.Title != episode.Title:
+				diff.retitled = append(diff.retitled, episodeChange{before: old, after: episode})
+			}
+		}
+	}
+
+	var gone []Episode
+	for _, chapter := range previous.Chapters {
+		for _, episode := range chapter.Episodes {
+			if episode.VimeoId != "" && !seen[episode.VimeoId] {
+				gone = append(gone, episode)
+			}
+		}
+	}
+
+	matched := make(map[string]bool) // vimeo ids of gone episodes re-uploaded
+	for _, episode := range appeared {
+		reuploaded := false
+		for _, old := range gone {
+			if old.Title == episode.Title && !matched[old.VimeoId] {
+				matched[old.VimeoId], reuploaded = true, true
+				diff.reuploaded = append(diff.reuploaded, episodeChange{before: old, after: episode})
+				break
+			}
+		}
+		if !reuploaded {
+			diff.added = append(diff.added, episode)
+		}
+	}
+	for _, old := range gone {
+		if !matched[old.VimeoId] {
+			diff.removed = append(diff.removed, old)
+		}
+	}
+	return diff
+}
+
+func (diff seriesDiff) empty() bool {
+	return len(diff.added)+len(diff.removed)+len(diff.retitled)+len(diff.reuploaded) == 0
+}
+
+// seriesRefreshed prints what changed between the cached metadata of a
+// series and the fresh one and records new and re-uploaded episodes in the
+// changelog
+func (d *Downloader) seriesRefreshed(cleanSlug string, previous, fresh *SeriesMetadata) {
+	diff := diffSeries(previous, fresh)
+	if diff.empty() {
+		return
+	}
+	d.printSeriesDiff(fresh.Title, diff)
+	d.Changelog.recordSeriesDiff(cleanSlug, fresh, diff)
+}
+
+// printSeriesDiff writes diff, colored when Color is set. It is written at
+// once, so the diffs of series refreshed at the same time do not interleave.
+func (d *Downloader) printSeriesDiff(title string, diff seriesDiff) {
+	var out strings.Builder
+	line := func(color, format string, args ...interface{}) {
+		text := fmt.Sprintf(format, args...)
+		if d.Color {
+			text = color + text + colorReset
+		}
+		out.WriteString(text + "\n")
+	}
+
+	fmt.Fprintf(&out, "\n📝 %s changed since it was cached:\n", title)
+	for _, e := range diff.added {
+		line(colorGreen, "  + %02d %s", e.Number, e.Title)
+	}
+	for _, e := range diff.removed {
+		line(colorRed, "  - %02d %s", e.Number, e.Title)
+	}
+	for _, c := range diff.retitled {
+		line(colorYellow, "  ~ %02d %s → %s", c.after.Number, c.before.Title, c.after.Title)
+	}
+	for _, c := range diff.reuploaded {
+		line(colorCyan, "  ↻ %02d %s (re-uploaded, vimeo %s → %s)", c.after.Number, c.after.Title, c.before.VimeoId, c.after.VimeoId)
+	}
+	vimeo.Printf("%s", out.String())
+}
+
+// colorOutput reports whether stdout is a terminal that wants colors; a
+// NO_COLOR that is set but empty does not turn them off, see https://no-color.org
+func colorOutput() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return term.IsTerminal(int(os.Stdout.Fd()))
+}
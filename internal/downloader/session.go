@@ -0,0 +1,192 @@
+package downloader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrLoggedOut is returned for pages fetched after Laracasts ended the
+// session, which it does to every session of an account it sees sending many
+// parallel requests. Pages then come back as a guest sees them, without the
+// videos.
+var ErrLoggedOut = errors.New("signed out by Laracasts")
+
+// maxRelogins caps how often a run signs back in after being signed out
+const maxRelogins = 3
+
+const (
+	reloginAttempts = 3               // sign-ins tried while rate limited before giving up
+	reloginBackoff  = 2 * time.Second // pause before the next attempt without Retry-After, doubling with each
+	reloginMaxWait  = 5 * time.Minute // longest Retry-After waited for, the run gives up on a longer one
+)
+
+// sessionState tracks the sign-in of the downloader, so pages served to a
+// guest are caught instead of parsed
+type sessionState struct {
+	mu         sync.Mutex
+	auth       Authenticator // the last one that succeeded
+	signedIn   bool
+	lost       bool // signed out and not signed back in
+	generation int  // sign-ins so far
+	relogins   int
+	throttle   uint // halvings of the episode concurrency
+
+	// signingIn is closed once the sign-in in flight is done, nil while
+	// none is
+	signingIn chan struct{}
+}
+
+// signIn records a successful sign-in with auth
+func (s *sessionState) signIn(auth Authenticator) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.auth, s.signedIn, s.lost = auth, true, false
+	s.generation++
+}
+
+// current returns the sign-in the next request is made with, or
+// ErrLoggedOut once the session is lost; it waits while the session is being
+// signed back in
+func (s *sessionState) current() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.awaitSignIn()
+	if s.lost {
+		return 0, ErrLoggedOut
+	}
+	return s.generation, nil
+}
+
+// awaitSignIn waits for the sign-in in flight, if any, to be done. It is
+// called and returns with s.mu held, which is released while waiting.
+func (s *sessionState) awaitSignIn() {
+	for s.signingIn != nil {
+		done := s.signingIn
+		s.mu.Unlock()
+		<-done
+		s.mu.Lock()
+	}
+}
+
+// guestPage reports whether the page data of a signed in session came back
+// without a user in its auth props. Pages without auth props at all are not
+// conclusive and pass.
+func (d *Downloader) guestPage(data string) bool {
+	d.session.mu.Lock()
+	signedIn := d.session.signedIn
+	d.session.mu.Unlock()
+
+	present, user := pageAuth(data)
+	return signedIn && present && !user
+}
+
+// sessionLost handles a page served to a guest by the sign-in generation:
+// downloads wait while the session is signed back in with fewer episode
+// workers, unless AutoRelogin is off or signing in fails, which fails every
+// further page with ErrLoggedOut. Only the first worker to notice signs in,
+// the others wait for it and share its outcome.
+func (d *Downloader) sessionLost(generation int) error {
+	s := &d.session
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.awaitSignIn()
+	if s.lost {
+		return ErrLoggedOut
+	}
+	if s.generation != generation {
+		// Another worker signed back in meanwhile
+		return nil
+	}
+
+	d.Report.AddSignedOut()
+	fmt.Println("\n🚨 Laracasts signed this session out, most likely for too many parallel requests. Downloads are paused.")
+	if !d.AutoRelogin || s.auth == nil || s.relogins >= maxRelogins {
+		s.lost = true
+		fmt.Println("Sign in again and run once more with lower SERIES_CONCURRENCY and EPISODE_CONCURRENCY")
+		return ErrLoggedOut
+	}
+
+	s.relogins++
+	s.throttle++
+	fmt.Printf("Signing in again, downloading with %d episode workers per series from now on\n", d.throttledWorkers())
+
+	// Signed in without holding s.mu, so waiting out a rate limited login
+	// does not hold up everything else asking about the session
+	auth, done := s.auth, make(chan struct{})
+	s.signingIn = done
+	s.mu.Unlock()
+	err := d.reauthenticate(auth)
+	s.mu.Lock()
+	s.signingIn = nil
+	close(done)
+
+	if err != nil {
+		s.lost = true
+		fmt.Printf("❌ Failed to sign in again: %v\n", err)
+		return ErrLoggedOut
+	}
+	s.generation++
+	return nil
+}
+
+// reauthenticate signs back in with auth, waiting out a rate limited login
+// for Retry-After, or a growing pause without one
+func (d *Downloader) reauthenticate(auth Authenticator) error {
+	var err error
+	for attempt := 0; attempt < reloginAttempts; attempt++ {
+		if err = auth.Authenticate(d.Client, d.Site); err == nil {
+			return nil
+		}
+
+		var statusErr *statusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusTooManyRequests || attempt == reloginAttempts-1 {
+			return err
+		}
+		wait := statusErr.RetryAfter
+		if wait == 0 {
+			wait = reloginBackoff << attempt
+		}
+		if wait > reloginMaxWait {
+			return fmt.Errorf("signing in is rate limited for %s: %w", wait, err)
+		}
+		fmt.Printf("⏳ Signing in is rate limited, trying again in %s\n", wait)
+		time.Sleep(wait)
+	}
+	return err
+}
+
+// episodeWorkers returns how many episodes of a series are downloaded at
+// once, fewer after Laracasts signed the session out
+func (d *Downloader) episodeWorkers() int {
+	d.session.mu.Lock()
+	defer d.session.mu.Unlock()
+	return d.throttledWorkers()
+}
+
+// throttledWorkers is episodeWorkers for callers holding d.session.mu
+func (d *Downloader) throttledWorkers() int {
+	return max(d.Concurrency.Episodes>>d.session.throttle, 1)
+}
+
+// pageAuth reads the auth props Laracasts shares with every page: whether
+// they are there, and whether they name a signed in user
+func pageAuth(data string) (present, user bool) {
+	// Streamed, as every page is checked
+	var auth *struct {
+		SignedIn bool            `json:"signedIn"`
+		User     json.RawMessage `json:"user"`
+	}
+	dec := pageDecoder(data)
+	if found, err := descend(dec, "props", "auth"); err != nil || !found || dec.Decode(&auth) != nil || auth == nil {
+		return false, false
+	}
+
+	raw := strings.TrimSpace(string(auth.User))
+	return true, auth.SignedIn || (raw != "" && raw != "null")
+}
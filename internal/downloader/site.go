@@ -0,0 +1,317 @@
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/config"
+	"github.com/sajjadanwar0/laracasts-dl/internal/vimeo"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Site adapts the scraper to an Inertia-based course site: where its pages
+// are, how to sign in, and how the props of its pages map onto topics and
+// series. Laracasts is the default; adapters for sibling sites register
+// themselves with RegisterSite and are selected with SITE.
+type Site interface {
+	// Name identifies the site in SITE
+	Name() string
+
+	// BaseURL is the site root, without a trailing slash
+	BaseURL() string
+
+	Paths() SitePaths
+
+	// LoginPayload is the JSON body posted to Paths().PostLogin
+	LoginPayload(email, password string) map[string]interface{}
+
+	// ParseTopics reads the topics listed on the browse page
+	ParseTopics(pageData string) ([]Topic, error)
+
+	// ParseTopicSeries reads the series listed on the page of a topic
+	ParseTopicSeries(pageData, topicName string) ([]TopicSeries, error)
+
+	// ParseSeries reads the page of a series. URL, PageBytes and UpdatedAt
+	// are filled in by the caller.
+	ParseSeries(pageData string) (*SeriesMetadata, error)
+}
+
+// SitePaths are the pages of a site the scraper visits, relative to its
+// base URL. Bits is empty for sites without them.
+type SitePaths struct {
+	Login     string // the sign-in form, visited for the XSRF cookie
+	PostLogin string
+	TwoFactor string
+	Browse    string // lists every topic
+	Series    string // prefix of series pages
+	Bits      string
+}
+
+var (
+	sitesMu sync.Mutex
+	sites   = map[string]Site{}
+)
+
+// RegisterSite makes site selectable by its name, replacing any adapter
+// registered under it before
+func RegisterSite(site Site) {
+	sitesMu.Lock()
+	defer sitesMu.Unlock()
+	sites[site.Name()] = site
+}
+
+// LookupSite returns the adapter registered as name
+func LookupSite(name string) (Site, error) {
+	sitesMu.Lock()
+	defer sitesMu.Unlock()
+	if site, ok := sites[name]; ok {
+		return site, nil
+	}
+
+	names := make([]string, 0, len(sites))
+	for name := range sites {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("unknown SITE %q (available: %s)", name, strings.Join(names, ", "))
+}
+
+func init() {
+	RegisterSite(Laracasts{})
+}
+
+// isSiteHost reports whether u points at site or one of its subdomains
+func isSiteHost(u *url.URL, site Site) bool {
+	base, err := url.Parse(site.BaseURL())
+	if err != nil {
+		return false
+	}
+
+	host := u.Hostname()
+	return host == base.Hostname() || strings.HasSuffix(host, "."+base.Hostname())
+}
+
+// Laracasts is the adapter of laracasts.com, the default site
+type Laracasts struct{}
+
+func (Laracasts) Name() string { return config.SiteLaracasts }
+
+// BaseURL is config.LaracastsBaseUrl, so tests can point it at a mock server
+func (Laracasts) BaseURL() string { return config.LaracastsBaseUrl }
+
+func (Laracasts) Paths() SitePaths {
+	return SitePaths{
+		Login:     config.LaracastsLoginPath,
+		PostLogin: config.LaracastsPostLoginPath,
+		TwoFactor: config.LaracastsTwoFactorPath,
+		Browse:    config.LaracastsBrowsePath + "/all",
+		Series:    config.LaracastsSeriesPath,
+		Bits:      config.LaracastsBitsPath,
+	}
+}
+
+func (Laracasts) LoginPayload(email, password string) map[string]interface{} {
+	return map[string]interface{}{
+		"email":    email,
+		"password": password,
+		"remember": true,
+	}
+}
+
+// ParseTopics streams the topics out of the browse page, see pagejson.go
+func (Laracasts) ParseTopics(pageData string) ([]Topic, error) {
+	dec := pageDecoder(pageData)
+	var topics []Topic
+	found, err := descend(dec, "props", "topics")
+	if err == nil && found {
+		err = forEachElement(dec, func() error {
+			var topic Topic
+			if err := dec.Decode(&topic); err != nil {
+				return err
+			}
+			topics = append(topics, topic)
+			return nil
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JSON data: %v", err)
+	}
+	return topics, nil
+}
+
+// laracastsTopicSeries is an entry of the series listed on a topic page
+type laracastsTopicSeries struct {
+	ID           int    `json:"id"`
+	Title        string `json:"title"`
+	Path         string `json:"path"`
+	Slug         string `json:"slug"`
+	EpisodeCount *int   `json:"episodeCount"` // nil when the page leaves it out
+	Difficulty   string `json:"difficultyLevel"`
+	Archived     bool   `json:"archived"`
+	Topics       []struct {
+		Name string `json:"name"`
+		Path string `json:"path"`
+	} `json:"topics"`
+}
+
+// ParseTopicSeries streams the series out of a topic page, one at a time
+func (Laracasts) ParseTopicSeries(pageData, topicName string) ([]TopicSeries, error) {
+	dec := pageDecoder(pageData)
+	var series []TopicSeries
+	var topicPath string
+	seen := make(map[string]bool)
+
+	found, err := descend(dec, "props", "topic")
+	if err == nil && found {
+		err = forEachKey(dec, func(key string) (bool, error) {
+			switch key {
+			case "path":
+				return true, dec.Decode(&topicPath)
+			case "series":
+				return true, forEachElement(dec, func() error {
+					var s laracastsTopicSeries
+					if err := dec.Decode(&s); err != nil {
+						return err
+					}
+					if s.Title == "" || seen[s.Slug] {
+						return nil
+					}
+					seen[s.Slug] = true
+					series = append(series, s.topicSeries(topicName))
+					return nil
+				})
+			}
+			return true, skipValue(dec)
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse page data: %v", err)
+	}
+
+	// The path of the topic may follow its series
+	for i := range series {
+		series[i].TopicPath = topicPath
+	}
+	return series, nil
+}
+
+func (s laracastsTopicSeries) topicSeries(topicName string) TopicSeries {
+	slug := s.Slug
+	if s.Path != "" {
+		slug = strings.TrimPrefix(s.Path, "/series/")
+	}
+	if !strings.HasPrefix(slug, "series/") {
+		slug = fmt.Sprintf("series/%s", slug)
+	}
+
+	var tags []string
+	for _, topic := range s.Topics {
+		tags = append(tags, topic.Name)
+	}
+
+	series := TopicSeries{
+		Title:     s.Title,
+		Slug:      slug,
+		Path:      s.Path,
+		TopicName: topicName,
+
+		Tags:       tags,
+		Difficulty: s.Difficulty,
+		Archived:   s.Archived,
+	}
+	if s.EpisodeCount != nil {
+		series.EpisodeCount = *s.EpisodeCount
+		series.Unreleased = *s.EpisodeCount == 0
+	}
+	return series
+}
+
+func (Laracasts) ParseSeries(pageData string) (*SeriesMetadata, error) {
+	var rawData struct {
+		Props struct {
+			Series struct {
+				Title       string `json:"title"`
+				Description string `json:"description"`
+				Excerpt     string `json:"excerpt"`
+				Author      struct {
+					Name string `json:"name"`
+				} `json:"author"`
+				Difficulty string  `json:"difficultyLevel"`
+				Archived   bool    `json:"archived"`
+				Topics     tagList `json:"topics"`
+				Tags       tagList `json:"tags"`
+				Chapters   []struct {
+					Title    string `json:"title"`
+					Episodes []struct {
+						Title       string  `json:"title"`
+						VimeoId     string  `json:"vimeoId"`
+						VimeoURL    string  `json:"vimeoUrl"` // signed player URL of private videos
+						Position    int     `json:"position"`
+						Length      int     `json:"length"`
+						PublishedAt string  `json:"publishedAt"`
+						Difficulty  string  `json:"difficulty"`
+						Tags        tagList `json:"tags"`
+						Author      struct {
+							Name string `json:"name"`
+						} `json:"author"`
+					} `json:"episodes"`
+				} `json:"chapters"`
+			} `json:"series"`
+		} `json:"props"`
+	}
+
+	if err := json.Unmarshal([]byte(pageData), &rawData); err != nil {
+		return nil, fmt.Errorf("failed to parse series data: %v", err)
+	}
+
+	series := rawData.Props.Series
+	seriesData := SeriesMetadata{
+		Title:       series.Title,
+		Description: series.Description,
+		Instructor:  series.Author.Name,
+		Difficulty:  series.Difficulty,
+		Tags:        mergeTags(series.Topics, series.Tags),
+		Archived:    series.Archived,
+	}
+	if seriesData.Description == "" {
+		seriesData.Description = series.Excerpt
+	}
+
+	for _, chapter := range series.Chapters {
+		seriesData.EpisodeCount += len(chapter.Episodes)
+
+		var episodes []Episode
+		for _, ep := range chapter.Episodes {
+			if ep.VimeoId != "" {
+				// Episodes inherit the labels of their series
+				difficulty := ep.Difficulty
+				if difficulty == "" {
+					difficulty = seriesData.Difficulty
+				}
+				instructor := ep.Author.Name
+				if instructor == "" {
+					instructor = seriesData.Instructor
+				}
+				episodes = append(episodes, Episode{
+					Title:       ep.Title,
+					VimeoId:     ep.VimeoId,
+					VimeoHash:   vimeo.PlayerHash(ep.VimeoURL),
+					Number:      ep.Position,
+					Length:      ep.Length,
+					PublishedAt: parsePublishedAt(ep.PublishedAt),
+					Tags:        mergeTags(seriesData.Tags, ep.Tags),
+					Difficulty:  difficulty,
+					Instructor:  instructor,
+				})
+			}
+		}
+
+		seriesData.Chapters = append(seriesData.Chapters, Chapter{
+			Title:    chapter.Title,
+			Episodes: episodes,
+		})
+	}
+	return &seriesData, nil
+}
@@ -0,0 +1,101 @@
+package downloader_test
+
+import (
+	"github.com/sajjadanwar0/laracasts-dl/internal/downloader"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// academySite is a community adapter of a sibling site sharing the
+// Laracasts props schema, which counts the series pages it parsed
+type academySite struct {
+	downloader.Laracasts
+	parsed *atomic.Int32
+}
+
+func (academySite) Name() string { return "academy" }
+
+func (s academySite) ParseSeries(pageData string) (*downloader.SeriesMetadata, error) {
+	s.parsed.Add(1)
+	return s.Laracasts.ParseSeries(pageData)
+}
+
+func TestDownloadSeriesWithSiteAdapter(t *testing.T) {
+	newMockLaracasts(t)
+	downloadPath := t.TempDir()
+
+	var parsed atomic.Int32
+	downloader.RegisterSite(academySite{parsed: &parsed})
+	t.Setenv("SITE", "academy")
+
+	dl := newTestDownloader(t, downloadPath)
+	if got := dl.Site.Name(); got != "academy" {
+		t.Fatalf("Site = %q, want academy", got)
+	}
+	if err := dl.Login(mockEmail, mockPassword); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+
+	if parsed.Load() == 0 {
+		t.Error("series page not parsed by the adapter")
+	}
+	if _, err := os.Stat(filepath.Join(downloadPath, "laravel-basics", "03-controllers.mp4")); err != nil {
+		t.Errorf("episode not downloaded: %v", err)
+	}
+}
+
+func TestNewRejectsUnknownSite(t *testing.T) {
+	t.Setenv("SITE", "no-such-site")
+	t.Setenv("DOWNLOAD_PATH", t.TempDir())
+
+	_, err := downloader.New()
+	if err == nil || !strings.Contains(err.Error(), "laracasts") {
+		t.Errorf("New() error = %v, want the available sites listed", err)
+	}
+}
+
+func TestLaracastsParseTopicSeriesStreamsProps(t *testing.T) {
+	// Props the parser does not read come before and after the topic, and
+	// the topic's path follows its series
+	page := `{"component": "Topics/Show", "props": {
+		"auth": {"signedIn": true, "user": {"name": "Jeffrey", "tags": [[1, 2], {"a": [3]}]}},
+		"topic": {
+			"name": "Laravel",
+			"series": [
+				{"title": "Laravel Basics", "slug": "laravel-basics", "path": "/series/laravel-basics", "episodeCount": 3, "topics": [{"name": "Laravel"}]},
+				{"title": "Laravel Basics", "slug": "laravel-basics", "path": "/series/laravel-basics"},
+				{"title": "", "slug": "untitled"},
+				{"title": "Pest", "slug": "pest"}
+			],
+			"path": "/topics/laravel"
+		},
+		"footer": {"links": ["a", "b"]}
+	}, "version": "4f1c2a"}`
+
+	var site downloader.Laracasts
+	series, err := site.ParseTopicSeries(page, "Laravel")
+	if err != nil {
+		t.Fatalf("ParseTopicSeries() error = %v", err)
+	}
+	want := []downloader.TopicSeries{
+		{Title: "Laravel Basics", Slug: "series/laravel-basics", Path: "/series/laravel-basics", TopicPath: "/topics/laravel", TopicName: "Laravel", EpisodeCount: 3, Tags: []string{"Laravel"}},
+		{Title: "Pest", Slug: "series/pest", TopicPath: "/topics/laravel", TopicName: "Laravel"},
+	}
+	if !reflect.DeepEqual(series, want) {
+		t.Errorf("ParseTopicSeries() = %+v, want %+v", series, want)
+	}
+
+	if _, err := site.ParseTopicSeries(`{"props": {"topic": {"series": [{"title": `, "Laravel"); err == nil {
+		t.Error("ParseTopicSeries() accepted truncated page data")
+	}
+	if topics, err := site.ParseTopics(`{"props": {"topics": null}}`); err != nil || len(topics) != 0 {
+		t.Errorf("ParseTopics() of no topics = %v, %v", topics, err)
+	}
+}
@@ -0,0 +1,75 @@
+package downloader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// sizeTolerance is the fraction by which a local video may differ from the
+// remote file before it is reported as possibly outdated or corrupt
+const sizeTolerance = 0.01
+
+// checkSizes compares the quality variants of outputPath on disk with the size
+// of the file Vimeo serves for them, reporting the ones that differ. With
+// RedownloadMismatched the mismatched files are removed and true is returned,
+// so the caller downloads them again.
+func (d *Downloader) checkSizes(title, vimeoId, outputPath string) bool {
+	remoteSizes, fetched, err := d.sizes.sizesOf(vimeoId)
+	if err != nil {
+		// The file is still usable, its size just cannot be checked
+		fmt.Printf("Warning: Failed to check size of %s: %v\n", filepath.Base(outputPath), err)
+		return false
+	}
+	if fetched {
+		d.sizes.save()
+	}
+
+	removed := false
+	for _, v := range d.variants(outputPath) {
+		// Only the progressive path is compared, an mkv stream fallback is
+		// remuxed by ffmpeg and never matches the progressive file in size
+		info, err := os.Stat(v.Path)
+		if err != nil {
+			continue
+		}
+
+		remote := remoteSizes[v.Quality]
+		if remote == 0 || !sizesDiffer(info.Size(), remote) {
+			continue
+		}
+
+		mismatch := Mismatch{Title: title, Path: d.relativePath(v.Path), LocalSize: info.Size(), RemoteSize: remote}
+		if d.RedownloadMismatched {
+			if err := d.trash(v.Path); err != nil {
+				fmt.Printf("Warning: Failed to remove %s: %v\n", mismatch.Path, err)
+			} else {
+				mismatch.Redownloaded = true
+				removed = true
+			}
+		}
+		d.Report.AddMismatch(mismatch)
+
+		fmt.Printf("⚠️  %s is %s locally but %s remotely\n", mismatch.Path,
+			formatBytes(mismatch.LocalSize), formatBytes(mismatch.RemoteSize))
+	}
+	return removed
+}
+
+// sizesDiffer reports whether local and remote differ by more than sizeTolerance
+func sizesDiffer(local, remote int64) bool {
+	diff := local - remote
+	if diff < 0 {
+		diff = -diff
+	}
+	return float64(diff) > float64(remote)*sizeTolerance
+}
+
+// relativePath returns path relative to the download directory when it is
+// inside it
+func (d *Downloader) relativePath(path string) string {
+	if rel, err := filepath.Rel(d.BasePath, path); err == nil && filepath.IsLocal(rel) {
+		return rel
+	}
+	return path
+}
@@ -0,0 +1,93 @@
+package downloader_test
+
+import (
+	"bytes"
+	"github.com/sajjadanwar0/laracasts-dl/internal/downloader"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownloadSeriesReportsSizeMismatch(t *testing.T) {
+	newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+
+	// A truncated copy left behind by another tool
+	episodePath := filepath.Join(downloadPath, "laravel-basics", "01-introduction-to-laravel.mp4")
+	if err := os.MkdirAll(filepath.Dir(episodePath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(episodePath, mockVideo("1001-1080.mp4")[:mockVideoSize/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+	if len(dl.Report.Mismatches) != 1 || dl.Report.Mismatches[0].Redownloaded {
+		t.Fatalf("Mismatches = %+v, want the truncated episode reported", dl.Report.Mismatches)
+	}
+	if info, _ := os.Stat(episodePath); info.Size() != mockVideoSize/2 {
+		t.Error("mismatched episode was replaced without -redownload-mismatched")
+	}
+
+	redownload := newTestDownloader(t, downloadPath)
+	redownload.RedownloadMismatched = true
+	if err := redownload.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+	if len(redownload.Report.Mismatches) != 1 || !redownload.Report.Mismatches[0].Redownloaded {
+		t.Errorf("Mismatches = %+v, want the truncated episode redownloaded", redownload.Report.Mismatches)
+	}
+	got, err := os.ReadFile(episodePath)
+	if err != nil || !bytes.Equal(got, mockVideo("1001-1080.mp4")) {
+		t.Error("mismatched episode was not redownloaded")
+	}
+
+	// The replaced copy is kept in the trash until it is emptied
+	trashed, _ := filepath.Glob(filepath.Join(downloadPath, downloader.TrashDir, "*", "laravel-basics", "01-introduction-to-laravel.mp4"))
+	if len(trashed) != 1 {
+		t.Fatalf("trashed copies = %v, want the replaced episode", trashed)
+	}
+	if info, err := os.Stat(trashed[0]); err != nil || info.Size() != mockVideoSize/2 {
+		t.Errorf("trashed copy is not the replaced episode: %v", err)
+	}
+	files, _, err := redownload.EmptyTrash()
+	if err != nil || files != 1 {
+		t.Errorf("EmptyTrash() = %d files, %v, want 1", files, err)
+	}
+	if _, err := os.Stat(trashed[0]); !os.IsNotExist(err) {
+		t.Errorf("trashed copy still exists after EmptyTrash(): %v", err)
+	}
+}
+
+func TestRedownloadMismatchedReusesProbedSizes(t *testing.T) {
+	server := newMockLaracasts(t)
+	downloadPath := t.TempDir()
+
+	dl := signedInDownloader(t, downloadPath)
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+
+	check := func() int {
+		before := server.HitsWithPrefix("HEAD", "/files/")
+		checker := newTestDownloader(t, downloadPath)
+		checker.RedownloadMismatched = true
+		if err := checker.DownloadSeries("laravel-basics"); err != nil {
+			t.Fatalf("DownloadSeries() error = %v", err)
+		}
+		if len(checker.Report.Mismatches) != 0 {
+			t.Errorf("Mismatches = %+v, want none", checker.Report.Mismatches)
+		}
+		return server.HitsWithPrefix("HEAD", "/files/") - before
+	}
+
+	if probed := check(); probed != 3 {
+		t.Errorf("first check made %d HEAD requests, want one per episode", probed)
+	}
+	if probed := check(); probed != 0 {
+		t.Errorf("second check made %d HEAD requests, want the cached sizes reused", probed)
+	}
+}
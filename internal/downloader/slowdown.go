@@ -0,0 +1,64 @@
+package downloader
+
+import "path/filepath"
+
+// SlowdownFailureRatio is the share of the episodes attempted in a pass that
+// may fail before the failed ones are retried with half the episode workers
+// and chunk requests. On weak connections most of those failures are caused
+// by the parallel requests themselves.
+const SlowdownFailureRatio = 0.25
+
+// slowDown halves the episode workers and chunk requests of the series saved
+// to outputDir once more when more than SlowdownFailureRatio of attempted
+// episodes failed for the connection, reporting false when the failures stay
+// below it or the series is downloading sequentially already
+func (d *Downloader) slowDown(outputDir string, failures []Failure, attempted int) bool {
+	failed := 0
+	for _, failure := range failures {
+		if failure.Category == FailureNetwork || failure.Category == FailureRateLimited {
+			failed++
+		}
+	}
+	if attempted == 0 || float64(failed)/float64(attempted) <= SlowdownFailureRatio {
+		return false
+	}
+	if d.seriesWorkers(outputDir) == 1 && d.seriesChunks(outputDir) == 1 {
+		return false
+	}
+
+	halvings, _ := d.slowdowns.Load(outputDir)
+	n, _ := halvings.(int)
+	d.slowdowns.Store(outputDir, n+1)
+	return true
+}
+
+// slowedDown reports whether the series saved to outputDir was slowed down
+func (d *Downloader) slowedDown(outputDir string) bool {
+	_, ok := d.slowdowns.Load(outputDir)
+	return ok
+}
+
+// seriesWorkers returns how many episodes of the series saved to outputDir
+// are downloaded at once
+func (d *Downloader) seriesWorkers(outputDir string) int {
+	halvings, _ := d.slowdowns.Load(outputDir)
+	n, _ := halvings.(int)
+	return max(d.episodeWorkers()>>n, 1)
+}
+
+// seriesChunks returns how many chunks of a video of the series saved to
+// outputDir are requested at once
+func (d *Downloader) seriesChunks(outputDir string) int {
+	halvings, _ := d.slowdowns.Load(outputDir)
+	n, _ := halvings.(int)
+	return max(d.Vimeo.ChunkWorkers>>n, 1)
+}
+
+// chunkLimit is the vimeo ChunkLimit: the chunk requests of the series the
+// video at path belongs to, or zero for the default of series not slowed down
+func (d *Downloader) chunkLimit(path string) int {
+	if !d.slowedDown(filepath.Dir(path)) {
+		return 0
+	}
+	return d.seriesChunks(filepath.Dir(path))
+}
@@ -0,0 +1,167 @@
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// activity tracks what the run is doing right now, for status dumps
+type activity struct {
+	mu      sync.Mutex
+	started time.Time
+	series  map[string]*activeSeries // by slug
+	videos  map[string]*activeVideo  // by output path
+	queued  func() int               // series waiting in a bulk download
+	dumped  time.Time                // when the last status was written
+	bytes   int64                    // received by then
+}
+
+// activeSeries is a series being downloaded
+type activeSeries struct {
+	title   string
+	started time.Time
+}
+
+// activeVideo is a video being downloaded
+type activeVideo struct {
+	started     time.Time
+	done, total int64 // bytes, total is 0 until known
+}
+
+func newActivity() *activity {
+	return &activity{
+		started: time.Now(),
+		series:  make(map[string]*activeSeries),
+		videos:  make(map[string]*activeVideo),
+	}
+}
+
+// startSeries records a series being downloaded until the returned func is
+// called; series sharing a title are told apart by slug
+func (a *activity) startSeries(slug, title string) func() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.series[slug] = &activeSeries{title: title, started: time.Now()}
+	return func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		delete(a.series, slug)
+	}
+}
+
+// startVideo records a video being downloaded to path until the returned
+// func is called
+func (a *activity) startVideo(path string) func() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.videos[path] = &activeVideo{started: time.Now()}
+	return func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		delete(a.videos, path)
+	}
+}
+
+// progress records the bytes saved so far of the video downloaded to path
+func (a *activity) progress(path string, done, total int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if v := a.videos[path]; v != nil {
+		v.done, v.total = done, total
+	}
+}
+
+// setQueue makes status dumps report the series waiting as queued returns
+// them, nil once the bulk download is over
+func (a *activity) setQueue(queued func() int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.queued = queued
+}
+
+// videoProgress records the progress of a download for status dumps and
+// passes it on to the webhook
+func (d *Downloader) videoProgress(outputPath string, done, total int64) {
+	d.activity.progress(outputPath, done, total)
+	if d.Webhook != nil {
+		d.Webhook.Progress(outputPath, done, total)
+	}
+}
+
+// WriteStatus writes a snapshot of the run to w: the series and videos being
+// downloaded, the series queued, the transfer rate and the failures so far
+func (d *Downloader) WriteStatus(w io.Writer) {
+	// Copied under the lock and written without it, so a slow writer never
+	// holds up the downloads reporting their progress
+	a := d.activity
+	a.mu.Lock()
+	started, queued, dumped, dumpedBytes := a.started, a.queued, a.dumped, a.bytes
+	series := make(map[string]activeSeries, len(a.series))
+	for slug, s := range a.series {
+		series[slug] = *s
+	}
+	videos := make(map[string]activeVideo, len(a.videos))
+	for path, v := range a.videos {
+		videos[path] = *v
+	}
+	a.mu.Unlock()
+
+	now := time.Now()
+	fmt.Fprintf(w, "\n=== Status at %s, running for %s ===\n", now.Format("15:04:05"), now.Sub(started).Round(time.Second))
+
+	fmt.Fprintf(w, "Series downloading: %d of %d workers\n", len(series), d.Concurrency.Series)
+	for _, slug := range sortedKeys(series) {
+		fmt.Fprintf(w, "  - %s (%s)\n", series[slug].title, now.Sub(series[slug].started).Round(time.Second))
+	}
+	if queued != nil {
+		fmt.Fprintf(w, "Series queued: %d\n", queued())
+	}
+
+	fmt.Fprintf(w, "Videos downloading: %d, up to %d per series\n", len(videos), d.episodeWorkers())
+	for _, path := range sortedKeys(videos) {
+		v := videos[path]
+		progress := "waiting for the first chunk"
+		if v.total > 0 {
+			progress = fmt.Sprintf("%d%%, %s of %s", v.done*100/v.total, formatBytes(v.done), formatBytes(v.total))
+		}
+		fmt.Fprintf(w, "  - %s: %s (%s)\n", d.relativePath(path), progress, now.Sub(v.started).Round(time.Second))
+	}
+
+	received := d.usage.run.Load()
+	average := float64(received) / max(now.Sub(started).Seconds(), 1)
+	fmt.Fprintf(w, "Received: %s, %s/s on average", formatBytes(received), formatBytes(int64(average)))
+	if !dumped.IsZero() {
+		recent := float64(received-dumpedBytes) / max(now.Sub(dumped).Seconds(), 1)
+		fmt.Fprintf(w, ", %s/s since the last status", formatBytes(int64(recent)))
+	}
+	fmt.Fprintln(w)
+	a.mu.Lock()
+	a.dumped, a.bytes = now, received
+	a.mu.Unlock()
+
+	d.Report.mu.Lock()
+	failures := append([]Failure(nil), d.Report.Failures...)
+	d.Report.mu.Unlock()
+	fmt.Fprintf(w, "Failures so far: %d\n", len(failures))
+	for _, f := range failures[max(len(failures)-statusFailureLimit, 0):] {
+		fmt.Fprintf(w, "  - [%s] %s (vimeo %s): %s\n", f.Source, f.Title, f.VimeoId, f.Reason)
+	}
+
+	fmt.Fprintf(w, "Goroutines: %d\n", runtime.NumGoroutine())
+}
+
+// statusFailureLimit caps the latest failures a status dump lists
+const statusFailureLimit = 10
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,6 @@
+//go:build !unix
+
+package downloader
+
+// DumpStatusOnSignal does nothing where there is no SIGUSR1
+func (d *Downloader) DumpStatusOnSignal() {}
@@ -0,0 +1,30 @@
+package downloader_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteStatusDuringDownload(t *testing.T) {
+	server := newMockLaracasts(t)
+	server.stallFile = "1002-1080.mp4"
+	server.stalled, server.release = make(chan struct{}, 1), make(chan struct{})
+	dl := signedInDownloader(t, t.TempDir())
+	done := make(chan error, 1)
+	go func() { done <- dl.DownloadSeries("laravel-basics") }()
+
+	<-server.stalled
+	var status bytes.Buffer
+	dl.WriteStatus(&status)
+	close(server.release)
+	if err := <-done; err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+
+	for _, want := range []string{"Series downloading: 1 of", "  - Laravel Basics (", "Videos downloading: ", "02-routing-basics.mp4", "Failures so far: 0"} {
+		if !strings.Contains(status.String(), want) {
+			t.Errorf("status does not contain %q:\n%s", want, status.String())
+		}
+	}
+}
@@ -0,0 +1,21 @@
+//go:build unix
+
+package downloader
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// DumpStatusOnSignal writes the status of the run to stderr every time the
+// process receives SIGUSR1, e.g. from kill -USR1 <pid>
+func (d *Downloader) DumpStatusOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+	go func() {
+		for range signals {
+			d.WriteStatus(os.Stderr)
+		}
+	}()
+}
@@ -0,0 +1,299 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/config"
+	"github.com/sajjadanwar0/laracasts-dl/internal/vimeo"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// headerTransport sends the browser fingerprint of the session with every
+// request and adds user-configured headers to those sent to the site,
+// overriding the defaults set by individual requests
+type headerTransport struct {
+	base        http.RoundTripper
+	site        Site
+	fingerprint map[string]string
+	headers     map[string]string
+
+	// blocked is called when the site refuses a request as a bot
+	blocked func()
+
+	// clock is measured against the first response of the site
+	clock *clockSkew
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	onSite := isSiteHost(req.URL, t.site)
+
+	req = req.Clone(req.Context())
+	for k, v := range t.fingerprint {
+		req.Header.Set(k, v)
+	}
+	if onSite {
+		for k, v := range t.headers {
+			req.Header.Set(k, v)
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err == nil && onSite {
+		t.clock.observe(resp)
+	}
+	if err == nil && onSite && t.blocked != nil && isBotBlock(resp) {
+		t.blocked()
+	}
+	return resp, err
+}
+
+// isBotBlock reports whether resp is Cloudflare refusing the client rather
+// than Laracasts denying access to a page
+func isBotBlock(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusForbidden {
+		return false
+	}
+	return resp.Header.Get("Cf-Mitigated") != "" || strings.EqualFold(resp.Header.Get("Server"), "cloudflare")
+}
+
+// mirrorTransport retries failed GET requests to the site through the
+// configured mirrors, in order. The route that last worked is tried first so
+// a misbehaving edge is not hit on every request.
+type mirrorTransport struct {
+	routes    []mirrorRoute // the direct route followed by the mirrors
+	site      Site
+	preferred atomic.Int32
+}
+
+type mirrorRoute struct {
+	name      string
+	transport http.RoundTripper
+	baseURL   *url.URL // rewrite requests to this base URL, keeping the Host header
+}
+
+// newMirrorTransport wraps base with failover through mirrors
+func newMirrorTransport(base *http.Transport, mirrors []config.Mirror, site Site) *mirrorTransport {
+	t := &mirrorTransport{routes: []mirrorRoute{{name: "direct", transport: base}}, site: site}
+
+	for _, m := range mirrors {
+		route := mirrorRoute{name: m.String(), transport: base, baseURL: m.BaseURL}
+		if m.Address != "" {
+			route.transport = pinnedTransport(base, m.Address, site)
+		}
+		t.routes = append(t.routes, route)
+	}
+	return t
+}
+
+// pinnedTransport dials address for connections to the site, so TLS and the
+// Host header still use the real hostname
+func pinnedTransport(base *http.Transport, address string, site Site) *http.Transport {
+	pinned := base.Clone()
+	dial := base.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	}
+
+	pinned.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err == nil && isSiteHost(&url.URL{Host: host}, site) {
+			addr = address
+			if _, _, err := net.SplitHostPort(address); err != nil {
+				addr = net.JoinHostPort(address, port)
+			}
+		}
+		return dial(ctx, network, addr)
+	}
+	return pinned
+}
+
+// networkDialer dials over the address family pref selects for each host,
+// working around dual-stack routes that are broken one way. With auto, IPv6
+// gets the preference's fallback delay before IPv4 is raced against it.
+func networkDialer(pref config.NetworkPreference) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, FallbackDelay: pref.FallbackDelay}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if network == "tcp" {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				host = addr
+			}
+			switch pref.For(host) {
+			case config.NetworkIPv4:
+				network = "tcp4"
+			case config.NetworkIPv6:
+				network = "tcp6"
+			}
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+}
+
+func (t *mirrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	direct := t.routes[0].transport
+	if len(t.routes) == 1 || !isSiteHost(req.URL, t.site) || (req.Method != "GET" && req.Method != "HEAD") {
+		return direct.RoundTrip(req)
+	}
+
+	start := int(t.preferred.Load())
+	var resp *http.Response
+	var err error
+
+	for i := range t.routes {
+		idx := (start + i) % len(t.routes)
+		route := t.routes[idx]
+
+		if i > 0 {
+			fmt.Printf("Laracasts request failed (%s), trying %s\n", failureReason(resp, err), route.name)
+			if resp != nil {
+				resp.Body.Close()
+			}
+		}
+
+		resp, err = route.transport.RoundTrip(route.rewrite(req))
+		if err == nil && resp.StatusCode < 500 {
+			t.preferred.Store(int32(idx))
+			return resp, nil
+		}
+	}
+	return resp, err
+}
+
+// rewrite points req at the route's base URL, pinning the original Host
+func (r mirrorRoute) rewrite(req *http.Request) *http.Request {
+	if r.baseURL == nil {
+		return req
+	}
+
+	req = req.Clone(req.Context())
+	req.Host = req.URL.Host
+	req.URL.Scheme = r.baseURL.Scheme
+	req.URL.Host = r.baseURL.Host
+	return req
+}
+
+func failureReason(resp *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return resp.Status
+}
+
+// compressionTransport lets Laracasts pages and Vimeo player configs, which
+// compress well, be fetched gzipped, while video transfers go through a
+// transport with compression disabled: ranged requests must count bytes of
+// the file itself, and videos do not shrink anyway
+type compressionTransport struct {
+	metadata http.RoundTripper
+	video    http.RoundTripper
+	site     Site
+}
+
+func (t *compressionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Range") != "" || !isMetadataHost(req.URL, t.site) {
+		return t.video.RoundTrip(req)
+	}
+	return t.metadata.RoundTrip(req)
+}
+
+// isMetadataHost reports whether u points at the site or the Vimeo player,
+// rather than the CDN serving the video files
+func isMetadataHost(u *url.URL, site Site) bool {
+	if isSiteHost(u, site) {
+		return true
+	}
+	player, err := url.Parse(fmt.Sprintf(vimeo.PlayerConfigURL, "0"))
+	return err == nil && u.Host == player.Host
+}
+
+// deadlineTransport bounds a request, reading its body included, by timeout.
+// Unlike http.Client.Timeout its clock starts when the request is sent, so
+// the wait of politeTransport in front of it does not count.
+type deadlineTransport struct {
+	base    http.RoundTripper
+	timeout time.Duration
+}
+
+func (t *deadlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody releases the deadline of its request once closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// politeTransport spaces out the requests sent to each host as the
+// politeness policy asks, however many workers send them
+type politeTransport struct {
+	base   http.RoundTripper
+	policy config.Politeness
+
+	mu   sync.Mutex
+	next map[string]time.Time // earliest time of the next request per host
+}
+
+func newPoliteTransport(base http.RoundTripper, policy config.Politeness) *politeTransport {
+	return &politeTransport{base: base, policy: policy, next: make(map[string]time.Time)}
+}
+
+func (t *politeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if wait := t.reserve(req.URL.Hostname()); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, req.Context().Err()
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// reserve claims the next free slot for a request to host and returns how
+// long to wait for it
+func (t *politeTransport) reserve(host string) time.Duration {
+	delay, jitter := t.policy.For(host)
+	if delay <= 0 {
+		return 0
+	}
+	if jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(jitter)))
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	slot := t.next[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	t.next[host] = slot.Add(delay)
+	return slot.Sub(now)
+}
@@ -0,0 +1,121 @@
+package downloader
+
+import (
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/fsutil"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// TrashDir holds the videos a run removed or replaced, in the download path
+	TrashDir = ".trash"
+
+	// trashBatchLayout names the folder of the videos trashed by one run
+	trashBatchLayout = "2006-01-02T15-04-05"
+)
+
+// trash moves path, a video or folder about to be removed or replaced, into
+// the trash under its path relative to the download path, instead of deleting
+// it. Batches older than TrashRetention are emptied the first time something
+// is trashed; without a retention path is deleted right away.
+func (d *Downloader) trash(path string) error {
+	if d.TrashRetention <= 0 {
+		return os.RemoveAll(path)
+	}
+
+	d.trashOnce.Do(func() {
+		d.trashBatch = filepath.Join(d.BasePath, TrashDir, time.Now().Format(trashBatchLayout))
+		if _, _, err := d.emptyTrash(time.Now().Add(-d.TrashRetention)); err != nil {
+			fmt.Printf("Warning: Failed to empty expired trash: %v\n", err)
+		}
+	})
+
+	rel := d.relativePath(path)
+	if filepath.IsAbs(rel) {
+		rel = filepath.Base(path)
+	}
+	target := filepath.Join(d.trashBatch, rel)
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(target); os.IsNotExist(err) {
+			break
+		}
+		target = fmt.Sprintf("%s.%d", filepath.Join(d.trashBatch, rel), i)
+	}
+
+	if err := fsutil.MkdirAll(filepath.Dir(target)); err != nil {
+		return err
+	}
+	if err := os.Rename(path, target); err != nil {
+		return err
+	}
+	fmt.Printf("🗑️  Moved %s to %s\n", rel, d.relativePath(target))
+	return nil
+}
+
+// trashVideos moves every quality variant of the video at outputPath to the
+// trash, for it to be downloaded again
+func (d *Downloader) trashVideos(outputPath string) {
+	for _, v := range d.variants(outputPath) {
+		if path, ok := d.existingVideo(v.Path); ok {
+			if err := d.trash(path); err != nil {
+				fmt.Printf("Warning: Failed to remove %s: %v\n", d.relativePath(path), err)
+			}
+		}
+	}
+}
+
+// EmptyTrash deletes everything in the trash, returning the number of files
+// and bytes freed
+func (d *Downloader) EmptyTrash() (int, int64, error) {
+	return d.emptyTrash(time.Time{})
+}
+
+// emptyTrash deletes the batches trashed before cutoff, or all of them when
+// cutoff is zero
+func (d *Downloader) emptyTrash(cutoff time.Time) (int, int64, error) {
+	trashDir := filepath.Join(d.BasePath, TrashDir)
+	entries, err := os.ReadDir(trashDir)
+	if os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var files int
+	var bytes int64
+	for _, entry := range entries {
+		if !cutoff.IsZero() {
+			trashed, err := time.ParseInLocation(trashBatchLayout, entry.Name(), time.Local)
+			if err != nil {
+				// Not a batch of ours, fall back to its modification time
+				info, err := entry.Info()
+				if err != nil {
+					continue
+				}
+				trashed = info.ModTime()
+			}
+			if !trashed.Before(cutoff) {
+				continue
+			}
+		}
+
+		batch := filepath.Join(trashDir, entry.Name())
+		_ = filepath.WalkDir(batch, func(path string, entry fs.DirEntry, err error) error {
+			if err == nil && !entry.IsDir() {
+				if info, err := entry.Info(); err == nil {
+					files++
+					bytes += info.Size()
+				}
+			}
+			return nil
+		})
+		if err := os.RemoveAll(batch); err != nil {
+			return files, bytes, err
+		}
+	}
+	return files, bytes, nil
+}
@@ -0,0 +1,52 @@
+package downloader_test
+
+import (
+	"bytes"
+	"github.com/sajjadanwar0/laracasts-dl/internal/downloader"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestForceDownloadKeepsOldCopyUntilReplaced(t *testing.T) {
+	server := newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	t.Setenv("TRASH_RETENTION_DAYS", "0")
+	dl := signedInDownloader(t, downloadPath)
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+	seriesDir := filepath.Join(downloadPath, "laravel-basics")
+	for _, filename := range []string{"01-introduction-to-laravel.mp4", "02-routing-basics.mp4"} {
+		if err := os.WriteFile(filepath.Join(seriesDir, filename), []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The new copy of the second episode fails, its old one is not deleted
+	server.forbidFile = "1002-1080.mp4"
+	dl = newTestDownloader(t, downloadPath)
+	dl.ForceDownload = true
+	if err := dl.DownloadSeries("laravel-basics"); err == nil {
+		t.Fatal("DownloadSeries() error = nil, want the forbidden episode failed")
+	}
+	if got, _ := os.ReadFile(filepath.Join(seriesDir, "01-introduction-to-laravel.mp4")); !bytes.Equal(got, mockVideo("1001-1080.mp4")) {
+		t.Error("ForceDownload did not replace the episode downloaded again")
+	}
+	if got, _ := os.ReadFile(filepath.Join(seriesDir, "02-routing-basics.mp4")); string(got) != "old" {
+		t.Errorf("failed episode = %q, want its old copy kept", got)
+	}
+	if _, err := os.Stat(filepath.Join(seriesDir, downloader.StagingPrefix+"01-introduction-to-laravel.mp4")); !os.IsNotExist(err) {
+		t.Errorf("staging folder of the replaced episode left behind: %v", err)
+	}
+
+	// Still completed, a normal run keeps the old copy
+	server.forbidFile = ""
+	dl = newTestDownloader(t, downloadPath)
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(seriesDir, "02-routing-basics.mp4")); string(got) != "old" {
+		t.Errorf("episode = %q after a normal run, want the old copy kept", got)
+	}
+}
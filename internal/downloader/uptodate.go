@@ -0,0 +1,65 @@
+package downloader
+
+import (
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/config"
+	"path/filepath"
+	"time"
+)
+
+// seriesUpToDate reports whether the series listed as s has nothing to
+// download into seriesDir, judged without a request: the cached metadata is
+// not outdated given the episode count of the listing (see metadataOutdated),
+// and every selected episode is completed and on disk, or was deleted on
+// purpose. It returns a row for the report when it is.
+//
+// Anything the check cannot vouch for, like sizes to compare or metadata to
+// refresh, leaves the series to the full sync.
+func (d *Downloader) seriesUpToDate(s TopicSeries, seriesDir string) (SeriesResult, bool) {
+	if s.EpisodeCount == 0 || d.ForceDownload || d.RefreshMetadata || d.NoCache || d.RedownloadMismatched {
+		return SeriesResult{}, false
+	}
+
+	slug := checkpointSlug(s.Slug)
+	var seriesData SeriesMetadata
+	if found, err := d.Cache.Get("series_"+slug, &seriesData); err != nil || !found || d.metadataOutdated("series_"+slug, &seriesData, s.EpisodeCount) {
+		return SeriesResult{}, false
+	}
+
+	state, err := d.loadDownloadState(slug)
+	if err != nil {
+		return SeriesResult{}, false
+	}
+	if dir, err := filepath.Abs(seriesDir); err != nil || state.Dir != dir {
+		return SeriesResult{}, false
+	}
+
+	disambiguateFilenames(&seriesData)
+	result := SeriesResult{Title: seriesData.Title, Slug: slug}
+	now := time.Now()
+	for chapterIdx, chapter := range seriesData.Chapters {
+		for _, episode := range chapter.Episodes {
+			result.Total++
+			if !d.Filter.AllowsChapter(chapterIdx+1) || !d.Filter.Allows(episode, now) {
+				result.Filtered++
+				continue
+			}
+			if !state.Completed[episode.VimeoId] {
+				return SeriesResult{}, false
+			}
+			onDisk := d.variantsExist(filepath.Join(seriesDir, episodeFilename(episode)))
+			deleted := state.Deleted[episode.VimeoId] && d.DeletedPolicy != config.DeletedPolicyRedownload
+			if !onDisk && !deleted {
+				return SeriesResult{}, false
+			}
+			result.Existing++
+		}
+	}
+	return result, true
+}
+
+// printUpToDate ends a sync that found every series up to date
+func printUpToDate(series int, started time.Time) {
+	fmt.Printf("\n✨ Library up to date: %d series checked in %s, nothing to download\n",
+		series, time.Since(started).Round(time.Millisecond))
+}
@@ -0,0 +1,197 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// usageMonthLayout keys the bytes downloaded per calendar month in the catalog
+const usageMonthLayout = "2006-01"
+
+// UsageSaveInterval is how often a run adds what it downloaded to the
+// catalog, so a crash loses little of the month's usage
+var UsageSaveInterval = time.Minute
+
+// ErrMonthlyCapReached is returned for videos not downloaded because
+// MAX_MONTHLY_GB was used up this month
+var ErrMonthlyCapReached = errors.New("monthly download cap reached")
+
+// usageMeter counts the bytes every response of the run brings in, so a
+// monthly cap holds for metered connections, pages and retries included.
+// Pages count at their uncompressed size; streams ffmpeg fetches itself are
+// not counted. Bytes count toward the month they were received in, so a run
+// spanning the turn of a month splits its usage.
+type usageMeter struct {
+	cap int64 // bytes allowed per month, 0 without a cap
+
+	mu       sync.Mutex
+	month    string           // the month previous was loaded for
+	previous int64            // bytes of month recorded in the catalog
+	unsaved  map[string]int64 // bytes per month not in the catalog yet
+	savedAt  time.Time
+
+	run atomic.Int64 // bytes received by this run
+}
+
+func newUsageMeter(cap int64) *usageMeter {
+	return &usageMeter{cap: cap, unsaved: make(map[string]int64), savedAt: time.Now()}
+}
+
+// add counts n bytes received now
+func (m *usageMeter) add(n int) {
+	if n <= 0 {
+		return
+	}
+	m.run.Add(int64(n))
+	month := time.Now().Format(usageMonthLayout)
+	m.mu.Lock()
+	m.unsaved[month] += int64(n)
+	m.mu.Unlock()
+}
+
+// usageExceeded reports whether the month's cap is used up, saving the usage
+// first when it was not saved for a while
+func (d *Downloader) usageExceeded() bool {
+	d.usage.mu.Lock()
+	due := time.Since(d.usage.savedAt) >= UsageSaveInterval
+	if due {
+		// One worker saves, the others go on
+		d.usage.savedAt = time.Now()
+	}
+	d.usage.mu.Unlock()
+	if due {
+		if err := d.SaveUsage(); err != nil {
+			fmt.Printf("Warning: Failed to save usage: %v\n", err)
+		}
+	}
+
+	if d.usage.cap <= 0 {
+		return false
+	}
+	return d.monthUsage() >= d.usage.cap
+}
+
+// monthUsage returns the bytes downloaded this month, including this run
+func (d *Downloader) monthUsage() int64 {
+	month := time.Now().Format(usageMonthLayout)
+
+	d.usage.mu.Lock()
+	defer d.usage.mu.Unlock()
+	if d.usage.month != month {
+		d.usage.month, d.usage.previous = month, 0
+		if catalog, found, err := d.LoadCatalog(); err == nil && found {
+			d.usage.previous = catalog.Usage[month]
+		}
+	}
+	return d.usage.previous + d.usage.unsaved[month]
+}
+
+// SaveUsage adds the bytes downloaded by the run to the month's usage in the
+// catalog
+func (d *Downloader) SaveUsage() error {
+	lock, err := d.lockCatalog()
+	if err != nil {
+		return fmt.Errorf("failed to lock catalog: %w", err)
+	}
+	defer lock.Unlock()
+
+	catalog, found, err := d.LoadCatalog()
+	if err != nil {
+		return err
+	}
+	if !found {
+		catalog = &Catalog{}
+	}
+	if catalog.Usage == nil {
+		catalog.Usage = make(map[string]int64)
+	}
+
+	d.usage.mu.Lock()
+	defer d.usage.mu.Unlock()
+	d.usage.savedAt = time.Now()
+	if len(d.usage.unsaved) == 0 {
+		return nil
+	}
+	for month, bytes := range d.usage.unsaved {
+		catalog.Usage[month] += bytes
+	}
+	if err := d.Cache.Set(catalogCacheKey, catalog); err != nil {
+		return fmt.Errorf("failed to save catalog: %v", err)
+	}
+	clear(d.usage.unsaved)
+	d.usage.month = time.Now().Format(usageMonthLayout)
+	d.usage.previous = catalog.Usage[d.usage.month]
+	return nil
+}
+
+// MonthlyUsage is the data downloaded in one calendar month
+type MonthlyUsage struct {
+	Month string `json:"month"` // e.g. 2024-05
+	Bytes int64  `json:"bytes"`
+}
+
+// Usage returns the bytes downloaded per month, oldest first, including
+// this run
+func (d *Downloader) Usage() []MonthlyUsage {
+	months := make(map[string]int64)
+	if catalog, found, err := d.LoadCatalog(); err == nil && found {
+		for month, bytes := range catalog.Usage {
+			months[month] = bytes
+		}
+	}
+	d.usage.mu.Lock()
+	for month, bytes := range d.usage.unsaved {
+		months[month] += bytes
+	}
+	d.usage.mu.Unlock()
+
+	usage := make([]MonthlyUsage, 0, len(months))
+	for month, bytes := range months {
+		usage = append(usage, MonthlyUsage{Month: month, Bytes: bytes})
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Month < usage[j].Month })
+	return usage
+}
+
+// PrintUsage writes the bytes downloaded per month and the cap
+func (d *Downloader) PrintUsage() {
+	for _, u := range d.Usage() {
+		fmt.Printf("%s  %10s\n", u.Month, formatBytes(u.Bytes))
+	}
+	if d.usage.cap > 0 {
+		used := d.monthUsage()
+		fmt.Printf("\nMonthly cap: %s, %s left this month\n", formatBytes(d.usage.cap), formatBytes(max(d.usage.cap-used, 0)))
+	}
+}
+
+// usageTransport counts the bytes of every response body read through it
+type usageTransport struct {
+	base  http.RoundTripper
+	meter *usageMeter
+}
+
+func (t *usageTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &usageBody{ReadCloser: resp.Body, meter: t.meter}
+	return resp, nil
+}
+
+type usageBody struct {
+	io.ReadCloser
+	meter *usageMeter
+}
+
+func (b *usageBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.meter.add(n)
+	return n, err
+}
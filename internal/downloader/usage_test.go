@@ -0,0 +1,65 @@
+package downloader_test
+
+import (
+	"github.com/sajjadanwar0/laracasts-dl/internal/downloader"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMonthlyUsageCapPausesDownloads(t *testing.T) {
+	newMockLaracasts(t)
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+	if err := dl.SaveUsage(); err != nil {
+		t.Fatalf("SaveUsage() error = %v", err)
+	}
+
+	month := time.Now().Format("2006-01")
+	reloaded := newTestDownloader(t, downloadPath)
+	usage := reloaded.Usage()
+	if len(usage) != 1 || usage[0].Month != month || usage[0].Bytes < 3*mockVideoSize {
+		t.Fatalf("Usage() = %+v, want the 3 episodes counted in %s", usage, month)
+	}
+
+	// A month already over the cap leaves every video for the next one
+	t.Setenv("MAX_MONTHLY_GB", "1")
+	capped := newTestDownloader(t, t.TempDir())
+	if err := capped.Cache.Set("catalog", downloader.Catalog{Usage: map[string]int64{month: 2 << 30}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := capped.Login(mockEmail, mockPassword); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if err := capped.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+	if capped.Report.Paused != 3 || len(capped.Report.Failures) != 0 {
+		t.Errorf("Report.Paused = %d with failures %+v, want 3 paused videos", capped.Report.Paused, capped.Report.Failures)
+	}
+	if _, err := os.Stat(filepath.Join(capped.BasePath, "laravel-basics", "01-introduction-to-laravel.mp4")); !os.IsNotExist(err) {
+		t.Errorf("episode downloaded over the monthly cap: %v", err)
+	}
+}
+
+func TestUsageIsSavedDuringTheRun(t *testing.T) {
+	newMockLaracasts(t)
+	interval := downloader.UsageSaveInterval
+	downloader.UsageSaveInterval = 0
+	t.Cleanup(func() { downloader.UsageSaveInterval = interval })
+	downloadPath := t.TempDir()
+	dl := signedInDownloader(t, downloadPath)
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+
+	// Without SaveUsage, as after a crash, the bytes saved along the way remain
+	usage := newTestDownloader(t, downloadPath).Usage()
+	if len(usage) != 1 || usage[0].Month != time.Now().Format("2006-01") || usage[0].Bytes == 0 {
+		t.Fatalf("Usage() = %+v, want the bytes received before the last video saved", usage)
+	}
+}
@@ -0,0 +1,198 @@
+package downloader
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Progress webhook events
+const (
+	EventStart    = "start"
+	EventProgress = "progress"
+	EventDone     = "done"
+	EventFailed   = "failed"
+)
+
+// progressMilestones are the percentages reported while an episode downloads
+var progressMilestones = []int{25, 50, 75}
+
+// webhookQueueSize is how many events may wait for delivery before further
+// ones are dropped, so a slow endpoint never holds up downloads
+const webhookQueueSize = 100
+
+// ProgressEvent is posted as JSON to the progress webhook
+type ProgressEvent struct {
+	Event   string    `json:"event"`
+	Series  string    `json:"series"`
+	Episode int       `json:"episode"`
+	Title   string    `json:"title"`
+	VimeoId string    `json:"vimeo_id"`
+	Percent int       `json:"percent"`
+	Error   string    `json:"error,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// ProgressWebhook posts per-episode events to a URL, e.g. a Home Assistant
+// webhook trigger. Progress is throttled to a few milestones per episode and
+// events are delivered in order by a single background sender.
+type ProgressWebhook struct {
+	url    string
+	client *http.Client
+	events chan ProgressEvent
+	done   chan struct{}
+
+	mu     sync.Mutex
+	active map[string]*trackedEpisode // by video file path
+}
+
+// trackedEpisode is an episode being downloaded and the last milestone sent
+type trackedEpisode struct {
+	series    string
+	episode   Episode
+	milestone int
+}
+
+// NewProgressWebhook starts delivering events to url
+func NewProgressWebhook(url string) *ProgressWebhook {
+	w := &ProgressWebhook{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+		events: make(chan ProgressEvent, webhookQueueSize),
+		done:   make(chan struct{}),
+		active: make(map[string]*trackedEpisode),
+	}
+	go w.send()
+	return w
+}
+
+// Close delivers the queued events and stops the sender
+func (w *ProgressWebhook) Close() {
+	close(w.events)
+	<-w.done
+}
+
+func (w *ProgressWebhook) send() {
+	defer close(w.done)
+
+	failures := 0
+	for event := range w.events {
+		body, err := json.Marshal(event)
+		if err != nil {
+			continue
+		}
+
+		resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 400 {
+				err = fmt.Errorf("status %d", resp.StatusCode)
+			}
+		}
+
+		// Warn once, the endpoint being down must not flood the output
+		if err != nil {
+			if failures == 0 {
+				fmt.Printf("\nWarning: progress webhook failed: %v\n", err)
+			}
+			failures++
+		}
+	}
+}
+
+// post queues event for delivery. Progress is dropped while the queue is
+// full, the outcome of an episode waits for room instead.
+func (w *ProgressWebhook) post(event ProgressEvent) {
+	event.Time = time.Now()
+	if event.Event == EventDone || event.Event == EventFailed {
+		w.events <- event
+		return
+	}
+	select {
+	case w.events <- event:
+	default:
+	}
+}
+
+// Start reports that an episode saved to paths began downloading
+func (w *ProgressWebhook) Start(series string, episode Episode, paths []string) {
+	tracked := &trackedEpisode{series: series, episode: episode}
+	w.mu.Lock()
+	for _, path := range paths {
+		w.active[path] = tracked
+	}
+	w.mu.Unlock()
+
+	w.post(tracked.event(EventStart, 0))
+}
+
+// Progress reports the bytes downloaded of the video saved to path, sending
+// an event whenever the next milestone is passed
+func (w *ProgressWebhook) Progress(path string, done, total int64) {
+	if total <= 0 {
+		return
+	}
+	percent := int(done * 100 / total)
+
+	w.mu.Lock()
+	tracked, ok := w.active[path]
+	var reached int
+	if ok {
+		for _, milestone := range progressMilestones {
+			if percent >= milestone && milestone > tracked.milestone {
+				reached = milestone
+			}
+		}
+		if reached > 0 {
+			tracked.milestone = reached
+		}
+	}
+	w.mu.Unlock()
+
+	if reached > 0 {
+		w.post(tracked.event(EventProgress, reached))
+	}
+}
+
+// Finish reports the outcome of the episode saved to paths and stops
+// tracking it
+func (w *ProgressWebhook) Finish(paths []string, err error) {
+	if len(paths) == 0 {
+		return
+	}
+	w.mu.Lock()
+	tracked, ok := w.active[paths[0]]
+	for _, path := range paths {
+		delete(w.active, path)
+	}
+	var milestone int
+	if ok {
+		milestone = tracked.milestone
+	}
+	w.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	if err != nil {
+		event := tracked.event(EventFailed, milestone)
+		event.Error = err.Error()
+		w.post(event)
+		return
+	}
+	w.post(tracked.event(EventDone, 100))
+}
+
+func (t *trackedEpisode) event(name string, percent int) ProgressEvent {
+	return ProgressEvent{
+		Event:   name,
+		Series:  t.series,
+		Episode: t.episode.Number,
+		Title:   t.episode.Title,
+		VimeoId: t.episode.VimeoId,
+		Percent: percent,
+	}
+}
@@ -0,0 +1,83 @@
+package downloader_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/downloader"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestProgressWebhookReportsMilestones(t *testing.T) {
+	newMockLaracasts(t)
+
+	var mu sync.Mutex
+	events := make(map[int][]string)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event downloader.ProgressEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("invalid webhook body: %v", err)
+			return
+		}
+		mu.Lock()
+		events[event.Episode] = append(events[event.Episode], fmt.Sprintf("%s %d", event.Event, event.Percent))
+		mu.Unlock()
+	}))
+	t.Cleanup(hook.Close)
+
+	t.Setenv("PROGRESS_WEBHOOK_URL", hook.URL)
+	dl := signedInDownloader(t, t.TempDir())
+	dl.Vimeo.SmallFileThreshold = 0
+	dl.Vimeo.ChunkSize = mockVideoSize / 4
+	dl.Vimeo.ChunkWorkers = 1
+
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+	dl.Webhook.Close()
+
+	want := []string{"start 0", "progress 25", "progress 50", "progress 75", "done 100"}
+	for episode := 1; episode <= 3; episode++ {
+		if got := events[episode]; !reflect.DeepEqual(got, want) {
+			t.Errorf("episode %d events = %q, want %q", episode, got, want)
+		}
+	}
+}
+
+func TestProgressWebhookReportsSmallFiles(t *testing.T) {
+	newMockLaracasts(t)
+
+	var mu sync.Mutex
+	events := make(map[int][]string)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event downloader.ProgressEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("invalid webhook body: %v", err)
+			return
+		}
+		mu.Lock()
+		events[event.Episode] = append(events[event.Episode], event.Event)
+		mu.Unlock()
+	}))
+	t.Cleanup(hook.Close)
+
+	// Videos below the small file threshold take a single request, without
+	// chunks to report
+	t.Setenv("PROGRESS_WEBHOOK_URL", hook.URL)
+	dl := signedInDownloader(t, t.TempDir())
+	if err := dl.DownloadSeries("laravel-basics"); err != nil {
+		t.Fatalf("DownloadSeries() error = %v", err)
+	}
+	dl.Webhook.Close()
+
+	for episode := 1; episode <= 3; episode++ {
+		got := events[episode]
+		if len(got) < 3 || got[0] != downloader.EventStart || !slices.Contains(got, downloader.EventProgress) || got[len(got)-1] != downloader.EventDone {
+			t.Errorf("episode %d events = %q, want start, progress and done", episode, got)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Package fsutil creates files and directories with the configured
+// permissions and ownership, so downloads can land on shares that expect
+// specific modes or owners
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+)
+
+var (
+	fileMode os.FileMode = 0644
+	dirMode  os.FileMode = 0755
+
+	// explicit is set when modes were configured, in which case they are
+	// applied with chmod so the process umask does not narrow them
+	explicit bool
+
+	uid = -1
+	gid = -1
+)
+
+// Configure sets the modes and owner used for everything created from now
+// on; a uid or gid of -1 leaves that part of the ownership unchanged
+func Configure(file, dir os.FileMode, owner, group int) {
+	fileMode, dirMode = file, dir
+	explicit = true
+	uid, gid = owner, group
+}
+
+// MkdirAll creates path and any missing parents, applying the configured
+// mode and owner to the directories it created
+func MkdirAll(path string) error {
+	created := missingDirs(path)
+	if err := os.MkdirAll(path, dirMode); err != nil {
+		return err
+	}
+
+	for _, dir := range created {
+		if err := apply(dir, dirMode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteFile writes data to path like os.WriteFile with the configured mode
+// and owner
+func WriteFile(path string, data []byte) error {
+	if err := os.WriteFile(path, data, fileMode); err != nil {
+		return err
+	}
+	return apply(path, fileMode)
+}
+
+// OpenFile opens path like os.OpenFile, applying the configured mode and
+// owner when the file is created
+func OpenFile(path string, flag int) (*os.File, error) {
+	_, statErr := os.Stat(path)
+
+	file, err := os.OpenFile(path, flag, fileMode)
+	if err != nil {
+		return nil, err
+	}
+
+	if os.IsNotExist(statErr) {
+		if err := apply(path, fileMode); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return file, nil
+}
+
+// Symlink creates newname pointing at oldname, owned by the configured owner
+func Symlink(oldname, newname string) error {
+	if err := os.Symlink(oldname, newname); err != nil {
+		return err
+	}
+	if uid == -1 && gid == -1 {
+		return nil
+	}
+	return os.Lchown(newname, uid, gid)
+}
+
+// Fix applies the configured mode and owner to a file written by another
+// process, such as ffmpeg
+func Fix(path string) error {
+	return apply(path, fileMode)
+}
+
+func apply(path string, mode os.FileMode) error {
+	if explicit {
+		if err := os.Chmod(path, mode); err != nil {
+			return err
+		}
+	}
+	if uid == -1 && gid == -1 {
+		return nil
+	}
+	return os.Chown(path, uid, gid)
+}
+
+// missingDirs lists path and those of its parents that do not exist yet
+func missingDirs(path string) []string {
+	var dirs []string
+	for dir := filepath.Clean(path); ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		dirs = append(dirs, dir)
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	return dirs
+}
@@ -0,0 +1,140 @@
+package fsutil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// LockStaleAfter is how long a lock file may go without its heartbeat before
+// it is considered left behind by a crashed process and taken over
+var LockStaleAfter = 2 * time.Minute
+
+// lockOwner is written into a lock file to tell who holds it
+type lockOwner struct {
+	PID      int       `json:"pid"`
+	Host     string    `json:"host"`
+	Acquired time.Time `json:"acquired"`
+}
+
+// LockError is returned by TryLock when another process holds the lock
+type LockError struct {
+	Path     string
+	PID      int
+	Host     string
+	Acquired time.Time
+}
+
+func (e *LockError) Error() string {
+	if e.PID == 0 {
+		return fmt.Sprintf("%s is locked by another process", e.Path)
+	}
+	return fmt.Sprintf("%s is locked by process %d on %s since %s (delete the lock file if that process is gone)",
+		e.Path, e.PID, e.Host, e.Acquired.Format(time.RFC3339))
+}
+
+// Lock is an advisory lock file held by this process. Its modification time
+// is refreshed while held so other processes can tell it is not stale.
+type Lock struct {
+	path string
+	stop chan struct{}
+	done chan struct{}
+}
+
+// TryLock creates the lock file at path, failing with a *LockError when a
+// live lock exists. A lock whose heartbeat stopped more than LockStaleAfter
+// ago is taken over.
+func TryLock(path string) (*Lock, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, fileMode)
+		if err == nil {
+			host, _ := os.Hostname()
+			err = json.NewEncoder(file).Encode(lockOwner{PID: os.Getpid(), Host: host, Acquired: time.Now()})
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, err
+			}
+
+			lock := &Lock{path: path, stop: make(chan struct{}), done: make(chan struct{})}
+			go lock.heartbeat()
+			return lock, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			continue // released in the meantime
+		}
+		if time.Since(info.ModTime()) < LockStaleAfter {
+			return nil, readLockError(path)
+		}
+		fmt.Printf("Taking over stale lock %s\n", path)
+		if !takeOver(path) {
+			return nil, readLockError(path)
+		}
+	}
+	return nil, readLockError(path)
+}
+
+// takeovers makes the names takeOver moves lock files to unique
+var takeovers atomic.Int64
+
+// takeOver moves a stale lock file away under a name of its own, so that of
+// several processes taking it over at once only one succeeds and none removes
+// the lock another just created. A lock found refreshed once moved is put
+// back. It returns false when the lock is live after all.
+func takeOver(path string) bool {
+	stale := fmt.Sprintf("%s.stale-%d-%d", path, os.Getpid(), takeovers.Add(1))
+	if err := os.Rename(path, stale); err != nil {
+		// Taken over or released by another process in the meantime
+		return errors.Is(err, os.ErrNotExist)
+	}
+	defer os.Remove(stale)
+
+	if info, err := os.Stat(stale); err == nil && time.Since(info.ModTime()) < LockStaleAfter {
+		_ = os.Link(stale, path)
+		return false
+	}
+	return true
+}
+
+func readLockError(path string) *LockError {
+	lockErr := &LockError{Path: path}
+	if data, err := os.ReadFile(path); err == nil {
+		var owner lockOwner
+		if json.Unmarshal(data, &owner) == nil {
+			lockErr.PID, lockErr.Host, lockErr.Acquired = owner.PID, owner.Host, owner.Acquired
+		}
+	}
+	return lockErr
+}
+
+func (l *Lock) heartbeat() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(LockStaleAfter / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case now := <-ticker.C:
+			_ = os.Chtimes(l.path, now, now)
+		}
+	}
+}
+
+// Unlock stops the heartbeat and removes the lock file
+func (l *Lock) Unlock() error {
+	close(l.stop)
+	<-l.done
+	return os.Remove(l.path)
+}
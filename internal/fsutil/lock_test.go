@@ -0,0 +1,52 @@
+package fsutil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTryLockTakesOverStaleLockOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "series.lock")
+	if err := os.WriteFile(path, []byte(`{"pid":1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stale := time.Now().Add(-2 * LockStaleAfter)
+	if err := os.Chtimes(path, stale, stale); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var held []*Lock
+	var wg sync.WaitGroup
+	for range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lock, err := TryLock(path)
+			var lockErr *LockError
+			if err != nil && !errors.As(err, &lockErr) {
+				t.Errorf("TryLock() error = %v, want a *LockError", err)
+			}
+			if lock != nil {
+				mu.Lock()
+				held = append(held, lock)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(held) != 1 {
+		t.Fatalf("%d of 16 takeovers hold the lock, want 1", len(held))
+	}
+	if err := held[0].Unlock(); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+	if leftovers, _ := filepath.Glob(path + "*"); len(leftovers) != 0 {
+		t.Errorf("files left behind: %v", leftovers)
+	}
+}
@@ -0,0 +1,81 @@
+// Package keychain stores the Laracasts password in the operating system
+// credential store using the platform's command line tools
+package keychain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+const service = "laracasts-dl"
+
+// Available reports whether a supported credential store tool is installed
+func Available() bool {
+	switch runtime.GOOS {
+	case "darwin":
+		_, err := exec.LookPath("security")
+		return err == nil
+	case "linux":
+		_, err := exec.LookPath("secret-tool")
+		return err == nil
+	}
+	return false
+}
+
+// Set stores the password for account, replacing any previous value
+func Set(account, password string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		// Given as an argument the password would show in ps, so the command
+		// is read from stdin by security's interactive mode, with the
+		// password hex encoded
+		if strings.ContainsAny(account, "'\r\n") {
+			return fmt.Errorf("cannot store a password for %q in the keychain", account)
+		}
+		cmd = exec.Command("security", "-i")
+		cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s '%s' -a '%s' -X %s\n",
+			service, account, hex.EncodeToString([]byte(password))))
+	case "linux":
+		cmd = exec.Command("secret-tool", "store", "--label", "Laracasts downloader",
+			"service", service, "account", account)
+		cmd.Stdin = strings.NewReader(password)
+	default:
+		return fmt.Errorf("keychain not supported on %s", runtime.GOOS)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to store password in keychain: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// Get returns the password stored for account
+func Get(account string) (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w")
+	case "linux":
+		cmd = exec.Command("secret-tool", "lookup", "service", service, "account", account)
+	default:
+		return "", fmt.Errorf("keychain not supported on %s", runtime.GOOS)
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read password from keychain: %v", err)
+	}
+
+	password := strings.TrimRight(string(out), "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("no password stored in keychain for %s", account)
+	}
+	return password, nil
+}
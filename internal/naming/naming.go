@@ -0,0 +1,143 @@
+// Package naming turns Laracasts titles into file and directory names that
+// work on every filesystem a library may live on, including SMB shares
+package naming
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+	"hash/crc32"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxLength caps a sanitized name in bytes, leaving room within the usual
+// 255 byte limit for the episode number, quality suffix and extension
+const MaxLength = 200
+
+var (
+	transliterate bool
+
+	invalidRe = regexp.MustCompile(`[/\\:*?"<>|\s]+`)
+	dashesRe  = regexp.MustCompile(`-+`)
+
+	// asciiReplacements covers letters and punctuation that do not decompose
+	// into an ASCII base and combining marks
+	asciiReplacements = strings.NewReplacer(
+		"ß", "ss", "æ", "ae", "Æ", "AE", "œ", "oe", "Œ", "OE",
+		"ø", "o", "Ø", "O", "ł", "l", "Ł", "L", "đ", "d", "Đ", "D",
+		"ð", "d", "Ð", "D", "þ", "th", "Þ", "TH", "ı", "i",
+		"‘", "'", "’", "'", "“", "", "”", "", "–", "-", "—", "-", "…", "...",
+	)
+)
+
+// ErrOutsideBase is returned for a path that would resolve outside the
+// directory it was built under
+var ErrOutsideBase = errors.New("path escapes the download directory")
+
+// Configure enables transliteration of names to ASCII
+func Configure(ascii bool) {
+	transliterate = ascii
+}
+
+// Sanitize returns the name used on disk for a title: NFC normalized,
+// lowercased, with path separators, reserved characters and whitespace
+// replaced by dashes, optionally transliterated to ASCII, and truncated to
+// MaxLength bytes
+func Sanitize(title string) string {
+	name := norm.NFC.String(title)
+	if transliterate {
+		name = toASCII(name)
+	}
+
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, strings.ToLower(name))
+	name = invalidRe.ReplaceAllString(name, "-")
+	name = dashesRe.ReplaceAllString(name, "-")
+	name = truncate(strings.Trim(name, "-"), MaxLength)
+
+	// Windows and SMB shares drop trailing dots
+	name = strings.Trim(strings.TrimRight(name, ". "), "-")
+	if strings.Trim(name, ".") == "" {
+		// "." and ".." are not names but references to directories
+		name = ""
+	}
+
+	if name == "" && strings.TrimSpace(title) != "" {
+		// Nothing survived transliteration (e.g. a CJK title), keep names
+		// distinct instead of colliding on an empty one
+		return fmt.Sprintf("untitled-%08x", crc32.ChecksumIEEE([]byte(title)))
+	}
+	return name
+}
+
+// legacyInvalidRe matches what names were sanitized of before Sanitize
+var legacyInvalidRe = regexp.MustCompile(`[/\\:*?"<>| ]`)
+
+// Legacy returns the name older versions gave a title, lowercased with path
+// separators, reserved characters and spaces replaced by dashes but neither
+// normalized nor truncated, to find what they saved under it
+func Legacy(title string) string {
+	name := legacyInvalidRe.ReplaceAllString(strings.ToLower(title), "-")
+	return strings.Trim(dashesRe.ReplaceAllString(name, "-"), "-")
+}
+
+// Within returns ErrOutsideBase unless path, once cleaned, is base or lies
+// under it. Titles are sanitized before they become path elements, so a
+// ".." element only gets there if Sanitize regresses; this is the last line
+// of defence before anything is written. Relative paths are resolved against
+// the working directory; symlinks are not followed.
+func Within(base, path string) error {
+	absBase, err := filepath.Abs(base)
+	if err != nil {
+		return err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(absBase, absPath)
+	if err != nil || (rel != "." && !filepath.IsLocal(rel)) {
+		return fmt.Errorf("%w: %s is outside %s", ErrOutsideBase, path, base)
+	}
+	return nil
+}
+
+// toASCII replaces accented letters by their base letter and drops every
+// character that has no ASCII equivalent
+func toASCII(s string) string {
+	s = asciiReplacements.Replace(s)
+
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	if out, _, err := transform.String(t, s); err == nil {
+		s = out
+	}
+
+	return strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// truncate shortens s to at most n bytes without splitting a character
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	s = s[:n]
+	for len(s) > 0 && !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return strings.TrimRight(s, "-")
+}
@@ -0,0 +1,120 @@
+package naming_test
+
+import (
+	"errors"
+	"github.com/sajjadanwar0/laracasts-dl/internal/naming"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	decomposed := "Cafe\u0301 Cre\u0300me"
+
+	tests := []struct {
+		name          string
+		title         string
+		transliterate bool
+		want          string
+	}{
+		{"reserved characters", `What's New: PHP 8.4 / "Hooks"?`, false, "what's-new-php-8.4-hooks"},
+		{"normalizes to NFC", decomposed, false, "café-crème"},
+		{"keeps unicode by default", "Ünïcödé Tïtlé", false, "ünïcödé-tïtlé"},
+		{"transliterates accents", decomposed, true, "cafe-creme"},
+		{"transliterates ligatures", "Straße Œuvre – Æon", true, "strasse-oeuvre-aeon"},
+		{"drops untranslatable", "Laravel 入門 Basics", true, "laravel-basics"},
+		{"trailing dots", "The End...", false, "the-end"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			naming.Configure(tt.transliterate)
+			defer naming.Configure(false)
+
+			if got := naming.Sanitize(tt.title); got != tt.want {
+				t.Errorf("Sanitize(%q) = %q, want %q", tt.title, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLegacy(t *testing.T) {
+	naming.Configure(true)
+	defer naming.Configure(false)
+
+	for title, want := range map[string]string{
+		"Laravel Basics":                 "laravel-basics",
+		"The End...":                     "the-end...",
+		"Café Crème":                     "café-crème",
+		`What's New: PHP 8.4 / "Hooks"?`: "what's-new-php-8.4-hooks",
+	} {
+		if got := naming.Legacy(title); got != want {
+			t.Errorf("Legacy(%q) = %q, want %q", title, got, want)
+		}
+	}
+}
+
+func TestSanitizeUntranslatableTitle(t *testing.T) {
+	naming.Configure(true)
+	defer naming.Configure(false)
+
+	first, second := naming.Sanitize("入門"), naming.Sanitize("応用")
+	if !strings.HasPrefix(first, "untitled-") || first == second {
+		t.Errorf("Sanitize() = %q and %q, want distinct untitled names", first, second)
+	}
+}
+
+func TestSanitizeTruncatesOnCharacterBoundary(t *testing.T) {
+	got := naming.Sanitize(strings.Repeat("é", naming.MaxLength))
+	if len(got) > naming.MaxLength || !strings.HasPrefix(got, "é") || strings.ContainsRune(got, '�') {
+		t.Errorf("Sanitize() = %q (%d bytes), want at most %d bytes of whole characters", got, len(got), naming.MaxLength)
+	}
+}
+
+func TestWithin(t *testing.T) {
+	base := filepath.Join("downloads", "library")
+
+	tests := []struct {
+		name string
+		path string
+		ok   bool
+	}{
+		{"episode", filepath.Join(base, "topics", "laravel", "laravel-basics", "01-intro.mp4"), true},
+		{"base itself", base, true},
+		{"dot dot in the middle", filepath.Join(base, "series") + string(filepath.Separator) + filepath.Join("..", "..", "..", "etc", "passwd"), false},
+		{"parent", filepath.Join(base, ".."), false},
+		{"sibling sharing the prefix", base + "-other" + string(filepath.Separator) + "01.mp4", false},
+		{"absolute elsewhere", filepath.Join(string(filepath.Separator), "etc", "passwd"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := naming.Within(base, tt.path)
+			if tt.ok && err != nil {
+				t.Errorf("Within(%q, %q) = %v, want nil", base, tt.path, err)
+			}
+			if !tt.ok && !errors.Is(err, naming.ErrOutsideBase) {
+				t.Errorf("Within(%q, %q) = %v, want ErrOutsideBase", base, tt.path, err)
+			}
+		})
+	}
+}
+
+func TestSanitizedTitlesStayWithinBase(t *testing.T) {
+	base := t.TempDir()
+	hostile := []string{"..", ".", "../../etc/passwd", `..\..\Windows\System32`, "a/../../b", ". .", "....", "/absolute", "~/.ssh"}
+
+	for _, transliterate := range []bool{false, true} {
+		naming.Configure(transliterate)
+		for _, title := range hostile {
+			name := naming.Sanitize(title)
+			if name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+				t.Errorf("Sanitize(%q) = %q, want a single path element", title, name)
+			}
+			if err := naming.Within(base, filepath.Join(base, name, name+".mp4")); err != nil {
+				t.Errorf("episode of %q escapes the base: %v", title, err)
+			}
+		}
+	}
+	naming.Configure(false)
+}
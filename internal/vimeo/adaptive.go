@@ -0,0 +1,130 @@
+package vimeo
+
+import (
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ParallelGain is how much faster than a single stream the parallel chunk
+// requests to a CDN host have to be to keep them. Some ISPs throttle every
+// connection to the same share of the line, so parallel requests only add
+// CDN load and local CPU.
+const ParallelGain = 0.10
+
+// ReprobeInterval is how long the requests at once settled on for a CDN host
+// are kept before it is measured again, as the line or the host may have
+// changed meanwhile
+const ReprobeInterval = 30 * time.Minute
+
+// connectionTuner measures, with a chunked download from each CDN host,
+// whether parallel ranged requests beat a single stream, and settles the
+// requests at once to the host on the outcome. A download only measures the
+// host when no other is running from it, and the ones starting meanwhile wait
+// for the measurement, so the rates compared are not shares of a line other
+// downloads are using too. When the host is due to be measured again, new
+// downloads wait for the running ones to end first.
+type connectionTuner struct {
+	mu      sync.Mutex
+	changed *sync.Cond // signalled when a measurement or a download ends
+	hosts   map[string]*hostConnections
+}
+
+// hostConnections is the state of the measurement for one CDN host
+type hostConnections struct {
+	active  int       // chunked downloads running from the host
+	probing bool      // one of them is measuring the host
+	limit   int       // requests at once settled on, zero until measured
+	settled time.Time // when limit was settled on
+}
+
+// start returns the requests at once settled on for the host of rawURL, or
+// zero, and whether the caller is to measure the host. It waits while
+// another download measures the host. Every start is followed by an end.
+func (t *connectionTuner) start(rawURL string) (limit int, probe bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.hosts == nil {
+		t.hosts = make(map[string]*hostConnections)
+		t.changed = sync.NewCond(&t.mu)
+	}
+
+	host := chunkHost(rawURL)
+	h, ok := t.hosts[host]
+	if !ok {
+		h = &hostConnections{}
+		t.hosts[host] = h
+	}
+	for h.probing || (h.active > 0 && h.due()) {
+		t.changed.Wait()
+	}
+	h.active++
+	if h.active > 1 || (h.limit > 0 && !h.due()) {
+		return h.limit, false
+	}
+	h.probing = true
+	return 0, true
+}
+
+// due reports whether the requests at once settled on for the host are to be
+// measured again
+func (h *hostConnections) due() bool {
+	return h.limit > 0 && time.Since(h.settled) >= ReprobeInterval
+}
+
+// end records that a download started from the host of rawURL is over
+func (t *connectionTuner) end(rawURL string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	defer t.changed.Broadcast()
+	t.hosts[chunkHost(rawURL)].active--
+}
+
+// settle records the measurement of the host of rawURL: a single stream
+// fetched single bytes per second, workers requests at once parallel bytes
+// per second. A zero rate gives the measurement up for the next download,
+// keeping the requests at once settled on before.
+func (t *connectionTuner) settle(rawURL string, workers int, single, parallel float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	defer t.changed.Broadcast()
+
+	host := chunkHost(rawURL)
+	h := t.hosts[host]
+	h.probing = false
+	if single <= 0 || parallel <= 0 {
+		return
+	}
+
+	gain := parallel/single - 1
+	previous := h.limit
+	h.limit, h.settled = workers, time.Now()
+	if gain < ParallelGain {
+		h.limit = 1
+		if previous != 1 {
+			Printf("\n🔌 %d parallel requests to %s are only %.0f%% faster than one, downloading from it over a single connection\n",
+				workers, host, max(gain, 0)*100)
+		}
+		return
+	}
+	if previous == 1 {
+		Printf("\n🔌 %d parallel requests to %s are now %.0f%% faster than one, downloading from it over %d connections again\n",
+			workers, host, gain*100, workers)
+	}
+}
+
+// chunkHost is the host of rawURL the measurement is kept for
+func chunkHost(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return u.Host
+	}
+	return rawURL
+}
+
+// rate returns the bytes per second of n bytes transferred in elapsed
+func rate(n int64, elapsed time.Duration) float64 {
+	if n <= 0 || elapsed <= 0 {
+		return 0
+	}
+	return float64(n) / elapsed.Seconds()
+}
@@ -0,0 +1,144 @@
+package vimeo
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BenchVideoID is the public Vimeo video the bench command measures the
+// network with, so no Laracasts account is involved
+var BenchVideoID = "76979871"
+
+// CDNLatency is the time to first byte of a small request to one CDN
+type CDNLatency struct {
+	Name    string
+	Latency time.Duration
+	Err     error
+}
+
+// CDNLatencies requests the stream manifest from every CDN the video is
+// offered on, fastest first
+func (c *Client) CDNLatencies(config *VideoConfig) []CDNLatency {
+	urls := make(map[string]string)
+	for name, cdn := range config.Request.Files.HLS.Cdns {
+		urls["hls/"+name] = cdn.URL
+	}
+	for name, cdn := range config.Request.Files.Dash.Cdns {
+		urls["dash/"+name] = cdn.URL
+	}
+
+	var results []CDNLatency
+	for name, url := range urls {
+		latency, err := c.Latency(url)
+		results = append(results, CDNLatency{Name: name, Latency: latency, Err: err})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if (results[i].Err == nil) != (results[j].Err == nil) {
+			return results[i].Err == nil
+		}
+		return results[i].Latency < results[j].Latency
+	})
+	return results
+}
+
+// Latency returns the time to the first byte of a GET request for url
+func (c *Client) Latency(url string) (time.Duration, error) {
+	started := time.Now()
+	resp, err := c.httpClient.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	latency := time.Since(started)
+	if resp.StatusCode >= 400 {
+		return latency, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	return latency, nil
+}
+
+// BenchURL returns the lowest quality progressive file of the video, or an
+// empty string when it only has streams
+func BenchURL(config *VideoConfig) string {
+	var url string
+	lowest := 0
+	for _, prog := range config.Request.Files.Progressive {
+		height := 0
+		if _, err := fmt.Sscanf(prog.Quality, "%dp", &height); err != nil {
+			continue
+		}
+		if url == "" || height < lowest {
+			url, lowest = prog.URL, height
+		}
+	}
+	return url
+}
+
+// Throughput downloads the first size bytes of url in as many ranged
+// requests as workers, all at once, and returns the bytes per second
+func (c *Client) Throughput(url string, size int64, workers int) (float64, error) {
+	fileSize, _, err := c.head(url)
+	if err != nil {
+		return 0, err
+	}
+	size = min(size, fileSize)
+	part := size / int64(workers)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	var total int64
+
+	started := time.Now()
+	for i := 0; i < workers; i++ {
+		start, end := int64(i)*part, int64(i+1)*part
+		if i == workers-1 {
+			end = size
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n, err := c.fetchRange(url, start, end)
+
+			mu.Lock()
+			defer mu.Unlock()
+			total += n
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return 0, firstErr
+	}
+	return float64(total) / time.Since(started).Seconds(), nil
+}
+
+// fetchRange downloads bytes [start, end) of url and discards them
+func (c *Client) fetchRange(url string, start, end int64) (int64, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, &chunkStatusError{StatusCode: resp.StatusCode}
+	}
+	return io.Copy(io.Discard, resp.Body)
+}
@@ -1,33 +1,152 @@
 package vimeo
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/schollz/progressbar/v3"
+	"github.com/sajjadanwar0/laracasts-dl/internal/fsutil"
 	"io"
 	"math"
 	"net/http"
-	"os/exec"
+	"net/url"
+	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// PlayerConfigURL is the Vimeo player config endpoint, formatted with the video ID
+var PlayerConfigURL = "https://player.vimeo.com/video/%s/config"
+
 type Client struct {
 	httpClient *http.Client
+
+	// streamClient fetches video bodies, see Stream
+	streamClient *http.Client
+
+	// Referer is the page the player is embedded in, sent with every
+	// request; Vimeo refuses private videos to other referers
+	Referer string
+
+	// Container is the output container used when falling back to ffmpeg
+	// for HLS and DASH streams
+	Container string
+
+	// ChunkWorkers limits the ranged requests made at once per video
+	ChunkWorkers int
+
+	// ChunkLimit, when set, returns the ranged requests or HLS segments
+	// fetched at once for the video at path (or its segment cache), in
+	// place of ChunkWorkers when positive
+	ChunkLimit func(path string) int
+
+	// Preallocate is whether files can be extended to their size up front
+	// for chunks to be written at their offsets; without it progressive
+	// downloads are sequential
+	Preallocate bool
+
+	// AdaptiveConnections measures with a chunked download from each CDN
+	// host, on its own, whether parallel ranged requests are at least
+	// ParallelGain faster than a single stream, and fetches later videos from
+	// the host over a single connection when they are not, measuring again
+	// every ReprobeInterval
+	AdaptiveConnections bool
+
+	// ChunkSize is the size of each ranged request
+	ChunkSize int64
+
+	// SmallFileThreshold is the size below which a progressive file is
+	// fetched with a single request into memory
+	SmallFileThreshold int64
+
+	// FFmpegWorkers limits the ffmpeg processes running at once, further
+	// conversions are queued
+	FFmpegWorkers int
+
+	// HasFFmpeg is whether ffmpeg was found at startup. Without it, stream
+	// fallbacks fail with ErrFFmpegMissing instead of running it.
+	HasFFmpeg bool
+
+	// Progress, when set, is called with the bytes saved so far of a
+	// progressive download each time a chunk completes
+	Progress func(outputPath string, done, total int64)
+
+	// ChunkRetry, when set, is called each time a failed chunk of a
+	// progressive download is about to be fetched again
+	ChunkRetry func(outputPath, url string, attempt int, err error)
+
+	// PieceSize, with Hashed set, makes progressive downloads hash every
+	// piece of this size as it is written; Hashed receives the hex SHA-256
+	// of the pieces of each completed file
+	PieceSize int64
+	Hashed    func(outputPath string, pieces []string)
+
+	Stats *TransferStats
+
+	ffmpeg      ffmpegPool
+	connections connectionTuner
 }
 
 func NewClient(httpClient *http.Client) *Client {
 	return &Client{
-		httpClient: httpClient,
+		httpClient:    httpClient,
+		streamClient:  streamClient(httpClient),
+		Referer:       DefaultReferer,
+		Container:     ContainerMP4,
+		ChunkWorkers:  MaxChunkWorkers,
+		Preallocate:   true,
+		ChunkSize:     ChunkSize,
+		FFmpegWorkers: runtime.NumCPU(),
+		HasFFmpeg:     FFmpegInstalled(),
+		Stats:         NewTransferStats(),
+
+		SmallFileThreshold:  SmallFileThreshold,
+		AdaptiveConnections: true,
 	}
 }
 
-func (c *Client) GetVideoConfig(vimeoId string) (*VideoConfig, error) {
-	configURL := fmt.Sprintf("https://player.vimeo.com/video/%s/config", vimeoId)
+// chunkWorkers returns how many chunks of the video at path are fetched at once
+func (c *Client) chunkWorkers(path string) int {
+	if c.ChunkLimit != nil {
+		if n := c.ChunkLimit(path); n > 0 {
+			return n
+		}
+	}
+	return max(c.ChunkWorkers, 1)
+}
+
+// origin is the Origin header matching Referer
+func (c *Client) origin() string {
+	return strings.TrimSuffix(c.Referer, "/")
+}
+
+// ValidateContainer checks if the provided container is supported
+func ValidateContainer(container string) bool {
+	return container == ContainerMP4 || container == ContainerMKV
+}
+
+// ContainerPath returns outputPath with its extension replaced by container
+func ContainerPath(outputPath, container string) string {
+	return strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + "." + container
+}
+
+// GetVideoConfig fetches the player config of a video. hash is the h=
+// parameter of the signed player URL, which Vimeo requires for private and
+// unlisted videos and refuses their config without; "" for public ones.
+func (c *Client) GetVideoConfig(vimeoId, hash string) (*VideoConfig, error) {
+	configURL := fmt.Sprintf(PlayerConfigURL, vimeoId)
+	if hash != "" {
+		separator := "?"
+		if strings.Contains(configURL, "?") {
+			separator = "&"
+		}
+		configURL += separator + "h=" + url.QueryEscape(hash)
+	}
 	maxRetries := MaxRetries
 	var lastErr error
 
@@ -35,8 +154,8 @@ func (c *Client) GetVideoConfig(vimeoId string) (*VideoConfig, error) {
 		"User-Agent":      "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36",
 		"Accept":          "application/json",
 		"Accept-Language": "en-US,en;q=0.9",
-		"Referer":         "https://laracasts.com/",
-		"Origin":          "https://laracasts.com",
+		"Referer":         c.Referer,
+		"Origin":          c.origin(),
 		"Sec-Fetch-Dest":  "empty",
 		"Sec-Fetch-Mode":  "cors",
 		"Sec-Fetch-Site":  "cross-site",
@@ -70,8 +189,12 @@ func (c *Client) GetVideoConfig(vimeoId string) (*VideoConfig, error) {
 		}
 
 		if resp.StatusCode != http.StatusOK {
-			lastErr = fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-			fmt.Printf("Response body: %s\n", string(body))
+			playerErr := newPlayerError(resp.StatusCode, body)
+			if playerErr.Permanent() {
+				return nil, playerErr
+			}
+			lastErr = playerErr
+			Printf("Response body: %s\n", string(body))
 			time.Sleep(time.Second)
 			continue
 		}
@@ -83,60 +206,74 @@ func (c *Client) GetVideoConfig(vimeoId string) (*VideoConfig, error) {
 		}
 
 		// Debug output
-		fmt.Printf("\nVideo formats found for %s:\n", vimeoId)
-		fmt.Printf("Progressive: %d formats\n", len(config.Request.Files.Progressive))
-		fmt.Printf("HLS: %v\n", config.Request.Files.HLS.DefaultCDN != "")
-		fmt.Printf("DASH: %v\n", config.Request.Files.Dash.DefaultCDN != "")
+		Printf("\nVideo formats found for %s:\n", vimeoId)
+		Printf("Progressive: %d formats\n", len(config.Request.Files.Progressive))
+		Printf("HLS: %v\n", config.Request.Files.HLS.DefaultCDN != "")
+		Printf("DASH: %v\n", config.Request.Files.Dash.DefaultCDN != "")
+		if config.Request.Files.Dash.DefaultCDN != "" && len(config.Request.Files.Progressive) == 0 && config.Request.Files.HLS.DefaultCDN == "" {
+			Printf("DASH only: separate audio and video streams will be merged with ffmpeg\n")
+		}
 
 		return &config, nil
 	}
 
-	return nil, fmt.Errorf("failed after %d attempts: %v", maxRetries, lastErr)
+	return nil, fmt.Errorf("failed after %d attempts: %w", maxRetries, lastErr)
 }
-func (c *Client) DownloadVideo(config *VideoConfig, outputPath string) error {
+
+// PlayerHash returns the hash of a signed player or video URL, from its h=
+// parameter (player.vimeo.com/video/<id>?h=<hash>) or its path
+// (vimeo.com/<id>/<hash>), or "" when it has none
+func PlayerHash(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	if hash := u.Query().Get("h"); hash != "" {
+		return hash
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) == 2 && !strings.HasPrefix(u.Host, "player.") {
+		return parts[1]
+	}
+	return ""
+}
+
+// DownloadVideo saves the video to outputPath. The progressive stream closest
+// to quality (without exceeding it) is preferred; an empty quality selects the
+// best one available.
+func (c *Client) DownloadVideo(config *VideoConfig, quality, outputPath string) error {
 	// Try progressive download first
 	if len(config.Request.Files.Progressive) > 0 {
-		fmt.Println("Available video formats:")
-		var bestURL string
-		var bestQuality int
+		Printf("Available video formats:\n")
 		for _, prog := range config.Request.Files.Progressive {
-			fmt.Printf("- Quality: %s, URL: available\n", prog.Quality)
-			quality := 0
-			_, err := fmt.Sscanf(prog.Quality, "%dp", &quality)
-			if err != nil {
-				return err
-			}
-			if quality > bestQuality {
-				bestQuality = quality
-				bestURL = prog.URL
-			}
+			Printf("- Quality: %s, URL: available\n", prog.Quality)
 		}
 
-		if bestURL != "" {
-			fmt.Printf("\nDownloading progressive MP4 stream (%dp)\n", bestQuality)
-			return c.downloadWithChunks(bestURL, outputPath)
+		if url, selected := c.selectProgressiveURL(config, quality); url != "" {
+			Printf("\nDownloading progressive MP4 stream (%dp)\n", selected)
+			return c.downloadProgressive(url, outputPath)
 		}
 	}
 
 	// Try HLS if progressive download is not available
 	if config.Request.Files.HLS.DefaultCDN != "" {
-		fmt.Println("\nTrying HLS stream...")
+		Printf("\nTrying HLS stream...\n")
 		if cdn, ok := config.Request.Files.HLS.Cdns[config.Request.Files.HLS.DefaultCDN]; ok {
 			hlsURL := cdn.URL
 			if hlsURL != "" {
-				return c.downloadHLSVideo(hlsURL, outputPath)
+				return c.downloadHLSVideo(hlsURL, outputPath, config.Video.Duration)
 			}
 		}
-		fmt.Printf("Available CDNs: %v\n", config.Request.Files.HLS.Cdns)
+		Printf("Available CDNs: %v\n", config.Request.Files.HLS.Cdns)
 	}
 
 	// Try Dash stream if available
 	if config.Request.Files.Dash.DefaultCDN != "" {
-		fmt.Println("\nTrying DASH stream...")
+		Printf("\nTrying DASH stream...\n")
 		if cdn, ok := config.Request.Files.Dash.Cdns[config.Request.Files.Dash.DefaultCDN]; ok {
 			dashURL := cdn.URL
 			if dashURL != "" {
-				return c.downloadDashVideo(dashURL, outputPath)
+				return c.downloadDashVideo(dashURL, quality, outputPath, config.Video.Duration)
 			}
 		}
 	}
@@ -144,134 +281,297 @@ func (c *Client) DownloadVideo(config *VideoConfig, outputPath string) error {
 	return fmt.Errorf("no suitable video URL found (tried Progressive, HLS, and DASH)")
 }
 
-func (c *Client) downloadDashVideo(url, outputPath string) error {
-	fmt.Printf("Downloading DASH stream: %s\n", filepath.Base(outputPath))
-
-	cmd := exec.Command("ffmpeg",
-		"-i", url,
-		"-c", "copy",
-		"-movflags", "+faststart",
-		"-y",
-		outputPath)
+// RemoteSize returns the size of the progressive file DownloadVideo would
+// fetch for quality, or 0 when the video is only available as a stream
+func (c *Client) RemoteSize(config *VideoConfig, quality string) (int64, error) {
+	url, _ := c.selectProgressiveURL(config, quality)
+	if url == "" {
+		return 0, nil
+	}
+	size, _, err := c.head(url)
+	return size, err
+}
 
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+// head returns the size of a progressive file from a HEAD request and
+// whether the server advertises support for range requests. Connection
+// failures, rate limiting and server errors are retried.
+func (c *Client) head(url string) (size int64, ranges bool, err error) {
+	for retry := 0; retry < MaxRetries; retry++ {
+		if retry > 0 {
+			time.Sleep(time.Second * time.Duration(retry))
+		}
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("ffmpeg failed: %v\nOutput: %s", err, stderr.String())
+		var status int
+		size, ranges, status, err = c.headOnce(url)
+		if err == nil || (status != 0 && status != http.StatusTooManyRequests && status < 500) {
+			return size, ranges, err
+		}
 	}
-
-	return nil
+	return 0, false, err
 }
 
-func (c *Client) downloadHLSVideo(url, outputPath string) error {
-	fmt.Printf("Downloading HLS stream: %s\n", filepath.Base(outputPath))
+// headOnce sends a single HEAD request, returning the status when the
+// server answered
+func (c *Client) headOnce(url string) (size int64, ranges bool, status int, err error) {
+	req, err := http.NewRequest("HEAD", url, nil)
+	if err != nil {
+		return 0, false, 0, fmt.Errorf("failed to create HEAD request: %v", err)
+	}
 
-	cmd := exec.Command("ffmpeg",
-		"-i", url,
-		"-c", "copy",
-		"-bsf:a", "aac_adtstoasc",
-		"-movflags", "+faststart",
-		"-y",
-		outputPath)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
+	req.Header.Set("Referer", c.Referer)
 
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, false, 0, fmt.Errorf("failed HEAD request: %w", err)
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			print("Failed to close response body")
+		}
+	}(resp.Body)
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("ffmpeg failed: %v\nOutput: %s", err, stderr.String())
+	if resp.StatusCode != http.StatusOK {
+		return 0, false, resp.StatusCode, fmt.Errorf("HEAD request failed: %w", &chunkStatusError{StatusCode: resp.StatusCode})
 	}
 
-	return nil
+	if resp.ContentLength <= 0 {
+		return 0, false, resp.StatusCode, fmt.Errorf("invalid file size: %d", resp.ContentLength)
+	}
+	return resp.ContentLength, resp.Header.Get("Accept-Ranges") == "bytes", resp.StatusCode, nil
+}
+
+// SelectQuality returns the quality DownloadVideo fetches for quality, like
+// "720p", or "" when the video is only available as a stream. An empty quality
+// returns the best one available.
+func (c *Client) SelectQuality(config *VideoConfig, quality string) string {
+	if _, height := c.selectProgressiveURL(config, quality); height > 0 {
+		return fmt.Sprintf("%dp", height)
+	}
+	return ""
 }
 
-func (c *Client) getBestProgressiveURL(config *VideoConfig) (string, int) {
-	var bestURL string
-	var bestQuality int
+// selectProgressiveURL returns the progressive stream matching quality, or the
+// highest one below it. When nothing fits, or quality is empty, the best
+// available stream is returned.
+func (c *Client) selectProgressiveURL(config *VideoConfig, quality string) (string, int) {
+	requested := 0
+	if quality != "" {
+		if _, err := fmt.Sscanf(quality, "%dp", &requested); err != nil {
+			requested = 0
+		}
+	}
+
+	var bestURL, fittingURL string
+	var bestQuality, fittingQuality int
 
 	for _, prog := range config.Request.Files.Progressive {
-		quality := 0
-		_, err := fmt.Sscanf(prog.Quality, "%dp", &quality)
-		if err != nil {
-			return "", 0
+		height := 0
+		if _, err := fmt.Sscanf(prog.Quality, "%dp", &height); err != nil {
+			continue
 		}
-		if quality > bestQuality {
-			bestQuality = quality
+		if height > bestQuality {
+			bestQuality = height
 			bestURL = prog.URL
 		}
+		if requested > 0 && height <= requested && height > fittingQuality {
+			fittingQuality = height
+			fittingURL = prog.URL
+		}
 	}
 
+	if fittingURL != "" {
+		return fittingURL, fittingQuality
+	}
 	return bestURL, bestQuality
 }
 
-func (c *Client) downloadWithChunks(url string, outputPath string) error {
-	// Get file size
-	req, err := http.NewRequest("HEAD", url, nil)
+// downloadProgressive saves a progressive MP4, in parallel chunks unless it is
+// small enough that pre-allocation and range requests gain nothing, the
+// server does not honour range requests or files cannot be pre-allocated
+func (c *Client) downloadProgressive(url, outputPath string) error {
+	fileSize, ranges, err := c.head(url)
 	if err != nil {
-		return fmt.Errorf("failed to create HEAD request: %v", err)
+		return err
 	}
 
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
-	req.Header.Set("Referer", "https://laracasts.com/")
+	switch {
+	case fileSize < c.SmallFileThreshold:
+		return c.downloadToMemory(url, outputPath, fileSize)
+	case !ranges:
+		Printf("Server does not accept range requests, downloading sequentially\n")
+		return c.downloadSequential(url, outputPath, fileSize)
+	case !c.Preallocate:
+		return c.downloadSequential(url, outputPath, fileSize)
+	}
 
-	resp, err := c.httpClient.Do(req)
+	err = c.downloadWithChunks(url, outputPath, fileSize)
+	if errors.Is(err, errRangeUnsupported) {
+		// Some CDN edges advertise ranges but answer 200 or 416
+		Printf("\n%v, downloading sequentially\n", err)
+		return c.downloadSequential(url, outputPath, fileSize)
+	}
+	return err
+}
+
+// follow passes the progress of bar on to c.Progress as that of the video
+// saved to outputPath. Chunked downloads report finished chunks themselves.
+func (c *Client) follow(bar *progressBar, outputPath string) *progressBar {
+	if c.Progress != nil {
+		bar.report = func(done, total int64) { c.Progress(outputPath, done, total) }
+	}
+	return bar
+}
+
+// downloadToMemory fetches a small file with a single request, retrying the
+// whole request, and writes it out once complete
+func (c *Client) downloadToMemory(url, outputPath string, fileSize int64) error {
+	bar := c.follow(newProgressBar(fileSize), outputPath)
+	defer bar.Finish()
+	data := bytes.NewBuffer(make([]byte, 0, fileSize))
+
+	err := c.retryWhole(url, fileSize, bar, func() (io.Writer, error) {
+		data.Reset()
+		return data, nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed HEAD request: %v", err)
+		return err
 	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
+	if err := fsutil.WriteFile(outputPath, data.Bytes()); err != nil {
+		return err
+	}
+
+	if hasher := c.startHashing(fileSize); hasher != nil {
+		hasher.write(data.Bytes(), 0)
+		c.finishHashing(hasher, outputPath, fileSize)
+	}
+	return nil
+}
+
+// downloadSequential streams a file with a single request straight to disk,
+// for servers that ignore range requests
+func (c *Client) downloadSequential(url, outputPath string, fileSize int64) error {
+	bar := c.follow(newProgressBar(fileSize), outputPath)
+	defer bar.Finish()
+
+	var file *os.File
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+
+	hasher := c.startHashing(fileSize)
+	err := c.retryWhole(url, fileSize, bar, func() (io.Writer, error) {
+		if file != nil {
+			file.Close()
+		}
+		var err error
+		if file, err = fsutil.OpenFile(outputPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC); err != nil || hasher == nil {
+			return file, err
+		}
+		hasher.reset(0, fileSize)
+		return io.MultiWriter(file, &hashingWriter{hasher: hasher}), nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	file = nil
+
+	c.finishHashing(hasher, outputPath, fileSize)
+	return nil
+}
+
+// retryWhole fetches a whole file with plain GET requests into the writer
+// returned by open, which is called again before every attempt
+func (c *Client) retryWhole(url string, fileSize int64, bar *progressBar, open func() (io.Writer, error)) error {
+	var lastErr error
+	for retry := 0; retry < MaxRetries; retry++ {
+		if retry > 0 {
+			bar.Reset()
+			time.Sleep(time.Second)
+		}
+
+		w, err := open()
 		if err != nil {
-			print("Failed to close response body")
+			return fmt.Errorf("failed to create output file: %w", err)
 		}
-	}(resp.Body)
+
+		written, err := c.fetchWhole(url, w, fileSize, bar)
+		c.Stats.recordChunk(url, written, err)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return nil
+	}
+	return fmt.Errorf("download failed after %d retries: %w", MaxRetries, lastErr)
+}
+
+// fetchWhole copies a file of fileSize bytes from a plain GET request to w
+func (c *Client) fetchWhole(url string, w io.Writer, fileSize int64, bar *progressBar) (int64, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
+	req.Header.Set("Referer", c.Referer)
+	req.Header.Set("Origin", c.origin())
+	req.Header.Set("Accept", "*/*")
+
+	resp, err := c.Stream(req)
+	if err != nil {
+		return 0, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HEAD request failed with status: %d", resp.StatusCode)
+		return 0, &chunkStatusError{StatusCode: resp.StatusCode}
 	}
 
-	fileSize := resp.ContentLength
-	if fileSize <= 0 {
-		return fmt.Errorf("invalid file size: %d", fileSize)
+	written, err := io.Copy(io.MultiWriter(w, bar), io.LimitReader(resp.Body, fileSize))
+	if err == nil && written != fileSize {
+		err = fmt.Errorf("incomplete download: got %d of %d bytes", written, fileSize)
 	}
+	return written, err
+}
 
-	// Create buffered file writer
-	writer, err := NewBufferedFileWriter(outputPath, fileSize)
+func (c *Client) downloadWithChunks(url string, outputPath string, fileSize int64) error {
+	file, err := createChunkFile(outputPath, fileSize)
 	if err != nil {
-		return fmt.Errorf("failed to create output file: %v", err)
+		return fmt.Errorf("failed to create output file: %w", err)
 	}
-	defer func(writer *BufferedFileWriter) {
-		err := writer.Close()
+	defer func(file *os.File) {
+		err := file.Close()
 		if err != nil {
 			print("Failed to close output file")
 		}
-	}(writer)
-
-	// Setup progress bar
-	bar := progressbar.NewOptions64(
-		fileSize,
-		progressbar.OptionSetDescription("Downloading"),
-		progressbar.OptionShowBytes(true),
-		progressbar.OptionSetWidth(30),
-		progressbar.OptionShowCount(),
-		progressbar.OptionSetTheme(progressbar.Theme{
-			Saucer:        "=",
-			SaucerHead:    ">",
-			SaucerPadding: " ",
-			BarStart:      "[",
-			BarEnd:        "]",
-		}),
-	)
+	}(file)
+
+	var w io.WriterAt = file
+	hasher := c.startHashing(fileSize)
+	if hasher != nil {
+		w = hashingWriterAt{w: file, hasher: hasher}
+	}
+
+	bar := newProgressBar(fileSize)
+	defer bar.Finish()
 
 	// Calculate chunks
-	numChunks := int(math.Ceil(float64(fileSize) / float64(ChunkSize)))
+	numChunks := int(math.Ceil(float64(fileSize) / float64(c.ChunkSize)))
 	chunks := make([]struct {
 		start int64
 		end   int64
 	}, numChunks)
 
 	for i := 0; i < numChunks; i++ {
-		start := int64(i) * ChunkSize
-		end := start + ChunkSize
+		start := int64(i) * c.ChunkSize
+		end := start + c.ChunkSize
 		if end > fileSize {
 			end = fileSize
 		}
@@ -284,82 +584,146 @@ func (c *Client) downloadWithChunks(url string, outputPath string) error {
 	// Create buffer pool
 	bufferPool := sync.Pool{
 		New: func() interface{} {
-			return make([]byte, MemoryBuffer)
+			return make([]byte, ChunkBuffer)
 		},
 	}
 
-	// Download chunks
+	// Download chunks. The first chunk that fails for good cancels the rest,
+	// so a doomed file is retried as a whole without waiting on them.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	var wg sync.WaitGroup
-	errors := make(chan error, numChunks)
-	limiter := make(chan struct{}, MaxChunkWorkers)
+	var failOnce sync.Once
+	var firstErr error
+	var completed atomic.Int64
+	workers := c.chunkWorkers(outputPath)
+	var probe bool
+	if c.AdaptiveConnections && workers > 1 && numChunks > 2 {
+		var limit int
+		limit, probe = c.connections.start(url)
+		defer c.connections.end(url)
+		if limit > 0 {
+			workers = min(workers, limit)
+		}
+	}
+	limiter := make(chan struct{}, workers)
 
-	for i, chunk := range chunks {
-		wg.Add(1)
-		go func(chunkIndex int, start, end int64) {
-			defer wg.Done()
-			limiter <- struct{}{}        // Acquire semaphore
-			defer func() { <-limiter }() // Release semaphore
-
-			// Get buffer from pool
-			buffer := bufferPool.Get().([]byte)
-			defer bufferPool.Put(buffer)
-
-			// Retry logic for chunk download
-			var lastErr error
-			for retry := 0; retry < MaxRetries; retry++ {
-				if err := c.downloadChunk(url, writer, start, end, bar, buffer); err != nil {
-					lastErr = err
-					time.Sleep(time.Second)
-					continue
+	fail := func(err error) {
+		failOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	fetch := func(chunkIndex int, start, end int64) {
+		limiter <- struct{}{}        // Acquire semaphore
+		defer func() { <-limiter }() // Release semaphore
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		// Get buffer from pool
+		buffer := bufferPool.Get().([]byte)
+		defer bufferPool.Put(buffer)
+
+		// Retry logic for chunk download
+		var lastErr error
+		for retry := 0; retry < MaxRetries; retry++ {
+			written, err := c.downloadChunk(ctx, url, w, start, end, bar, buffer)
+			if ctx.Err() != nil {
+				// Another chunk failed, this attempt was aborted
+				return
+			}
+			c.Stats.recordChunk(url, written, err)
+			if err == nil {
+				if c.Progress != nil {
+					c.Progress(outputPath, completed.Add(end-start), fileSize)
 				}
-				lastErr = nil
-				break
+				return
 			}
 
-			if lastErr != nil {
-				errors <- fmt.Errorf("chunk %d failed after %d retries: %v",
-					chunkIndex, MaxRetries, lastErr)
+			// The retry downloads the whole chunk again
+			_ = bar.Add64(-written)
+			if hasher != nil {
+				hasher.reset(start, end)
 			}
-		}(i, chunk.start, chunk.end)
-	}
+			lastErr = err
+			if isFatalChunkError(err) {
+				break
+			}
+			if c.ChunkRetry != nil && retry+1 < MaxRetries {
+				c.ChunkRetry(outputPath, url, retry+1, err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+		}
 
-	wg.Wait()
-	close(errors)
+		fail(fmt.Errorf("chunk %d failed: %w", chunkIndex, lastErr))
+	}
 
-	// Check for errors
-	var errMsgs []string
-	for err := range errors {
-		if err != nil {
-			errMsgs = append(errMsgs, err.Error())
+	// Measuring the host, the first chunk is fetched alone for the rate of a
+	// single stream, to compare with the rate of the others fetched together
+	first := 0
+	var began time.Time
+	var single, parallel float64
+	if probe {
+		defer func() { c.connections.settle(url, workers, single, parallel) }()
+		began = time.Now()
+		fetch(0, chunks[0].start, chunks[0].end)
+		if firstErr == nil {
+			single = rate(chunks[0].end-chunks[0].start, time.Since(began))
 		}
+		first = 1
+		began = time.Now()
 	}
 
-	if len(errMsgs) > 0 {
-		return fmt.Errorf("chunk download errors:\n%s",
-			strings.Join(errMsgs, "\n"))
+	for i, chunk := range chunks[first:] {
+		wg.Add(1)
+		go func(chunkIndex int, start, end int64) {
+			defer wg.Done()
+			fetch(chunkIndex, start, end)
+		}(first+i, chunk.start, chunk.end)
+	}
+
+	wg.Wait()
+	if probe && firstErr == nil {
+		parallel = rate(fileSize-chunks[0].end, time.Since(began))
 	}
 
-	fmt.Println() // New line after progress bar
+	if firstErr != nil {
+		return fmt.Errorf("chunk download aborted: %w", firstErr)
+	}
+
+	c.finishHashing(hasher, outputPath, fileSize)
 	return nil
 }
 
-func (c *Client) downloadChunk(url string, writer *BufferedFileWriter,
-	start, end int64, bar *progressbar.ProgressBar, buffer []byte) error {
+// downloadChunk fetches bytes start to end of url and writes them at their
+// offset in w, gathering up to a buffer of them per write. Chunks of a file are
+// written in parallel without any lock, as positional writes do not share a
+// file offset.
+func (c *Client) downloadChunk(ctx context.Context, url string, w io.WriterAt,
+	start, end int64, bar *progressBar, buffer []byte) (int64, error) {
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
+		return 0, fmt.Errorf("failed to create request: %v", err)
 	}
 
 	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
-	req.Header.Set("Referer", "https://laracasts.com/")
-	req.Header.Set("Origin", "https://laracasts.com")
+	req.Header.Set("Referer", c.Referer)
+	req.Header.Set("Origin", c.origin())
 	req.Header.Set("Accept", "*/*")
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.Stream(req)
 	if err != nil {
-		return fmt.Errorf("chunk request failed: %v", err)
+		return 0, fmt.Errorf("chunk request failed: %w", err)
 	}
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
@@ -368,33 +732,36 @@ func (c *Client) downloadChunk(url string, writer *BufferedFileWriter,
 		}
 	}(resp.Body)
 
-	if resp.StatusCode != http.StatusPartialContent {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK, http.StatusRequestedRangeNotSatisfiable:
+		return 0, fmt.Errorf("%w (status %d)", errRangeUnsupported, resp.StatusCode)
+	default:
+		return 0, &chunkStatusError{StatusCode: resp.StatusCode}
 	}
 
-	// Read and write chunk using buffer
-	reader := bufio.NewReader(resp.Body)
+	body := io.LimitReader(resp.Body, end-start)
 	written := int64(0)
 
 	for written < end-start {
-		n, err := reader.Read(buffer)
-		if err != nil && err != io.EOF {
-			return fmt.Errorf("failed to read chunk: %v", err)
+		n, err := io.ReadFull(body, buffer)
+		if n > 0 {
+			if _, err := w.WriteAt(buffer[:n], start+written); err != nil {
+				return written, fmt.Errorf("failed to write chunk: %w", err)
+			}
+			written += int64(n)
+			_ = bar.Add64(int64(n)) // progress display only
 		}
-		if n == 0 {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
 			break
 		}
-
-		if _, err := writer.WriteAt(buffer[:n], start+written); err != nil {
-			return fmt.Errorf("failed to write chunk: %v", err)
-		}
-
-		written += int64(n)
-		err = bar.Add64(int64(n))
 		if err != nil {
-			return err
+			return written, fmt.Errorf("failed to read chunk: %w", err)
 		}
 	}
 
-	return nil
+	if written != end-start {
+		return written, fmt.Errorf("incomplete chunk: got %d of %d bytes", written, end-start)
+	}
+	return written, nil
 }
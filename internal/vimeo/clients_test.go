@@ -0,0 +1,804 @@
+package vimeo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const benchFileSize = 64 * 1024 * 1024
+
+// seekWriter writes the way chunks used to be written: seeking the shared
+// handle and flushing a shared buffered writer under a lock on every call
+type seekWriter struct {
+	mu   sync.Mutex
+	file *os.File
+	buf  []byte
+}
+
+func (w *seekWriter) WriteAt(p []byte, off int64) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.file.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	w.buf = append(w.buf[:0], p...)
+	return w.file.Write(w.buf)
+}
+
+// BenchmarkChunkWrites writes a file in parallel chunks the way
+// downloadWithChunks does, without the network
+func BenchmarkChunkWrites(b *testing.B) {
+	data := bytes.Repeat([]byte{0xab}, ChunkBuffer)
+
+	for _, bench := range []struct {
+		name   string
+		buffer int
+		open   func(path string) (io.WriterAt, io.Closer, error)
+	}{
+		{"seek-flush", MemoryBuffer, func(path string) (io.WriterAt, io.Closer, error) {
+			file, err := createChunkFile(path, benchFileSize)
+			return &seekWriter{file: file}, file, err
+		}},
+		{"write-at", MemoryBuffer, func(path string) (io.WriterAt, io.Closer, error) {
+			file, err := createChunkFile(path, benchFileSize)
+			return file, file, err
+		}},
+		{"write-at-buffered", ChunkBuffer, func(path string) (io.WriterAt, io.Closer, error) {
+			file, err := createChunkFile(path, benchFileSize)
+			return file, file, err
+		}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.SetBytes(benchFileSize)
+			path := filepath.Join(b.TempDir(), "video.mp4")
+			chunkSize := int64(benchFileSize / MaxChunkWorkers)
+
+			for i := 0; i < b.N; i++ {
+				w, closer, err := bench.open(path)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				var wg sync.WaitGroup
+				for start := int64(0); start < benchFileSize; start += chunkSize {
+					end := min(start+chunkSize, benchFileSize)
+					wg.Add(1)
+					go func(start, end int64) {
+						defer wg.Done()
+						for off := start; off < end; off += int64(bench.buffer) {
+							n := min(int64(bench.buffer), end-off)
+							if _, err := w.WriteAt(data[:n], off); err != nil {
+								b.Error(err)
+								return
+							}
+						}
+					}(start, end)
+				}
+				wg.Wait()
+				if err := closer.Close(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkDownloadWithChunks downloads a file from a local server in chunks
+func BenchmarkDownloadWithChunks(b *testing.B) {
+	data := bytes.Repeat([]byte{0xab}, benchFileSize)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "video.mp4", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	out := transfers.out
+	transfers.out = io.Discard
+	defer func() { transfers.out = out }()
+
+	client := NewClient(server.Client())
+	client.ChunkSize = benchFileSize / MaxChunkWorkers
+	client.AdaptiveConnections = false
+	path := filepath.Join(b.TempDir(), "video.mp4")
+
+	b.SetBytes(benchFileSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := client.downloadWithChunks(server.URL, path, benchFileSize); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestAdaptiveConnections(t *testing.T) {
+	const fileSize, block = 1024 * 1024, 16 * 1024
+	data := bytes.Repeat([]byte{0xcd}, fileSize)
+
+	for _, tt := range []struct {
+		name   string
+		shared bool // every connection shares the throttled line
+		want   int
+	}{
+		{"throttled per line", true, 1},
+		{"throttled per connection", false, 4},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var line sync.Mutex
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var start, end int
+				if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, fileSize))
+				w.WriteHeader(http.StatusPartialContent)
+				for off := start; off <= end; off += block {
+					if tt.shared {
+						line.Lock()
+					}
+					w.Write(data[off:min(off+block, end+1)])
+					time.Sleep(5 * time.Millisecond)
+					if tt.shared {
+						line.Unlock()
+					}
+				}
+			}))
+			defer server.Close()
+
+			c := NewClient(server.Client())
+			c.ChunkWorkers = 4
+			c.ChunkSize = 64 * 1024
+			path := filepath.Join(t.TempDir(), "video.mp4")
+			if err := c.downloadWithChunks(server.URL+"/video.mp4", path, fileSize); err != nil {
+				t.Fatalf("downloadWithChunks() error = %v", err)
+			}
+			if got, _ := os.ReadFile(path); !bytes.Equal(got, data) {
+				t.Error("downloaded file differs from the served one")
+			}
+
+			limit, probe := c.connections.start(server.URL + "/other.mp4")
+			if limit != tt.want || probe {
+				t.Errorf("start() = %d, %v, want %d requests at once settled on", limit, probe, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdaptiveConnectionsMeasureAlone(t *testing.T) {
+	const url = "https://cdn.example.com/video.mp4"
+	var c connectionTuner
+	started := func() <-chan int {
+		ch := make(chan int, 1)
+		go func() {
+			limit, _ := c.start(url)
+			ch <- limit
+		}()
+		return ch
+	}
+
+	if _, probe := c.start(url); !probe {
+		t.Fatal("first download does not measure the host")
+	}
+	// Downloads starting meanwhile wait for the measurement
+	waiting := started()
+	select {
+	case <-waiting:
+		t.Fatal("download started while the host was measured")
+	case <-time.After(50 * time.Millisecond):
+	}
+	c.settle(url, 4, 100, 105)
+	if limit := <-waiting; limit != 1 {
+		t.Errorf("limit = %d after a measurement without gain, want 1", limit)
+	}
+
+	// Due to be measured again, new downloads wait for the running ones
+	c.mu.Lock()
+	c.hosts[chunkHost(url)].settled = time.Now().Add(-ReprobeInterval)
+	c.mu.Unlock()
+	waiting = started()
+	select {
+	case <-waiting:
+		t.Fatal("download started before the others ended")
+	case <-time.After(50 * time.Millisecond):
+	}
+	c.end(url)
+	c.end(url)
+	if limit := <-waiting; limit != 0 {
+		t.Errorf("limit = %d measuring again, want every request", limit)
+	}
+
+	// Parallel requests that became faster are used again
+	c.settle(url, 4, 100, 200)
+	c.end(url)
+	if limit, probe := c.start(url); limit != 4 || probe {
+		t.Errorf("start() = %d, %v, want 4 requests at once settled on", limit, probe)
+	}
+}
+
+func TestStreamOutlastsClientTimeout(t *testing.T) {
+	const size = 64 * 1024
+	data := bytes.Repeat([]byte{0xef}, size)
+	stall := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprint(size))
+		for off := 0; off < size; off += 8 * 1024 {
+			if r.URL.Path == "/stalled.mp4" && off > 0 {
+				select {
+				case <-stall:
+				case <-r.Context().Done():
+				}
+				return
+			}
+			w.Write(data[off : off+8*1024])
+			w.(http.Flusher).Flush()
+			time.Sleep(40 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+	defer close(stall)
+
+	idle := StreamIdleTimeout
+	StreamIdleTimeout = 150 * time.Millisecond
+	defer func() { StreamIdleTimeout = idle }()
+
+	// The whole body takes longer than the client timeout, but bytes keep
+	// coming
+	httpClient := server.Client()
+	httpClient.Timeout = 100 * time.Millisecond
+	c := NewClient(httpClient)
+	c.Preallocate = false
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	if err := c.downloadSequential(server.URL+"/video.mp4", path, size); err != nil {
+		t.Fatalf("downloadSequential() error = %v", err)
+	}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, data) {
+		t.Error("downloaded file differs from the served one")
+	}
+
+	var buf bytes.Buffer
+	if _, err := c.fetchWhole(server.URL+"/stalled.mp4", &buf, size, newProgressBar(size)); !errors.Is(err, errStalled) {
+		t.Errorf("fetchWhole() of a stalled body error = %v, want errStalled", err)
+	}
+}
+
+func TestPieceHasher(t *testing.T) {
+	const pieceSize = 1000
+	data := make([]byte, 3500)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	want := make([]string, 0, 4)
+	for start := 0; start < len(data); start += pieceSize {
+		sum := sha256.Sum256(data[start:min(start+pieceSize, len(data))])
+		want = append(want, hex.EncodeToString(sum[:]))
+	}
+
+	t.Run("in order", func(t *testing.T) {
+		hasher := newPieceHasher(int64(len(data)), pieceSize)
+		for off := 0; off < len(data); off += 300 {
+			hasher.write(data[off:min(off+300, len(data))], int64(off))
+		}
+		// Every piece was hashed as written, the file is not read back
+		got, err := hasher.sums(filepath.Join(t.TempDir(), "missing.mp4"), int64(len(data)))
+		if err != nil || !slices.Equal(got, want) {
+			t.Errorf("sums() = %v, %v, want %v", got, err, want)
+		}
+	})
+
+	t.Run("out of order with retry", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "video.mp4")
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		// Chunks of 1500 bytes written last to first, the middle one twice
+		hasher := newPieceHasher(int64(len(data)), pieceSize)
+		hasher.write(data[3000:], 3000)
+		hasher.write(data[1500:2000], 1500)
+		hasher.reset(1500, 3000)
+		hasher.write(data[1500:3000], 1500)
+		hasher.write(data[:1500], 0)
+
+		got, err := hasher.sums(path, int64(len(data)))
+		if err != nil || !slices.Equal(got, want) {
+			t.Errorf("sums() = %v, %v, want %v", got, err, want)
+		}
+	})
+}
+
+func TestHeadRetriesTransientFailures(t *testing.T) {
+	var mu sync.Mutex
+	hits := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		first := hits[r.URL.Path] == 1
+		mu.Unlock()
+		switch {
+		case r.URL.Path == "/missing.mp4":
+			http.NotFound(w, r)
+		case first:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.Header().Set("Content-Length", "1024")
+		}
+	}))
+	defer server.Close()
+	c := NewClient(server.Client())
+
+	size, ranges, err := c.head(server.URL + "/video.mp4")
+	if err != nil || size != 1024 || !ranges {
+		t.Errorf("head() = %d, %v, %v, want the size after retrying the 503", size, ranges, err)
+	}
+	if _, _, err := c.head(server.URL + "/missing.mp4"); err == nil {
+		t.Error("head() of a missing file succeeded")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if hits["/video.mp4"] != 2 || hits["/missing.mp4"] != 1 {
+		t.Errorf("requests = %v, want the 503 retried once and the 404 not retried", hits)
+	}
+}
+
+func TestRendererLogsWithoutTerminal(t *testing.T) {
+	var out bytes.Buffer
+	r := &renderer{out: &out, logInterval: 300 * time.Millisecond}
+
+	bar := r.add("Downloading", 100, true)
+	bar.Add64(50)
+	time.Sleep(450 * time.Millisecond)
+	r.remove(bar)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if strings.Contains(out.String(), "\r") || len(lines) != 1 {
+		t.Fatalf("output = %q, want a single status line without redraws", out.String())
+	}
+	if !strings.Contains(lines[0], " 50% ") {
+		t.Errorf("status line = %q, want the progress of the transfer", lines[0])
+	}
+}
+
+func testBar(description string, current, total int64, inBytes bool) *progressBar {
+	b := &progressBar{description: description, bytes: inBytes, started: time.Now()}
+	b.total.Store(total)
+	b.current.Store(current)
+	return b
+}
+
+func TestRenderBar(t *testing.T) {
+	tests := []struct {
+		current, total int64
+		want           string
+	}{
+		{0, 0, "     [------------------------------]"},
+		{0, 100, "  0% [>                             ]"},
+		{50, 100, " 50% [===============>              ]"},
+		{100, 100, "100% [==============================]"},
+		{150, 100, "100% [==============================]"},
+		{-5, 100, "  0% [>                             ]"},
+	}
+	for _, tt := range tests {
+		if got := renderBar(tt.current, tt.total); got != tt.want {
+			t.Errorf("renderBar(%d, %d) = %q, want %q", tt.current, tt.total, got, tt.want)
+		}
+	}
+}
+
+func TestRendererDrawSumsBarsUp(t *testing.T) {
+	var out bytes.Buffer
+	r := &renderer{out: &out, interactive: true}
+	r.draw([]*progressBar{
+		testBar("Downloading", 1024, 2048, true),
+		testBar("Downloading", 1024, 2048, true),
+		testBar("Remuxing", 30, 60, false),
+	})
+
+	line := out.String()
+	for _, want := range []string{"\rDownloading 2 files  50% [", "(2.0 KB/4.0 KB, ", " | Remuxing  50% [", "(30s/60s)"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("line %q misses %q", line, want)
+		}
+	}
+	if strings.Contains(line, "\n") {
+		t.Errorf("line %q ends the line, want it redrawn in place", line)
+	}
+
+	// A shorter line blanks out what is left of the longer one
+	out.Reset()
+	width := r.width
+	r.draw([]*progressBar{testBar("Remuxing", 60, 60, false)})
+	if got := len(out.String()) - 1; got != width {
+		t.Errorf("redrawn line is %d wide, want the %d of the previous one", got, width)
+	}
+}
+
+func TestRendererPrintfClearsTheProgressLine(t *testing.T) {
+	var out bytes.Buffer
+	r := &renderer{out: &out, interactive: true}
+	r.draw([]*progressBar{testBar("Downloading", 512, 1024, true)})
+	width := r.width
+
+	out.Reset()
+	r.printf("✅ Worker %d completed episode %d\n", 1, 2)
+	want := "\r" + strings.Repeat(" ", width) + "\r✅ Worker 1 completed episode 2\n"
+	if out.String() != want {
+		t.Errorf("printf() wrote %q, want %q", out.String(), want)
+	}
+	if r.width != 0 {
+		t.Errorf("width = %d after printf(), want the next line drawn from scratch", r.width)
+	}
+
+	// Nothing to clear once the line is gone, nor without a terminal
+	for _, r := range []*renderer{r, {out: &out, width: width}} {
+		out.Reset()
+		r.printf("next\n")
+		if out.String() != "next\n" {
+			t.Errorf("printf() wrote %q, want only the message", out.String())
+		}
+	}
+}
+
+// dashServer serves a master.json with two video renditions and one audio
+// stream, each of two segments
+func dashServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	init := base64.StdEncoding.EncodeToString([]byte("init|"))
+	playlist := `{"base_url": "../",
+		"video": [
+			{"id": "v360", "base_url": "v360/", "codecs": "avc1", "bitrate": 500000, "height": 360, "init_segment": "` + init + `",
+			 "segments": [{"url": "s1.m4s", "size": 3}, {"url": "s2.m4s", "size": 3}]},
+			{"id": "v1080", "base_url": "v1080/", "codecs": "avc1", "bitrate": 4000000, "height": 1080, "init_segment": "` + init + `",
+			 "segments": [{"url": "s1.m4s", "size": 3}, {"url": "s2.m4s", "size": 3}]}],
+		"audio": [
+			{"id": "a64", "base_url": "a64/", "codecs": "mp4a", "bitrate": 64000, "init_segment": "` + init + `",
+			 "segments": [{"url": "s1.m4s", "size": 3}]},
+			{"id": "a128", "base_url": "a128/", "codecs": "mp4a", "bitrate": 128000, "init_segment": "` + init + `",
+			 "segments": [{"url": "s1.m4s", "size": 3}]}]}`
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/dash/sep/master.json":
+			w.Write([]byte(playlist))
+		case strings.HasSuffix(r.URL.Path, ".m4s"):
+			// The segment body names the rendition and segment it is from
+			stream := filepath.Base(filepath.Dir(r.URL.Path))
+			w.Write([]byte(stream + ":" + strings.TrimSuffix(filepath.Base(r.URL.Path), ".m4s") + "|"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestDashStreams(t *testing.T) {
+	server := dashServer(t)
+	defer server.Close()
+	c := NewClient(server.Client())
+
+	playlist, base, err := c.fetchDashPlaylist(server.URL + "/dash/sep/master.json")
+	if err != nil {
+		t.Fatalf("fetchDashPlaylist() error = %v", err)
+	}
+	if base.String() != server.URL+"/dash/" {
+		t.Errorf("base = %s, want the playlist base URL resolved", base)
+	}
+
+	for quality, want := range map[string]string{"": "v1080", "1080p": "v1080", "720p": "v360", "240p": "v1080"} {
+		video, audio := selectDashStreams(playlist, quality)
+		if video.ID != want || audio.ID != "a128" {
+			t.Errorf("selectDashStreams(%q) = %s, %s, want %s, a128", quality, video.ID, audio.ID, want)
+		}
+	}
+
+	video, _ := selectDashStreams(playlist, "720p")
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	bar := newProgressBar(6)
+	err = c.downloadDashStream(base, video, path, bar)
+	bar.Finish()
+	if err != nil {
+		t.Fatalf("downloadDashStream() error = %v", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "init|v360:s1|v360:s2|" {
+		t.Errorf("stream file = %q, want the init segment followed by the segments in order", got)
+	}
+}
+
+func TestDashOnlyVideoNeedsFFmpeg(t *testing.T) {
+	server := dashServer(t)
+	defer server.Close()
+	c := NewClient(server.Client())
+	c.HasFFmpeg = false
+
+	var config VideoConfig
+	body := `{"request": {"files": {"dash": {"default_cdn": "akfire", "cdns": {"akfire": {"url": "` +
+		server.URL + `/dash/sep/master.json"}}}}}}`
+	if err := json.Unmarshal([]byte(body), &config); err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(t.TempDir(), "video.mp4")
+	if err := c.DownloadVideo(&config, "", output); !errors.Is(err, ErrFFmpegMissing) {
+		t.Errorf("DownloadVideo() error = %v, want ErrFFmpegMissing", err)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("output exists without ffmpeg to merge the streams")
+	}
+}
+
+// fakeFFmpeg puts an ffmpeg on the PATH that reports covering 60 seconds and
+// appends to its last argument, or fails when fail is set. It returns the
+// file the arguments of its last run are written to, one per line.
+func fakeFFmpeg(t *testing.T, fail bool) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ffmpeg is a shell script")
+	}
+	dir := t.TempDir()
+	argsPath := filepath.Join(dir, "args")
+	script := "#!/bin/sh\nprintf '%s\\n' \"$@\" > '" + argsPath + "'\n"
+	if fail {
+		script += "exit 1\n"
+	} else {
+		script += "for last; do :; done\necho out_time_us=60000000\necho remuxed >> \"$last\"\n"
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ffmpeg"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+	return argsPath
+}
+
+// ffmpegArgs returns the arguments of the last run of fakeFFmpeg
+func ffmpegArgs(t *testing.T, argsPath string) []string {
+	t.Helper()
+	data, err := os.ReadFile(argsPath)
+	if err != nil {
+		t.Fatalf("ffmpeg did not run: %v", err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func TestFFmpegRestartsInterruptedStreams(t *testing.T) {
+	c := NewClient(http.DefaultClient)
+	c.HasFFmpeg = true
+	outputPath := filepath.Join(t.TempDir(), "stream.mp4")
+
+	// A failed remux never becomes the output
+	fakeFFmpeg(t, true)
+	if err := c.runFFmpeg("http://example.com/stream.m3u8", outputPath, 60); !errors.Is(err, ErrFFmpegFailed) {
+		t.Fatalf("runFFmpeg() error = %v, want %v", err, ErrFFmpegFailed)
+	}
+	if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+		t.Errorf("output exists after the remux failed")
+	}
+
+	// The next attempt drops what the interrupted one wrote and starts over
+	if err := os.WriteFile(partialPath(outputPath), []byte("stale\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fakeFFmpeg(t, false)
+	if err := c.runFFmpeg("http://example.com/stream.m3u8", outputPath, 60); err != nil {
+		t.Fatalf("runFFmpeg() error = %v", err)
+	}
+	if data, err := os.ReadFile(outputPath); err != nil || string(data) != "remuxed\n" {
+		t.Errorf("output = %q (%v), want only the remuxed stream", data, err)
+	}
+	if _, err := os.Stat(partialPath(outputPath)); !os.IsNotExist(err) {
+		t.Errorf("partial stream left behind after the remux completed")
+	}
+}
+
+// subtitleServer serves a WebVTT track for every path but /missing.vtt
+func subtitleServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.vtt" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, "WEBVTT\n\n00:00.000 --> 00:01.000\n%s\n", r.URL.Path)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestEmbedSubtitles(t *testing.T) {
+	server := subtitleServer(t)
+	var config VideoConfig
+	config.Request.TextTracks = []TextTrack{
+		{Lang: "en", Label: "English", URL: server.URL + "/en.vtt"},
+		{Lang: "es", Label: "Español", URL: server.URL + "/es.vtt"},
+	}
+
+	for _, tt := range []struct {
+		ext, codec string
+	}{
+		{".mp4", "mov_text"},
+		{".mkv", "srt"},
+	} {
+		t.Run(tt.ext, func(t *testing.T) {
+			argsPath := fakeFFmpeg(t, false)
+			c := NewClient(http.DefaultClient)
+			c.HasFFmpeg = true
+			videoPath := filepath.Join(t.TempDir(), "episode"+tt.ext)
+			if err := os.WriteFile(videoPath, []byte("video\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := c.EmbedSubtitles(&config, videoPath); err != nil {
+				t.Fatalf("EmbedSubtitles() error = %v", err)
+			}
+
+			args := ffmpegArgs(t, argsPath)
+			muxed := args[len(args)-1]
+			if filepath.Ext(muxed) != tt.ext {
+				t.Errorf("muxed into %s, want the container of the video", filepath.Base(muxed))
+			}
+			subs := filepath.Dir(muxed)
+			want := []string{
+				"-i", videoPath,
+				"-i", filepath.Join(subs, "0.vtt"),
+				"-i", filepath.Join(subs, "1.vtt"),
+				"-map", "0", "-map", "1:s", "-map", "2:s",
+				"-c", "copy", "-c:s", tt.codec,
+				"-metadata:s:s:0", "language=en", "-metadata:s:s:0", "title=English",
+				"-metadata:s:s:1", "language=es", "-metadata:s:s:1", "title=Español",
+				"-y", muxed,
+			}
+			if !slices.Equal(args, want) {
+				t.Errorf("ffmpeg args =\n%q\nwant\n%q", args, want)
+			}
+
+			if data, err := os.ReadFile(videoPath); err != nil || string(data) != "remuxed\n" {
+				t.Errorf("video = %q (%v), want it replaced by the muxed one", data, err)
+			}
+			if _, err := os.Stat(subs); !os.IsNotExist(err) {
+				t.Errorf("subtitle folder %s left behind", filepath.Base(subs))
+			}
+		})
+	}
+}
+
+func TestEmbedSubtitlesSkipsFailedTracks(t *testing.T) {
+	server := subtitleServer(t)
+	argsPath := fakeFFmpeg(t, false)
+	c := NewClient(http.DefaultClient)
+	c.HasFFmpeg = true
+	videoPath := filepath.Join(t.TempDir(), "episode.mp4")
+	if err := os.WriteFile(videoPath, []byte("video\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var config VideoConfig
+	config.Request.TextTracks = []TextTrack{
+		{Lang: "fr", Label: "Français", URL: server.URL + "/missing.vtt"},
+		{Lang: "en", Label: "English", URL: server.URL + "/en.vtt"},
+	}
+	if err := c.EmbedSubtitles(&config, videoPath); err != nil {
+		t.Fatalf("EmbedSubtitles() error = %v", err)
+	}
+
+	// Only the English track is muxed in, as the first subtitle stream
+	args := ffmpegArgs(t, argsPath)
+	if got := strings.Count(strings.Join(args, " "), "-map "); got != 2 {
+		t.Errorf("ffmpeg maps %d inputs, want the video and one track: %q", got, args)
+	}
+	for _, arg := range []string{"language=en", "title=English"} {
+		if i := slices.Index(args, arg); i < 1 || args[i-1] != "-metadata:s:s:0" {
+			t.Errorf("ffmpeg args %q lack -metadata:s:s:0 %s", args, arg)
+		}
+	}
+	if slices.Contains(args, "language=fr") {
+		t.Errorf("ffmpeg args %q include the track that failed to download", args)
+	}
+
+	// Without any track to embed the video is left alone
+	config.Request.TextTracks = config.Request.TextTracks[:1]
+	if err := os.Remove(argsPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.EmbedSubtitles(&config, videoPath); err == nil {
+		t.Error("EmbedSubtitles() without any track downloaded succeeded, want error")
+	}
+	if _, err := os.Stat(argsPath); !os.IsNotExist(err) {
+		t.Error("ffmpeg ran without a track to embed")
+	}
+}
+
+func TestHLSSegmentCacheResumes(t *testing.T) {
+	master := "#EXTM3U\n" +
+		`#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aud",NAME="en",DEFAULT=YES,URI="audio/index.m3u8"` + "\n" +
+		`#EXT-X-STREAM-INF:BANDWIDTH=400000,CODECS="avc1,mp4a",AUDIO="aud"` + "\nlow/index.m3u8\n" +
+		`#EXT-X-STREAM-INF:BANDWIDTH=2000000,CODECS="avc1,mp4a",AUDIO="aud"` + "\nhigh/index.m3u8?token=abc\n"
+	media := "#EXTM3U\n#EXT-X-TARGETDURATION:6\n#EXT-X-MAP:URI=\"init.mp4\"\n" +
+		"#EXTINF:6.0,\nseg-1.m4s\n#EXTINF:6.0,\nseg-2.m4s\n#EXTINF:3.0,\nseg-3.m4s\n#EXT-X-ENDLIST\n"
+
+	var mu sync.Mutex
+	fetched := make(map[string]int)
+	failing := "/hls/high/seg-2.m4s"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched[r.URL.Path]++
+		fail := r.URL.Path == failing
+		mu.Unlock()
+		switch {
+		case fail:
+			w.WriteHeader(http.StatusForbidden)
+		case r.URL.Path == "/hls/master.m3u8":
+			w.Write([]byte(master))
+		case strings.HasSuffix(r.URL.Path, ".m3u8"):
+			w.Write([]byte(media))
+		default:
+			w.Write([]byte(r.URL.Path))
+		}
+	}))
+	defer server.Close()
+	c := NewClient(server.Client())
+	dir := filepath.Join(t.TempDir(), "video.mp4.hls")
+
+	playlists, err := c.fetchHLSPlaylists(server.URL + "/hls/master.m3u8")
+	if err != nil {
+		t.Fatalf("fetchHLSPlaylists() error = %v", err)
+	}
+	if len(playlists) != 2 || playlists[0].segments[0].url != server.URL+"/hls/high/init.mp4" {
+		t.Fatalf("playlists = %+v, want the high variant and its audio rendition", playlists)
+	}
+	if _, err := c.cacheHLSSegments(playlists, dir, ""); err == nil {
+		t.Fatal("cacheHLSSegments() succeeded with a failing segment")
+	}
+
+	mu.Lock()
+	failing = ""
+	mu.Unlock()
+	inputs, err := c.cacheHLSSegments(playlists, dir, "")
+	if err != nil {
+		t.Fatalf("cacheHLSSegments() error = %v", err)
+	}
+	if !slices.Equal(inputs, []string{filepath.Join(dir, "video.m3u8"), filepath.Join(dir, "audio.m3u8")}) {
+		t.Errorf("inputs = %v, want the local video and audio playlists", inputs)
+	}
+
+	for path, n := range fetched {
+		if path != "/hls/high/seg-2.m4s" && strings.HasSuffix(path, ".m4s") && n != 1 {
+			t.Errorf("%s fetched %d times, want segments of the failed attempt kept", path, n)
+		}
+	}
+	local, _ := os.ReadFile(filepath.Join(dir, "video.m3u8"))
+	if !strings.Contains(string(local), `#EXT-X-MAP:URI="video-init.mp4"`) || !strings.Contains(string(local), "\nvideo-00002.m4s\n") {
+		t.Errorf("local playlist = %q, want segments referred to by their cached names", local)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "video-00002.m4s")); string(got) != "/hls/high/seg-2.m4s" {
+		t.Errorf("cached segment = %q, want the body of the retried segment", got)
+	}
+}
+
+func TestPlayerHash(t *testing.T) {
+	for rawURL, want := range map[string]string{
+		"https://player.vimeo.com/video/76979871?h=8272103f6e":         "8272103f6e",
+		"https://player.vimeo.com/video/76979871?h=8272103f6e&badge=0": "8272103f6e",
+		"https://vimeo.com/76979871/8272103f6e":                        "8272103f6e",
+		"https://player.vimeo.com/video/76979871":                      "",
+		"": "",
+	} {
+		if got := PlayerHash(rawURL); got != want {
+			t.Errorf("PlayerHash(%q) = %q, want %q", rawURL, got, want)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package vimeo
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/fsutil"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// dashPlaylist is the master.json a Vimeo DASH CDN URL points at: separate
+// video and audio streams, each an init segment followed by media segments.
+// ffmpeg cannot read it, so the segments are fetched here and only merged by
+// ffmpeg.
+type dashPlaylist struct {
+	BaseURL string       `json:"base_url"`
+	Video   []dashStream `json:"video"`
+	Audio   []dashStream `json:"audio"`
+}
+
+// dashStream is one rendition of a playlist; its base URL is relative to the
+// playlist's, and its segment URLs to its own
+type dashStream struct {
+	ID          string        `json:"id"`
+	BaseURL     string        `json:"base_url"`
+	Codecs      string        `json:"codecs"`
+	Bitrate     int           `json:"bitrate"`
+	Height      int           `json:"height"`
+	InitSegment string        `json:"init_segment"` // base64
+	Segments    []dashSegment `json:"segments"`
+}
+
+type dashSegment struct {
+	URL  string `json:"url"`
+	Size int64  `json:"size"`
+}
+
+// errNotSegmented is returned for DASH URLs that do not serve a segmented
+// playlist, which are left to ffmpeg as they are
+var errNotSegmented = errors.New("not a segmented DASH playlist")
+
+// downloadDashVideo saves a DASH stream to outputPath. Playlists with
+// separate audio and video streams are downloaded segment by segment and
+// merged with ffmpeg; anything else is handed to ffmpeg directly.
+func (c *Client) downloadDashVideo(playlistURL, quality, outputPath string, duration int) error {
+	progressPath := outputPath // as the caller knows the video
+	outputPath = ContainerPath(outputPath, c.Container)
+	Printf("Downloading DASH stream: %s\n", filepath.Base(outputPath))
+
+	playlist, base, err := c.fetchDashPlaylist(playlistURL)
+	if errors.Is(err, errNotSegmented) {
+		return c.runFFmpeg(playlistURL, outputPath, duration)
+	}
+	if err != nil {
+		return err
+	}
+
+	video, audio := selectDashStreams(playlist, quality)
+	if video == nil {
+		return c.runFFmpeg(playlistURL, outputPath, duration)
+	}
+	printDashStreams(playlist, video, audio)
+	if !c.HasFFmpeg {
+		return ErrFFmpegMissing
+	}
+	return c.mergeDashStreams(base, video, audio, outputPath, progressPath, duration)
+}
+
+// fetchDashPlaylist fetches and parses the playlist at playlistURL, returning
+// it with the URL its streams are relative to
+func (c *Client) fetchDashPlaylist(playlistURL string) (*dashPlaylist, *url.URL, error) {
+	body, err := c.fetchSegment(playlistURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch DASH playlist: %w", err)
+	}
+
+	var playlist dashPlaylist
+	if err := json.Unmarshal(body, &playlist); err != nil || len(playlist.Video) == 0 {
+		return nil, nil, errNotSegmented
+	}
+
+	base, err := url.Parse(playlistURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if playlist.BaseURL != "" {
+		ref, err := url.Parse(playlist.BaseURL)
+		if err != nil {
+			return nil, nil, err
+		}
+		base = base.ResolveReference(ref)
+	}
+	return &playlist, base, nil
+}
+
+// selectDashStreams picks the video stream matching quality, or the highest
+// one below it, the way progressive downloads do, and the audio stream of
+// the highest bitrate. audio is nil for videos without sound.
+func selectDashStreams(playlist *dashPlaylist, quality string) (video, audio *dashStream) {
+	requested := 0
+	if quality != "" {
+		if _, err := fmt.Sscanf(quality, "%dp", &requested); err != nil {
+			requested = 0
+		}
+	}
+
+	var best, fitting *dashStream
+	for i := range playlist.Video {
+		s := &playlist.Video[i]
+		if best == nil || s.Height > best.Height || (s.Height == best.Height && s.Bitrate > best.Bitrate) {
+			best = s
+		}
+		if requested > 0 && s.Height <= requested && (fitting == nil || s.Height > fitting.Height || (s.Height == fitting.Height && s.Bitrate > fitting.Bitrate)) {
+			fitting = s
+		}
+	}
+	video = best
+	if fitting != nil {
+		video = fitting
+	}
+
+	for i := range playlist.Audio {
+		if s := &playlist.Audio[i]; audio == nil || s.Bitrate > audio.Bitrate {
+			audio = s
+		}
+	}
+	return video, audio
+}
+
+// printDashStreams lists the renditions of a playlist and the ones selected
+func printDashStreams(playlist *dashPlaylist, video, audio *dashStream) {
+	var heights []string
+	for _, s := range playlist.Video {
+		heights = append(heights, fmt.Sprintf("%dp", s.Height))
+	}
+	Printf("Separate DASH streams: video %s; %d audio\n", strings.Join(heights, ", "), len(playlist.Audio))
+	if audio == nil {
+		Printf("Merging %dp video (%s), no audio stream\n", video.Height, video.Codecs)
+		return
+	}
+	Printf("Merging %dp video (%s) with %d kbps audio (%s)\n", video.Height, video.Codecs, audio.Bitrate/1000, audio.Codecs)
+}
+
+// mergeDashStreams downloads the video and audio streams next to outputPath
+// and muxes them into it with ffmpeg, without re-encoding. Progress is
+// reported as that of progressPath.
+func (c *Client) mergeDashStreams(base *url.URL, video, audio *dashStream, outputPath, progressPath string, duration int) error {
+	streams := []*dashStream{video}
+	if audio != nil {
+		streams = append(streams, audio)
+	}
+
+	var total int64
+	for _, s := range streams {
+		for _, segment := range s.Segments {
+			total += segment.Size
+		}
+	}
+	bar := c.follow(newProgressBar(total), progressPath)
+	defer bar.Finish()
+
+	var inputs []string
+	defer func() {
+		for _, input := range inputs {
+			os.Remove(input)
+		}
+	}()
+	for i, s := range streams {
+		path := fmt.Sprintf("%s.stream%d.mp4", partialPath(outputPath), i)
+		inputs = append(inputs, path)
+		if err := c.downloadDashStream(base, s, path, bar); err != nil {
+			return err
+		}
+	}
+
+	extra := []string{"-map", "0:v:0"}
+	if audio != nil {
+		extra = append(extra, "-map", "1:a:0")
+	}
+	return c.runFFmpegInputs(inputs, outputPath, duration, extra...)
+}
+
+// downloadDashStream writes the init segment and every media segment of s to
+// path, in order
+func (c *Client) downloadDashStream(base *url.URL, s *dashStream, path string, bar *progressBar) error {
+	ref, err := url.Parse(s.BaseURL)
+	if err != nil {
+		return fmt.Errorf("invalid DASH stream URL %q: %v", s.BaseURL, err)
+	}
+	streamBase := base.ResolveReference(ref)
+
+	init, err := base64.StdEncoding.DecodeString(s.InitSegment)
+	if err != nil {
+		return fmt.Errorf("invalid init segment of DASH stream %s: %v", s.ID, err)
+	}
+
+	file, err := fsutil.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(init); err != nil {
+		return err
+	}
+	for _, segment := range s.Segments {
+		ref, err := url.Parse(segment.URL)
+		if err != nil {
+			return fmt.Errorf("invalid DASH segment URL %q: %v", segment.URL, err)
+		}
+		data, err := c.fetchSegment(streamBase.ResolveReference(ref).String())
+		if err != nil {
+			return fmt.Errorf("failed to download DASH segment %s: %w", segment.URL, err)
+		}
+		if _, err := file.Write(data); err != nil {
+			return err
+		}
+		bar.Add64(int64(len(data)))
+	}
+	return file.Close()
+}
+
+// fetchSegment returns the body of rawURL, retrying connection failures, rate
+// limiting and server errors like chunks are
+func (c *Client) fetchSegment(rawURL string) ([]byte, error) {
+	var err error
+	for retry := 0; retry < MaxRetries; retry++ {
+		if retry > 0 {
+			time.Sleep(time.Second * time.Duration(retry))
+		}
+
+		var data []byte
+		var status int
+		data, status, err = c.fetchSegmentOnce(rawURL)
+		if c.Stats != nil {
+			c.Stats.recordChunk(rawURL, int64(len(data)), err)
+		}
+		if err == nil || (status != 0 && status != http.StatusTooManyRequests && status < 500) {
+			return data, err
+		}
+	}
+	return nil, err
+}
+
+func (c *Client) fetchSegmentOnce(rawURL string) ([]byte, int, error) {
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
+	req.Header.Set("Referer", c.Referer)
+
+	resp, err := c.Stream(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode, &chunkStatusError{StatusCode: resp.StatusCode}
+	}
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, resp.Body); err != nil {
+		return buf.Bytes(), resp.StatusCode, err
+	}
+	return buf.Bytes(), resp.StatusCode, nil
+}
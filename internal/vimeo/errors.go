@@ -0,0 +1,128 @@
+package vimeo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// permanentMessages are fragments of Vimeo player error messages for videos
+// that will never become available by retrying
+var permanentMessages = []string{
+	"does not exist",
+	"couldn't find",
+	"has been removed",
+	"privacy settings",
+	"not available in your country",
+	"not available in your region",
+}
+
+// PlayerError is returned when the Vimeo player config endpoint refuses to
+// serve a video
+type PlayerError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *PlayerError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+	}
+	return fmt.Sprintf("vimeo refused video (status %d): %s", e.StatusCode, e.Message)
+}
+
+// Permanent reports whether the video is removed, private or region-blocked,
+// in which case retrying cannot succeed
+func (e *PlayerError) Permanent() bool {
+	switch e.StatusCode {
+	case http.StatusNotFound, http.StatusGone, http.StatusUnavailableForLegalReasons:
+		return true
+	case http.StatusTooManyRequests:
+		return false
+	}
+
+	message := strings.ToLower(e.Message)
+	for _, fragment := range permanentMessages {
+		if strings.Contains(message, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// newPlayerError builds a PlayerError from a non-200 config response, using
+// the message from Vimeo's JSON error payload when present
+func newPlayerError(statusCode int, body []byte) *PlayerError {
+	var payload struct {
+		Message string `json:"message"`
+		Title   string `json:"title"`
+	}
+	_ = json.Unmarshal(body, &payload)
+
+	message := payload.Message
+	if message == "" {
+		message = payload.Title
+	}
+	return &PlayerError{StatusCode: statusCode, Message: strings.TrimSpace(message)}
+}
+
+// IsPermanent reports whether err is a Vimeo failure that should be skipped
+// rather than retried, including streams that need the missing ffmpeg
+func IsPermanent(err error) bool {
+	if errors.Is(err, ErrFFmpegMissing) {
+		return true
+	}
+	var playerErr *PlayerError
+	return errors.As(err, &playerErr) && playerErr.Permanent()
+}
+
+// ErrFFmpegFailed is returned when ffmpeg exits with an error
+var ErrFFmpegFailed = errors.New("ffmpeg failed")
+
+// StatusCode returns the HTTP status a Vimeo request was refused with, or 0
+// when err does not come from an HTTP response
+func StatusCode(err error) int {
+	var playerErr *PlayerError
+	if errors.As(err, &playerErr) {
+		return playerErr.StatusCode
+	}
+	var statusErr *chunkStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode
+	}
+	return 0
+}
+
+// errRangeUnsupported is returned by a chunk request the server answered
+// without honouring its Range header
+var errRangeUnsupported = errors.New("server ignored the range request")
+
+// chunkStatusError is returned when a ranged request for a chunk gets an
+// unexpected status
+type chunkStatusError struct {
+	StatusCode int
+}
+
+func (e *chunkStatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+}
+
+// isFatalChunkError reports whether retrying the chunk with the same URL is
+// pointless, e.g. because the signed CDN URL expired
+func isFatalChunkError(err error) bool {
+	if errors.Is(err, errRangeUnsupported) {
+		return true
+	}
+
+	var statusErr *chunkStatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	switch statusErr.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusGone:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package vimeo
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/fsutil"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// completeRatio is how much of the target duration a remuxed stream must
+// cover to be accepted as complete
+const completeRatio = 0.98
+
+// ErrFFmpegMissing is returned for videos only available as HLS or DASH
+// streams, and for embedding subtitles, when ffmpeg is not installed
+var ErrFFmpegMissing = errors.New("requires ffmpeg, which is not installed")
+
+// FFmpegInstalled reports whether ffmpeg is on the PATH
+func FFmpegInstalled() bool {
+	_, err := exec.LookPath("ffmpeg")
+	return err == nil
+}
+
+// FFmpegInstallHint tells how to install ffmpeg on this platform
+func FFmpegInstallHint() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "install it with: brew install ffmpeg"
+	case "windows":
+		return "install it with: choco install ffmpeg"
+	}
+	return "install it with your package manager, e.g.: sudo apt-get install ffmpeg"
+}
+
+// ffmpegPool limits the ffmpeg processes running at once
+type ffmpegPool struct {
+	once  sync.Once
+	slots chan struct{}
+}
+
+// acquireFFmpeg waits for a free ffmpeg slot, sized by FFmpegWorkers on first
+// use, and returns the function releasing it
+func (c *Client) acquireFFmpeg(outputPath string) func() {
+	c.ffmpeg.once.Do(func() {
+		c.ffmpeg.slots = make(chan struct{}, max(c.FFmpegWorkers, 1))
+	})
+
+	select {
+	case c.ffmpeg.slots <- struct{}{}:
+	default:
+		Printf("Waiting for a free ffmpeg slot: %s\n", filepath.Base(outputPath))
+		c.ffmpeg.slots <- struct{}{}
+	}
+	return func() { <-c.ffmpeg.slots }
+}
+
+// partialPath keeps the extension last so ffmpeg still infers the container
+func partialPath(outputPath string) string {
+	ext := filepath.Ext(outputPath)
+	return strings.TrimSuffix(outputPath, ext) + ".part" + ext
+}
+
+// runFFmpeg remuxes a stream into outputPath, using the container implied by
+// its extension. The stream is written to a ".part" file that only replaces
+// outputPath once ffmpeg covered the target duration. A remux cannot be
+// continued, so a stream is always downloaded from scratch and a ".part" left
+// by an interrupted attempt is dropped.
+func (c *Client) runFFmpeg(url, outputPath string, duration int, extra ...string) error {
+	return c.runFFmpegInputs([]string{url}, outputPath, duration, extra...)
+}
+
+// runFFmpegInputs is runFFmpeg for several inputs, e.g. separate video and
+// audio streams, which extra maps into the output
+func (c *Client) runFFmpegInputs(inputs []string, outputPath string, duration int, extra ...string) error {
+	if !c.HasFFmpeg {
+		return ErrFFmpegMissing
+	}
+
+	partPath := partialPath(outputPath)
+
+	if _, err := os.Stat(partPath); err == nil {
+		Printf("Restarting interrupted stream download from scratch: %s\n", outputPath)
+		os.Remove(partPath)
+	}
+
+	args := []string{"-nostats", "-progress", "pipe:1"}
+	for _, input := range inputs {
+		args = append(args, "-i", input)
+	}
+	args = append(args, "-c", "copy")
+	args = append(args, extra...)
+	if c.Container == ContainerMP4 {
+		args = append(args, "-movflags", "+faststart")
+	}
+	args = append(args, "-y", partPath)
+
+	release := c.acquireFFmpeg(outputPath)
+	defer release()
+
+	cmd := exec.Command("ffmpeg", args...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("%w: %v", ErrFFmpegFailed, err)
+	}
+
+	covered := trackFFmpegProgress(stdout, duration)
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("%w: %v\nOutput: %s", ErrFFmpegFailed, err, stderr.String())
+	}
+
+	if duration > 0 && covered.Seconds() < float64(duration)*completeRatio {
+		return fmt.Errorf("ffmpeg stopped at %s of %s, stream incomplete",
+			covered.Round(time.Second), time.Duration(duration)*time.Second)
+	}
+
+	if err := os.Rename(partPath, outputPath); err != nil {
+		return fmt.Errorf("failed to finalize %s: %w", outputPath, err)
+	}
+
+	return fsutil.Fix(outputPath)
+}
+
+// trackFFmpegProgress reads ffmpeg's -progress key=value output, advancing a
+// progress bar over the target duration, and returns how much of the stream
+// was written
+func trackFFmpegProgress(progress io.Reader, duration int) time.Duration {
+	// An unknown duration shows an empty bar
+	bar := transfers.add("Remuxing", int64(duration), false)
+	defer bar.Finish()
+
+	var covered time.Duration
+	scanner := bufio.NewScanner(progress)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+
+		// out_time_ms is in microseconds as well, kept for older ffmpeg builds
+		if key == "out_time_us" || key == "out_time_ms" {
+			us, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil || us < 0 {
+				continue
+			}
+			covered = time.Duration(us) * time.Microsecond
+			bar.Set64(int64(covered.Seconds()))
+		}
+	}
+	return covered
+}
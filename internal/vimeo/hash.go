@@ -0,0 +1,157 @@
+package vimeo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+	"sync"
+)
+
+// pieceHasher computes the SHA-256 of every piece of a file as its bytes are
+// written, so a finished download is not read back to be hashed. Chunks are
+// written in parallel, so a piece is hashed as long as its bytes arrive in
+// order; a piece straddling two chunks whose second half arrives first is
+// read back from disk once the file is complete.
+type pieceHasher struct {
+	pieceSize int64
+	pieces    []pieceHash
+}
+
+type pieceHash struct {
+	mu     sync.Mutex
+	hash   hash.Hash
+	next   int64 // offset of the next byte the hash expects
+	broken bool  // bytes arrived out of order, read the piece back
+}
+
+func newPieceHasher(fileSize, pieceSize int64) *pieceHasher {
+	h := &pieceHasher{pieceSize: pieceSize, pieces: make([]pieceHash, (fileSize+pieceSize-1)/pieceSize)}
+	for i := range h.pieces {
+		h.pieces[i].hash = sha256.New()
+		h.pieces[i].next = int64(i) * pieceSize
+	}
+	return h
+}
+
+// write hashes p, written at offset off of the file
+func (h *pieceHasher) write(p []byte, off int64) {
+	for len(p) > 0 {
+		idx := off / h.pieceSize
+		if idx >= int64(len(h.pieces)) {
+			return
+		}
+		n := min(int64(len(p)), (idx+1)*h.pieceSize-off)
+
+		piece := &h.pieces[idx]
+		piece.mu.Lock()
+		if !piece.broken && piece.next == off {
+			piece.hash.Write(p[:n])
+			piece.next += n
+		} else {
+			piece.broken = true
+		}
+		piece.mu.Unlock()
+
+		p, off = p[n:], off+n
+	}
+}
+
+// reset forgets the bytes hashed from start to end, which are about to be
+// written again by a retry
+func (h *pieceHasher) reset(start, end int64) {
+	for idx := start / h.pieceSize; idx < int64(len(h.pieces)) && idx*h.pieceSize < end; idx++ {
+		pieceStart := idx * h.pieceSize
+		piece := &h.pieces[idx]
+		piece.mu.Lock()
+		if pieceStart >= start && pieceStart+h.pieceSize <= end {
+			piece.hash.Reset()
+			piece.next = pieceStart
+			piece.broken = false
+		} else {
+			// Shared with a neighbouring chunk
+			piece.broken = true
+		}
+		piece.mu.Unlock()
+	}
+}
+
+// sums returns the hex SHA-256 of every piece of the complete file at path,
+// reading back only the pieces that could not be hashed while written
+func (h *pieceHasher) sums(path string, fileSize int64) ([]string, error) {
+	var file *os.File
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+
+	sums := make([]string, len(h.pieces))
+	for i := range h.pieces {
+		piece := &h.pieces[i]
+		end := min(int64(i+1)*h.pieceSize, fileSize)
+		if !piece.broken && piece.next == end {
+			sums[i] = hex.EncodeToString(piece.hash.Sum(nil))
+			continue
+		}
+
+		if file == nil {
+			var err error
+			if file, err = os.Open(path); err != nil {
+				return nil, err
+			}
+		}
+		hash := sha256.New()
+		start := int64(i) * h.pieceSize
+		if _, err := io.Copy(hash, io.NewSectionReader(file, start, end-start)); err != nil {
+			return nil, err
+		}
+		sums[i] = hex.EncodeToString(hash.Sum(nil))
+	}
+	return sums, nil
+}
+
+// hashingWriterAt hashes what it writes to w
+type hashingWriterAt struct {
+	w      io.WriterAt
+	hasher *pieceHasher
+}
+
+func (w hashingWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	n, err := w.w.WriteAt(p, off)
+	w.hasher.write(p[:n], off)
+	return n, err
+}
+
+// hashingWriter hashes what is written sequentially from the start of a file
+type hashingWriter struct {
+	hasher *pieceHasher
+	off    int64
+}
+
+func (w *hashingWriter) Write(p []byte) (int, error) {
+	w.hasher.write(p, w.off)
+	w.off += int64(len(p))
+	return len(p), nil
+}
+
+// startHashing returns the hasher of a progressive download of fileSize
+// bytes, or nil when pieces are not hashed
+func (c *Client) startHashing(fileSize int64) *pieceHasher {
+	if c.PieceSize <= 0 || c.Hashed == nil || fileSize <= 0 {
+		return nil
+	}
+	return newPieceHasher(fileSize, c.PieceSize)
+}
+
+// finishHashing hands the piece hashes of a completed download to Hashed. A
+// failure only costs the hashes, which are computed again from the file.
+func (c *Client) finishHashing(hasher *pieceHasher, outputPath string, fileSize int64) {
+	if hasher == nil {
+		return
+	}
+	if sums, err := hasher.sums(outputPath, fileSize); err == nil {
+		c.Hashed(outputPath, sums)
+	}
+}
@@ -0,0 +1,385 @@
+package vimeo
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/fsutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// errNotCacheable is returned for HLS streams whose segments cannot be
+// cached locally, like encrypted ones, which ffmpeg pulls itself
+var errNotCacheable = errors.New("HLS stream cannot be cached locally")
+
+// hlsMediaPlaylist is a media playlist rewritten to point at local segment
+// files, and the remote segments behind them
+type hlsMediaPlaylist struct {
+	name     string // of the local playlist, without extension
+	local    string
+	segments []hlsSegment
+}
+
+type hlsSegment struct {
+	url  string
+	file string // name in the segment cache
+}
+
+// HLSCacheExt is the extension of the folders segment caches are kept in,
+// next to the video they are for
+const HLSCacheExt = ".hls"
+
+// hlsCacheDir is where the playlists and finished segments of the stream
+// saved to outputPath are kept until it is complete, so a retry only fetches
+// the segments missing
+func hlsCacheDir(outputPath string) string {
+	return outputPath + HLSCacheExt
+}
+
+// RemoveHLSCache removes the segments cached for the video saved to
+// outputPath, for a video that will not be downloaded after all
+func (c *Client) RemoveHLSCache(outputPath string) error {
+	return os.RemoveAll(hlsCacheDir(ContainerPath(outputPath, c.Container)))
+}
+
+// downloadHLSVideo saves an HLS stream to outputPath. The playlists and
+// segments are downloaded into a cache next to the output and remuxed from
+// there, so a failed attempt leaves the segments it finished to the next
+// one; streams that cannot be cached are pulled by ffmpeg directly.
+func (c *Client) downloadHLSVideo(playlistURL, outputPath string, duration int) error {
+	progressPath := outputPath // as the caller knows the video
+	outputPath = ContainerPath(outputPath, c.Container)
+	Printf("Downloading HLS stream: %s\n", filepath.Base(outputPath))
+
+	var extra []string
+	if c.Container == ContainerMP4 {
+		extra = []string{"-bsf:a", "aac_adtstoasc"}
+	}
+	if !c.HasFFmpeg {
+		return ErrFFmpegMissing
+	}
+
+	playlists, err := c.fetchHLSPlaylists(playlistURL)
+	if errors.Is(err, errNotCacheable) {
+		return c.runFFmpeg(playlistURL, outputPath, duration, extra...)
+	}
+	if err != nil {
+		return err
+	}
+
+	inputs, err := c.cacheHLSSegments(playlists, hlsCacheDir(outputPath), progressPath)
+	if err != nil {
+		return err
+	}
+	if len(inputs) > 1 {
+		extra = append(extra, "-map", "0:v:0", "-map", "1:a:0")
+	}
+	if err := c.runFFmpegInputs(inputs, outputPath, duration, extra...); err != nil {
+		return err
+	}
+	return os.RemoveAll(hlsCacheDir(outputPath))
+}
+
+// fetchHLSPlaylists returns the media playlists to download for the
+// playlist at playlistURL: itself, or for a master playlist the variant of
+// the highest bandwidth and the audio rendition it refers to, if any
+func (c *Client) fetchHLSPlaylists(playlistURL string) ([]*hlsMediaPlaylist, error) {
+	body, err := c.fetchSegment(playlistURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch HLS playlist: %w", err)
+	}
+	content := string(body)
+	if !strings.HasPrefix(strings.TrimSpace(content), "#EXTM3U") {
+		return nil, errNotCacheable
+	}
+	if !strings.Contains(content, "#EXT-X-STREAM-INF") {
+		media, err := parseHLSMedia("video", playlistURL, content)
+		if err != nil {
+			return nil, err
+		}
+		return []*hlsMediaPlaylist{media}, nil
+	}
+
+	variant, audio, err := selectHLSVariant(playlistURL, content)
+	if err != nil {
+		return nil, err
+	}
+	var playlists []*hlsMediaPlaylist
+	for i, mediaURL := range []string{variant, audio} {
+		if mediaURL == "" {
+			continue
+		}
+		body, err := c.fetchSegment(mediaURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch HLS playlist: %w", err)
+		}
+		media, err := parseHLSMedia([]string{"video", "audio"}[i], mediaURL, string(body))
+		if err != nil {
+			return nil, err
+		}
+		playlists = append(playlists, media)
+	}
+	return playlists, nil
+}
+
+// selectHLSVariant picks the variant of the highest bandwidth from a master
+// playlist, and the URL of the default audio rendition of its audio group
+// when the audio is separate
+func selectHLSVariant(masterURL, content string) (variant, audio string, err error) {
+	lines := strings.Split(content, "\n")
+	bandwidth := -1
+	group := ""
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		attrs, ok := strings.CutPrefix(line, "#EXT-X-STREAM-INF:")
+		if !ok {
+			continue
+		}
+		uri := nextURI(lines[i+1:])
+		a := parseHLSAttributes(attrs)
+		if b, _ := strconv.Atoi(a["BANDWIDTH"]); uri != "" && b > bandwidth {
+			bandwidth, group = b, a["AUDIO"]
+			if variant, err = resolveHLS(masterURL, uri); err != nil {
+				return "", "", err
+			}
+		}
+	}
+	if variant == "" {
+		return "", "", errNotCacheable
+	}
+	if group == "" {
+		return variant, "", nil
+	}
+
+	for _, line := range lines {
+		attrs, ok := strings.CutPrefix(strings.TrimSpace(line), "#EXT-X-MEDIA:")
+		if !ok {
+			continue
+		}
+		a := parseHLSAttributes(attrs)
+		if a["TYPE"] != "AUDIO" || a["GROUP-ID"] != group || a["URI"] == "" {
+			continue
+		}
+		if audio == "" || a["DEFAULT"] == "YES" {
+			if audio, err = resolveHLS(masterURL, a["URI"]); err != nil {
+				return "", "", err
+			}
+		}
+	}
+	return variant, audio, nil
+}
+
+// parseHLSMedia reads the segments of a media playlist and rewrites it to
+// refer to them by their file names in the segment cache. Encrypted and live
+// playlists are not cacheable.
+func parseHLSMedia(name, playlistURL, content string) (*hlsMediaPlaylist, error) {
+	media := &hlsMediaPlaylist{name: name}
+	var local strings.Builder
+	ended := false
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#EXT-X-KEY:"):
+			if parseHLSAttributes(strings.TrimPrefix(line, "#EXT-X-KEY:"))["METHOD"] != "NONE" {
+				return nil, errNotCacheable
+			}
+		case line == "#EXT-X-ENDLIST":
+			ended = true
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			uri := parseHLSAttributes(strings.TrimPrefix(line, "#EXT-X-MAP:"))["URI"]
+			segment, err := media.add(playlistURL, uri, "init")
+			if err != nil {
+				return nil, err
+			}
+			line = fmt.Sprintf(`#EXT-X-MAP:URI="%s"`, segment.file)
+		case !strings.HasPrefix(line, "#"):
+			segment, err := media.add(playlistURL, line, fmt.Sprintf("%05d", len(media.segments)))
+			if err != nil {
+				return nil, err
+			}
+			line = segment.file
+		}
+		local.WriteString(line + "\n")
+	}
+	if !ended || len(media.segments) == 0 {
+		return nil, errNotCacheable
+	}
+	media.local = local.String()
+	return media, nil
+}
+
+// add appends the segment at uri, relative to playlistURL
+func (m *hlsMediaPlaylist) add(playlistURL, uri, id string) (hlsSegment, error) {
+	resolved, err := resolveHLS(playlistURL, uri)
+	if err != nil {
+		return hlsSegment{}, err
+	}
+	segment := hlsSegment{url: resolved, file: m.name + "-" + id + segmentExt(resolved)}
+	m.segments = append(m.segments, segment)
+	return segment, nil
+}
+
+// cacheHLSSegments writes the local playlists into dir and downloads the
+// segments not there yet, returning the playlists to remux. Segments of an
+// earlier attempt are dropped if the stream changed since. Progress is
+// reported as that of the video saved to outputPath.
+func (c *Client) cacheHLSSegments(playlists []*hlsMediaPlaylist, dir, outputPath string) ([]string, error) {
+	if err := fsutil.MkdirAll(dir); err != nil {
+		return nil, fmt.Errorf("failed to create segment cache: %w", err)
+	}
+
+	var inputs []string
+	var missing []hlsSegment
+	cached := 0
+	for _, media := range playlists {
+		playlistPath := filepath.Join(dir, media.name+".m3u8")
+		if previous, err := os.ReadFile(playlistPath); err == nil && string(previous) != media.local {
+			Printf("HLS stream changed since the last attempt, dropping its cached segments\n")
+			for _, segment := range media.segments {
+				os.Remove(filepath.Join(dir, segment.file))
+			}
+		}
+		if err := fsutil.WriteFile(playlistPath, []byte(media.local)); err != nil {
+			return nil, fmt.Errorf("failed to write HLS playlist: %w", err)
+		}
+		inputs = append(inputs, playlistPath)
+
+		for _, segment := range media.segments {
+			if _, err := os.Stat(filepath.Join(dir, segment.file)); err == nil {
+				cached++
+				continue
+			}
+			missing = append(missing, segment)
+		}
+	}
+	if cached > 0 {
+		Printf("Resuming HLS stream: %d segments cached, %d to download\n", cached, len(missing))
+	}
+
+	if err := c.fetchHLSSegments(missing, dir, outputPath, cached); err != nil {
+		return nil, err
+	}
+	return inputs, nil
+}
+
+// fetchHLSSegments downloads segments into dir with up to chunkWorkers at
+// once. Each segment is renamed into place once complete, so a file in the
+// cache is always a whole segment.
+func (c *Client) fetchHLSSegments(segments []hlsSegment, dir, outputPath string, cached int) error {
+	bar := c.follow(transfers.add("Segments", int64(cached+len(segments)), false), outputPath)
+	bar.Set64(int64(cached))
+	defer bar.Finish()
+
+	var wg sync.WaitGroup
+	var failOnce sync.Once
+	var firstErr error
+	var failed atomic.Bool
+	limiter := make(chan struct{}, c.chunkWorkers(dir))
+
+	for _, segment := range segments {
+		wg.Add(1)
+		go func(segment hlsSegment) {
+			defer wg.Done()
+			limiter <- struct{}{}
+			defer func() { <-limiter }()
+			if failed.Load() {
+				return
+			}
+
+			err := c.fetchHLSSegment(segment, dir)
+			if err != nil {
+				failOnce.Do(func() {
+					firstErr = err
+					failed.Store(true)
+				})
+				return
+			}
+			bar.Add64(1)
+		}(segment)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+func (c *Client) fetchHLSSegment(segment hlsSegment, dir string) error {
+	data, err := c.fetchSegment(segment.url)
+	if err != nil {
+		return fmt.Errorf("failed to download HLS segment %s: %w", segment.file, err)
+	}
+	path := filepath.Join(dir, segment.file)
+	if err := fsutil.WriteFile(path+".tmp", data); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// parseHLSAttributes reads an attribute list like
+// BANDWIDTH=800000,CODECS="avc1,mp4a",AUDIO="audio", unquoting values
+func parseHLSAttributes(list string) map[string]string {
+	attrs := make(map[string]string)
+	for list != "" {
+		key, rest, ok := strings.Cut(list, "=")
+		if !ok {
+			break
+		}
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+			rest = strings.TrimPrefix(rest, ",")
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		attrs[strings.TrimSpace(key)] = value
+		list = rest
+	}
+	return attrs
+}
+
+// nextURI returns the first URI line of lines
+func nextURI(lines []string) string {
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			return line
+		}
+	}
+	return ""
+}
+
+func resolveHLS(base, ref string) (string, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid HLS URI %q: %v", ref, err)
+	}
+	return b.ResolveReference(r).String(), nil
+}
+
+// segmentExt keeps the extension of a segment when ffmpeg accepts it for
+// local HLS segments, and falls back to MPEG-TS otherwise
+func segmentExt(segmentURL string) string {
+	u, err := url.Parse(segmentURL)
+	if err != nil {
+		return ".ts"
+	}
+	switch ext := path.Ext(u.Path); ext {
+	case ".ts", ".m4s", ".mp4", ".m4v", ".m4a", ".aac":
+		return ext
+	}
+	return ".ts"
+}
@@ -0,0 +1,278 @@
+package vimeo
+
+import (
+	"fmt"
+	"golang.org/x/term"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	progressInterval = 200 * time.Millisecond // between redraws of the progress line
+	progressWidth    = 30                     // of the bar in characters
+
+	// DefaultLogInterval is how often a status line is written when stdout
+	// is not a terminal
+	DefaultLogInterval = 30 * time.Second
+)
+
+// transfers draws every transfer of the process. Episode workers each used to
+// draw their own bar, garbling the terminal as soon as several downloaded at
+// once; now a single goroutine owns the line and sums them up.
+var transfers = &renderer{
+	out:         os.Stdout,
+	interactive: term.IsTerminal(int(os.Stdout.Fd())),
+	logInterval: DefaultLogInterval,
+}
+
+// SetLogInterval sets how often a status line sums up the transfers when
+// stdout is not a terminal, e.g. under cron or CI; zero or less writes none
+func SetLogInterval(interval time.Duration) {
+	transfers.mu.Lock()
+	defer transfers.mu.Unlock()
+	transfers.logInterval = interval
+}
+
+// Interactive reports whether progress is redrawn in place on a terminal,
+// rather than logged a line at a time
+func Interactive() bool {
+	return transfers.interactive
+}
+
+// Printf writes a message while transfers may be drawn: the progress line is
+// blanked out first, instead of the message running into it, and drawn again
+// below the message on the next redraw
+func Printf(format string, args ...any) {
+	transfers.printf(format, args...)
+}
+
+// renderer redraws one progress line for all active bars, from a goroutine
+// that only runs while there are any. Without a terminal to redraw on, it
+// writes a status line every logInterval instead.
+type renderer struct {
+	out         io.Writer
+	interactive bool
+	logInterval time.Duration
+
+	mu     sync.Mutex
+	logged time.Time // when the last status line was written
+	bars   map[*progressBar]bool
+	stop   chan struct{}
+	done   chan struct{}
+	width  int // of the line last drawn, to blank out what a shorter one leaves
+}
+
+// progressBar is the progress of one download or remux. It is safe for
+// concurrent use, e.g. by the chunk workers of a file.
+type progressBar struct {
+	description string
+	bytes       bool // total counts bytes rather than seconds
+	started     time.Time
+	total       atomic.Int64 // unknown when not positive
+	current     atomic.Int64
+
+	// report, when set, is called with every change, see Client.follow
+	report func(done, total int64)
+}
+
+// newProgressBar starts showing the download of size bytes
+func newProgressBar(size int64) *progressBar {
+	return transfers.add("Downloading", size, true)
+}
+
+// Add64 advances the bar by n, which may be negative when a chunk is retried
+func (b *progressBar) Add64(n int64) error {
+	b.notify(b.current.Add(n))
+	return nil
+}
+
+// Write advances the bar by len(p), so it can follow an io.Copy
+func (b *progressBar) Write(p []byte) (int, error) {
+	b.notify(b.current.Add(int64(len(p))))
+	return len(p), nil
+}
+
+// Set64 moves the bar to n
+func (b *progressBar) Set64(n int64) {
+	b.current.Store(n)
+	b.notify(n)
+}
+
+// Reset starts the bar over for another attempt
+func (b *progressBar) Reset() {
+	b.Set64(0)
+}
+
+func (b *progressBar) notify(current int64) {
+	if b.report != nil {
+		b.report(current, b.total.Load())
+	}
+}
+
+// Finish stops showing the bar
+func (b *progressBar) Finish() {
+	transfers.remove(b)
+}
+
+func (r *renderer) add(description string, total int64, bytes bool) *progressBar {
+	b := &progressBar{description: description, bytes: bytes, started: time.Now()}
+	b.total.Store(total)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.bars == nil {
+		r.bars = make(map[*progressBar]bool)
+	}
+	r.bars[b] = true
+	if r.stop == nil {
+		r.stop, r.done = make(chan struct{}), make(chan struct{})
+		go r.run(r.stop, r.done)
+	}
+	return b
+}
+
+func (r *renderer) remove(b *progressBar) {
+	r.mu.Lock()
+	if !r.bars[b] {
+		r.mu.Unlock()
+		return
+	}
+	delete(r.bars, b)
+	if len(r.bars) > 0 {
+		r.mu.Unlock()
+		return
+	}
+	stop, done := r.stop, r.done
+	r.stop, r.done = nil, nil
+	r.mu.Unlock()
+
+	close(stop)
+	<-done
+
+	// Leave the final state of the last transfer on screen
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.interactive {
+		return
+	}
+	r.draw([]*progressBar{b})
+	fmt.Fprintln(r.out)
+	r.width = 0
+}
+
+func (r *renderer) printf(format string, args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.interactive && r.width > 0 {
+		fmt.Fprintf(r.out, "\r%s\r", strings.Repeat(" ", r.width))
+		r.width = 0
+	}
+	fmt.Fprintf(r.out, format, args...)
+}
+
+func (r *renderer) run(stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			r.mu.Lock()
+			if !r.interactive && (r.logInterval <= 0 || time.Since(r.logged) < r.logInterval) {
+				r.mu.Unlock()
+				continue
+			}
+			bars := make([]*progressBar, 0, len(r.bars))
+			for b := range r.bars {
+				bars = append(bars, b)
+			}
+			r.draw(bars)
+			r.mu.Unlock()
+		}
+	}
+}
+
+// draw writes one line summing bars up: downloads by their bytes and speed,
+// remuxes by the share of the duration done. Called with mu held.
+func (r *renderer) draw(bars []*progressBar) {
+	var parts []string
+	for _, inBytes := range []bool{true, false} {
+		var description string
+		var count int
+		var current, total int64
+		var rate float64
+		for _, b := range bars {
+			if b.bytes != inBytes {
+				continue
+			}
+			description = b.description
+			count++
+			current += b.current.Load()
+			total += max(b.total.Load(), 0)
+			if elapsed := time.Since(b.started).Seconds(); elapsed > 0 {
+				rate += float64(b.current.Load()) / elapsed
+			}
+		}
+		if count == 0 {
+			continue
+		}
+
+		if count > 1 {
+			noun := "files"
+			if !inBytes {
+				noun = "streams"
+			}
+			description = fmt.Sprintf("%s %d %s", description, count, noun)
+		}
+		if inBytes {
+			parts = append(parts, fmt.Sprintf("%s %s (%s/%s, %s/s)",
+				description, renderBar(current, total), formatSize(current), formatSize(total), formatSize(int64(rate))))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s %s (%ds/%ds)",
+				description, renderBar(current, total), current, total))
+		}
+	}
+
+	line := strings.Join(parts, " | ")
+	if !r.interactive {
+		fmt.Fprintf(r.out, "[%s] %s\n", time.Now().Format("15:04:05"), line)
+		r.logged = time.Now()
+		return
+	}
+	fmt.Fprintf(r.out, "\r%s%s", line, strings.Repeat(" ", max(r.width-len(line), 0)))
+	r.width = len(line)
+}
+
+// renderBar renders the percentage and bar of current out of total
+func renderBar(current, total int64) string {
+	if total <= 0 {
+		return fmt.Sprintf("     [%s]", strings.Repeat("-", progressWidth))
+	}
+	current = min(max(current, 0), total)
+	filled := int(current * progressWidth / total)
+	bar := strings.Repeat("=", filled)
+	if filled < progressWidth {
+		bar += ">" + strings.Repeat(" ", progressWidth-filled-1)
+	}
+	return fmt.Sprintf("%3d%% [%s]", current*100/total, bar)
+}
+
+// formatSize formats a byte count like the run summary does
+func formatSize(n int64) string {
+	switch {
+	case n >= 1024*1024*1024:
+		return fmt.Sprintf("%.1f GB", float64(n)/1024/1024/1024)
+	case n >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(n)/1024/1024)
+	case n >= 1024:
+		return fmt.Sprintf("%.1f KB", float64(n)/1024)
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,95 @@
+package vimeo
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+)
+
+// HostStats counts chunk requests and failures against a single CDN host
+type HostStats struct {
+	Requests int64
+	Errors   int64
+}
+
+// TransferStats instruments the chunk downloader so the cost of retries can
+// be weighed against the concurrency used
+type TransferStats struct {
+	mu sync.Mutex
+
+	BytesDownloaded     int64 // bytes written by successful chunk attempts
+	RetriedBytes        int64 // bytes received by failed attempts and fetched again
+	ChunkAttempts       int64
+	FailedChunkAttempts int64
+	Hosts               map[string]*HostStats
+}
+
+func NewTransferStats() *TransferStats {
+	return &TransferStats{Hosts: make(map[string]*HostStats)}
+}
+
+// recordChunk accounts for a single chunk attempt against rawURL
+func (s *TransferStats) recordChunk(rawURL string, written int64, err error) {
+	host := rawURL
+	if u, parseErr := url.Parse(rawURL); parseErr == nil {
+		host = u.Host
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hostStats, ok := s.Hosts[host]
+	if !ok {
+		hostStats = &HostStats{}
+		s.Hosts[host] = hostStats
+	}
+
+	s.ChunkAttempts++
+	hostStats.Requests++
+	if err != nil {
+		s.FailedChunkAttempts++
+		s.RetriedBytes += written
+		hostStats.Errors++
+		return
+	}
+	s.BytesDownloaded += written
+}
+
+// Print writes the transfer efficiency summary
+func (s *TransferStats) Print() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ChunkAttempts == 0 {
+		return
+	}
+
+	fmt.Printf("\n📊 Transfer Efficiency:\n")
+	fmt.Printf("Downloaded: %.1f MB\n", float64(s.BytesDownloaded)/1024/1024)
+	fmt.Printf("Retransmitted: %.1f MB (%.1f%% overhead)\n",
+		float64(s.RetriedBytes)/1024/1024,
+		percent(s.RetriedBytes, s.BytesDownloaded))
+	fmt.Printf("Chunk attempts: %d (%d failed, %.1f%%)\n",
+		s.ChunkAttempts, s.FailedChunkAttempts,
+		percent(s.FailedChunkAttempts, s.ChunkAttempts))
+
+	hosts := make([]string, 0, len(s.Hosts))
+	for host := range s.Hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	for _, host := range hosts {
+		h := s.Hosts[host]
+		fmt.Printf("- %s: %d requests, %d errors (%.1f%%)\n",
+			host, h.Requests, h.Errors, percent(h.Errors, h.Requests))
+	}
+}
+
+func percent(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total) * 100
+}
@@ -0,0 +1,77 @@
+package vimeo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// StreamIdleTimeout is how long a video transfer may go without a byte
+// arriving before it is abandoned. Transfers have no overall deadline, as a
+// whole video over a slow line can take far longer than any page request.
+var StreamIdleTimeout = 30 * time.Second
+
+// errStalled ends a transfer that received nothing for StreamIdleTimeout
+var errStalled = errors.New("transfer stalled")
+
+// streamClient returns a client sharing the cookies, redirects and transport
+// of client without its overall Timeout, which would also cover reading the
+// body
+func streamClient(client *http.Client) *http.Client {
+	stream := *client
+	stream.Timeout = 0
+	return &stream
+}
+
+// Stream sends req for a video body. Waiting for the response and every read
+// of its body are bounded by StreamIdleTimeout instead of an overall deadline.
+func (c *Client) Stream(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancelCause(req.Context())
+	timer := time.AfterFunc(StreamIdleTimeout, func() {
+		cancel(fmt.Errorf("%w: nothing received for %s", errStalled, StreamIdleTimeout))
+	})
+
+	resp, err := c.streamClient.Do(req.WithContext(ctx))
+	if err != nil {
+		timer.Stop()
+		if cause := context.Cause(ctx); errors.Is(cause, errStalled) {
+			err = cause
+		}
+		cancel(nil)
+		return nil, err
+	}
+	resp.Body = &idleBody{ReadCloser: resp.Body, ctx: ctx, timer: timer, cancel: cancel}
+	return resp, nil
+}
+
+// idleBody is a response body whose request is cancelled once no byte was
+// read from it for StreamIdleTimeout
+type idleBody struct {
+	io.ReadCloser
+	ctx    context.Context
+	timer  *time.Timer
+	cancel context.CancelCauseFunc
+}
+
+func (b *idleBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.timer.Reset(StreamIdleTimeout)
+	}
+	if err != nil && err != io.EOF {
+		if cause := context.Cause(b.ctx); errors.Is(cause, errStalled) {
+			err = cause
+		}
+	}
+	return n, err
+}
+
+func (b *idleBody) Close() error {
+	b.timer.Stop()
+	err := b.ReadCloser.Close()
+	b.cancel(nil)
+	return err
+}
@@ -0,0 +1,119 @@
+package vimeo
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/sajjadanwar0/laracasts-dl/internal/fsutil"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// EmbedSubtitles downloads the video's text tracks and muxes them into
+// videoPath as soft subtitle tracks: mov_text for MP4, SubRip for MKV. Videos
+// without text tracks are left untouched.
+func (c *Client) EmbedSubtitles(config *VideoConfig, videoPath string) error {
+	if !c.HasFFmpeg {
+		return ErrFFmpegMissing
+	}
+
+	tracks := config.Request.TextTracks
+	if len(tracks) == 0 {
+		return nil
+	}
+
+	tmpDir, err := os.MkdirTemp(filepath.Dir(videoPath), ".subs-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	args := []string{"-i", videoPath}
+	var embedded []TextTrack
+	for i, track := range tracks {
+		subPath := filepath.Join(tmpDir, fmt.Sprintf("%d.vtt", i))
+		if err := c.downloadTextTrack(track, subPath); err != nil {
+			fmt.Printf("Warning: Skipping %s subtitles: %v\n", track.Lang, err)
+			continue
+		}
+		args = append(args, "-i", subPath)
+		embedded = append(embedded, track)
+	}
+	if len(embedded) == 0 {
+		return fmt.Errorf("no subtitle track could be downloaded")
+	}
+
+	subCodec := "mov_text"
+	if strings.EqualFold(filepath.Ext(videoPath), ".mkv") {
+		subCodec = "srt"
+	}
+
+	args = append(args, "-map", "0")
+	for i := range embedded {
+		args = append(args, "-map", fmt.Sprintf("%d:s", i+1))
+	}
+	args = append(args, "-c", "copy", "-c:s", subCodec)
+	for i, track := range embedded {
+		args = append(args,
+			fmt.Sprintf("-metadata:s:s:%d", i), "language="+track.Lang,
+			fmt.Sprintf("-metadata:s:s:%d", i), "title="+track.Label)
+	}
+
+	muxedPath := filepath.Join(tmpDir, "muxed"+filepath.Ext(videoPath))
+	args = append(args, "-y", muxedPath)
+
+	release := c.acquireFFmpeg(videoPath)
+	cmd := exec.Command("ffmpeg", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	release()
+	if err != nil {
+		return fmt.Errorf("ffmpeg failed to embed subtitles: %v\nOutput: %s", err, stderr.String())
+	}
+
+	if err := os.Rename(muxedPath, videoPath); err != nil {
+		return fmt.Errorf("failed to replace %s: %v", videoPath, err)
+	}
+	if err := fsutil.Fix(videoPath); err != nil {
+		return err
+	}
+	fmt.Printf("Embedded %d subtitle tracks into %s\n", len(embedded), filepath.Base(videoPath))
+	return nil
+}
+
+// downloadTextTrack saves a WebVTT track, resolving its URL against the
+// player host
+func (c *Client) downloadTextTrack(track TextTrack, path string) error {
+	base, err := url.Parse(fmt.Sprintf(PlayerConfigURL, "0"))
+	if err != nil {
+		return err
+	}
+	ref, err := url.Parse(track.URL)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Get(base.ResolveReference(ref).String())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, resp.Body)
+	return err
+}
@@ -1,17 +1,30 @@
 package vimeo
 
 import (
-	"bufio"
+	"github.com/sajjadanwar0/laracasts-dl/internal/fsutil"
 	"os"
-	"sync"
 )
 
 const (
 	// ChunkSize Chunk download settings
-	ChunkSize       = 20 * 1024 * 1024 // 20MB chunks
+	ChunkSize       = 20 * 1024 * 1024 // 20MB chunks by default
 	MaxChunkWorkers = 15               // Concurrent chunks per download
 	MaxRetries      = 3                // Maximum retries per chunk
 	MemoryBuffer    = 32 * 1024        // 32KB buffer for file operations
+	ChunkBuffer     = 256 * 1024       // 256KB of a chunk gathered per write
+
+	// SmallFileThreshold is the default size below which a video is fetched
+	// into memory with a single request instead of in chunks
+	SmallFileThreshold = 30 * 1024 * 1024
+
+	// DefaultReferer is the page Laracasts embeds the player in
+	DefaultReferer = "https://laracasts.com/"
+)
+
+const (
+	// ContainerMP4 Output containers for ffmpeg-based downloads
+	ContainerMP4 = "mp4"
+	ContainerMKV = "mkv"
 )
 
 type VideoConfig struct {
@@ -34,61 +47,34 @@ type VideoConfig struct {
 				} `json:"cdns"`
 			} `json:"dash"`
 		} `json:"files"`
+		TextTracks []TextTrack `json:"text_tracks"`
 	} `json:"request"`
+	Video struct {
+		Duration int `json:"duration"` // seconds
+	} `json:"video"`
 }
-type BufferedFileWriter struct {
-	file    *os.File
-	writer  *bufio.Writer
-	size    int64
-	written int64
-	mu      sync.Mutex
+
+// TextTrack is a WebVTT subtitle or caption track of a video
+type TextTrack struct {
+	Lang  string `json:"lang"`
+	Label string `json:"label"`
+	Kind  string `json:"kind"`
+	URL   string `json:"url"` // relative to the player host
 }
 
-func NewBufferedFileWriter(path string, size int64) (*BufferedFileWriter, error) {
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+// createChunkFile creates the file chunks of size bytes are written to, at
+// its full size so every chunk can be written at its offset right away. The
+// returned file is safe for concurrent WriteAt calls.
+func createChunkFile(path string, size int64) (*os.File, error) {
+	file, err := fsutil.OpenFile(path, os.O_CREATE|os.O_WRONLY)
 	if err != nil {
 		return nil, err
 	}
 
 	// Pre-allocate file
 	if err := file.Truncate(size); err != nil {
-		err := file.Close()
-		if err != nil {
-			return nil, err
-		}
+		_ = file.Close()
 		return nil, err
 	}
-
-	return &BufferedFileWriter{
-		file:   file,
-		writer: bufio.NewWriterSize(file, MemoryBuffer),
-		size:   size,
-	}, nil
-}
-
-func (w *BufferedFileWriter) WriteAt(p []byte, off int64) (int, error) {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-
-	if _, err := w.file.Seek(off, 0); err != nil {
-		return 0, err
-	}
-
-	n, err := w.writer.Write(p)
-	if err != nil {
-		return n, err
-	}
-
-	w.written += int64(n)
-	return n, w.writer.Flush()
-}
-
-func (w *BufferedFileWriter) Close() error {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-
-	if err := w.writer.Flush(); err != nil {
-		return err
-	}
-	return w.file.Close()
+	return file, nil
 }